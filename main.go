@@ -6,12 +6,19 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/access"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/audit"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/commands"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/commands/gpt"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/constants"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/health"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/moderation"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session"
 
 	// "github.com/stretchr/testify/assert/yaml"
 	"gopkg.in/yaml.v3"
@@ -31,6 +38,110 @@ type Config struct {
 		CompletionModels []string `yaml:"completionModels"`
 		ImageModels      []string `yaml:"imageModels"`
 	} `yaml:"openRouter"`
+	Backends      []BackendConfig     `yaml:"backends"`
+	ResponseCache ResponseCacheConfig `yaml:"responseCache"`
+	Moderation    moderation.Config   `yaml:"moderation"`
+	Timeouts      TimeoutsConfig      `yaml:"timeouts"`
+	ModelCatalog  ModelCatalogConfig  `yaml:"modelCatalog"`
+	// MessageActions are offered in the Apps menu of messages, nil uses gpt.DefaultMessageActions
+	MessageActions []gpt.MessageAction `yaml:"messageActions"`
+	CommandSync    CommandSyncConfig   `yaml:"commandSync"`
+	// RateLimits are checked in order, the first rule matching a request applies
+	RateLimits []bot.RateLimitConfig `yaml:"rateLimits"`
+	Access     access.Config         `yaml:"access"`
+	Shutdown   ShutdownConfig        `yaml:"shutdown"`
+	// MessageQueue bounds how many messages are handled and waiting at the same time
+	MessageQueue MessageQueueConfig `yaml:"messageQueue"`
+	// FollowUps replaces locking threads while they are answered by queueing the messages sent meanwhile
+	FollowUps gpt.FollowUpConfig `yaml:"followUps"`
+	// Mentions lets users talk to the bot outside threads by mentioning it
+	Mentions gpt.MentionConfig `yaml:"mentions"`
+	// Sharding splits the guilds of the bot across several gateway sessions
+	Sharding bot.ShardOptions `yaml:"sharding"`
+	// Localization adds translations to the built-in ones of the bot
+	Localization i18n.Config `yaml:"localization"`
+	// Audit records who used which command and model to a file or Discord channel
+	Audit audit.Config `yaml:"audit"`
+	// Health serves liveness, readiness and status endpoints over HTTP
+	Health health.Config `yaml:"health"`
+}
+
+type MessageQueueConfig struct {
+	Workers int `yaml:"workers"`
+	// ChannelQueueSize is how many messages of a thread may wait while one of them is answered
+	ChannelQueueSize int `yaml:"channelQueueSize"`
+	// QueueSize is how many messages of all threads may wait for a worker
+	QueueSize int `yaml:"queueSize"`
+}
+
+type ShutdownConfig struct {
+	// GracePeriod is how long in-flight handlers may take to finish before they are cancelled
+	GracePeriod time.Duration `yaml:"gracePeriod"`
+}
+
+// CommandSyncConfig selects where commands are registered. Without scopes,
+// all commands are registered in discord.guild, or globally if it is empty
+type CommandSyncConfig struct {
+	// DryRun logs the changes a sync would make and exits
+	DryRun bool                 `yaml:"dryRun"`
+	Scopes []CommandScopeConfig `yaml:"scopes"`
+}
+
+type CommandScopeConfig struct {
+	// Guild is the guild ID, empty registers the commands globally
+	Guild string `yaml:"guild"`
+	// Commands are the names of the root commands, e.g. "chat". Omitted registers all
+	// commands, an empty list removes all commands of the scope
+	Commands []string `yaml:"commands"`
+}
+
+// Scopes returns the command sync scopes of the configuration
+func (c *Config) Scopes() []bot.Scope {
+	if len(c.CommandSync.Scopes) == 0 {
+		return []bot.Scope{{GuildID: c.Discord.Guild}}
+	}
+	scopes := make([]bot.Scope, 0, len(c.CommandSync.Scopes))
+	for _, scope := range c.CommandSync.Scopes {
+		scopes = append(scopes, bot.Scope{
+			GuildID:  scope.Guild,
+			Commands: scope.Commands,
+		})
+	}
+	return scopes
+}
+
+// ModelCatalogConfig enables autocompletion of models from the full OpenRouter catalog
+type ModelCatalogConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+}
+
+// TimeoutsConfig configures how long handlers may run before their requests are cancelled
+type TimeoutsConfig struct {
+	Default time.Duration `yaml:"default"`
+	Message time.Duration `yaml:"message"`
+	// Commands overrides the timeout per command path, e.g. "chat gpt". A path covers its subcommands
+	Commands map[string]time.Duration `yaml:"commands"`
+}
+
+// ResponseCacheConfig configures reuse of responses to deterministic (temperature 0) requests
+type ResponseCacheConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Backend is either "memory" or "disk"
+	Backend   string        `yaml:"backend"`
+	Size      int           `yaml:"size"`
+	TTL       time.Duration `yaml:"ttl"`
+	Directory string        `yaml:"directory"`
+}
+
+// BackendConfig describes an additional OpenAI-compatible server (Ollama, llama.cpp...)
+// that serves every model starting with Prefix
+type BackendConfig struct {
+	Name        string `yaml:"name"`
+	Prefix      string `yaml:"prefix"`
+	BaseURL     string `yaml:"baseURL"`
+	APIKey      string `yaml:"apiKey"`
+	StripPrefix bool   `yaml:"stripPrefix"`
 }
 
 func (c *Config) ReadFromFile(file string) error {
@@ -42,6 +153,10 @@ func (c *Config) ReadFromFile(file string) error {
 	if err != nil {
 		return err
 	}
+	// The Docker image enables the health server for its health check
+	if address := os.Getenv(health.AddressEnv); address != "" {
+		c.Health.Address = address
+	}
 	return c.Validate()
 }
 
@@ -95,6 +210,152 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	// Validate additional backends
+	prefixes := make(map[string]struct{}, len(c.Backends))
+	for i, backend := range c.Backends {
+		if backend.Name == "" {
+			c.Backends[i].Name = backend.Prefix
+		}
+		if !strings.HasSuffix(backend.Prefix, "/") || len(backend.Prefix) < 2 {
+			return fmt.Errorf("invalid backend prefix '%s', must end with '/' (e.g., 'local/')", backend.Prefix)
+		}
+		if _, exists := prefixes[backend.Prefix]; exists {
+			return fmt.Errorf("duplicate backend prefix '%s'", backend.Prefix)
+		}
+		prefixes[backend.Prefix] = struct{}{}
+		if !strings.HasPrefix(backend.BaseURL, "http://") && !strings.HasPrefix(backend.BaseURL, "https://") {
+			return fmt.Errorf("invalid base URL for backend '%s', must start with http:// or https://", backend.Prefix)
+		}
+	}
+
+	// Set response cache defaults
+	if c.ResponseCache.Enabled {
+		if c.ResponseCache.Backend == "" {
+			c.ResponseCache.Backend = "memory"
+		}
+		if c.ResponseCache.Size == 0 {
+			c.ResponseCache.Size = 256
+		}
+		if c.ResponseCache.TTL == 0 {
+			c.ResponseCache.TTL = 24 * time.Hour
+		}
+		if c.ResponseCache.Directory == "" {
+			c.ResponseCache.Directory = "cache"
+		}
+		if c.ResponseCache.Backend != "memory" && c.ResponseCache.Backend != "disk" {
+			return fmt.Errorf("invalid response cache backend '%s', must be 'memory' or 'disk'", c.ResponseCache.Backend)
+		}
+		if c.ResponseCache.Size < 0 {
+			return fmt.Errorf("response cache size must be positive")
+		}
+	}
+
+	// Set moderation defaults
+	if c.Moderation.LLM.Enabled && c.Moderation.LLM.Model == "" {
+		c.Moderation.LLM.Model = "openai/gpt-3.5-turbo"
+	}
+
+	// Set handler timeout defaults
+	if c.Timeouts.Default == 0 {
+		c.Timeouts.Default = 3 * time.Minute
+	}
+	if c.Timeouts.Message == 0 {
+		c.Timeouts.Message = c.Timeouts.Default
+	}
+	if c.Timeouts.Default < 0 || c.Timeouts.Message < 0 {
+		return fmt.Errorf("timeouts must be positive")
+	}
+	for path, timeout := range c.Timeouts.Commands {
+		if timeout <= 0 {
+			return fmt.Errorf("invalid timeout for command '%s', must be positive", path)
+		}
+	}
+
+	// Set shutdown defaults
+	if c.Shutdown.GracePeriod == 0 {
+		c.Shutdown.GracePeriod = 30 * time.Second
+	}
+	if c.Shutdown.GracePeriod < 0 {
+		return fmt.Errorf("shutdown grace period must be positive")
+	}
+
+	// Set message queue defaults
+	if c.MessageQueue.Workers == 0 {
+		c.MessageQueue.Workers = 16
+	}
+	if c.MessageQueue.ChannelQueueSize == 0 {
+		c.MessageQueue.ChannelQueueSize = 10
+	}
+	if c.MessageQueue.QueueSize == 0 {
+		c.MessageQueue.QueueSize = 500
+	}
+	if c.MessageQueue.Workers < 0 || c.MessageQueue.ChannelQueueSize < 0 || c.MessageQueue.QueueSize < 0 {
+		return fmt.Errorf("message queue sizes must be positive")
+	}
+
+	if err := c.FollowUps.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Mentions.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Sharding.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Health.Validate(); err != nil {
+		return err
+	}
+
+	// Set model catalog defaults
+	if c.ModelCatalog.Enabled && c.ModelCatalog.RefreshInterval <= 0 {
+		c.ModelCatalog.RefreshInterval = time.Hour
+	}
+
+	// Every guild and the global scope can only be synced once
+	syncScopes := make(map[string]struct{}, len(c.CommandSync.Scopes))
+	for _, scope := range c.CommandSync.Scopes {
+		if _, exists := syncScopes[scope.Guild]; exists {
+			return fmt.Errorf("duplicate command sync scope '%s'", scope.Guild)
+		}
+		syncScopes[scope.Guild] = struct{}{}
+	}
+
+	// Set message action defaults, an empty list disables them
+	if c.MessageActions == nil {
+		c.MessageActions = gpt.DefaultMessageActions
+	}
+	actionNames := make(map[string]struct{}, len(c.MessageActions))
+	for _, action := range c.MessageActions {
+		if _, err := gpt.ParseMessageActionPrompt(action); err != nil {
+			return err
+		}
+		if _, exists := actionNames[action.Name]; exists {
+			return fmt.Errorf("duplicate message action '%s'", action.Name)
+		}
+		actionNames[action.Name] = struct{}{}
+	}
+
+	for i := range c.Access.Rules {
+		if err := c.Access.Rules[i].Validate(); err != nil {
+			return err
+		}
+	}
+
+	// Rate limit names identify the rules in logs and metrics
+	rateLimitNames := make(map[string]struct{}, len(c.RateLimits))
+	for _, rateLimit := range c.RateLimits {
+		if _, err := rateLimit.Rule(); err != nil {
+			return err
+		}
+		if _, exists := rateLimitNames[rateLimit.Name]; exists {
+			return fmt.Errorf("duplicate rate limit '%s'", rateLimit.Name)
+		}
+		rateLimitNames[rateLimit.Name] = struct{}{}
+	}
+
 	return nil
 }
 
@@ -104,11 +365,14 @@ func init() {
 }
 
 var (
-	discordBot      *bot.Bot
+	discordBot       *bot.Bot
 	openrouterClient *openrouter.Client
+	backendRegistry  *openrouter.BackendRegistry
+	completionClient openrouter.OpenRouterClient
+	responseCache    openrouter.ResponseCache
 
 	gptMessagesCache     *gpt.MessagesCache
-	ignoredChannelsCache = make(gpt.IgnoredChannelsCache)
+	ignoredChannelsCache = gpt.NewIgnoredChannelsCache()
 )
 
 func main() {
@@ -117,14 +381,69 @@ func main() {
 	if err != nil {
 		log.Fatalf("Error reading credentials.yaml: %v", err)
 	}
+	if err := i18n.Load(config.Localization); err != nil {
+		log.Fatalf("Error loading translations: %v", err)
+	}
 	gptMessagesCache, err = gpt.NewMessagesCache(constants.DiscordThreadsCacheSize)
 	if err != nil {
 		log.Fatalf("Error initializing GPTMessageCache: %v", err)
 	}
+	gptMessagesCache.FollowUps = config.FollowUps
+	gptMessagesCache.Mentions = config.Mentions
+	gptMessagesCache.LanguageHint = !config.Localization.DisableLanguageHint
 	discordBot, err := bot.NewBot(config.Discord.Token)
 	if err != nil {
 		log.Fatalf("Inavalid parameters:%v", err)
 	}
+	discordBot.Router.Timeouts = bot.Timeouts{
+		Default:  config.Timeouts.Default,
+		Message:  config.Timeouts.Message,
+		Commands: config.Timeouts.Commands,
+	}
+	discordBot.Router.Dispatcher = bot.NewDispatcher(bot.DispatcherOptions{
+		Workers:          config.MessageQueue.Workers,
+		ChannelQueueSize: config.MessageQueue.ChannelQueueSize,
+		QueueSize:        config.MessageQueue.QueueSize,
+	})
+	if config.Audit.File != "" {
+		discordBot.Router.Subscribe(audit.NewFileSubscriber(config.Audit.File))
+		log.Printf("Audit log enabled [File: %s]", config.Audit.File)
+	}
+	if config.Audit.Channel != "" {
+		auditChannel, err := audit.NewChannelSubscriber(session.New(discordBot.Session), config.Audit.Channel, config.Audit.ChannelEvents)
+		if err != nil {
+			log.Fatalf("Error initializing audit channel: %v", err)
+		}
+		// Events of the handlers drained at shutdown are still posted
+		defer auditChannel.Close()
+		discordBot.Router.Subscribe(auditChannel)
+		log.Printf("Audit log enabled [Channel: %s]", config.Audit.Channel)
+	}
+	// Access is checked first, so denied commands do not count against rate limits
+	accessPolicy, err := access.NewPolicy(config.Access)
+	if err != nil {
+		log.Fatalf("Error initializing access policy: %v", err)
+	}
+	discordBot.Router.Use(access.Middleware(accessPolicy))
+	discordBot.Router.Register(commands.AccessCommand(accessPolicy))
+	// The direct messages toggle applies to every guild, only operators may use it
+	if len(config.Access.Operators) > 0 {
+		discordBot.Router.Register(commands.DirectMessagesCommand(accessPolicy))
+	}
+	if len(config.RateLimits) > 0 {
+		rules := make([]*bot.RateLimitRule, 0, len(config.RateLimits))
+		for _, rateLimit := range config.RateLimits {
+			rule, err := rateLimit.Rule()
+			if err != nil {
+				log.Fatalf("Error initializing rate limits: %v", err)
+			}
+			rules = append(rules, rule)
+		}
+		rateLimiter := bot.NewRateLimiter(rules)
+		discordBot.Router.Use(rateLimiter.Middleware())
+		discordBot.Router.UseMessage(rateLimiter.MessageMiddleware())
+		log.Printf("Rate limits enabled [Rules: %d]", len(rules))
+	}
 	if config.OpenRouter.APIKey != "" {
 		log.Printf("Initializing OpenRouter client with base URL: %s", config.OpenRouter.BaseURL)
 		
@@ -153,6 +472,38 @@ func main() {
 			log.Printf("OpenRouter API connection test successful")
 		}
 		
+		// Route models with a configured prefix to their own backends, everything else goes to OpenRouter
+		backendRegistry = openrouter.NewBackendRegistry(openrouterClient)
+		for _, backend := range config.Backends {
+			err := backendRegistry.Register(&openrouter.Backend{
+				Name:        backend.Name,
+				Prefix:      backend.Prefix,
+				StripPrefix: backend.StripPrefix,
+				Client: openrouter.NewClientWithConfig(openrouter.ClientConfig{
+					APIKey:  backend.APIKey,
+					BaseURL: backend.BaseURL,
+				}),
+			})
+			if err != nil {
+				log.Fatalf("Error registering backend: %v", err)
+			}
+			log.Printf("Backend %s registered for models with prefix '%s' at %s", backend.Name, backend.Prefix, backend.BaseURL)
+		}
+
+		completionClient = backendRegistry
+		if config.ResponseCache.Enabled {
+			if config.ResponseCache.Backend == "disk" {
+				responseCache, err = openrouter.NewDiskResponseCache(config.ResponseCache.Directory, config.ResponseCache.Size, config.ResponseCache.TTL)
+			} else {
+				responseCache, err = openrouter.NewMemoryResponseCache(config.ResponseCache.Size, config.ResponseCache.TTL)
+			}
+			if err != nil {
+				log.Fatalf("Error initializing response cache: %v", err)
+			}
+			completionClient = openrouter.NewCachingClient(backendRegistry, responseCache, openrouterClient.GetLogger())
+			log.Printf("Response cache enabled [Backend: %s, Size: %d, TTL: %v]", config.ResponseCache.Backend, config.ResponseCache.Size, config.ResponseCache.TTL)
+		}
+
 		// Log available models
 		log.Printf("Configured completion models: %v", config.OpenRouter.CompletionModels)
 		log.Printf("Configured image models: %v", config.OpenRouter.ImageModels)
@@ -161,17 +512,63 @@ func main() {
 		defaultImageModel := config.OpenRouter.ImageModels[0]
 		log.Printf("Using default image model: %s", defaultImageModel)
 		
+		// Offer every OpenRouter model through autocompletion, configured models come first
+		var modelCatalog *gpt.ModelCatalog
+		if config.ModelCatalog.Enabled {
+			modelCatalog = gpt.NewModelCatalog(openrouterClient, config.OpenRouter.CompletionModels, config.ModelCatalog.RefreshInterval)
+			catalogCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			if err := modelCatalog.Refresh(catalogCtx); err != nil {
+				log.Printf("Warning: Failed to load model catalog: %v", err)
+			} else {
+				log.Printf("Model catalog loaded with %d models", len(modelCatalog.Models()))
+			}
+			cancel()
+		}
+
 		// Register commands with OpenRouter client
 		log.Printf("Registering chat command with OpenRouter client")
 		discordBot.Router.Register(commands.ChatCommand(&commands.ChatCommandParams{
-			OpenRouterClient:     openrouterClient,
+			CompletionClient:     completionClient,
 			CompletionModels:     config.OpenRouter.CompletionModels,
 			GPTMessagesCache:     gptMessagesCache,
-			IgnoredChannelsCache: &ignoredChannelsCache,
+			IgnoredChannelsCache: ignoredChannelsCache,
+			ModelCatalog:         modelCatalog,
+			AccessPolicy:         accessPolicy,
 		}))
+
+		log.Printf("Registering message actions with OpenRouter client")
+		messageActions, err := commands.MessageActionCommands(&commands.MessageActionCommandsParams{
+			CompletionClient: completionClient,
+			GPTMessagesCache: gptMessagesCache,
+			Actions:          config.MessageActions,
+			AccessPolicy:     accessPolicy,
+		})
+		if err != nil {
+			log.Fatalf("Error initializing message actions: %v", err)
+		}
+		for _, action := range messageActions {
+			discordBot.Router.Register(action)
+		}
 		
+		// Prompts for image generation are checked against the moderation policy first
+		moderationPolicies, err := moderation.NewPolicySet(config.Moderation, completionClient)
+		if err != nil {
+			log.Fatalf("Error initializing moderation: %v", err)
+		}
+		var moderationAuditor moderation.Auditor
+		if config.Moderation.AuditFile != "" {
+			moderationAuditor = moderation.NewFileAuditor(config.Moderation.AuditFile)
+		}
+		log.Printf("Moderation enabled: %t [Moderators: %d, Guild policies: %d]", config.Moderation.Enabled, len(moderationPolicies.Default.Moderators), len(moderationPolicies.Guilds))
+
 		log.Printf("Registering image command with OpenRouter client")
-		discordBot.Router.Register(commands.ImageCommand(openrouterClient, defaultImageModel))
+		discordBot.Router.Register(commands.ImageCommand(&commands.ImageCommandParams{
+			ImageClient:        backendRegistry,
+			ImageModel:         defaultImageModel,
+			ModerationPolicies: moderationPolicies,
+			AccessPolicy:       accessPolicy,
+			ModerationAuditor:  moderationAuditor,
+		}))
 		
 		log.Printf("OpenRouter client initialization and command registration completed")
 	} else {
@@ -179,5 +576,34 @@ func main() {
 	}
 	log.Printf("Loaded Discord Token: %s", config.Discord.Token)
 	discordBot.Router.Register(commands.InfoCommand())
-	discordBot.Run(config.Discord.Guild, config.Discord.RemoveCommands)
+	if config.Health.Address != "" {
+		healthOptions := health.Options{
+			Gateway: discordBot,
+			Caches: map[string]func() int{
+				"conversations":    gptMessagesCache.Len,
+				"ignored_channels": ignoredChannelsCache.Len,
+			},
+			PingInterval: config.Health.PingInterval,
+		}
+		// A nil client must not end up in the interface, the bot is ready without OpenRouter then
+		if openrouterClient != nil {
+			healthOptions.OpenRouter = openrouterClient
+		}
+		if responseCache != nil {
+			healthOptions.Caches["responses"] = responseCache.Len
+		}
+		healthServer := health.NewServer(healthOptions)
+		if err := healthServer.Start(config.Health.Address); err != nil {
+			log.Fatalf("Error starting health server: %v", err)
+		}
+		defer healthServer.Close()
+	}
+	discordBot.Run(bot.RunOptions{
+		Scopes:         config.Scopes(),
+		RemoveCommands: config.Discord.RemoveCommands,
+		DryRun:         config.CommandSync.DryRun,
+
+		ShutdownGracePeriod: config.Shutdown.GracePeriod,
+		Shards:              config.Sharding,
+	})
 }
\ No newline at end of file
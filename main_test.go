@@ -2,7 +2,14 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/access"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/commands/gpt"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/health"
 )
 
 func createValidConfig() Config {
@@ -66,6 +73,130 @@ func createConfigWithInvalidImageModel() Config {
 	return config
 }
 
+func createConfigWithLocalBackend() Config {
+	config := createValidConfig()
+	config.OpenRouter.CompletionModels = []string{"openai/gpt-4", "local/llama3"}
+	config.Backends = []BackendConfig{
+		{Prefix: "local/", BaseURL: "http://localhost:11434/v1", StripPrefix: true},
+	}
+	return config
+}
+
+func createConfigWithInvalidBackendPrefix() Config {
+	config := createConfigWithLocalBackend()
+	config.Backends[0].Prefix = "local"
+	return config
+}
+
+func createConfigWithDuplicateBackendPrefix() Config {
+	config := createConfigWithLocalBackend()
+	config.Backends = append(config.Backends, BackendConfig{Prefix: "local/", BaseURL: "http://localhost:8080/v1"})
+	return config
+}
+
+func createConfigWithInvalidBackendURL() Config {
+	config := createConfigWithLocalBackend()
+	config.Backends[0].BaseURL = "localhost:11434/v1"
+	return config
+}
+
+func createConfigWithInvalidResponseCacheBackend() Config {
+	config := createValidConfig()
+	config.ResponseCache.Enabled = true
+	config.ResponseCache.Backend = "redis"
+	return config
+}
+
+func createConfigWithInvalidCommandTimeout() Config {
+	config := createValidConfig()
+	config.Timeouts.Commands = map[string]time.Duration{"chat gpt": -time.Second}
+	return config
+}
+
+func createConfigWithInvalidMessageAction() Config {
+	config := createValidConfig()
+	config.MessageActions = []gpt.MessageAction{
+		{Name: "Summarize", Prompt: "Summarize {{.Content"},
+	}
+	return config
+}
+
+func createConfigWithDuplicateMessageAction() Config {
+	config := createValidConfig()
+	config.MessageActions = []gpt.MessageAction{
+		{Name: "Summarize", Prompt: "Summarize {{.Content}}"},
+		{Name: "Summarize", Prompt: "Shorten {{.Content}}"},
+	}
+	return config
+}
+
+func createConfigWithDuplicateSyncScope() Config {
+	config := createValidConfig()
+	config.CommandSync.Scopes = []CommandScopeConfig{
+		{Guild: "123"},
+		{Guild: ""},
+		{Guild: "123", Commands: []string{"chat"}},
+	}
+	return config
+}
+
+func createConfigWithInvalidRateLimit() Config {
+	config := createValidConfig()
+	config.RateLimits = []bot.RateLimitConfig{
+		{Name: "images", Commands: []string{"image dalle"}, Limit: 3},
+	}
+	return config
+}
+
+func createConfigWithDuplicateRateLimit() Config {
+	config := createValidConfig()
+	config.RateLimits = []bot.RateLimitConfig{
+		{Name: "images", Commands: []string{"image dalle"}, Limit: 3, Window: time.Minute},
+		{Name: "images", Limit: 10, Window: time.Minute, Per: "guild"},
+	}
+	return config
+}
+
+func createConfigWithInvalidAccessRule() Config {
+	config := createValidConfig()
+	config.Access.Rules = []access.Rule{
+		{Models: []string{"openai/gpt-4*"}},
+	}
+	return config
+}
+
+func createConfigWithInvalidMessageQueue() Config {
+	config := createValidConfig()
+	config.MessageQueue.Workers = -1
+	return config
+}
+
+func createConfigWithInvalidFollowUpMode() Config {
+	config := createValidConfig()
+	config.FollowUps.Guilds = map[string]gpt.FollowUpMode{"123": "wait"}
+	return config
+}
+
+func createConfigWithInvalidMentionDepth() Config {
+	config := createValidConfig()
+	config.Mentions.MaxDepth = -1
+	return config
+}
+
+func createConfigWithInvalidShardIDs() Config {
+	config := createValidConfig()
+	config.Sharding.Count = 2
+	config.Sharding.IDs = []int{0, 2}
+	return config
+}
+
+func createConfigWithInvalidHealthPingInterval() Config {
+	config := createValidConfig()
+	config.Health.Address = ":8080"
+	config.Health.PingInterval = -time.Second
+	return config
+}
+
 func createConfigWithDefaults() Config {
 	return Config{
 		Discord: struct {
@@ -142,6 +273,107 @@ func TestConfig_Validate(t *testing.T) {
 			config:  createConfigWithDefaults(),
 			wantErr: false,
 		},
+		{
+			name:    "config with local backend",
+			config:  createConfigWithLocalBackend(),
+			wantErr: false,
+		},
+		{
+			name:    "invalid backend prefix",
+			config:  createConfigWithInvalidBackendPrefix(),
+			wantErr: true,
+			errMsg:  "invalid backend prefix 'local', must end with '/' (e.g., 'local/')",
+		},
+		{
+			name:    "duplicate backend prefix",
+			config:  createConfigWithDuplicateBackendPrefix(),
+			wantErr: true,
+			errMsg:  "duplicate backend prefix 'local/'",
+		},
+		{
+			name:    "invalid backend base url",
+			config:  createConfigWithInvalidBackendURL(),
+			wantErr: true,
+			errMsg:  "invalid base URL for backend 'local/', must start with http:// or https://",
+		},
+		{
+			name:    "invalid response cache backend",
+			config:  createConfigWithInvalidResponseCacheBackend(),
+			wantErr: true,
+			errMsg:  "invalid response cache backend 'redis', must be 'memory' or 'disk'",
+		},
+		{
+			name:    "invalid command timeout",
+			config:  createConfigWithInvalidCommandTimeout(),
+			wantErr: true,
+			errMsg:  "invalid timeout for command 'chat gpt', must be positive",
+		},
+		{
+			name:    "invalid message action prompt",
+			config:  createConfigWithInvalidMessageAction(),
+			wantErr: true,
+			errMsg:  "invalid prompt template for message action 'Summarize': template: Summarize:1: unclosed action",
+		},
+		{
+			name:    "duplicate message action",
+			config:  createConfigWithDuplicateMessageAction(),
+			wantErr: true,
+			errMsg:  "duplicate message action 'Summarize'",
+		},
+		{
+			name:    "duplicate command sync scope",
+			config:  createConfigWithDuplicateSyncScope(),
+			wantErr: true,
+			errMsg:  "duplicate command sync scope '123'",
+		},
+		{
+			name:    "rate limit without window",
+			config:  createConfigWithInvalidRateLimit(),
+			wantErr: true,
+			errMsg:  "invalid window for rate limit 'images', must be positive",
+		},
+		{
+			name:    "duplicate rate limit",
+			config:  createConfigWithDuplicateRateLimit(),
+			wantErr: true,
+			errMsg:  "duplicate rate limit 'images'",
+		},
+		{
+			name:    "access rule without restriction",
+			config:  createConfigWithInvalidAccessRule(),
+			wantErr: true,
+			errMsg:  "access rule must restrict roles or channels",
+		},
+		{
+			name:    "negative message queue workers",
+			config:  createConfigWithInvalidMessageQueue(),
+			wantErr: true,
+			errMsg:  "message queue sizes must be positive",
+		},
+		{
+			name:    "invalid follow-up mode",
+			config:  createConfigWithInvalidFollowUpMode(),
+			wantErr: true,
+			errMsg:  "invalid follow-up mode 'wait', must be 'lock', 'queue' or 'batch'",
+		},
+		{
+			name:    "negative mention reply chain depth",
+			config:  createConfigWithInvalidMentionDepth(),
+			wantErr: true,
+			errMsg:  "mention reply chain depth must not be negative",
+		},
+		{
+			name:    "shard ID out of range",
+			config:  createConfigWithInvalidShardIDs(),
+			wantErr: true,
+			errMsg:  "shard ID 2 must be less than the shard count 2",
+		},
+		{
+			name:    "negative health ping interval",
+			config:  createConfigWithInvalidHealthPingInterval(),
+			wantErr: true,
+			errMsg:  "health ping interval must not be negative",
+		},
 	}
 
 	for _, tt := range tests {
@@ -241,6 +473,48 @@ openRouter:
 	}
 }
 
+func TestConfig_Scopes(t *testing.T) {
+	config := createValidConfig()
+	config.Discord.Guild = "test-guild"
+	scopes := config.Scopes()
+	if len(scopes) != 1 || scopes[0].GuildID != "test-guild" || scopes[0].Commands != nil {
+		t.Errorf("Expected all commands in the configured guild, got %+v", scopes)
+	}
+
+	config.CommandSync.Scopes = []CommandScopeConfig{
+		{Guild: ""},
+		{Guild: "123", Commands: []string{"chat"}},
+	}
+	scopes = config.Scopes()
+	if len(scopes) != 2 || scopes[0].GuildID != "" || scopes[1].GuildID != "123" || len(scopes[1].Commands) != 1 {
+		t.Errorf("Unexpected scopes %+v", scopes)
+	}
+}
+
+func TestConfig_HealthAddress(t *testing.T) {
+	// The health server is optional, only the Docker image enables it
+	config := createValidConfig()
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Config.Validate() unexpected error = %v", err)
+	}
+	if config.Health.Address != "" {
+		t.Errorf("Expected the health server to stay disabled, got %q", config.Health.Address)
+	}
+
+	file := filepath.Join(t.TempDir(), "credentials.yaml")
+	if err := os.WriteFile(file, []byte("discord:\n  token: \"test-token\"\nopenRouter:\n  apiKey: \"sk-or-v1-test-key\"\nhealth:\n  address: \":9000\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(health.AddressEnv, ":8081")
+	config = Config{}
+	if err := config.ReadFromFile(file); err != nil {
+		t.Fatalf("Config.ReadFromFile() error = %v", err)
+	}
+	if config.Health.Address != ":8081" {
+		t.Errorf("Expected %s to override the health address, got %q", health.AddressEnv, config.Health.Address)
+	}
+}
+
 func TestConfig_ReadFromFile_InvalidFile(t *testing.T) {
 	config := &Config{}
 	err := config.ReadFromFile("nonexistent-file.yaml")
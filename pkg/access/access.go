@@ -0,0 +1,304 @@
+// Package access restricts which roles can use which commands and models in which channels.
+package access
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Config is the access section of the bot configuration
+type Config struct {
+	Rules []Rule `yaml:"rules"`
+	// File persists the rules admins add at runtime, without it they are lost on restart
+	File string `yaml:"file"`
+	// DirectMessages allows conversations and images in direct messages with the bot.
+	// Operators can toggle it at runtime, which is persisted in File
+	DirectMessages bool `yaml:"directMessages"`
+	// Operators are the IDs of the users who change settings of the whole bot, e.g. toggle direct messages.
+	// Guild admins cannot, as the settings apply to every guild
+	Operators []string `yaml:"operators"`
+}
+
+// Rule restricts the requests it applies to. A request has to satisfy every rule that applies to it
+type Rule struct {
+	// ID identifies rules added at runtime, rules of the configuration have none
+	ID int `yaml:"-" json:"id"`
+	// Guild limits the rule to a guild, empty applies it to all guilds
+	Guild string `yaml:"guild" json:"guild,omitempty"`
+	// Commands are the command paths the rule applies to, e.g. "chat gpt". A path covers
+	// its subcommands, empty applies the rule to all commands
+	Commands []string `yaml:"commands" json:"commands,omitempty"`
+	// Models are patterns of the models the rule applies to, e.g. "openai/gpt-4*".
+	// Rules with models only apply to requests using a matching model
+	Models []string `yaml:"models" json:"models,omitempty"`
+	// Roles allowed to make the requests, empty allows everyone
+	Roles []string `yaml:"roles" json:"roles,omitempty"`
+	// Channels the requests are allowed in, empty allows all channels. Threads inherit the channel they are in
+	Channels []string `yaml:"channels" json:"channels,omitempty"`
+}
+
+// Validate checks the model patterns of the rule and that it restricts anything
+func (r *Rule) Validate() error {
+	if len(r.Roles) == 0 && len(r.Channels) == 0 {
+		return fmt.Errorf("access rule must restrict roles or channels")
+	}
+	for _, pattern := range r.Models {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid model pattern '%s' in access rule: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Request describes the use of a command, or of a model if Model is set
+type Request struct {
+	GuildID   string
+	ChannelID string
+	// ParentID is the channel of the thread ChannelID, if it is one
+	ParentID string
+	Roles    []string
+	Command  string
+	Model    string
+}
+
+func (r *Rule) appliesTo(req Request) bool {
+	if r.Guild != "" && r.Guild != req.GuildID {
+		return false
+	}
+	if len(r.Commands) > 0 && !slices.ContainsFunc(r.Commands, func(path string) bool {
+		return req.Command == path || strings.HasPrefix(req.Command, path+" ")
+	}) {
+		return false
+	}
+	if len(r.Models) > 0 && (req.Model == "" || !slices.ContainsFunc(r.Models, func(pattern string) bool {
+		ok, _ := path.Match(pattern, req.Model)
+		return ok
+	})) {
+		return false
+	}
+	return true
+}
+
+// Denial explains to the user why a request was denied
+type Denial struct {
+	Rule *Rule
+	// Roles the user needs one of, empty if the roles were not the problem
+	Roles []string
+	// Channels the request is allowed in, empty if the channel was not the problem
+	Channels []string
+	Request  Request
+}
+
+func (d *Denial) Error() string {
+	subject := "/" + d.Request.Command
+	if d.Request.Model != "" {
+		subject = "model " + d.Request.Model
+	}
+	if len(d.Roles) > 0 {
+		return fmt.Sprintf("%s requires one of the roles %s", subject, strings.Join(d.Roles, ", "))
+	}
+	return fmt.Sprintf("%s can only be used in the channels %s", subject, strings.Join(d.Channels, ", "))
+}
+
+func (r *Rule) check(req Request) *Denial {
+	if len(r.Channels) > 0 && !slices.Contains(r.Channels, req.ChannelID) && (req.ParentID == "" || !slices.Contains(r.Channels, req.ParentID)) {
+		return &Denial{Rule: r, Channels: r.Channels, Request: req}
+	}
+	if len(r.Roles) > 0 && !slices.ContainsFunc(r.Roles, func(role string) bool {
+		return slices.Contains(req.Roles, role)
+	}) {
+		return &Denial{Rule: r, Roles: r.Roles, Request: req}
+	}
+	return nil
+}
+
+// Policy holds the rules of the configuration and the rules admins add at runtime
+type Policy struct {
+	file string
+
+	mu             sync.RWMutex
+	config         []Rule
+	runtime        []Rule
+	nextID         int
+	directMessages bool
+	operators      []string
+	// directMessagesToggled is set once admins toggled direct messages, so the toggle outlives restarts
+	directMessagesToggled bool
+}
+
+// policyFile is the content of the file of the policy. Older versions stored only the rules as a list
+type policyFile struct {
+	Rules          []Rule `json:"rules"`
+	DirectMessages *bool  `json:"directMessages,omitempty"`
+}
+
+// NewPolicy creates the policy of the configuration and loads the runtime rules from its file
+func NewPolicy(config Config) (*Policy, error) {
+	for i := range config.Rules {
+		if err := config.Rules[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	p := &Policy{
+		file:           config.File,
+		config:         config.Rules,
+		nextID:         1,
+		directMessages: config.DirectMessages,
+		operators:      config.Operators,
+	}
+	if p.file == "" {
+		return p, nil
+	}
+
+	data, err := os.ReadFile(p.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read access rules: %w", err)
+	}
+	var file policyFile
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		err = json.Unmarshal(data, &file.Rules)
+	} else {
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse access rules: %w", err)
+	}
+	p.runtime = file.Rules
+	if file.DirectMessages != nil {
+		p.directMessages = *file.DirectMessages
+		p.directMessagesToggled = true
+	}
+	for _, rule := range p.runtime {
+		p.nextID = max(p.nextID, rule.ID+1)
+	}
+	return p, nil
+}
+
+// Check returns why the request is denied, or nil if it is allowed. A nil policy allows everything
+func (p *Policy) Check(req Request) *Denial {
+	if p == nil {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, rules := range [][]Rule{p.config, p.runtime} {
+		for i := range rules {
+			if !rules[i].appliesTo(req) {
+				continue
+			}
+			if denial := rules[i].check(req); denial != nil {
+				return denial
+			}
+		}
+	}
+	return nil
+}
+
+// Rules returns the rules applying in the guild, configured rules first
+func (p *Policy) Rules(guildID string) []Rule {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var rules []Rule
+	for _, list := range [][]Rule{p.config, p.runtime} {
+		for _, rule := range list {
+			if rule.Guild == "" || rule.Guild == guildID {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return rules
+}
+
+// Add adds a runtime rule and persists the runtime rules. The ID of the rule is returned
+func (p *Policy) Add(rule Rule) (int, error) {
+	if err := rule.Validate(); err != nil {
+		return 0, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rule.ID = p.nextID
+	p.nextID++
+	p.runtime = append(p.runtime, rule)
+	return rule.ID, p.save()
+}
+
+// Remove removes the runtime rule with the ID from the guild and persists the runtime rules.
+// Rules of the configuration cannot be removed
+func (p *Policy) Remove(guildID string, id int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	i := slices.IndexFunc(p.runtime, func(rule Rule) bool {
+		return rule.ID == id && rule.Guild == guildID
+	})
+	if i < 0 {
+		return fmt.Errorf("no access rule with ID %d", id)
+	}
+	p.runtime = slices.Delete(p.runtime, i, i+1)
+	return p.save()
+}
+
+// DirectMessagesAllowed reports whether the bot talks to users in direct messages. A nil policy allows them
+func (p *Policy) DirectMessagesAllowed() bool {
+	if p == nil {
+		return true
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.directMessages
+}
+
+// IsOperator reports whether the user may change settings of the whole bot. A nil policy has no operators
+func (p *Policy) IsOperator(userID string) bool {
+	if p == nil {
+		return false
+	}
+	return slices.Contains(p.operators, userID)
+}
+
+// SetDirectMessages allows or disallows direct messages and persists the toggle
+func (p *Policy) SetDirectMessages(allowed bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.directMessages = allowed
+	p.directMessagesToggled = true
+	return p.save()
+}
+
+// save writes the runtime rules and toggles to the file, replacing it atomically
+func (p *Policy) save() error {
+	if p.file == "" {
+		return nil
+	}
+	file := policyFile{Rules: p.runtime}
+	if p.directMessagesToggled {
+		file.DirectMessages = &p.directMessages
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal access rules: %w", err)
+	}
+	tmp := p.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write access rules: %w", err)
+	}
+	if err := os.Rename(tmp, p.file); err != nil {
+		return fmt.Errorf("failed to write access rules: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package access
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	policy, err := NewPolicy(Config{
+		Rules: []Rule{
+			{Models: []string{"openai/gpt-4*"}, Roles: []string{"premium"}},
+			{Commands: []string{"image"}, Channels: []string{"art"}},
+			{Guild: "other", Commands: []string{"chat"}, Roles: []string{"staff"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		req     Request
+		allowed bool
+	}{
+		{"cheap model", Request{GuildID: "g", Command: "chat gpt", Model: "openai/gpt-3.5-turbo"}, true},
+		{"gated model without role", Request{GuildID: "g", Command: "chat gpt", Model: "openai/gpt-4-turbo"}, false},
+		{"gated model with role", Request{GuildID: "g", Command: "chat gpt", Model: "openai/gpt-4", Roles: []string{"premium"}}, true},
+		{"command without model", Request{GuildID: "g", Command: "chat gpt"}, true},
+		{"subcommand in wrong channel", Request{GuildID: "g", ChannelID: "general", Command: "image dalle"}, false},
+		{"subcommand in channel", Request{GuildID: "g", ChannelID: "art", Command: "image dalle"}, true},
+		{"thread of channel", Request{GuildID: "g", ChannelID: "thread", ParentID: "art", Command: "image dalle"}, true},
+		{"similar command name", Request{GuildID: "g", ChannelID: "general", Command: "imagine"}, true},
+		{"rule of other guild", Request{GuildID: "g", Command: "chat"}, true},
+		{"guild rule", Request{GuildID: "other", Command: "chat"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			denial := policy.Check(tt.req)
+			if (denial == nil) != tt.allowed {
+				t.Errorf("Check() = %v, want allowed %v", denial, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestDenial_Error(t *testing.T) {
+	policy, _ := NewPolicy(Config{
+		Rules: []Rule{
+			{Models: []string{"openai/gpt-4*"}, Roles: []string{"premium"}},
+			{Commands: []string{"image"}, Channels: []string{"art"}},
+		},
+	})
+
+	denial := policy.Check(Request{Command: "chat gpt", Model: "openai/gpt-4"})
+	if denial == nil || denial.Error() != "model openai/gpt-4 requires one of the roles premium" {
+		t.Errorf("Unexpected denial %v", denial)
+	}
+	denial = policy.Check(Request{ChannelID: "general", Command: "image dalle"})
+	if denial == nil || denial.Error() != "/image dalle can only be used in the channels art" {
+		t.Errorf("Unexpected denial %v", denial)
+	}
+}
+
+func TestPolicy_NilAllowsEverything(t *testing.T) {
+	var policy *Policy
+	if denial := policy.Check(Request{Command: "chat gpt", Model: "openai/gpt-4"}); denial != nil {
+		t.Errorf("Expected nil policy to allow, got %v", denial)
+	}
+}
+
+func TestPolicy_RuntimeRules(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "access.json")
+	policy, err := NewPolicy(Config{File: file})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+
+	if _, err := policy.Add(Rule{Guild: "g", Commands: []string{"chat"}}); err == nil {
+		t.Error("Expected a rule without roles and channels to be rejected")
+	}
+	id, err := policy.Add(Rule{Guild: "g", Models: []string{"openai/gpt-4*"}, Roles: []string{"premium"}})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if denial := policy.Check(Request{GuildID: "g", Command: "chat gpt", Model: "openai/gpt-4"}); denial == nil {
+		t.Error("Expected the runtime rule to apply")
+	}
+
+	// The rules are loaded again after a restart
+	restarted, err := NewPolicy(Config{File: file})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+	if rules := restarted.Rules("g"); len(rules) != 1 || rules[0].ID != id {
+		t.Fatalf("Expected the persisted rule, got %v", rules)
+	}
+	if len(restarted.Rules("other")) != 0 {
+		t.Error("Expected the rule to be listed in its guild only")
+	}
+
+	if err := restarted.Remove("other", id); err == nil {
+		t.Error("Expected rules of other guilds not to be removable")
+	}
+	if err := restarted.Remove("g", id); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if next, _ := restarted.Add(Rule{Guild: "g", Roles: []string{"staff"}}); next == id {
+		t.Error("Expected IDs not to be reused")
+	}
+}
+
+func TestPolicy_DirectMessages(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "access.json")
+	if err := os.WriteFile(file, []byte(`[{"id": 1, "guild": "g", "roles": ["staff"]}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := NewPolicy(Config{File: file})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+	if len(policy.Rules("g")) != 1 {
+		t.Error("Expected the rules of the older file format to be loaded")
+	}
+	if policy.DirectMessagesAllowed() {
+		t.Error("Expected direct messages to be disabled by default")
+	}
+
+	if err := policy.SetDirectMessages(true); err != nil {
+		t.Fatalf("SetDirectMessages() error = %v", err)
+	}
+	// The toggle overrides the configuration after a restart
+	restarted, err := NewPolicy(Config{File: file})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+	if !restarted.DirectMessagesAllowed() {
+		t.Error("Expected the toggle to be persisted")
+	}
+	if rules := restarted.Rules("g"); len(rules) != 1 || rules[0].ID != 1 {
+		t.Errorf("Expected the rules to be kept, got %v", rules)
+	}
+
+	if !(*Policy)(nil).DirectMessagesAllowed() {
+		t.Error("Expected nil policy to allow direct messages")
+	}
+}
+
+func TestPolicy_IsOperator(t *testing.T) {
+	policy, err := NewPolicy(Config{Operators: []string{"op"}})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+	if !policy.IsOperator("op") {
+		t.Error("Expected the configured user to be an operator")
+	}
+	if policy.IsOperator("admin") {
+		t.Error("Expected other users not to be operators")
+	}
+	if (*Policy)(nil).IsOperator("op") {
+		t.Error("Expected nil policy to have no operators")
+	}
+}
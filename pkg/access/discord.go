@@ -0,0 +1,135 @@
+package access
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+// InteractionRequest describes the use of command with model through the interaction
+func InteractionRequest(s session.Session, i *discord.Interaction, command string, model string) Request {
+	req := Request{
+		GuildID:   i.GuildID,
+		ChannelID: i.ChannelID,
+		ParentID:  parentID(s, i.ChannelID),
+		Command:   command,
+		Model:     model,
+	}
+	if i.Member != nil {
+		req.Roles = i.Member.Roles
+	}
+	return req
+}
+
+// MessageRequest describes the use of command with model through the message
+func MessageRequest(s session.Session, m *discord.Message, command string, model string) Request {
+	req := Request{
+		GuildID:   m.GuildID,
+		ChannelID: m.ChannelID,
+		ParentID:  parentID(s, m.ChannelID),
+		Command:   command,
+		Model:     model,
+	}
+	if m.Member != nil {
+		req.Roles = m.Member.Roles
+	}
+	return req
+}
+
+func parentID(s session.Session, channelID string) string {
+	ch, err := s.State().Channel(channelID)
+	if err != nil || !ch.IsThread() {
+		return ""
+	}
+	return ch.ParentID
+}
+
+// DenialEmbed explains the denial to the user in the language of the locale
+func DenialEmbed(locale discord.Locale, denial *Denial) *discord.MessageEmbed {
+	subject := fmt.Sprintf("`/%s`", denial.Request.Command)
+	if denial.Request.Model != "" {
+		subject = i18n.Text(locale, "access.denied.model", denial.Request.Model)
+	}
+
+	var description string
+	if len(denial.Roles) > 0 {
+		description = i18n.Text(locale, "access.denied.roles", subject, mentions("<@&%s>", denial.Roles))
+	} else {
+		description = i18n.Text(locale, "access.denied.channels", subject, mentions("<#%s>", denial.Channels))
+	}
+	return &discord.MessageEmbed{
+		Title:       i18n.Text(locale, "access.denied.title"),
+		Description: description,
+		Color:       0xff0000,
+	}
+}
+
+func mentions(format string, ids []string) string {
+	formatted := make([]string, len(ids))
+	for i, id := range ids {
+		formatted[i] = fmt.Sprintf(format, id)
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// Middleware denies slash and context menu commands the policy does not allow in the channel
+// or for the roles of the user. Components and modals are checked as their command.
+// Models are checked by the handlers choosing them
+func Middleware(policy *Policy) bot.Handler {
+	return bot.HandlerFunc(func(ctx *bot.Context) {
+		req := InteractionRequest(ctx.Session, ctx.Interaction, ctx.Path(), "")
+		denial := policy.Check(req)
+		if denial == nil {
+			ctx.Next()
+			return
+		}
+		log.Printf("[GID: %s, i.ID: %s] Access denied: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, denial)
+		bot.SetEventReason(ctx, denial.Error())
+		err := ctx.Respond(&discord.InteractionResponse{
+			Type: discord.InteractionResponseChannelMessageWithSource,
+			Data: &discord.InteractionResponseData{
+				Embeds: []*discord.MessageEmbed{DenialEmbed(ctx.Locale(), denial)},
+				Flags:  discord.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			log.Printf("[GID: %s, i.ID: %s] Failed to respond to interaction with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		}
+	})
+}
+
+// DirectMessagesDisabledEmbed tells the user the bot does not talk in direct messages
+func DirectMessagesDisabledEmbed(locale discord.Locale) *discord.MessageEmbed {
+	return &discord.MessageEmbed{
+		Title:       i18n.Text(locale, "access.direct_messages.title"),
+		Description: i18n.Text(locale, "access.direct_messages.description"),
+		Color:       0xff0000,
+	}
+}
+
+// DirectMessagesMiddleware denies commands in direct messages while the policy disallows them
+func DirectMessagesMiddleware(policy *Policy) bot.Handler {
+	return bot.HandlerFunc(func(ctx *bot.Context) {
+		if ctx.Interaction.GuildID != "" || policy.DirectMessagesAllowed() {
+			ctx.Next()
+			return
+		}
+		log.Printf("[GID: %s, i.ID: %s] Command of UserID: %s denied in direct messages\n", ctx.Interaction.GuildID, ctx.Interaction.ID, ctx.User().ID)
+		bot.SetEventReason(ctx, "direct messages are disabled")
+		err := ctx.Respond(&discord.InteractionResponse{
+			Type: discord.InteractionResponseChannelMessageWithSource,
+			Data: &discord.InteractionResponseData{
+				Embeds: []*discord.MessageEmbed{DirectMessagesDisabledEmbed(ctx.Locale())},
+				Flags:  discord.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			log.Printf("[GID: %s, i.ID: %s] Failed to respond to interaction with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+// Package audit records the lifecycle events of the bot, so admins can see who used which model for what
+package audit
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/utils"
+)
+
+// Config enables the audit log
+type Config struct {
+	// File is the JSONL file every event is appended to
+	File string `yaml:"file"`
+	// Channel is the Discord channel events are posted to
+	Channel string `yaml:"channel"`
+	// ChannelEvents are the types of events posted to the channel, DefaultChannelEvents if empty
+	ChannelEvents []string `yaml:"channelEvents"`
+}
+
+// Record is an event as written to the audit file
+type Record struct {
+	Type          bot.EventType `json:"type"`
+	Time          time.Time     `json:"time"`
+	Command       string        `json:"command,omitempty"`
+	GuildID       string        `json:"guild_id,omitempty"`
+	ChannelID     string        `json:"channel_id,omitempty"`
+	UserID        string        `json:"user_id,omitempty"`
+	InteractionID string        `json:"interaction_id,omitempty"`
+	MessageID     string        `json:"message_id,omitempty"`
+	ThreadID      string        `json:"thread_id,omitempty"`
+	Model         string        `json:"model,omitempty"`
+	Prompt        string        `json:"prompt,omitempty"`
+	Reason        string        `json:"reason,omitempty"`
+	Error         string        `json:"error,omitempty"`
+	DurationMS    int64         `json:"duration_ms,omitempty"`
+}
+
+func newRecord(event bot.Event) Record {
+	return Record{
+		Type:          event.Type,
+		Time:          event.Time,
+		Command:       event.Command,
+		GuildID:       event.GuildID,
+		ChannelID:     event.ChannelID,
+		UserID:        event.UserID,
+		InteractionID: event.InteractionID,
+		MessageID:     event.MessageID,
+		ThreadID:      event.ThreadID,
+		Model:         event.Model,
+		Prompt:        event.Prompt,
+		Reason:        event.Reason,
+		Error:         event.Error,
+		DurationMS:    event.Duration.Milliseconds(),
+	}
+}
+
+// FileSubscriber appends every event to a JSONL file
+type FileSubscriber struct {
+	file *utils.JSONLFile
+}
+
+// NewFileSubscriber creates a subscriber appending to the file at path
+func NewFileSubscriber(path string) *FileSubscriber {
+	return &FileSubscriber{file: utils.NewJSONLFile(path)}
+}
+
+func (f *FileSubscriber) HandleEvent(event bot.Event) {
+	if err := f.Record(event); err != nil {
+		log.Printf("[Event: %s] Failed to write audit record with the error: %v\n", event.Type, err)
+	}
+}
+
+// Record appends the event as a single JSON line
+func (f *FileSubscriber) Record(event bot.Event) error {
+	return f.file.Append(newRecord(event))
+}
+
+// parseEventTypes returns the event types of the configuration
+func parseEventTypes(names []string) (map[bot.EventType]bool, error) {
+	types := make(map[bot.EventType]bool, len(names))
+	for _, name := range names {
+		known := false
+		for _, eventType := range bot.EventTypes {
+			if string(eventType) == name {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown audit event type '%s', must be one of %v", name, bot.EventTypes)
+		}
+		types[bot.EventType(name)] = true
+	}
+	return types, nil
+}
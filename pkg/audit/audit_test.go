@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session/sessiontest"
+)
+
+const testAuditChannelID = "audit"
+
+func testEvent(eventType bot.EventType) bot.Event {
+	return bot.Event{
+		Type:      eventType,
+		Time:      time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Command:   "chat gpt",
+		GuildID:   "guild",
+		ChannelID: "channel",
+		UserID:    "user",
+		Model:     "openai/gpt-4o",
+		Prompt:    "Hello",
+		Duration:  1500 * time.Millisecond,
+	}
+}
+
+func TestFileSubscriber(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	subscriber := NewFileSubscriber(path)
+	subscriber.HandleEvent(testEvent(bot.EventCommandInvoked))
+	subscriber.HandleEvent(testEvent(bot.EventCommandCompleted))
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Expected a JSON record per line, got %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 || records[0].Type != bot.EventCommandInvoked || records[1].Type != bot.EventCommandCompleted {
+		t.Fatalf("Expected both events in order, got %+v", records)
+	}
+	if records[1].UserID != "user" || records[1].Model != "openai/gpt-4o" || records[1].DurationMS != 1500 {
+		t.Errorf("Expected who used which model for how long, got %+v", records[1])
+	}
+}
+
+func TestChannelSubscriber(t *testing.T) {
+	s := sessiontest.NewFake("bot", "guild", testAuditChannelID)
+	subscriber, err := NewChannelSubscriber(s, testAuditChannelID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := testEvent(bot.EventCommandFailed)
+	failed.Error = "OpenRouter is down"
+	subscriber.HandleEvent(testEvent(bot.EventCommandInvoked))
+	subscriber.HandleEvent(failed)
+	subscriber.Close()
+	// Events after closing are ignored instead of panicking
+	subscriber.HandleEvent(failed)
+
+	messages := s.Messages(testAuditChannelID)
+	if len(messages) != 1 || len(messages[0].Embeds) != 1 {
+		t.Fatalf("Expected only the failure to be posted by default, got %v", messages)
+	}
+	embed := messages[0].Embeds[0]
+	if embed.Color != channelEmbedColorFailed || !strings.Contains(embed.Description, "<@user> used `/chat gpt` in <#channel>") {
+		t.Errorf("Expected the failed command to be described, got %+v", embed)
+	}
+	fields := make(map[string]string)
+	for _, field := range embed.Fields {
+		fields[field.Name] = field.Value
+	}
+	if fields["Model"] != "openai/gpt-4o" || fields["Prompt"] != "Hello" || fields["Error"] != "OpenRouter is down" || fields["Duration"] != "1.5s" {
+		t.Errorf("Unexpected fields %v", fields)
+	}
+}
+
+func TestChannelSubscriber_Events(t *testing.T) {
+	s := sessiontest.NewFake("bot", "guild", testAuditChannelID)
+	subscriber, err := NewChannelSubscriber(s, testAuditChannelID, []string{string(bot.EventMessageHandled)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscriber.HandleEvent(testEvent(bot.EventCommandCompleted))
+	subscriber.HandleEvent(testEvent(bot.EventMessageHandled))
+	subscriber.Close()
+
+	if messages := s.Messages(testAuditChannelID); len(messages) != 1 || messages[0].Embeds[0].Title != channelEventTitles[bot.EventMessageHandled] {
+		t.Errorf("Expected only the configured events to be posted, got %v", messages)
+	}
+
+	if _, err := NewChannelSubscriber(s, testAuditChannelID, []string{"command.exploded"}); err == nil {
+		t.Error("Expected unknown event types to be reported")
+	}
+}
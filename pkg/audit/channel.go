@@ -0,0 +1,199 @@
+package audit
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+// EventsDropped counts events not posted to the audit channel because Discord could not keep up
+var EventsDropped = expvar.NewInt("audit_events_dropped")
+
+// DefaultChannelEvents leaves out command.invoked, which is followed by the outcome of the command anyway,
+// and message.handled, which would post every message of every conversation
+var DefaultChannelEvents = []string{
+	string(bot.EventCommandRejected),
+	string(bot.EventCommandCompleted),
+	string(bot.EventCommandFailed),
+	string(bot.EventThreadCreated),
+}
+
+// channelQueueSize bounds the events waiting to be posted, e.g. while Discord rate limits the bot
+const channelQueueSize = 100
+
+const (
+	discordMaxEmbedFieldLength = 1024
+
+	channelEmbedColor         = 0x00bfff
+	channelEmbedColorRejected = 0xffa500
+	channelEmbedColorFailed   = 0xff0000
+)
+
+var channelEventTitles = map[bot.EventType]string{
+	bot.EventCommandInvoked:   "▶️ Command invoked",
+	bot.EventCommandRejected:  "🚫 Command rejected",
+	bot.EventCommandCompleted: "✅ Command completed",
+	bot.EventCommandFailed:    "❌ Command failed",
+	bot.EventThreadCreated:    "🧵 Thread created",
+	bot.EventMessageHandled:   "💬 Message answered",
+}
+
+// ChannelSubscriber posts events to a Discord channel. Events are posted in the background,
+// so a slow Discord API does not hold up the handlers
+type ChannelSubscriber struct {
+	session   session.Session
+	channelID string
+	events    map[bot.EventType]bool
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan bot.Event
+	done   chan struct{}
+}
+
+// NewChannelSubscriber creates a subscriber posting the events of the given types to the channel
+func NewChannelSubscriber(s session.Session, channelID string, events []string) (*ChannelSubscriber, error) {
+	if len(events) == 0 {
+		events = DefaultChannelEvents
+	}
+	types, err := parseEventTypes(events)
+	if err != nil {
+		return nil, err
+	}
+	c := &ChannelSubscriber{
+		session:   s,
+		channelID: channelID,
+		events:    types,
+		queue:     make(chan bot.Event, channelQueueSize),
+		done:      make(chan struct{}),
+	}
+	go c.run()
+	return c, nil
+}
+
+func (c *ChannelSubscriber) HandleEvent(event bot.Event) {
+	if !c.events[event.Type] {
+		return
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.queue <- event:
+	default:
+		EventsDropped.Add(1)
+		log.Printf("[Event: %s] Dropping audit event, the audit channel queue is full\n", event.Type)
+	}
+}
+
+// Close posts the events still queued and stops the subscriber
+func (c *ChannelSubscriber) Close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	close(c.queue)
+	c.mu.Unlock()
+
+	<-c.done
+}
+
+func (c *ChannelSubscriber) run() {
+	defer close(c.done)
+	for event := range c.queue {
+		_, err := c.session.ChannelMessageSendComplex(c.channelID, &discord.MessageSend{
+			Embeds: []*discord.MessageEmbed{channelEventEmbed(event)},
+			// The audit log must not ping the users it mentions
+			AllowedMentions: &discord.MessageAllowedMentions{},
+		})
+		if err != nil {
+			log.Printf("[CHID: %s] Failed to post audit event %s with the error: %v\n", c.channelID, event.Type, err)
+		}
+	}
+}
+
+// channelEventEmbed describes the event, e.g. "@user used `/chat gpt` in #general"
+func channelEventEmbed(event bot.Event) *discord.MessageEmbed {
+	var description strings.Builder
+	if event.UserID != "" {
+		fmt.Fprintf(&description, "<@%s> ", event.UserID)
+	}
+	switch {
+	case event.Type == bot.EventMessageHandled:
+		description.WriteString("sent a message")
+	case event.Command != "":
+		fmt.Fprintf(&description, "used `/%s`", event.Command)
+	}
+	if event.ChannelID != "" {
+		fmt.Fprintf(&description, " in <#%s>", event.ChannelID)
+	}
+	if event.ThreadID != "" {
+		fmt.Fprintf(&description, ", thread <#%s>", event.ThreadID)
+	}
+
+	color := channelEmbedColor
+	switch event.Type {
+	case bot.EventCommandRejected:
+		color = channelEmbedColorRejected
+	case bot.EventCommandFailed:
+		color = channelEmbedColorFailed
+	}
+	if event.Error != "" {
+		color = channelEmbedColorFailed
+	}
+
+	var fields []*discord.MessageEmbedField
+	addField := func(name, value string, inline bool) {
+		if value == "" {
+			return
+		}
+		fields = append(fields, &discord.MessageEmbedField{
+			Name:   name,
+			Value:  truncateField(value),
+			Inline: inline,
+		})
+	}
+	addField("Model", event.Model, true)
+	if event.Duration > 0 {
+		addField("Duration", event.Duration.Round(time.Millisecond).String(), true)
+	}
+	addField("Prompt", event.Prompt, false)
+	addField("Reason", event.Reason, false)
+	addField("Error", event.Error, false)
+
+	title, ok := channelEventTitles[event.Type]
+	if !ok {
+		title = string(event.Type)
+	}
+	embed := &discord.MessageEmbed{
+		Title:       title,
+		Description: strings.TrimSpace(description.String()),
+		Color:       color,
+		Fields:      fields,
+	}
+	if !event.Time.IsZero() {
+		embed.Timestamp = event.Time.Format(time.RFC3339)
+	}
+	return embed
+}
+
+// truncateField keeps values within the length Discord allows for embed fields
+func truncateField(value string) string {
+	runes := []rune(value)
+	if len(runes) <= discordMaxEmbedFieldLength {
+		return value
+	}
+	return string(runes[:discordMaxEmbedFieldLength-1]) + "…"
+}
@@ -3,17 +3,28 @@
 package bot
 
 import (
+	"context"
+	"expvar"
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	discord "github.com/bwmarrin/discordgo"
 )
 
 type Bot struct {
+	// Session is the first shard, it also serves the REST requests of the bot
 	*discord.Session
 	Router *Router
+
+	mu sync.Mutex
+	// Shards are the gateway sessions of the bot, all of them share the router
+	Shards []*Shard
+	// commandsSynced is set once the commands of all scopes are registered
+	commandsSynced bool
 }
 
 func NewBot(token string) (*Bot, error) {
@@ -27,33 +38,80 @@ func NewBot(token string) (*Bot, error) {
 	}, nil
 }
 
-func (b *Bot) Run(guildID string, removeCommands bool) {
+// RunOptions configures how the bot registers its commands
+type RunOptions struct {
+	// Scopes the commands are synced to
+	Scopes []Scope
+	// RemoveCommands deletes the commands of the scopes when the bot stops
+	RemoveCommands bool
+	// DryRun logs the command sync plan and stops the bot without changing any commands
+	DryRun bool
+	// ShutdownGracePeriod is how long in-flight handlers may take to finish when the bot stops
+	ShutdownGracePeriod time.Duration
+	// Shards selects the gateway shards the bot runs
+	Shards ShardOptions
+}
+
+func (b *Bot) Run(options RunOptions) {
 	b.Identify.Intents = discord.MakeIntent(discord.IntentsAllWithoutPrivileged | discord.IntentMessageContent)
 
-	b.AddHandler(func(s *discord.Session, r *discord.Ready) {
-		log.Printf("Logged in as: %v#%v", s.State.User.Username, s.State.User.Discriminator)
-	})
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// Handlers are only cancelled when they do not finish within the grace period of the shutdown
+	b.Router.SetContext(context.Background())
 
-	b.AddHandler(b.Router.HandleInteraction)
-	b.AddHandler(b.Router.HandleMessage)
+	if expvar.Get("shards") == nil {
+		expvar.Publish("shards", expvar.Func(func() any {
+			return b.ShardStatuses()
+		}))
+	}
 
-	err := b.Open()
+	err := b.openShards(options.Shards)
 	if err != nil {
 		log.Fatalf("Cannot open the session : %v", err)
 	}
 
-	err = b.Router.Sync(b.Session, guildID)
+	defer b.closeShards()
+
+	plan, err := b.Router.SyncScopes(b.Session, options.Scopes, options.DryRun)
+	if plan != nil {
+		log.Println(plan)
+	}
 	if err != nil {
-		panic(err)
+		// Commands that were synced keep working, so the bot keeps running
+		log.Printf("Failed to sync commands: %v", err)
+	} else if !options.DryRun {
+		b.mu.Lock()
+		b.commandsSynced = true
+		b.mu.Unlock()
+	}
+	if options.DryRun {
+		log.Println("Dry run, no commands were changed")
+		return
 	}
 
-	defer b.Close()
+	<-ctx.Done()
+	// A second signal kills the bot without waiting for the handlers
+	stop()
+	log.Printf("Shutting down, waiting up to %v for in-flight handlers...", options.ShutdownGracePeriod)
+	b.Router.Shutdown(options.ShutdownGracePeriod)
 
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
-	<-stop
-	if removeCommands {
+	if options.RemoveCommands {
 		log.Println("Removing commands...")
-		b.Router.ClearCommands(b.Session, guildID)
+		if err := b.Router.ClearCommands(b.Session); err != nil {
+			log.Printf("Failed to remove commands: %v", err)
+		}
 	}
 }
+
+// CommandsSynced reports whether the commands of all scopes were registered when the bot started
+func (b *Bot) CommandsSynced() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.commandsSynced
+}
+
+// ShuttingDown reports whether the bot stopped accepting new interactions and messages
+func (b *Bot) ShuttingDown() bool {
+	return b.Router.isDraining()
+}
@@ -2,6 +2,10 @@
 package bot
 
 import (
+	"slices"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session"
 	discord "github.com/bwmarrin/discordgo"
 )
 
@@ -21,6 +25,40 @@ type MessageHandlerFunc func(ctx *MessageContext)
 
 func (f MessageHandlerFunc) HandleMessageCommand(ctx *MessageContext) { f(ctx) }
 
+// MessageQueue takes the messages sent in a channel while the message handler of its command answers it.
+// With a dispatcher, they would otherwise wait for the running handler before reaching the command
+type MessageQueue interface {
+	// Answering reports whether the command answers the channel of m and would queue m
+	Answering(s session.Session, m *discord.Message) bool
+	// Enqueue queues the message of ctx behind the running answer. It returns false if the answer
+	// finished meanwhile, the message is then dispatched as usual
+	Enqueue(ctx *MessageContext) bool
+}
+
+type ComponentHandler interface {
+	HandleComponent(ctx *ComponentContext)
+}
+
+type ComponentHandlerFunc func(ctx *ComponentContext)
+
+func (f ComponentHandlerFunc) HandleComponent(ctx *ComponentContext) { f(ctx) }
+
+type ModalHandler interface {
+	HandleModal(ctx *ModalContext)
+}
+
+type ModalHandlerFunc func(ctx *ModalContext)
+
+func (f ModalHandlerFunc) HandleModal(ctx *ModalContext) { f(ctx) }
+
+type AutocompleteHandler interface {
+	HandleAutocomplete(ctx *AutocompleteContext)
+}
+
+type AutocompleteHandlerFunc func(ctx *AutocompleteContext)
+
+func (f AutocompleteHandlerFunc) HandleAutocomplete(ctx *AutocompleteContext) { f(ctx) }
+
 type Command struct {
 	Name                     string
 	Description              string
@@ -32,6 +70,21 @@ type Command struct {
 	Middlewares              []Handler
 	MessageHandler           MessageHandler
 	SubCommands              *Router
+	// MessageQueue takes the messages sent while MessageHandler answers their channel. It runs
+	// after the message middlewares in the event goroutine, before the messages are dispatched
+	MessageQueue MessageQueue
+	// Schema declares options like Options, but their values are validated before the handlers run.
+	// They are registered after Options
+	Schema []*OptionSchema
+	// Components handle the message components (e.g. buttons) the command attaches to its messages
+	Components []*Component
+	// Modals handle the submissions of the modals the command opens
+	Modals []*Modal
+	// Autocomplete handlers suggest values for the option with the map key as name.
+	// Options with a handler are registered with autocompletion enabled
+	Autocomplete map[string]AutocompleteHandler
+	// Timeout overrides the default deadline of the command handler
+	Timeout time.Duration
 }
 
 func (cmd Command) ApplicationCommand() *discord.ApplicationCommand {
@@ -40,9 +93,17 @@ func (cmd Command) ApplicationCommand() *discord.ApplicationCommand {
 		Description:              cmd.Description,
 		DMPermission:             &cmd.DMPermission,
 		DefaultMemberPermissions: &cmd.DefaultMemberPermissions,
-		Options:                  cmd.Options,
+		Options:                  slices.Clip(cmd.Options),
 		Type:                     cmd.Type,
 	}
+	for _, option := range cmd.Schema {
+		applicationCommand.Options = append(applicationCommand.Options, option.ApplicationCommandOption())
+	}
+	for _, option := range applicationCommand.Options {
+		if _, ok := cmd.Autocomplete[option.Name]; ok {
+			option.Autocomplete = true
+		}
+	}
 	for _, subcommand := range cmd.SubCommands.List() {
 		applicationCommand.Options = append(applicationCommand.Options, subcommand.ApplicationCommandOption())
 	}
@@ -0,0 +1,99 @@
+// routing of message components and modal submissions by custom ID prefix
+
+package bot
+
+import (
+	"strings"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+// Catalog keys of the messages shown for components and modals the bot cannot handle
+const (
+	defaultComponentExpiredMessage = "component.expired"
+	defaultModalExpiredMessage     = "modal.expired"
+	unknownComponentMessage        = "component.unknown"
+)
+
+// Component handles message components (buttons, select menus) whose custom ID starts with Prefix
+type Component struct {
+	Prefix      string
+	Handler     ComponentHandler
+	Middlewares []ComponentHandler
+	// Expiry is how long custom IDs created with EncodeCustomID stay usable. Zero means they never expire
+	Expiry time.Duration
+	// ExpiredMessage is shown to the user of an expired component. Keys of the catalog are translated
+	ExpiredMessage string
+	// Timeout overrides the default deadline of the handler
+	Timeout time.Duration
+	// SkipMiddlewares exempts the component from the middlewares of the router, e.g. the rate limits of its command
+	SkipMiddlewares bool
+}
+
+func (c *Component) handlers() []ComponentHandler {
+	return append(append([]ComponentHandler{}, c.Middlewares...), c.Handler)
+}
+
+func (c *Component) expired(customID string) bool {
+	return isExpired(customID, c.Prefix, c.Expiry)
+}
+
+func (c *Component) expiredMessage(locale discord.Locale) string {
+	if c.ExpiredMessage != "" {
+		return i18n.Text(locale, c.ExpiredMessage)
+	}
+	return i18n.Text(locale, defaultComponentExpiredMessage)
+}
+
+// Modal handles submissions of modals whose custom ID starts with Prefix
+type Modal struct {
+	Prefix      string
+	Handler     ModalHandler
+	Middlewares []ModalHandler
+	// Expiry is how long custom IDs created with EncodeCustomID stay usable. Zero means they never expire
+	Expiry time.Duration
+	// ExpiredMessage is shown to the user submitting an expired modal. Keys of the catalog are translated
+	ExpiredMessage string
+	// Timeout overrides the default deadline of the handler
+	Timeout time.Duration
+	// SkipMiddlewares exempts the modal from the middlewares of the router, e.g. the rate limits of its command
+	SkipMiddlewares bool
+}
+
+func (m *Modal) handlers() []ModalHandler {
+	return append(append([]ModalHandler{}, m.Middlewares...), m.Handler)
+}
+
+func (m *Modal) expired(customID string) bool {
+	return isExpired(customID, m.Prefix, m.Expiry)
+}
+
+func (m *Modal) expiredMessage(locale discord.Locale) string {
+	if m.ExpiredMessage != "" {
+		return i18n.Text(locale, m.ExpiredMessage)
+	}
+	return i18n.Text(locale, defaultModalExpiredMessage)
+}
+
+// isExpired reports whether a custom ID created with EncodeCustomID is older than expiry.
+// Custom IDs without an issue time never expire
+func isExpired(customID string, prefix string, expiry time.Duration) bool {
+	if expiry <= 0 {
+		return false
+	}
+	issued, ok := customIDIssued(customID, prefix)
+	return ok && time.Since(issued) > expiry
+}
+
+// matchPrefix returns the index of the longest prefix customID starts with, or -1
+func matchPrefix(customID string, prefixes []string) int {
+	match := -1
+	for i, prefix := range prefixes {
+		if strings.HasPrefix(customID, prefix) && (match == -1 || len(prefix) > len(prefixes[match])) {
+			match = i
+		}
+	}
+	return match
+}
@@ -3,28 +3,86 @@
 package bot
 
 import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session"
 	discord "github.com/bwmarrin/discordgo"
 )
 
 type OptionsMap = map[string]*discord.ApplicationCommandInteractionDataOption
 
+// Context is passed to command handlers. It carries the deadline of the command,
+// so it can be passed directly to requests made on behalf of the interaction
 type Context struct {
-	*discord.Session
+	context.Context
+	session.Session
 	Caller      *Command
 	Interaction *discord.Interaction
 	Options     OptionsMap
 
+	path     string
 	handlers []Handler
 }
 
+// MessageContext is passed to message handlers and carries the deadline of the handler
 type MessageContext struct {
-	*discord.Session
+	context.Context
+	session.Session
 	Caller  *Command
 	Message *discord.Message
 
 	handlers []MessageHandler
 }
 
+// MaxAutocompleteChoices is the maximum number of choices Discord accepts for an autocomplete response
+const MaxAutocompleteChoices = 25
+
+// AutocompleteContext is passed to autocomplete handlers
+type AutocompleteContext struct {
+	context.Context
+	session.Session
+	Caller      *Command
+	Interaction *discord.Interaction
+	// Options holds the values the user entered so far
+	Options OptionsMap
+	// Focused is the option the user is typing in
+	Focused *discord.ApplicationCommandInteractionDataOption
+}
+
+// ComponentContext is passed to message component handlers
+type ComponentContext struct {
+	context.Context
+	session.Session
+	Caller      *Command
+	Interaction *discord.Interaction
+	// CustomID is the custom ID of the component that was used
+	CustomID string
+	// Prefix is the prefix of the component handler that matched CustomID
+	Prefix string
+	// Values holds the selected values of select menus
+	Values []string
+
+	handlers []ComponentHandler
+}
+
+// ModalContext is passed to modal submit handlers
+type ModalContext struct {
+	context.Context
+	session.Session
+	Caller      *Command
+	Interaction *discord.Interaction
+	// CustomID is the custom ID of the submitted modal
+	CustomID string
+	// Prefix is the prefix of the modal handler that matched CustomID
+	Prefix string
+	// Values holds the submitted text inputs by their custom ID
+	Values map[string]string
+
+	handlers []ModalHandler
+}
+
 func makeOptionMap(options []*discord.ApplicationCommandInteractionDataOption) (m OptionsMap) {
 	m = make(OptionsMap, len(options))
 
@@ -35,12 +93,13 @@ func makeOptionMap(options []*discord.ApplicationCommandInteractionDataOption) (
 	return
 }
 
-func NewContext(s *discord.Session, caller *Command, i *discord.Interaction, parent *discord.ApplicationCommandInteractionDataOption, handlers []Handler) *Context {
+func NewContext(ctx context.Context, s session.Session, caller *Command, i *discord.Interaction, parent *discord.ApplicationCommandInteractionDataOption, handlers []Handler) *Context {
 	options := i.ApplicationCommandData().Options
 	if parent != nil {
 		options = parent.Options
 	}
 	return &Context{
+		Context:     ctx,
 		Session:     s,
 		Caller:      caller,
 		Interaction: i,
@@ -54,6 +113,20 @@ func (ctx *Context) Respond(response *discord.InteractionResponse) error {
 	return ctx.Session.InteractionRespond(ctx.Interaction, response)
 }
 
+// Path returns the path of the invoked command, e.g. "chat gpt". Middlewares running for a component
+// or modal get the path of the command it belongs to, empty if it was registered on the router
+func (ctx *Context) Path() string {
+	if ctx.path == "" && ctx.Interaction.Type == discord.InteractionApplicationCommand {
+		return CommandPath(ctx.Interaction.ApplicationCommandData())
+	}
+	return ctx.path
+}
+
+// User returns the user who invoked the command, in guilds and in direct messages
+func (ctx *Context) User() *discord.User {
+	return InteractionUser(ctx.Interaction)
+}
+
 func (ctx *Context) Edit(content string) error {
 	_, err := ctx.Session.InteractionResponseEdit(ctx.Interaction, &discord.WebhookEdit{
 		Content: &content,
@@ -61,6 +134,20 @@ func (ctx *Context) Edit(content string) error {
 	return err
 }
 
+// TargetMessage returns the message a message context menu command was used on
+func (ctx *Context) TargetMessage() *discord.Message {
+	data := ctx.Interaction.ApplicationCommandData()
+	if data.Resolved == nil {
+		return nil
+	}
+	return data.Resolved.Messages[data.TargetID]
+}
+
+// OpenModal responds by opening a modal with the given text inputs
+func (ctx *Context) OpenModal(customID string, title string, inputs ...discord.TextInput) error {
+	return openModal(ctx.Session, ctx.Interaction, customID, title, inputs)
+}
+
 func (ctx *Context) Response() (*discord.Message, error) {
 	return ctx.Session.InteractionResponse(ctx.Interaction)
 }
@@ -78,8 +165,9 @@ func (ctx *Context) Next() {
 
 ///
 
-func NewMessageContext(s *discord.Session, caller *Command, m *discord.Message, handlers []MessageHandler) *MessageContext {
+func NewMessageContext(ctx context.Context, s session.Session, caller *Command, m *discord.Message, handlers []MessageHandler) *MessageContext {
 	return &MessageContext{
+		Context: ctx,
 		Session: s,
 		Caller:  caller,
 		Message: m,
@@ -127,3 +215,213 @@ func (ctx *MessageContext) RemoveReaction(emojiID string) error {
 func (ctx *MessageContext) ChannelTyping() error {
 	return ctx.Session.ChannelTyping(ctx.Message.ChannelID)
 }
+
+///
+
+func NewComponentContext(ctx context.Context, s session.Session, caller *Command, i *discord.Interaction, prefix string, handlers []ComponentHandler) *ComponentContext {
+	data := i.MessageComponentData()
+	return &ComponentContext{
+		Context:     ctx,
+		Session:     s,
+		Caller:      caller,
+		Interaction: i,
+		CustomID:    data.CustomID,
+		Prefix:      prefix,
+		Values:      data.Values,
+
+		handlers: handlers,
+	}
+}
+
+func (ctx *ComponentContext) Next() {
+	if len(ctx.handlers) == 0 {
+		return
+	}
+
+	handler := ctx.handlers[0]
+	ctx.handlers = ctx.handlers[1:]
+	handler.HandleComponent(ctx)
+}
+
+// Payload returns the part of the custom ID that follows the handler prefix
+func (ctx *ComponentContext) Payload() string {
+	return strings.TrimPrefix(ctx.CustomID, ctx.Prefix)
+}
+
+// Decode decodes the payload of a custom ID created with EncodeCustomID into payload
+func (ctx *ComponentContext) Decode(payload any) error {
+	_, err := DecodeCustomID(ctx.CustomID, ctx.Prefix, payload)
+	return err
+}
+
+// User returns the user that used the component, both in guilds and in DMs
+func (ctx *ComponentContext) User() *discord.User {
+	return InteractionUser(ctx.Interaction)
+}
+
+func (ctx *ComponentContext) Respond(response *discord.InteractionResponse) error {
+	return ctx.Session.InteractionRespond(ctx.Interaction, response)
+}
+
+// RespondEphemeral responds with a message only visible to the user that used the component
+func (ctx *ComponentContext) RespondEphemeral(content string) error {
+	return respondEphemeral(ctx.Session, ctx.Interaction, content)
+}
+
+// Acknowledge acknowledges the interaction without changing the message the component is attached to
+func (ctx *ComponentContext) Acknowledge() error {
+	return ctx.Respond(&discord.InteractionResponse{
+		Type: discord.InteractionResponseDeferredMessageUpdate,
+	})
+}
+
+// OpenModal responds by opening a modal with the given text inputs
+func (ctx *ComponentContext) OpenModal(customID string, title string, inputs ...discord.TextInput) error {
+	return openModal(ctx.Session, ctx.Interaction, customID, title, inputs)
+}
+
+///
+
+func NewModalContext(ctx context.Context, s session.Session, caller *Command, i *discord.Interaction, prefix string, handlers []ModalHandler) *ModalContext {
+	data := i.ModalSubmitData()
+	return &ModalContext{
+		Context:     ctx,
+		Session:     s,
+		Caller:      caller,
+		Interaction: i,
+		CustomID:    data.CustomID,
+		Prefix:      prefix,
+		Values:      modalValues(data.Components),
+
+		handlers: handlers,
+	}
+}
+
+func (ctx *ModalContext) Next() {
+	if len(ctx.handlers) == 0 {
+		return
+	}
+
+	handler := ctx.handlers[0]
+	ctx.handlers = ctx.handlers[1:]
+	handler.HandleModal(ctx)
+}
+
+// Payload returns the part of the custom ID that follows the handler prefix
+func (ctx *ModalContext) Payload() string {
+	return strings.TrimPrefix(ctx.CustomID, ctx.Prefix)
+}
+
+// Decode decodes the payload of a custom ID created with EncodeCustomID into payload
+func (ctx *ModalContext) Decode(payload any) error {
+	_, err := DecodeCustomID(ctx.CustomID, ctx.Prefix, payload)
+	return err
+}
+
+// User returns the user that submitted the modal, both in guilds and in DMs
+func (ctx *ModalContext) User() *discord.User {
+	return InteractionUser(ctx.Interaction)
+}
+
+func (ctx *ModalContext) Respond(response *discord.InteractionResponse) error {
+	return ctx.Session.InteractionRespond(ctx.Interaction, response)
+}
+
+// RespondEphemeral responds with a message only visible to the user that submitted the modal
+func (ctx *ModalContext) RespondEphemeral(content string) error {
+	return respondEphemeral(ctx.Session, ctx.Interaction, content)
+}
+
+// modalValues collects the text inputs of a submitted modal by their custom ID
+func modalValues(components []discord.MessageComponent) map[string]string {
+	values := make(map[string]string)
+	for _, component := range components {
+		switch c := component.(type) {
+		case *discord.ActionsRow:
+			for id, value := range modalValues(c.Components) {
+				values[id] = value
+			}
+		case *discord.TextInput:
+			values[c.CustomID] = c.Value
+		}
+	}
+	return values
+}
+
+// InteractionUser returns the user of the interaction. Interactions in direct messages have no member
+func InteractionUser(i *discord.Interaction) *discord.User {
+	if i.Member != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+func respondEphemeral(s session.Session, i *discord.Interaction, content string) error {
+	return s.InteractionRespond(i, &discord.InteractionResponse{
+		Type: discord.InteractionResponseChannelMessageWithSource,
+		Data: &discord.InteractionResponseData{
+			Content: content,
+			Flags:   discord.MessageFlagsEphemeral,
+		},
+	})
+}
+
+func openModal(s session.Session, i *discord.Interaction, customID string, title string, inputs []discord.TextInput) error {
+	rows := make([]discord.MessageComponent, 0, len(inputs))
+	for _, input := range inputs {
+		rows = append(rows, discord.ActionsRow{
+			Components: []discord.MessageComponent{input},
+		})
+	}
+	return s.InteractionRespond(i, &discord.InteractionResponse{
+		Type: discord.InteractionResponseModal,
+		Data: &discord.InteractionResponseData{
+			CustomID:   customID,
+			Title:      title,
+			Components: rows,
+		},
+	})
+}
+
+///
+
+func NewAutocompleteContext(ctx context.Context, s session.Session, caller *Command, i *discord.Interaction, options []*discord.ApplicationCommandInteractionDataOption) *AutocompleteContext {
+	autocompleteCtx := &AutocompleteContext{
+		Context:     ctx,
+		Session:     s,
+		Caller:      caller,
+		Interaction: i,
+		Options:     makeOptionMap(options),
+	}
+	for _, option := range options {
+		if option.Focused {
+			autocompleteCtx.Focused = option
+			break
+		}
+	}
+	return autocompleteCtx
+}
+
+// Value returns the partial input of the focused option
+func (ctx *AutocompleteContext) Value() string {
+	if ctx.Focused == nil || ctx.Focused.Value == nil {
+		return ""
+	}
+	if value, ok := ctx.Focused.Value.(string); ok {
+		return value
+	}
+	return fmt.Sprint(ctx.Focused.Value)
+}
+
+// Respond sends the choices to the user. Only the first MaxAutocompleteChoices choices are sent
+func (ctx *AutocompleteContext) Respond(choices []*discord.ApplicationCommandOptionChoice) error {
+	if len(choices) > MaxAutocompleteChoices {
+		choices = choices[:MaxAutocompleteChoices]
+	}
+	return ctx.Session.InteractionRespond(ctx.Interaction, &discord.InteractionResponse{
+		Type: discord.InteractionApplicationCommandAutocompleteResult,
+		Data: &discord.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+}
@@ -0,0 +1,93 @@
+// encoding of typed payloads into the custom IDs of components and modals
+
+package bot
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxCustomIDLength is the maximum length of a component or modal custom ID accepted by Discord
+const MaxCustomIDLength = 100
+
+// customIDSeparator separates the issue time from the payload
+const customIDSeparator = "."
+
+var (
+	ErrCustomIDTooLong = errors.New("custom ID exceeds 100 characters")
+	ErrCustomIDInvalid = errors.New("custom ID is not encoded with a payload")
+)
+
+// EncodeCustomID encodes payload into a custom ID routed by prefix. The custom ID
+// also records when it was issued, so components can expire. The format is
+// <prefix><issued, base36 unix seconds>.<payload, base64url JSON>
+func EncodeCustomID(prefix string, payload any) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode custom ID payload: %w", err)
+	}
+	customID := prefix + strconv.FormatInt(time.Now().Unix(), 36) + customIDSeparator + base64.RawURLEncoding.EncodeToString(data)
+	if len(customID) > MaxCustomIDLength {
+		return "", ErrCustomIDTooLong
+	}
+	return customID, nil
+}
+
+// DecodeCustomID decodes the payload of a custom ID created by EncodeCustomID with the same prefix
+func DecodeCustomID(customID string, prefix string, payload any) (issued time.Time, err error) {
+	issued, data, err := splitCustomID(customID, prefix)
+	if err != nil {
+		return time.Time{}, err
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return time.Time{}, ErrCustomIDInvalid
+	}
+	if err := json.Unmarshal(raw, payload); err != nil {
+		return time.Time{}, fmt.Errorf("failed to decode custom ID payload: %w", err)
+	}
+	return issued, nil
+}
+
+// customIDIssued returns when a custom ID created by EncodeCustomID was issued
+func customIDIssued(customID string, prefix string) (time.Time, bool) {
+	issued, _, err := splitCustomID(customID, prefix)
+	return issued, err == nil
+}
+
+func splitCustomID(customID string, prefix string) (time.Time, string, error) {
+	rest, ok := strings.CutPrefix(customID, prefix)
+	if !ok {
+		return time.Time{}, "", ErrCustomIDInvalid
+	}
+	timestamp, data, ok := strings.Cut(rest, customIDSeparator)
+	if !ok {
+		return time.Time{}, "", ErrCustomIDInvalid
+	}
+	seconds, err := strconv.ParseInt(timestamp, 36, 64)
+	if err != nil {
+		return time.Time{}, "", ErrCustomIDInvalid
+	}
+	return time.Unix(seconds, 0), data, nil
+}
+
+// CustomID encodes payloads of type T into the custom IDs of the component or modal routed by Prefix
+type CustomID[T any] struct {
+	Prefix string
+}
+
+// Encode returns a custom ID carrying payload
+func (c CustomID[T]) Encode(payload T) (string, error) {
+	return EncodeCustomID(c.Prefix, payload)
+}
+
+// Decode returns the payload carried by customID
+func (c CustomID[T]) Decode(customID string) (payload T, err error) {
+	_, err = DecodeCustomID(customID, c.Prefix, &payload)
+	return payload, err
+}
@@ -0,0 +1,177 @@
+// bounded worker pool handling messages in order per channel
+
+package bot
+
+import (
+	"errors"
+	"expvar"
+	"log"
+	"runtime/debug"
+	"sync"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+var (
+	// ErrQueueFull is returned by Dispatcher.Submit when the queue of the channel or the dispatcher is full
+	ErrQueueFull = errors.New("message queue is full")
+	// ErrDispatcherClosed is returned by Dispatcher.Submit after Close
+	ErrDispatcherClosed = errors.New("dispatcher is closed")
+)
+
+// MessagesDropped counts the messages that were not handled because the queue was full
+var MessagesDropped = expvar.NewInt("messages_dropped")
+
+// busyResendMessage is the catalog key of the reply to messages that could not be queued
+const busyResendMessage = "bot.busy_resend"
+
+// DispatcherOptions configures the size of the worker pool and its queues
+type DispatcherOptions struct {
+	// Workers is the number of jobs running at the same time
+	Workers int
+	// ChannelQueueSize is how many jobs of a channel may wait while one of them is running
+	ChannelQueueSize int
+	// QueueSize is how many jobs of all channels may wait for a worker
+	QueueSize int
+}
+
+// Dispatcher runs jobs on a bounded pool of workers. Jobs submitted with the same key,
+// e.g. the messages of a thread, run one after another in the order they were submitted
+type Dispatcher struct {
+	options DispatcherOptions
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queues map[string]*dispatchQueue
+	// ready are the keys with waiting jobs and no running job, in the order they are picked up
+	ready  []string
+	queued int
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type dispatchQueue struct {
+	jobs    []func()
+	running bool
+}
+
+// NewDispatcher starts the workers of the dispatcher. Options that are not positive default to 1
+func NewDispatcher(options DispatcherOptions) *Dispatcher {
+	options.Workers = max(1, options.Workers)
+	options.ChannelQueueSize = max(1, options.ChannelQueueSize)
+	options.QueueSize = max(1, options.QueueSize)
+
+	d := &Dispatcher{
+		options: options,
+		queues:  make(map[string]*dispatchQueue),
+	}
+	d.cond = sync.NewCond(&d.mu)
+	d.wg.Add(options.Workers)
+	for range options.Workers {
+		go d.work()
+	}
+	return d
+}
+
+// Submit queues job behind the other jobs of key. Instead of blocking when the queue of key
+// or the dispatcher is full, ErrQueueFull is returned, so the caller can tell the user to retry
+func (d *Dispatcher) Submit(key string, job func()) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrDispatcherClosed
+	}
+	queue, ok := d.queues[key]
+	if !ok {
+		queue = &dispatchQueue{}
+		d.queues[key] = queue
+	}
+	if len(queue.jobs) >= d.options.ChannelQueueSize || d.queued >= d.options.QueueSize {
+		return ErrQueueFull
+	}
+
+	queue.jobs = append(queue.jobs, job)
+	d.queued++
+	// Keys with a running job are scheduled again once it finishes
+	if !queue.running && len(queue.jobs) == 1 {
+		d.ready = append(d.ready, key)
+		d.cond.Signal()
+	}
+	return nil
+}
+
+// Len returns the number of jobs waiting for a worker
+func (d *Dispatcher) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.queued
+}
+
+// Close stops accepting jobs and waits until the queued jobs ran
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	d.closed = true
+	d.cond.Broadcast()
+	d.mu.Unlock()
+
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for {
+		for len(d.ready) == 0 && !d.closed {
+			d.cond.Wait()
+		}
+		if len(d.ready) == 0 {
+			return
+		}
+
+		key := d.ready[0]
+		d.ready = d.ready[1:]
+		queue := d.queues[key]
+		job := queue.jobs[0]
+		queue.jobs = queue.jobs[1:]
+		queue.running = true
+		d.queued--
+
+		d.mu.Unlock()
+		runJob(job)
+		d.mu.Lock()
+
+		queue.running = false
+		if len(queue.jobs) > 0 {
+			// Other keys waiting longer go first
+			d.ready = append(d.ready, key)
+			d.cond.Signal()
+		} else {
+			delete(d.queues, key)
+		}
+	}
+}
+
+// runJob keeps the worker alive when a job panics outside of the recovery of the router
+func runJob(job func()) {
+	defer func() {
+		if value := recover(); value != nil {
+			log.Printf("[Handler: dispatcher] Recovered from panic: %v\n%s", value, debug.Stack())
+		}
+	}()
+	job()
+}
+
+// rejectBusyMessage asks the user to resend a message in a thread of the bot that could not be queued
+func rejectBusyMessage(s session.Session, m *discord.Message) {
+	if !isBotThreadMessage(s, m) {
+		return
+	}
+	if _, err := s.ChannelMessageSendReply(m.ChannelID, i18n.Text(MessageLocale(s, m), busyResendMessage), m.Reference()); err != nil {
+		log.Printf("[GID: %s, CHID: %s, MID: %s] Failed to reply in the thread with the error: %v\n", m.GuildID, m.ChannelID, m.ID, err)
+	}
+}
@@ -0,0 +1,222 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session/sessiontest"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+func TestDispatcher_OrderPerChannel(t *testing.T) {
+	d := NewDispatcher(DispatcherOptions{Workers: 4, ChannelQueueSize: 100, QueueSize: 1000})
+
+	var mu sync.Mutex
+	handled := make(map[string][]int)
+	for i := range 50 {
+		for _, channel := range []string{"a", "b", "c"} {
+			err := d.Submit(channel, func() {
+				mu.Lock()
+				handled[channel] = append(handled[channel], i)
+				mu.Unlock()
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+		}
+	}
+	d.Close()
+
+	for channel, order := range handled {
+		if len(order) != 50 {
+			t.Fatalf("Expected 50 jobs of channel %s, got %d", channel, len(order))
+		}
+		for i, n := range order {
+			if n != i {
+				t.Fatalf("Expected the jobs of channel %s in order, got %v", channel, order)
+			}
+		}
+	}
+}
+
+func TestDispatcher_BoundedWorkers(t *testing.T) {
+	d := NewDispatcher(DispatcherOptions{Workers: 3, ChannelQueueSize: 10, QueueSize: 100})
+
+	var running, peak atomic.Int32
+	for i := range 20 {
+		d.Submit(fmt.Sprintf("channel-%d", i), func() {
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			running.Add(-1)
+		})
+	}
+	d.Close()
+
+	if peak.Load() > 3 {
+		t.Errorf("Expected at most 3 jobs at the same time, got %d", peak.Load())
+	}
+}
+
+func TestDispatcher_QueueFull(t *testing.T) {
+	d := NewDispatcher(DispatcherOptions{Workers: 1, ChannelQueueSize: 2, QueueSize: 3})
+	release := make(chan struct{})
+	started := make(chan struct{})
+	d.Submit("a", func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	for range 2 {
+		if err := d.Submit("a", func() {}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	if err := d.Submit("a", func() {}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected the channel queue to be full, got %v", err)
+	}
+	if err := d.Submit("b", func() {}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := d.Submit("c", func() {}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected the dispatcher queue to be full, got %v", err)
+	}
+	if d.Len() != 3 {
+		t.Errorf("Expected 3 queued jobs, got %d", d.Len())
+	}
+
+	close(release)
+	d.Close()
+	if err := d.Submit("a", func() {}); !errors.Is(err, ErrDispatcherClosed) {
+		t.Errorf("Expected the dispatcher to be closed, got %v", err)
+	}
+}
+
+func TestDispatcher_RecoversPanics(t *testing.T) {
+	d := NewDispatcher(DispatcherOptions{Workers: 1, ChannelQueueSize: 10, QueueSize: 10})
+	handled := false
+	d.Submit("a", func() { panic("boom") })
+	d.Submit("a", func() { handled = true })
+	d.Close()
+
+	if !handled {
+		t.Error("Expected the worker to keep running after a panic")
+	}
+}
+
+func TestRouter_HandleMessageWithDispatcher(t *testing.T) {
+	s := &discord.Session{State: discord.NewState()}
+	s.State.User = &discord.User{ID: "bot"}
+
+	var mu sync.Mutex
+	var handled []string
+	r := NewRouter([]*Command{{
+		Name: "chat",
+		MessageHandler: MessageHandlerFunc(func(ctx *MessageContext) {
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			handled = append(handled, ctx.Message.ID)
+			mu.Unlock()
+		}),
+	}})
+	r.SetContext(context.Background())
+	r.Dispatcher = NewDispatcher(DispatcherOptions{Workers: 4, ChannelQueueSize: 100, QueueSize: 100})
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.HandleMessage(s, &discord.MessageCreate{Message: &discord.Message{ID: fmt.Sprint(i), ChannelID: fmt.Sprint(i % 2)}})
+		}()
+	}
+	wg.Wait()
+
+	r.Dispatcher.Close()
+	if len(handled) != 10 {
+		t.Errorf("Expected 10 handled messages, got %d", len(handled))
+	}
+}
+
+// fakeMessageQueue queues the messages of the channel it answers
+type fakeMessageQueue struct {
+	channelID string
+	// finished makes Enqueue fail, as if the answer finished after Answering
+	finished bool
+	queued   []string
+}
+
+func (q *fakeMessageQueue) Answering(s session.Session, m *discord.Message) bool {
+	return m.ChannelID == q.channelID
+}
+
+func (q *fakeMessageQueue) Enqueue(ctx *MessageContext) bool {
+	if q.finished {
+		return false
+	}
+	q.queued = append(q.queued, ctx.Message.ID)
+	return true
+}
+
+func TestRouter_QueueMessage(t *testing.T) {
+	queue := &fakeMessageQueue{channelID: "thread"}
+	var mu sync.Mutex
+	var handled, limited []string
+	r := NewRouter([]*Command{{
+		Name: "chat",
+		SubCommands: NewRouter([]*Command{{
+			Name:         "gpt",
+			MessageQueue: queue,
+			MessageHandler: MessageHandlerFunc(func(ctx *MessageContext) {
+				mu.Lock()
+				defer mu.Unlock()
+				handled = append(handled, ctx.Message.ID)
+			}),
+		}}),
+	}})
+	r.UseMessage(MessageHandlerFunc(func(ctx *MessageContext) {
+		mu.Lock()
+		limited = append(limited, ctx.Message.ID)
+		mu.Unlock()
+		if ctx.Message.Content != "spam" {
+			ctx.Next()
+		}
+	}))
+	r.Dispatcher = NewDispatcher(DispatcherOptions{Workers: 1, ChannelQueueSize: 10, QueueSize: 10})
+	s := sessiontest.NewFake("bot", "guild", "channel")
+	serve := func(id, channelID, content string) {
+		r.ServeMessage(s, &discord.MessageCreate{Message: &discord.Message{ID: id, ChannelID: channelID, Content: content}})
+	}
+
+	serve("1", "thread", "hello")
+	serve("2", "thread", "spam")
+	serve("3", "channel", "hello")
+	queue.finished = true
+	serve("4", "thread", "hello")
+	r.Dispatcher.Close()
+
+	if fmt.Sprint(queue.queued) != "[1]" {
+		t.Errorf("Expected the message of the answered thread to be queued, got %v", queue.queued)
+	}
+	if fmt.Sprint(handled) != "[3 4]" {
+		t.Errorf("Expected only the messages that were not queued to be dispatched, got %v", handled)
+	}
+	// The middlewares run once for queued and stopped messages, the late message passes them again on dispatch
+	slices.Sort(limited)
+	if fmt.Sprint(limited) != "[1 2 3 4 4]" {
+		t.Errorf("Expected the middlewares to run before queueing, got %v", limited)
+	}
+}
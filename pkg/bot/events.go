@@ -0,0 +1,268 @@
+// lifecycle events of commands and messages for auditing
+
+package bot
+
+import (
+	"context"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	discord "github.com/bwmarrin/discordgo"
+)
+
+// EventType names a step in the lifecycle of a command or message
+type EventType string
+
+const (
+	// EventCommandInvoked is emitted before the middlewares of a command run
+	EventCommandInvoked EventType = "command.invoked"
+	// EventCommandRejected is emitted when invalid options or a middleware stopped the command
+	EventCommandRejected EventType = "command.rejected"
+	// EventCommandCompleted is emitted when the handler of a command returned
+	EventCommandCompleted EventType = "command.completed"
+	// EventCommandFailed is emitted when the handler of a command panicked, timed out or reported an error
+	EventCommandFailed EventType = "command.failed"
+	// EventThreadCreated is emitted by handlers starting a thread
+	EventThreadCreated EventType = "thread.created"
+	// EventMessageHandled is emitted by message handlers answering a message
+	EventMessageHandled EventType = "message.handled"
+)
+
+// EventTypes are all types of events, in the order of the lifecycle
+var EventTypes = []EventType{
+	EventCommandInvoked,
+	EventCommandRejected,
+	EventCommandCompleted,
+	EventCommandFailed,
+	EventThreadCreated,
+	EventMessageHandled,
+}
+
+// maxEventPromptLength keeps prompts with huge contexts from flooding the subscribers
+const maxEventPromptLength = 1000
+
+// Event describes a step in the lifecycle of a command or message
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Command is the command path, e.g. "chat gpt", or the command whose handler emitted the event
+	Command       string
+	GuildID       string
+	ChannelID     string
+	UserID        string
+	InteractionID string
+	MessageID     string
+	// ThreadID is the thread a thread.created event is about
+	ThreadID string
+	// Model and Prompt are what the user asked for, as recorded by the handler
+	Model  string
+	Prompt string
+	// Reason tells why the command was rejected
+	Reason string
+	// Error tells why the command or message failed
+	Error string
+	// Duration is how long the handler ran, for command.completed, command.failed and message.handled
+	Duration time.Duration
+}
+
+// Subscriber receives the lifecycle events of the router. Events are delivered in the goroutine
+// of the handler, so subscribers doing I/O should hand them off instead of blocking it
+type Subscriber interface {
+	HandleEvent(event Event)
+}
+
+// SubscriberFunc adapts a function to a Subscriber
+type SubscriberFunc func(event Event)
+
+func (f SubscriberFunc) HandleEvent(event Event) {
+	f(event)
+}
+
+// Subscribe delivers the lifecycle events of commands and messages to the subscribers
+func (r *Router) Subscribe(subscribers ...Subscriber) {
+	r.subscribersMu.Lock()
+	defer r.subscribersMu.Unlock()
+	r.subscribers = append(r.subscribers, subscribers...)
+}
+
+func (r *Router) emit(event Event) {
+	r.subscribersMu.RLock()
+	subscribers := r.subscribers
+	r.subscribersMu.RUnlock()
+	if len(subscribers) == 0 {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	event.Prompt = truncatePrompt(event.Prompt)
+	for _, subscriber := range subscribers {
+		notify(subscriber, event)
+	}
+}
+
+// notify delivers the event, a panicking subscriber must not fail the handler
+func notify(subscriber Subscriber, event Event) {
+	defer func() {
+		if value := recover(); value != nil {
+			log.Printf("[Event: %s] Recovered from panic in event subscriber: %v\n", event.Type, value)
+		}
+	}()
+	subscriber.HandleEvent(event)
+}
+
+// Emit delivers the event to the subscribers of the router the handler of ctx belongs to.
+// Fields left empty are filled in from the handler, e.g. its command, guild, channel and user
+func Emit(ctx context.Context, event Event) {
+	inv := invocationFrom(ctx)
+	if inv == nil {
+		return
+	}
+	inv.mu.Lock()
+	base := inv.event
+	inv.mu.Unlock()
+	inv.router.emit(event.withDefaults(base))
+}
+
+// SetEventModel records the model and prompt the handler of ctx works with, so the events of the command tell them
+func SetEventModel(ctx context.Context, model, prompt string) {
+	inv := invocationFrom(ctx)
+	if inv == nil {
+		return
+	}
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.event.Model = model
+	inv.event.Prompt = prompt
+}
+
+// SetEventReason records why a middleware stopped the command of ctx
+func SetEventReason(ctx context.Context, reason string) {
+	inv := invocationFrom(ctx)
+	if inv == nil {
+		return
+	}
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.event.Reason = reason
+}
+
+// SetEventError records the error the handler of ctx failed with, the command is then reported as failed
+// even though the handler told the user about it and returned normally
+func SetEventError(ctx context.Context, err error) {
+	inv := invocationFrom(ctx)
+	if inv == nil || err == nil {
+		return
+	}
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.event.Error = err.Error()
+}
+
+// truncatePrompt shortens the prompt to at most maxEventPromptLength bytes without breaking UTF-8 characters
+func truncatePrompt(prompt string) string {
+	if len(prompt) <= maxEventPromptLength {
+		return prompt
+	}
+	cut := maxEventPromptLength - len("…")
+	for cut > 0 && !utf8.RuneStart(prompt[cut]) {
+		cut--
+	}
+	return prompt[:cut] + "…"
+}
+
+// withDefaults fills the empty fields of the event with the fields of base
+func (e Event) withDefaults(base Event) Event {
+	fill := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	fill(&e.Command, base.Command)
+	fill(&e.GuildID, base.GuildID)
+	fill(&e.ChannelID, base.ChannelID)
+	fill(&e.UserID, base.UserID)
+	fill(&e.InteractionID, base.InteractionID)
+	fill(&e.MessageID, base.MessageID)
+	fill(&e.Model, base.Model)
+	fill(&e.Prompt, base.Prompt)
+	return e
+}
+
+func interactionEvent(command string, i *discord.Interaction) Event {
+	event := Event{
+		Command:       command,
+		GuildID:       i.GuildID,
+		ChannelID:     i.ChannelID,
+		InteractionID: i.ID,
+	}
+	if user := InteractionUser(i); user != nil {
+		event.UserID = user.ID
+	}
+	return event
+}
+
+func messageEvent(command string, m *discord.Message) Event {
+	event := Event{
+		Command:   command,
+		GuildID:   m.GuildID,
+		ChannelID: m.ChannelID,
+		MessageID: m.ID,
+	}
+	if m.Author != nil {
+		event.UserID = m.Author.ID
+	}
+	return event
+}
+
+// commandEvents emits the lifecycle events of a command invocation
+type commandEvents struct {
+	router *Router
+	inv    *invocation
+	start  time.Time
+	// rejected is set when the options were invalid or a middleware did not call Next
+	rejected bool
+}
+
+func (r *Router) beginCommandEvents(ctx context.Context) *commandEvents {
+	events := &commandEvents{router: r, inv: invocationFrom(ctx), start: time.Now()}
+	events.emit(EventCommandInvoked, 0)
+	return events
+}
+
+func (e *commandEvents) emit(eventType EventType, duration time.Duration) {
+	e.inv.mu.Lock()
+	event := e.inv.event
+	e.inv.mu.Unlock()
+	event.Type = eventType
+	event.Duration = duration
+	if eventType != EventCommandFailed {
+		event.Error = ""
+	}
+	if eventType != EventCommandRejected {
+		event.Reason = ""
+	}
+	e.router.emit(event)
+}
+
+// end must be deferred before the panic recovery of the command, so it sees the recovered panic.
+// Commands that ran out of time or were cancelled by the shutdown fail with the cause
+func (e *commandEvents) end(ctx context.Context) {
+	e.inv.mu.Lock()
+	if err := context.Cause(ctx); err != nil && e.inv.event.Error == "" {
+		e.inv.event.Error = err.Error()
+	}
+	failed := e.inv.event.Error != ""
+	e.inv.mu.Unlock()
+
+	switch {
+	case failed:
+		e.emit(EventCommandFailed, time.Since(e.start))
+	case e.rejected:
+		e.emit(EventCommandRejected, time.Since(e.start))
+	default:
+		e.emit(EventCommandCompleted, time.Since(e.start))
+	}
+}
@@ -0,0 +1,175 @@
+package bot
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session/sessiontest"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+// eventRecorder collects the events of a router
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) HandleEvent(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) types() []EventType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	types := make([]EventType, len(r.events))
+	for i, event := range r.events {
+		types[i] = event.Type
+	}
+	return types
+}
+
+func (r *eventRecorder) last() Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.events[len(r.events)-1]
+}
+
+func eventsRouter(middleware Handler, handler Handler) (*Router, *eventRecorder) {
+	var middlewares []Handler
+	if middleware != nil {
+		middlewares = append(middlewares, middleware)
+	}
+	r := NewRouter([]*Command{{
+		Name:        "chat",
+		Middlewares: middlewares,
+		SubCommands: NewRouter([]*Command{{Name: "gpt", Handler: handler}}),
+	}})
+	recorder := &eventRecorder{}
+	r.Subscribe(recorder)
+	return r, recorder
+}
+
+func chatGPTInteraction() *discord.InteractionCreate {
+	return &discord.InteractionCreate{Interaction: &discord.Interaction{
+		ID:        "interaction",
+		Type:      discord.InteractionApplicationCommand,
+		GuildID:   "guild",
+		ChannelID: "channel",
+		Member:    &discord.Member{User: &discord.User{ID: "user"}},
+		Data: discord.ApplicationCommandInteractionData{
+			Name:    "chat",
+			Options: []*discord.ApplicationCommandInteractionDataOption{{Name: "gpt", Type: discord.ApplicationCommandOptionSubCommand}},
+		},
+	}}
+}
+
+func TestEvents_CommandCompleted(t *testing.T) {
+	r, recorder := eventsRouter(nil, HandlerFunc(func(ctx *Context) {
+		SetEventModel(ctx, "openai/gpt-4o", "Hello")
+		Emit(ctx, Event{Type: EventThreadCreated, ThreadID: "thread"})
+	}))
+	r.ServeInteraction(sessiontest.NewFake("bot", "guild", "channel"), chatGPTInteraction())
+
+	expected := []EventType{EventCommandInvoked, EventThreadCreated, EventCommandCompleted}
+	if types := recorder.types(); !slices.Equal(types, expected) {
+		t.Fatalf("Expected events %v, got %v", expected, types)
+	}
+	thread := recorder.events[1]
+	if thread.ThreadID != "thread" || thread.Command != "chat gpt" || thread.UserID != "user" || thread.Model != "openai/gpt-4o" {
+		t.Errorf("Expected the thread event to be filled in from the command, got %+v", thread)
+	}
+	completed := recorder.last()
+	if completed.Command != "chat gpt" || completed.GuildID != "guild" || completed.ChannelID != "channel" || completed.InteractionID != "interaction" {
+		t.Errorf("Expected the command to be described, got %+v", completed)
+	}
+	if completed.Model != "openai/gpt-4o" || completed.Prompt != "Hello" || completed.Time.IsZero() {
+		t.Errorf("Expected the model and prompt of the handler, got %+v", completed)
+	}
+}
+
+func TestEvents_CommandRejected(t *testing.T) {
+	handled := false
+	r, recorder := eventsRouter(HandlerFunc(func(ctx *Context) {
+		SetEventReason(ctx, "rate limited")
+	}), HandlerFunc(func(ctx *Context) {
+		handled = true
+	}))
+	r.ServeInteraction(sessiontest.NewFake("bot", "guild", "channel"), chatGPTInteraction())
+
+	if handled {
+		t.Error("Expected the middleware to stop the handler")
+	}
+	rejected := recorder.last()
+	if rejected.Type != EventCommandRejected || rejected.Reason != "rate limited" {
+		t.Errorf("Expected the command to be rejected with the reason of the middleware, got %+v", rejected)
+	}
+}
+
+func TestEvents_CommandFailed(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler Handler
+		err     string
+	}{
+		{"error", HandlerFunc(func(ctx *Context) { SetEventError(ctx, errors.New("OpenRouter is down")) }), "OpenRouter is down"},
+		{"panic", HandlerFunc(func(ctx *Context) { panic("boom") }), `panic in command handler "chat gpt": boom`},
+	}
+	for _, test := range tests {
+		r, recorder := eventsRouter(nil, test.handler)
+		r.ServeInteraction(sessiontest.NewFake("bot", "guild", "channel"), chatGPTInteraction())
+
+		failed := recorder.last()
+		if failed.Type != EventCommandFailed || failed.Error != test.err {
+			t.Errorf("%s: expected the command to fail with %q, got %+v", test.name, test.err, failed)
+		}
+	}
+}
+
+func TestEvents_CommandTimedOut(t *testing.T) {
+	r, recorder := eventsRouter(nil, HandlerFunc(func(ctx *Context) {
+		<-ctx.Done()
+	}))
+	r.Timeouts.Default = 10 * time.Millisecond
+	r.ServeInteraction(sessiontest.NewFake("bot", "guild", "channel"), chatGPTInteraction())
+
+	failed := recorder.last()
+	if failed.Type != EventCommandFailed || failed.Error == "" || failed.Duration < 10*time.Millisecond {
+		t.Errorf("Expected the command to fail after its timeout, got %+v", failed)
+	}
+}
+
+func TestEvents_PanickingSubscriber(t *testing.T) {
+	r, recorder := eventsRouter(nil, HandlerFunc(func(ctx *Context) {}))
+	r.Subscribe(SubscriberFunc(func(event Event) {
+		panic("broken subscriber")
+	}))
+	r.ServeInteraction(sessiontest.NewFake("bot", "guild", "channel"), chatGPTInteraction())
+
+	if types := recorder.types(); len(types) != 2 || types[1] != EventCommandCompleted {
+		t.Errorf("Expected the command to complete despite the subscriber, got %v", types)
+	}
+}
+
+func TestEmit_TruncatesPrompt(t *testing.T) {
+	r := NewRouter(nil)
+	recorder := &eventRecorder{}
+	r.Subscribe(recorder)
+	ctx, end, _ := r.begin(nil, 0, Event{Command: "chat"})
+	defer end()
+
+	prompt := make([]byte, 0, 2*maxEventPromptLength)
+	for len(prompt) < 2*maxEventPromptLength {
+		prompt = append(prompt, "ä"...)
+	}
+	Emit(ctx, Event{Type: EventMessageHandled, Prompt: string(prompt)})
+
+	event := recorder.last()
+	if len(event.Prompt) > maxEventPromptLength || event.Command != "chat" {
+		t.Errorf("Expected a truncated prompt of the chat command, got %d bytes of %q", len(event.Prompt), event.Command)
+	}
+}
@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+// InteractionLocale returns the language responses to the interaction are written in,
+// the language of the user or else the language of the guild
+func InteractionLocale(i *discord.Interaction) discord.Locale {
+	if i.Locale != "" {
+		return i.Locale
+	}
+	if i.GuildLocale != nil && *i.GuildLocale != "" {
+		return *i.GuildLocale
+	}
+	return i18n.DefaultLocale
+}
+
+// MessageLocale returns the language replies to the message are written in. Messages do not carry
+// the language of their author, so the preferred language of the guild is used
+func MessageLocale(s session.Session, m *discord.Message) discord.Locale {
+	if m.GuildID == "" {
+		return i18n.DefaultLocale
+	}
+	guild, err := s.State().Guild(m.GuildID)
+	if err != nil || guild.PreferredLocale == "" {
+		return i18n.DefaultLocale
+	}
+	return discord.Locale(guild.PreferredLocale)
+}
+
+// Locale returns the language responses to the command are written in
+func (ctx *Context) Locale() discord.Locale {
+	return InteractionLocale(ctx.Interaction)
+}
+
+// Locale returns the language responses to the component are written in
+func (ctx *ComponentContext) Locale() discord.Locale {
+	return InteractionLocale(ctx.Interaction)
+}
+
+// Locale returns the language responses to the modal are written in
+func (ctx *ModalContext) Locale() discord.Locale {
+	return InteractionLocale(ctx.Interaction)
+}
+
+// Locale returns the language replies to the message are written in
+func (ctx *MessageContext) Locale() discord.Locale {
+	return MessageLocale(ctx.Session, ctx.Message)
+}
+
+// localizeCommand adds the translations of the catalog to the names and descriptions of the command,
+// its options and their choices. The keys follow the command path, e.g. "command.chat.gpt.description",
+// "command.chat.gpt.option.prompt.description" or "command.image.dalle.option.style.choice.vivid"
+func localizeCommand(cmd *discord.ApplicationCommand) *discord.ApplicationCommand {
+	key := "command." + cmd.Name
+	if localizations := i18n.Localizations(key + ".name"); localizations != nil {
+		cmd.NameLocalizations = &localizations
+	}
+	if localizations := i18n.Localizations(key + ".description"); localizations != nil {
+		cmd.DescriptionLocalizations = &localizations
+	}
+	cmd.Options = slices.Clone(cmd.Options)
+	localizeOptions(key, cmd.Options)
+	return cmd
+}
+
+// localizeOptions replaces the options with localized copies, as they are shared with the command
+func localizeOptions(key string, options []*discord.ApplicationCommandOption) {
+	for i, option := range options {
+		localized := *option
+		optionKey := key + ".option." + option.Name
+		if option.Type == discord.ApplicationCommandOptionSubCommand || option.Type == discord.ApplicationCommandOptionSubCommandGroup {
+			optionKey = key + "." + option.Name
+		}
+		localized.NameLocalizations = i18n.Localizations(optionKey + ".name")
+		localized.DescriptionLocalizations = i18n.Localizations(optionKey + ".description")
+		localized.Choices = slices.Clone(option.Choices)
+		for j, choice := range option.Choices {
+			localizedChoice := *choice
+			localizedChoice.NameLocalizations = i18n.Localizations(fmt.Sprintf("%s.choice.%v", optionKey, choice.Value))
+			localized.Choices[j] = &localizedChoice
+		}
+		localized.Options = slices.Clone(option.Options)
+		localizeOptions(optionKey, localized.Options)
+		options[i] = &localized
+	}
+}
@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+func TestInteractionLocale(t *testing.T) {
+	guildLocale := discord.French
+	tests := []struct {
+		interaction *discord.Interaction
+		expected    discord.Locale
+	}{
+		{&discord.Interaction{Locale: discord.German, GuildLocale: &guildLocale}, discord.German},
+		{&discord.Interaction{GuildLocale: &guildLocale}, discord.French},
+		{&discord.Interaction{}, i18n.DefaultLocale},
+	}
+	for _, test := range tests {
+		if locale := InteractionLocale(test.interaction); locale != test.expected {
+			t.Errorf("Expected locale %s, got %s", test.expected, locale)
+		}
+	}
+}
+
+func TestLocalizeCommand(t *testing.T) {
+	r := testCommands()
+	commands, _ := r.scopeCommands(Scope{Commands: []string{"info"}})
+	info := commands[0]
+	if info.DescriptionLocalizations == nil || (*info.DescriptionLocalizations)[discord.German] != i18n.Text(discord.German, "command.info.description") {
+		t.Fatalf("Expected the German description of info, got %v", info.DescriptionLocalizations)
+	}
+	if _, ok := (*info.DescriptionLocalizations)[i18n.DefaultLocale]; ok {
+		t.Error("Expected the default locale to use the description of the command")
+	}
+	if info.NameLocalizations != nil {
+		t.Errorf("Expected names without translations to be left alone, got %v", *info.NameLocalizations)
+	}
+}
+
+func TestLocalizeCommand_CopiesOptions(t *testing.T) {
+	option := &discord.ApplicationCommandOption{
+		Type:        discord.ApplicationCommandOptionString,
+		Name:        "style",
+		Description: "Image style",
+		Choices:     []*discord.ApplicationCommandOptionChoice{{Name: "Vivid", Value: "vivid"}},
+	}
+	subcommand := &discord.ApplicationCommandOption{
+		Type:        discord.ApplicationCommandOptionSubCommand,
+		Name:        "dalle",
+		Description: "Generate images",
+		Options:     []*discord.ApplicationCommandOption{option},
+	}
+	cmd := &discord.ApplicationCommand{Name: "image", Description: "Generate images", Options: []*discord.ApplicationCommandOption{subcommand}}
+	localized := localizeCommand(cmd)
+
+	style := localized.Options[0].Options[0]
+	if style.DescriptionLocalizations[discord.French] != i18n.Text(discord.French, "command.image.dalle.option.style.description") {
+		t.Errorf("Expected the French description of the style option, got %v", style.DescriptionLocalizations)
+	}
+	if style.Choices[0].NameLocalizations[discord.German] != i18n.Text(discord.German, "command.image.dalle.option.style.choice.vivid") {
+		t.Errorf("Expected the German name of the vivid choice, got %v", style.Choices[0].NameLocalizations)
+	}
+	if option.DescriptionLocalizations != nil || option.Choices[0].NameLocalizations != nil || subcommand.DescriptionLocalizations != nil {
+		t.Error("Expected the options of the command to be left unchanged")
+	}
+}
+
+func TestDiffCommands_Localizations(t *testing.T) {
+	r := testCommands()
+	scope := Scope{}
+	current := registered(r, scope)
+	for _, cmd := range current {
+		if cmd.Name == "info" {
+			// Registered before the descriptions were translated
+			cmd.DescriptionLocalizations = nil
+		}
+	}
+
+	desired, _ := r.scopeCommands(scope)
+	changes, _ := diffCommands(scope, desired, current)
+	if len(changes) != 1 || changes[0].String() != "[global] update info" {
+		t.Errorf("Expected info to be updated with its translations, got %v", changes)
+	}
+}
@@ -0,0 +1,293 @@
+// typed access to command options and declarative option schemas validated before handlers run
+
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+// OptionSchema declares an option of a command. The router registers the ApplicationCommandOption
+// generated from it and validates the value the user entered before the handlers run.
+// Discord enforces most constraints in its client already, but values of autocompleted options are never checked
+type OptionSchema struct {
+	Type        discord.ApplicationCommandOptionType
+	Name        string
+	Description string
+	Required    bool
+	// Choices restrict the value to one of them
+	Choices []*discord.ApplicationCommandOptionChoice
+	// MinValue and MaxValue bound integer and number options
+	MinValue *float64
+	MaxValue *float64
+	// MinLength and MaxLength bound the length of string options in characters
+	MinLength *int
+	MaxLength *int
+	// ChannelTypes restrict the channels offered for channel options
+	ChannelTypes []discord.ChannelType
+	// Validate checks the value further, its error is shown to the user
+	Validate func(option *discord.ApplicationCommandInteractionDataOption) error
+}
+
+// OptionError tells the user which option has an invalid value
+type OptionError struct {
+	Option string
+	Reason string
+
+	// key and args translate the reasons of the schema, reasons of Validate are shown as they are
+	key  string
+	args []any
+}
+
+// optionError returns the error of the option with the reason of the catalog key
+func optionError(option string, key string, args ...any) *OptionError {
+	return &OptionError{Option: option, Reason: i18n.Text(i18n.DefaultLocale, key, args...), key: key, args: args}
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("`%s` %s", e.Option, e.Reason)
+}
+
+// Localized returns the error in the language of the locale
+func (e *OptionError) Localized(locale discord.Locale) string {
+	if e.key == "" {
+		return e.Error()
+	}
+	return fmt.Sprintf("`%s` %s", e.Option, i18n.Text(locale, e.key, e.args...))
+}
+
+// ApplicationCommandOption returns the option registered with Discord
+func (o *OptionSchema) ApplicationCommandOption() *discord.ApplicationCommandOption {
+	option := &discord.ApplicationCommandOption{
+		Type:         o.Type,
+		Name:         o.Name,
+		Description:  o.Description,
+		Required:     o.Required,
+		Choices:      o.Choices,
+		MinValue:     o.MinValue,
+		MinLength:    o.MinLength,
+		ChannelTypes: o.ChannelTypes,
+	}
+	if o.MaxValue != nil {
+		option.MaxValue = *o.MaxValue
+	}
+	if o.MaxLength != nil {
+		option.MaxLength = *o.MaxLength
+	}
+	return option
+}
+
+// validate checks the option the user entered, which is nil if it was omitted
+func (o *OptionSchema) validate(option *discord.ApplicationCommandInteractionDataOption) error {
+	if option == nil {
+		if o.Required {
+			return optionError(o.Name, "option.error.required")
+		}
+		return nil
+	}
+	if option.Type != o.Type {
+		return optionError(o.Name, "option.error.type")
+	}
+
+	if len(o.Choices) > 0 {
+		value := fmt.Sprint(option.Value)
+		matches := slices.ContainsFunc(o.Choices, func(choice *discord.ApplicationCommandOptionChoice) bool {
+			return fmt.Sprint(choice.Value) == value
+		})
+		if !matches {
+			names := make([]string, len(o.Choices))
+			for i, choice := range o.Choices {
+				names[i] = fmt.Sprintf("`%s`", choice.Name)
+			}
+			return optionError(o.Name, "option.error.choice", strings.Join(names, ", "))
+		}
+	}
+
+	switch option.Type {
+	case discord.ApplicationCommandOptionInteger, discord.ApplicationCommandOptionNumber:
+		value, _ := option.Value.(float64)
+		if o.MinValue != nil && value < *o.MinValue {
+			return optionError(o.Name, "option.error.min_value", *o.MinValue)
+		}
+		if o.MaxValue != nil && value > *o.MaxValue {
+			return optionError(o.Name, "option.error.max_value", *o.MaxValue)
+		}
+	case discord.ApplicationCommandOptionString:
+		value, _ := option.Value.(string)
+		length := utf8.RuneCountInString(value)
+		if o.MinLength != nil && length < *o.MinLength {
+			return optionError(o.Name, "option.error.min_length", *o.MinLength)
+		}
+		if o.MaxLength != nil && length > *o.MaxLength {
+			return optionError(o.Name, "option.error.max_length", *o.MaxLength)
+		}
+	}
+
+	if o.Validate != nil {
+		if err := o.Validate(option); err != nil {
+			var optionErr *OptionError
+			if errors.As(err, &optionErr) {
+				return optionErr
+			}
+			return &OptionError{Option: o.Name, Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+// ValidateOptions checks the entered options against the schema of the command
+func ValidateOptions(schema []*OptionSchema, options OptionsMap) error {
+	for _, o := range schema {
+		if err := o.validate(options[o.Name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// respondOptionError tells the user which option is invalid instead of running the handlers
+func respondOptionError(s session.Session, i *discord.Interaction, err error) {
+	locale := InteractionLocale(i)
+	description := err.Error()
+	var optionErr *OptionError
+	if errors.As(err, &optionErr) {
+		description = optionErr.Localized(locale)
+	}
+	respondErr := s.InteractionRespond(i, &discord.InteractionResponse{
+		Type: discord.InteractionResponseChannelMessageWithSource,
+		Data: &discord.InteractionResponseData{
+			Embeds: []*discord.MessageEmbed{
+				{
+					Title:       i18n.Text(locale, "error.option.title"),
+					Description: description,
+					Color:       0xff0000,
+				},
+			},
+			Flags: discord.MessageFlagsEphemeral,
+		},
+	})
+	if respondErr != nil {
+		log.Printf("[GID: %s, i.ID: %s] Failed to respond to interaction with the error: %v\n", i.GuildID, i.ID, respondErr)
+	}
+}
+
+// option returns the option if it was entered with the given type
+func (ctx *Context) option(name string, typ discord.ApplicationCommandOptionType) *discord.ApplicationCommandInteractionDataOption {
+	option, ok := ctx.Options[name]
+	if !ok || option.Type != typ {
+		return nil
+	}
+	return option
+}
+
+// resolved returns the users, channels, roles and attachments the options refer to
+func (ctx *Context) resolved() *discord.ApplicationCommandInteractionDataResolved {
+	data := ctx.Interaction.ApplicationCommandData()
+	if data.Resolved == nil {
+		return &discord.ApplicationCommandInteractionDataResolved{}
+	}
+	return data.Resolved
+}
+
+// StringOption returns the value of the string option, or def if it was omitted
+func (ctx *Context) StringOption(name string, def string) string {
+	if option := ctx.option(name, discord.ApplicationCommandOptionString); option != nil {
+		if value, ok := option.Value.(string); ok {
+			return value
+		}
+	}
+	return def
+}
+
+// IntOption returns the value of the integer option, or def if it was omitted
+func (ctx *Context) IntOption(name string, def int64) int64 {
+	if option := ctx.option(name, discord.ApplicationCommandOptionInteger); option != nil {
+		if value, ok := option.Value.(float64); ok {
+			return int64(value)
+		}
+	}
+	return def
+}
+
+// FloatOption returns the value of the number option, or def if it was omitted
+func (ctx *Context) FloatOption(name string, def float64) float64 {
+	if option := ctx.option(name, discord.ApplicationCommandOptionNumber); option != nil {
+		if value, ok := option.Value.(float64); ok {
+			return value
+		}
+	}
+	return def
+}
+
+// BoolOption returns the value of the boolean option, or def if it was omitted
+func (ctx *Context) BoolOption(name string, def bool) bool {
+	if option := ctx.option(name, discord.ApplicationCommandOptionBoolean); option != nil {
+		if value, ok := option.Value.(bool); ok {
+			return value
+		}
+	}
+	return def
+}
+
+// optionID returns the ID of the user, channel, role or attachment the option refers to
+func (ctx *Context) optionID(name string, typ discord.ApplicationCommandOptionType) string {
+	if option := ctx.option(name, typ); option != nil {
+		id, _ := option.Value.(string)
+		return id
+	}
+	return ""
+}
+
+// UserOption returns the user of the option, or nil if it was omitted
+func (ctx *Context) UserOption(name string) *discord.User {
+	id := ctx.optionID(name, discord.ApplicationCommandOptionUser)
+	if id == "" {
+		return nil
+	}
+	if user, ok := ctx.resolved().Users[id]; ok {
+		return user
+	}
+	return &discord.User{ID: id}
+}
+
+// ChannelOption returns the channel of the option, or nil if it was omitted
+func (ctx *Context) ChannelOption(name string) *discord.Channel {
+	id := ctx.optionID(name, discord.ApplicationCommandOptionChannel)
+	if id == "" {
+		return nil
+	}
+	if channel, ok := ctx.resolved().Channels[id]; ok {
+		return channel
+	}
+	return &discord.Channel{ID: id}
+}
+
+// RoleOption returns the role of the option, or nil if it was omitted
+func (ctx *Context) RoleOption(name string) *discord.Role {
+	id := ctx.optionID(name, discord.ApplicationCommandOptionRole)
+	if id == "" {
+		return nil
+	}
+	if role, ok := ctx.resolved().Roles[id]; ok {
+		return role
+	}
+	return &discord.Role{ID: id}
+}
+
+// AttachmentOption returns the attachment of the option with its URL, size and content type,
+// or nil if it was omitted
+func (ctx *Context) AttachmentOption(name string) *discord.MessageAttachment {
+	id := ctx.optionID(name, discord.ApplicationCommandOptionAttachment)
+	if id == "" {
+		return nil
+	}
+	return ctx.resolved().Attachments[id]
+}
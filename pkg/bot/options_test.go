@@ -0,0 +1,131 @@
+package bot
+
+import (
+	"errors"
+	"testing"
+
+	discord "github.com/bwmarrin/discordgo"
+)
+
+func optionsContext(options []*discord.ApplicationCommandInteractionDataOption, resolved *discord.ApplicationCommandInteractionDataResolved) *Context {
+	i := &discord.Interaction{
+		Type: discord.InteractionApplicationCommand,
+		Data: discord.ApplicationCommandInteractionData{Name: "test", Options: options, Resolved: resolved},
+	}
+	return NewContext(nil, nil, nil, i, nil, nil)
+}
+
+func TestContext_TypedOptions(t *testing.T) {
+	ctx := optionsContext([]*discord.ApplicationCommandInteractionDataOption{
+		{Name: "prompt", Type: discord.ApplicationCommandOptionString, Value: "hello"},
+		{Name: "number", Type: discord.ApplicationCommandOptionInteger, Value: float64(3)},
+		{Name: "temperature", Type: discord.ApplicationCommandOptionNumber, Value: 0.5},
+		{Name: "private", Type: discord.ApplicationCommandOptionBoolean, Value: true},
+		{Name: "role", Type: discord.ApplicationCommandOptionRole, Value: "10"},
+		{Name: "file", Type: discord.ApplicationCommandOptionAttachment, Value: "20"},
+	}, &discord.ApplicationCommandInteractionDataResolved{
+		Roles:       map[string]*discord.Role{"10": {ID: "10", Name: "Admins"}},
+		Attachments: map[string]*discord.MessageAttachment{"20": {ID: "20", URL: "https://cdn/file.txt"}},
+	})
+
+	if v := ctx.StringOption("prompt", ""); v != "hello" {
+		t.Errorf("Expected the string option, got %q", v)
+	}
+	if v := ctx.IntOption("number", 1); v != 3 {
+		t.Errorf("Expected the integer option, got %d", v)
+	}
+	if v := ctx.FloatOption("temperature", 1); v != 0.5 {
+		t.Errorf("Expected the number option, got %g", v)
+	}
+	if v := ctx.BoolOption("private", false); !v {
+		t.Error("Expected the boolean option")
+	}
+	if role := ctx.RoleOption("role"); role == nil || role.Name != "Admins" {
+		t.Errorf("Expected the resolved role, got %v", role)
+	}
+	if attachment := ctx.AttachmentOption("file"); attachment == nil || attachment.URL != "https://cdn/file.txt" {
+		t.Errorf("Expected the resolved attachment, got %v", attachment)
+	}
+
+	// Omitted options and options of another type fall back to the default
+	if v := ctx.StringOption("context", "default"); v != "default" {
+		t.Errorf("Expected the default, got %q", v)
+	}
+	if v := ctx.IntOption("prompt", 7); v != 7 {
+		t.Errorf("Expected the default for a mismatched type, got %d", v)
+	}
+	if user := ctx.UserOption("user"); user != nil {
+		t.Errorf("Expected no user, got %v", user)
+	}
+	if channel := ctx.ChannelOption("channel"); channel != nil {
+		t.Errorf("Expected no channel, got %v", channel)
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	minTemperature, maxTemperature := 0.0, 2.0
+	maxLength := 5
+	schema := []*OptionSchema{
+		{Type: discord.ApplicationCommandOptionString, Name: "prompt", Required: true, MaxLength: &maxLength},
+		{Type: discord.ApplicationCommandOptionNumber, Name: "temperature", MinValue: &minTemperature, MaxValue: &maxTemperature},
+		{Type: discord.ApplicationCommandOptionString, Name: "size", Choices: []*discord.ApplicationCommandOptionChoice{
+			{Name: "Small", Value: "256x256"},
+			{Name: "Large", Value: "1024x1024"},
+		}},
+		{Type: discord.ApplicationCommandOptionInteger, Name: "number", Validate: func(option *discord.ApplicationCommandInteractionDataOption) error {
+			if option.IntValue()%2 != 0 {
+				return errors.New("must be even")
+			}
+			return nil
+		}},
+	}
+	option := func(name string, typ discord.ApplicationCommandOptionType, value any) *discord.ApplicationCommandInteractionDataOption {
+		return &discord.ApplicationCommandInteractionDataOption{Name: name, Type: typ, Value: value}
+	}
+	prompt := option("prompt", discord.ApplicationCommandOptionString, "hi")
+
+	tests := []struct {
+		name    string
+		options []*discord.ApplicationCommandInteractionDataOption
+		err     string
+	}{
+		{"valid", []*discord.ApplicationCommandInteractionDataOption{prompt, option("size", discord.ApplicationCommandOptionString, "256x256")}, ""},
+		{"missing required", nil, "`prompt` is required"},
+		{"too long", []*discord.ApplicationCommandInteractionDataOption{option("prompt", discord.ApplicationCommandOptionString, "hello!")}, "`prompt` must be at most 5 characters long"},
+		{"above maximum", []*discord.ApplicationCommandInteractionDataOption{prompt, option("temperature", discord.ApplicationCommandOptionNumber, 2.5)}, "`temperature` must be at most 2"},
+		{"unknown choice", []*discord.ApplicationCommandInteractionDataOption{prompt, option("size", discord.ApplicationCommandOptionString, "512x512")}, "`size` must be one of `Small`, `Large`"},
+		{"custom validation", []*discord.ApplicationCommandInteractionDataOption{prompt, option("number", discord.ApplicationCommandOptionInteger, float64(3))}, "`number` must be even"},
+		{"wrong type", []*discord.ApplicationCommandInteractionDataOption{option("prompt", discord.ApplicationCommandOptionInteger, float64(1))}, "`prompt` has an unexpected type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateOptions(schema, makeOptionMap(tt.options))
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("Unexpected error %v", err)
+				}
+				return
+			}
+			var optionErr *OptionError
+			if !errors.As(err, &optionErr) || err.Error() != tt.err {
+				t.Errorf("Expected option error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestCommand_SchemaOptions(t *testing.T) {
+	maxValue := 4.0
+	cmd := Command{
+		Name:    "image",
+		Options: []*discord.ApplicationCommandOption{{Type: discord.ApplicationCommandOptionString, Name: "prompt"}},
+		Schema:  []*OptionSchema{{Type: discord.ApplicationCommandOptionInteger, Name: "number", MaxValue: &maxValue}},
+	}
+	options := cmd.ApplicationCommand().Options
+	if len(options) != 2 || options[1].Name != "number" || options[1].MaxValue != 4 {
+		t.Errorf("Expected the schema options after the options, got %v", options)
+	}
+	if len(cmd.Options) != 1 {
+		t.Error("Expected the options of the command to be left unchanged")
+	}
+}
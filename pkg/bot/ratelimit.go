@@ -0,0 +1,455 @@
+// rate limiting of commands and thread messages
+
+package bot
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+// RateLimitHits counts the requests rejected by each rate limit rule
+var RateLimitHits = expvar.NewMap("ratelimit_hits")
+
+// Limiter decides whether another request counted under key is allowed.
+// If not, it returns how long to wait until the next request is allowed
+type Limiter interface {
+	Allow(key string, now time.Time) (ok bool, retryAfter time.Duration)
+}
+
+// SlidingWindow allows at most limit requests per key within any window
+type SlidingWindow struct {
+	limit  int
+	window time.Duration
+
+	mu        sync.Mutex
+	hits      map[string][]time.Time
+	lastSweep time.Time
+}
+
+func NewSlidingWindow(limit int, window time.Duration) *SlidingWindow {
+	return &SlidingWindow{
+		limit:  limit,
+		window: window,
+		hits:   make(map[string][]time.Time),
+	}
+}
+
+func (w *SlidingWindow) Allow(key string, now time.Time) (bool, time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.sweep(now)
+	hits := w.prune(w.hits[key], now)
+	if len(hits) >= w.limit {
+		w.hits[key] = hits
+		return false, hits[0].Add(w.window).Sub(now)
+	}
+	w.hits[key] = append(hits, now)
+	return true, 0
+}
+
+// prune drops the hits that left the window
+func (w *SlidingWindow) prune(hits []time.Time, now time.Time) []time.Time {
+	start := now.Add(-w.window)
+	i := 0
+	for i < len(hits) && !hits[i].After(start) {
+		i++
+	}
+	return hits[i:]
+}
+
+// sweep forgets the keys without hits in the window, at most once per window
+func (w *SlidingWindow) sweep(now time.Time) {
+	if now.Sub(w.lastSweep) < w.window {
+		return
+	}
+	w.lastSweep = now
+	for key, hits := range w.hits {
+		if len(w.prune(hits, now)) == 0 {
+			delete(w.hits, key)
+		}
+	}
+}
+
+// TokenBucket allows bursts of up to capacity requests per key and refills one token every interval
+type TokenBucket struct {
+	capacity int
+	interval time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func NewTokenBucket(capacity int, interval time.Duration) *TokenBucket {
+	return &TokenBucket{
+		capacity: capacity,
+		interval: interval,
+		buckets:  make(map[string]*tokenBucket),
+	}
+}
+
+func (b *TokenBucket) Allow(key string, now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sweep(now)
+	bucket, ok := b.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(b.capacity), updated: now}
+		b.buckets[key] = bucket
+	}
+	bucket.tokens = b.refill(bucket, now)
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) * float64(b.interval))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+func (b *TokenBucket) refill(bucket *tokenBucket, now time.Time) float64 {
+	tokens := bucket.tokens + float64(now.Sub(bucket.updated))/float64(b.interval)
+	return math.Min(tokens, float64(b.capacity))
+}
+
+// sweep forgets the buckets that refilled completely, as they equal new buckets
+func (b *TokenBucket) sweep(now time.Time) {
+	full := time.Duration(b.capacity) * b.interval
+	if now.Sub(b.lastSweep) < full {
+		return
+	}
+	b.lastSweep = now
+	for key, bucket := range b.buckets {
+		if b.refill(bucket, now) >= float64(b.capacity) {
+			delete(b.buckets, key)
+		}
+	}
+}
+
+// RateLimitPer selects which requests are counted together
+type RateLimitPer string
+
+const (
+	RateLimitPerUser  RateLimitPer = "user"
+	RateLimitPerGuild RateLimitPer = "guild"
+)
+
+// RateLimitRule limits the requests it matches
+type RateLimitRule struct {
+	Name string
+	// Commands are the command paths the rule applies to, e.g. "image dalle". A path
+	// covers its subcommands, empty applies the rule to all commands
+	Commands []string
+	// Messages applies the rule to messages in the threads of the bot, in direct messages and to messages
+	// mentioning the bot or replying to it instead of commands. Commands then match the name of the command handling the messages, e.g. "chat"
+	Messages bool
+	// DirectMessages restricts the rule to direct messages and commands used in them
+	DirectMessages bool
+	Per            RateLimitPer
+	// Users, Roles and Guilds restrict the rule to the listed users, members with any
+	// of the listed roles and the listed guilds. Empty lists match everyone
+	Users  []string
+	Roles  []string
+	Guilds []string
+	// Limiter counts the matched requests, nil exempts them from the rules that follow
+	Limiter Limiter
+}
+
+// rateLimitRequest describes a command invocation, a thread message or a direct message
+type rateLimitRequest struct {
+	command string
+	message bool
+	guildID string
+	userID  string
+	roles   []string
+}
+
+func (rule *RateLimitRule) matches(req rateLimitRequest) bool {
+	if rule.Messages != req.message {
+		return false
+	}
+	if rule.DirectMessages && req.guildID != "" {
+		return false
+	}
+	if len(rule.Commands) > 0 && !slices.ContainsFunc(rule.Commands, func(path string) bool {
+		return req.command == path || strings.HasPrefix(req.command, path+" ")
+	}) {
+		return false
+	}
+	if len(rule.Users) > 0 && !slices.Contains(rule.Users, req.userID) {
+		return false
+	}
+	if len(rule.Roles) > 0 && !slices.ContainsFunc(rule.Roles, func(role string) bool {
+		return slices.Contains(req.roles, role)
+	}) {
+		return false
+	}
+	if len(rule.Guilds) > 0 && !slices.Contains(rule.Guilds, req.guildID) {
+		return false
+	}
+	return true
+}
+
+func (rule *RateLimitRule) key(req rateLimitRequest) string {
+	// Direct messages have no guild, so they are counted per user
+	if rule.Per == RateLimitPerGuild && req.guildID != "" {
+		return "guild:" + req.guildID
+	}
+	return "user:" + req.userID
+}
+
+// RateLimiter rejects commands and thread messages exceeding the first rule they match
+type RateLimiter struct {
+	rules []*RateLimitRule
+	now   func() time.Time
+
+	// notified holds until when users were told about a limit, so flooding a thread
+	// is not answered with a notice for every message
+	mu       sync.Mutex
+	notified map[string]time.Time
+}
+
+func NewRateLimiter(rules []*RateLimitRule) *RateLimiter {
+	return &RateLimiter{
+		rules:    rules,
+		now:      time.Now,
+		notified: make(map[string]time.Time),
+	}
+}
+
+// check returns the rule rejecting the request and how long to wait, or nil if the request is allowed
+func (l *RateLimiter) check(req rateLimitRequest) (*RateLimitRule, time.Duration) {
+	for _, rule := range l.rules {
+		if !rule.matches(req) {
+			continue
+		}
+		if rule.Limiter == nil {
+			return nil, 0
+		}
+		ok, retryAfter := rule.Limiter.Allow(rule.key(req), l.now())
+		if ok {
+			return nil, 0
+		}
+		RateLimitHits.Add(rule.Name, 1)
+		return rule, retryAfter
+	}
+	return nil, 0
+}
+
+// notify reports whether the user should be told about the limit, at most once until it expires
+func (l *RateLimiter) notify(rule *RateLimitRule, userID string, retryAfter time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for key, until := range l.notified {
+		if now.After(until) {
+			delete(l.notified, key)
+		}
+	}
+	key := rule.Name + ":" + userID
+	if _, ok := l.notified[key]; ok {
+		return false
+	}
+	l.notified[key] = now.Add(retryAfter)
+	return true
+}
+
+// Middleware rejects commands exceeding their rate limit. Components and modals count against
+// the rate limits of the command they belong to
+func (l *RateLimiter) Middleware() Handler {
+	return HandlerFunc(func(ctx *Context) {
+		req := rateLimitRequest{
+			command: ctx.Path(),
+			guildID: ctx.Interaction.GuildID,
+		}
+		if user := InteractionUser(ctx.Interaction); user != nil {
+			req.userID = user.ID
+		}
+		if ctx.Interaction.Member != nil {
+			req.roles = ctx.Interaction.Member.Roles
+		}
+
+		rule, retryAfter := l.check(req)
+		if rule == nil {
+			ctx.Next()
+			return
+		}
+		log.Printf("[GID: %s, i.ID: %s] Command '%s' of UserID: %s exceeded rate limit '%s', retry after %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, req.command, req.userID, rule.Name, retryAfter)
+		SetEventReason(ctx, fmt.Sprintf("rate limit '%s' exceeded", rule.Name))
+		err := ctx.Respond(&discord.InteractionResponse{
+			Type: discord.InteractionResponseChannelMessageWithSource,
+			Data: &discord.InteractionResponseData{
+				Embeds: []*discord.MessageEmbed{rateLimitEmbed(ctx.Locale(), retryAfter)},
+				Flags:  discord.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			log.Printf("[GID: %s, i.ID: %s] Failed to respond to interaction with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		}
+	})
+}
+
+// MessageMiddleware rejects messages in conversations with the bot exceeding their rate limit.
+// Other messages are passed on without being counted
+func (l *RateLimiter) MessageMiddleware() MessageHandler {
+	return MessageHandlerFunc(func(ctx *MessageContext) {
+		// Direct messages, mentions and replies to the bot are conversations with the bot as well
+		if !isBotThreadMessage(ctx.Session, ctx.Message) && !isDirectMessage(ctx.Message) && !isBotMention(ctx.Session, ctx.Message) {
+			ctx.Next()
+			return
+		}
+
+		req := rateLimitRequest{
+			command: ctx.Caller.Name,
+			message: true,
+			guildID: ctx.Message.GuildID,
+			userID:  ctx.Message.Author.ID,
+		}
+		if ctx.Message.Member != nil {
+			req.roles = ctx.Message.Member.Roles
+		}
+
+		rule, retryAfter := l.check(req)
+		if rule == nil {
+			ctx.Next()
+			return
+		}
+		log.Printf("[GID: %s, CHID: %s, MID: %s] Message of UserID: %s exceeded rate limit '%s', retry after %v\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID, req.userID, rule.Name, retryAfter)
+		if !l.notify(rule, req.userID, retryAfter) {
+			return
+		}
+		_, err := ctx.Session.ChannelMessageSendEmbedReply(ctx.Message.ChannelID, rateLimitEmbed(ctx.Locale(), retryAfter), ctx.Message.Reference())
+		if err != nil {
+			log.Printf("[GID: %s, CHID: %s, MID: %s] Failed to reply in the thread with the error: %v\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID, err)
+		}
+	})
+}
+
+// isBotThreadMessage reports whether a user wrote the message in a thread the bot started
+func isBotThreadMessage(s session.Session, m *discord.Message) bool {
+	if m.Author == nil || m.Author.Bot || s.State().User == nil {
+		return false
+	}
+	ch, err := s.State().Channel(m.ChannelID)
+	if err != nil {
+		return false
+	}
+	return ch.IsThread() && ch.OwnerID == s.State().User.ID
+}
+
+// isBotMention reports whether a user wrote the message mentioning the bot or replying to one of its messages,
+// which starts or continues a conversation outside threads
+func isBotMention(s session.Session, m *discord.Message) bool {
+	if m.Author == nil || m.Author.Bot || s.State().User == nil {
+		return false
+	}
+	botID := s.State().User.ID
+	if reference := m.ReferencedMessage; reference != nil && reference.Author != nil && reference.Author.ID == botID {
+		return true
+	}
+	return slices.ContainsFunc(m.Mentions, func(user *discord.User) bool {
+		return user.ID == botID
+	}) || strings.Contains(m.Content, "<@"+botID+">") || strings.Contains(m.Content, "<@!"+botID+">")
+}
+
+// isDirectMessage reports whether a user wrote the message in direct messages with the bot
+func isDirectMessage(m *discord.Message) bool {
+	return m.GuildID == "" && m.Author != nil && !m.Author.Bot
+}
+
+func rateLimitEmbed(locale discord.Locale, retryAfter time.Duration) *discord.MessageEmbed {
+	return &discord.MessageEmbed{
+		Title:       i18n.Text(locale, "ratelimit.title"),
+		Description: i18n.Text(locale, "ratelimit.description", retryAfterSeconds(retryAfter)),
+		Color:       0xff0000,
+	}
+}
+
+// retryAfterSeconds rounds up, so users are never told to retry before the limit expires
+func retryAfterSeconds(retryAfter time.Duration) int {
+	return max(1, int(math.Ceil(retryAfter.Seconds())))
+}
+
+// RateLimitConfig is a rate limit rule of the bot configuration
+type RateLimitConfig struct {
+	Name string `yaml:"name"`
+	// Commands are the command paths the rule applies to, e.g. "image dalle". Empty applies to all commands
+	Commands []string `yaml:"commands"`
+	// Messages applies the rule to messages in the threads of the bot, in direct messages and to messages
+	// mentioning the bot or replying to it instead of commands
+	Messages bool `yaml:"messages"`
+	// DirectMessages restricts the rule to direct messages and commands used in them
+	DirectMessages bool `yaml:"directMessages"`
+	// Per is either "user" (default) or "guild"
+	Per string `yaml:"per"`
+	// Algorithm is either "sliding-window" (default) or "token-bucket"
+	Algorithm string `yaml:"algorithm"`
+	// Limit is the number of requests allowed per window, 0 exempts the matched requests from later rules.
+	// A token bucket allows bursts of Limit requests and refills completely within Window
+	Limit  int           `yaml:"limit"`
+	Window time.Duration `yaml:"window"`
+	Users  []string      `yaml:"users"`
+	Roles  []string      `yaml:"roles"`
+	Guilds []string      `yaml:"guilds"`
+}
+
+// Rule validates the configuration and creates the rule
+func (c RateLimitConfig) Rule() (*RateLimitRule, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("rate limit name is required")
+	}
+	rule := &RateLimitRule{
+		Name:           c.Name,
+		Commands:       c.Commands,
+		Messages:       c.Messages,
+		DirectMessages: c.DirectMessages,
+		Per:            RateLimitPer(c.Per),
+		Users:          c.Users,
+		Roles:          c.Roles,
+		Guilds:         c.Guilds,
+	}
+	switch rule.Per {
+	case "":
+		rule.Per = RateLimitPerUser
+	case RateLimitPerUser, RateLimitPerGuild:
+	default:
+		return nil, fmt.Errorf("invalid per '%s' for rate limit '%s', must be 'user' or 'guild'", c.Per, c.Name)
+	}
+	if c.Limit < 0 {
+		return nil, fmt.Errorf("invalid limit for rate limit '%s', must not be negative", c.Name)
+	}
+	if c.Limit == 0 {
+		return rule, nil
+	}
+	if c.Window <= 0 {
+		return nil, fmt.Errorf("invalid window for rate limit '%s', must be positive", c.Name)
+	}
+
+	switch c.Algorithm {
+	case "", "sliding-window":
+		rule.Limiter = NewSlidingWindow(c.Limit, c.Window)
+	case "token-bucket":
+		rule.Limiter = NewTokenBucket(c.Limit, c.Window/time.Duration(c.Limit))
+	default:
+		return nil, fmt.Errorf("invalid algorithm '%s' for rate limit '%s', must be 'sliding-window' or 'token-bucket'", c.Algorithm, c.Name)
+	}
+	return rule, nil
+}
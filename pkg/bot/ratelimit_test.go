@@ -0,0 +1,247 @@
+package bot
+
+import (
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session/sessiontest"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+func TestSlidingWindow(t *testing.T) {
+	w := NewSlidingWindow(2, time.Minute)
+	start := time.Unix(0, 0)
+
+	if ok, _ := w.Allow("a", start); !ok {
+		t.Fatal("Expected the first request to be allowed")
+	}
+	if ok, _ := w.Allow("a", start.Add(20*time.Second)); !ok {
+		t.Fatal("Expected the second request to be allowed")
+	}
+	ok, retryAfter := w.Allow("a", start.Add(30*time.Second))
+	if ok || retryAfter != 30*time.Second {
+		t.Errorf("Expected the third request to wait 30s, got %t and %v", ok, retryAfter)
+	}
+	if ok, _ := w.Allow("b", start.Add(30*time.Second)); !ok {
+		t.Error("Expected other keys to be counted separately")
+	}
+	if ok, _ := w.Allow("a", start.Add(time.Minute)); !ok {
+		t.Error("Expected the request to be allowed once the first one left the window")
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	b := NewTokenBucket(2, 10*time.Second)
+	start := time.Unix(0, 0)
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := b.Allow("a", start); !ok {
+			t.Fatalf("Expected burst request %d to be allowed", i+1)
+		}
+	}
+	ok, retryAfter := b.Allow("a", start.Add(4*time.Second))
+	if ok || retryAfter != 6*time.Second {
+		t.Errorf("Expected the request to wait 6s, got %t and %v", ok, retryAfter)
+	}
+	if ok, _ := b.Allow("a", start.Add(10*time.Second)); !ok {
+		t.Error("Expected a refilled token to be allowed")
+	}
+}
+
+func TestRateLimiter_FirstMatchingRule(t *testing.T) {
+	l := NewRateLimiter([]*RateLimitRule{
+		{Name: "vip", Roles: []string{"vip"}},
+		{Name: "images", Commands: []string{"image"}, Per: RateLimitPerUser, Limiter: NewSlidingWindow(1, time.Minute)},
+		{Name: "threads", Messages: true, Per: RateLimitPerGuild, Limiter: NewSlidingWindow(1, time.Minute)},
+	})
+	now := time.Unix(0, 0)
+	l.now = func() time.Time { return now }
+	hits := rateLimitHits("images")
+
+	image := rateLimitRequest{command: "image dalle", guildID: "g", userID: "u"}
+	if rule, _ := l.check(image); rule != nil {
+		t.Fatal("Expected the first image to be allowed")
+	}
+	rule, retryAfter := l.check(image)
+	if rule == nil || rule.Name != "images" || retryAfter != time.Minute {
+		t.Errorf("Expected the images rule to reject the second image, got %v and %v", rule, retryAfter)
+	}
+
+	vip := rateLimitRequest{command: "image dalle", guildID: "g", userID: "u", roles: []string{"vip"}}
+	if rule, _ := l.check(vip); rule != nil {
+		t.Error("Expected vip members to be exempt")
+	}
+	if rule, _ := l.check(rateLimitRequest{command: "chat gpt", guildID: "g", userID: "u"}); rule != nil {
+		t.Error("Expected commands without a rule to be allowed")
+	}
+	if rule, _ := l.check(rateLimitRequest{command: "imagine", guildID: "g", userID: "u"}); rule != nil {
+		t.Error("Expected command paths to match whole names only")
+	}
+
+	// Messages are counted per guild, so another user in the guild is limited as well
+	if rule, _ := l.check(rateLimitRequest{command: "chat", message: true, guildID: "g", userID: "u"}); rule != nil {
+		t.Fatal("Expected the first message to be allowed")
+	}
+	if rule, _ := l.check(rateLimitRequest{command: "chat", message: true, guildID: "g", userID: "other"}); rule == nil || rule.Name != "threads" {
+		t.Errorf("Expected the threads rule to reject the message, got %v", rule)
+	}
+	if got := rateLimitHits("images") - hits; got != 1 {
+		t.Errorf("Expected 1 hit of the images rule, got %d", got)
+	}
+}
+
+func TestRateLimiter_DirectMessages(t *testing.T) {
+	l := NewRateLimiter([]*RateLimitRule{
+		{Name: "dms", Messages: true, DirectMessages: true, Per: RateLimitPerGuild, Limiter: NewSlidingWindow(1, time.Minute)},
+	})
+	now := time.Unix(0, 0)
+	l.now = func() time.Time { return now }
+
+	if rule, _ := l.check(rateLimitRequest{command: "chat", message: true, guildID: "g", userID: "u"}); rule != nil {
+		t.Error("Expected messages in guilds not to match")
+	}
+	if rule, _ := l.check(rateLimitRequest{command: "chat", message: true, userID: "u"}); rule != nil {
+		t.Fatal("Expected the first direct message to be allowed")
+	}
+	if rule, _ := l.check(rateLimitRequest{command: "chat", message: true, userID: "u"}); rule == nil || rule.Name != "dms" {
+		t.Errorf("Expected the dms rule to reject the direct message, got %v", rule)
+	}
+	// Direct messages have no guild, so they are counted per user
+	if rule, _ := l.check(rateLimitRequest{command: "chat", message: true, userID: "other"}); rule != nil {
+		t.Error("Expected direct messages of other users to be allowed")
+	}
+}
+
+func rateLimitHits(rule string) int64 {
+	if hits, ok := RateLimitHits.Get(rule).(*expvar.Int); ok {
+		return hits.Value()
+	}
+	return 0
+}
+
+func TestRateLimiter_NotifyOnce(t *testing.T) {
+	l := NewRateLimiter(nil)
+	now := time.Unix(0, 0)
+	l.now = func() time.Time { return now }
+	rule := &RateLimitRule{Name: "threads"}
+
+	if !l.notify(rule, "u", 10*time.Second) {
+		t.Fatal("Expected the first hit to be notified")
+	}
+	if l.notify(rule, "u", 10*time.Second) {
+		t.Error("Expected repeated hits not to be notified")
+	}
+	now = now.Add(11 * time.Second)
+	if !l.notify(rule, "u", 10*time.Second) {
+		t.Error("Expected a hit after the limit expired to be notified")
+	}
+}
+
+func TestRateLimitConfig_Rule(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  RateLimitConfig
+		wantErr bool
+	}{
+		{"sliding window", RateLimitConfig{Name: "a", Limit: 3, Window: time.Minute}, false},
+		{"token bucket", RateLimitConfig{Name: "a", Algorithm: "token-bucket", Limit: 3, Window: time.Minute}, false},
+		{"exempt", RateLimitConfig{Name: "a", Roles: []string{"vip"}}, false},
+		{"missing name", RateLimitConfig{Limit: 3, Window: time.Minute}, true},
+		{"missing window", RateLimitConfig{Name: "a", Limit: 3}, true},
+		{"negative limit", RateLimitConfig{Name: "a", Limit: -1, Window: time.Minute}, true},
+		{"unknown per", RateLimitConfig{Name: "a", Per: "channel", Limit: 3, Window: time.Minute}, true},
+		{"unknown algorithm", RateLimitConfig{Name: "a", Algorithm: "leaky", Limit: 3, Window: time.Minute}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.config.Rule()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Rule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	if got := retryAfterSeconds(1500 * time.Millisecond); got != 2 {
+		t.Errorf("Expected 2s, got %d", got)
+	}
+	if got := retryAfterSeconds(time.Millisecond); got != 1 {
+		t.Errorf("Expected at least 1s, got %d", got)
+	}
+}
+
+func TestRateLimiter_ComponentsAndModals(t *testing.T) {
+	var submitted, stopped int
+	r := NewRouter([]*Command{{
+		Name: "chat",
+		SubCommands: NewRouter([]*Command{{
+			Name: "compose",
+			Components: []*Component{{
+				Prefix:          "stop",
+				SkipMiddlewares: true,
+				Handler:         ComponentHandlerFunc(func(ctx *ComponentContext) { stopped++ }),
+			}},
+			Modals: []*Modal{{
+				Prefix:  "compose",
+				Handler: ModalHandlerFunc(func(ctx *ModalContext) { submitted++ }),
+			}},
+		}}),
+	}})
+	r.Use(NewRateLimiter([]*RateLimitRule{
+		{Name: "compose", Commands: []string{"chat compose"}, Per: RateLimitPerUser, Limiter: NewSlidingWindow(1, time.Minute)},
+	}).Middleware())
+	s := sessiontest.NewFake("bot", "guild", "channel")
+	interaction := func(typ discord.InteractionType, data discord.InteractionData) *discord.InteractionCreate {
+		return &discord.InteractionCreate{Interaction: &discord.Interaction{
+			ID:        "interaction",
+			Type:      typ,
+			GuildID:   "guild",
+			ChannelID: "channel",
+			Member:    &discord.Member{User: &discord.User{ID: "user"}},
+			Data:      data,
+		}}
+	}
+	modal := interaction(discord.InteractionModalSubmit, discord.ModalSubmitInteractionData{CustomID: "compose"})
+	stop := interaction(discord.InteractionMessageComponent, discord.MessageComponentInteractionData{CustomID: "stop:1"})
+
+	r.ServeInteraction(s, modal)
+	r.ServeInteraction(s, modal)
+	if submitted != 1 {
+		t.Errorf("Expected the second submission to exceed the rate limit of its command, got %d submissions", submitted)
+	}
+	r.ServeInteraction(s, stop)
+	r.ServeInteraction(s, stop)
+	if stopped != 2 {
+		t.Errorf("Expected components skipping middlewares not to be rate limited, got %d stops", stopped)
+	}
+}
+
+func TestIsBotMention(t *testing.T) {
+	s := sessiontest.NewFake("bot", "guild", "channel")
+	user := &discord.User{ID: "user"}
+	answer := &discord.Message{ID: "answer", Author: &discord.User{ID: "bot"}}
+
+	tests := []struct {
+		name    string
+		message *discord.Message
+		want    bool
+	}{
+		{"mention", &discord.Message{Author: user, Content: "<@bot> hi"}, true},
+		{"nickname mention", &discord.Message{Author: user, Content: "<@!bot> hi"}, true},
+		{"mentioned user", &discord.Message{Author: user, Mentions: []*discord.User{{ID: "bot"}}}, true},
+		{"reply to the bot", &discord.Message{Author: user, Content: "and?", ReferencedMessage: answer}, true},
+		{"other mention", &discord.Message{Author: user, Content: "<@other> hi"}, false},
+		{"reply to another user", &discord.Message{Author: user, ReferencedMessage: &discord.Message{Author: user}}, false},
+		{"bot author", &discord.Message{Author: &discord.User{ID: "other", Bot: true}, Content: "<@bot> hi"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBotMention(s, tt.message); got != tt.want {
+				t.Errorf("Expected %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+// recovery of panicking handlers
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/utils"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+// PanicError describes a panic recovered from a handler
+type PanicError struct {
+	Value any
+	Stack []byte
+	// Handler is the kind of the handler, e.g. "command", "message" or "component"
+	Handler string
+	// Name is the command path or the custom ID that was handled
+	Name          string
+	GuildID       string
+	ChannelID     string
+	UserID        string
+	InteractionID string
+	MessageID     string
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in %s handler %q: %v", e.Handler, e.Name, e.Value)
+}
+
+// ErrorHook is called with every panic recovered from a handler, e.g. to forward it to alerting
+type ErrorHook func(err *PanicError)
+
+func panicEmbed(locale discord.Locale) *discord.MessageEmbed {
+	return &discord.MessageEmbed{
+		Title:       i18n.Text(locale, "error.panic.title"),
+		Description: i18n.Text(locale, "error.panic.description"),
+		Color:       0xff0000,
+	}
+}
+
+type invocationKey struct{}
+
+// invocation tracks the side effects of a handler that must be undone when it panics
+// or does not finish before the bot shuts down
+type invocation struct {
+	router  *Router
+	session session.Session
+
+	mu            sync.Mutex
+	lockedThreads map[string]struct{}
+	// event describes the handler in its lifecycle events, handlers add their model, prompt and errors
+	event Event
+}
+
+func newInvocation(r *Router, s session.Session, event Event) *invocation {
+	return &invocation{
+		router:        r,
+		session:       s,
+		lockedThreads: make(map[string]struct{}),
+		event:         event,
+	}
+}
+
+func invocationFrom(ctx context.Context) *invocation {
+	inv, _ := ctx.Value(invocationKey{}).(*invocation)
+	return inv
+}
+
+// LockThread locks the thread while the handler of ctx answers in it and returns the function unlocking it.
+// Threads still locked when the handler panics are unlocked by the router
+func LockThread(ctx context.Context, s session.Session, threadID string) (unlock func()) {
+	utils.ToggleDiscordThreadLock(s, threadID, true)
+	inv := invocationFrom(ctx)
+	if inv != nil {
+		inv.mu.Lock()
+		inv.lockedThreads[threadID] = struct{}{}
+		inv.mu.Unlock()
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			utils.ToggleDiscordThreadLock(s, threadID, false)
+			if inv != nil {
+				inv.mu.Lock()
+				delete(inv.lockedThreads, threadID)
+				inv.mu.Unlock()
+			}
+		})
+	}
+}
+
+func (inv *invocation) unlockThreads() {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	for threadID := range inv.lockedThreads {
+		utils.ToggleDiscordThreadLock(inv.session, threadID, false)
+		delete(inv.lockedThreads, threadID)
+	}
+}
+
+// Go runs fn in a new goroutine. A panic in fn is logged and reported to the error hook
+// of the handler ctx belongs to, with the IDs of the event it handles, instead of crashing the bot.
+// The bot waits for the goroutine before shutting down
+func Go(ctx context.Context, fn func()) {
+	inv := invocationFrom(ctx)
+	if inv != nil {
+		inv.router.inflight.Add(1)
+	}
+	go func() {
+		if inv != nil {
+			defer inv.router.inflight.Done()
+		}
+		defer func() {
+			if value := recover(); value != nil {
+				err := &PanicError{
+					Value:   value,
+					Stack:   debug.Stack(),
+					Handler: "goroutine",
+				}
+				if inv != nil {
+					err.setEvent(inv)
+				}
+				log.Printf("[GID: %s, CHID: %s, i.ID: %s, MID: %s] Recovered from panic in %s handler %q: %v\n%s", err.GuildID, err.ChannelID, err.InteractionID, err.MessageID, err.Handler, err.Name, value, err.Stack)
+				if inv != nil {
+					inv.unlockThreads()
+					if inv.router.ErrorHook != nil {
+						inv.router.ErrorHook(err)
+					}
+				}
+			}
+		}()
+		fn()
+	}()
+}
+
+// recoverPanic must be deferred by the router around every handler invocation. It unlocks the
+// threads the handler locked, reports the panic and tells the user something went wrong
+func (r *Router) recoverPanic(ctx context.Context, err *PanicError, reply func()) {
+	value := recover()
+	if value == nil {
+		return
+	}
+	err.Value = value
+	err.Stack = debug.Stack()
+	log.Printf("[GID: %s, CHID: %s, i.ID: %s, MID: %s] Recovered from panic in %s handler %q: %v\n%s", err.GuildID, err.ChannelID, err.InteractionID, err.MessageID, err.Handler, err.Name, value, err.Stack)
+
+	if inv := invocationFrom(ctx); inv != nil {
+		inv.unlockThreads()
+		inv.mu.Lock()
+		inv.event.Error = err.Error()
+		inv.mu.Unlock()
+	}
+	if r.ErrorHook != nil {
+		r.ErrorHook(err)
+	}
+	if reply != nil {
+		reply()
+	}
+}
+
+// setEvent copies the command and IDs of the event the invocation handles
+func (e *PanicError) setEvent(inv *invocation) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	e.Name = inv.event.Command
+	e.GuildID = inv.event.GuildID
+	e.ChannelID = inv.event.ChannelID
+	e.UserID = inv.event.UserID
+	e.InteractionID = inv.event.InteractionID
+	e.MessageID = inv.event.MessageID
+}
+
+func interactionPanicError(handler string, name string, i *discord.Interaction) *PanicError {
+	err := &PanicError{
+		Handler:       handler,
+		Name:          name,
+		GuildID:       i.GuildID,
+		ChannelID:     i.ChannelID,
+		InteractionID: i.ID,
+	}
+	if user := InteractionUser(i); user != nil {
+		err.UserID = user.ID
+	}
+	return err
+}
+
+// replyInteractionError shows the generic error to the user, whether the interaction was already responded to or not
+func replyInteractionError(s session.Session, i *discord.Interaction) {
+	embed := panicEmbed(InteractionLocale(i))
+	err := s.InteractionRespond(i, &discord.InteractionResponse{
+		Type: discord.InteractionResponseChannelMessageWithSource,
+		Data: &discord.InteractionResponseData{
+			Embeds: []*discord.MessageEmbed{embed},
+			Flags:  discord.MessageFlagsEphemeral,
+		},
+	})
+	if err == nil {
+		return
+	}
+	_, err = s.FollowupMessageCreate(i, false, &discord.WebhookParams{
+		Embeds: []*discord.MessageEmbed{embed},
+		Flags:  discord.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		log.Printf("[GID: %s, i.ID: %s] Failed to report the error to the user: %v\n", i.GuildID, i.ID, err)
+	}
+}
+
+func replyMessageError(s session.Session, m *discord.Message) {
+	_, err := s.ChannelMessageSendEmbedReply(m.ChannelID, panicEmbed(MessageLocale(s, m)), m.Reference())
+	if err != nil {
+		log.Printf("[GID: %s, CHID: %s, MID: %s] Failed to report the error to the user: %v\n", m.GuildID, m.ChannelID, m.ID, err)
+	}
+}
@@ -0,0 +1,74 @@
+package bot
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	r := NewRouter(nil)
+	var reported *PanicError
+	r.ErrorHook = func(err *PanicError) {
+		reported = err
+	}
+	replied := false
+
+	func() {
+		ctx, end, _ := r.begin(nil, 0, Event{})
+		defer end()
+		defer r.recoverPanic(ctx, &PanicError{Handler: "command", Name: "chat"}, func() {
+			replied = true
+		})
+		panic("boom")
+	}()
+
+	if reported == nil {
+		t.Fatal("Expected the panic to be reported to the error hook")
+	}
+	if reported.Value != "boom" || len(reported.Stack) == 0 {
+		t.Errorf("Expected the panic value and stack, got %v", reported.Value)
+	}
+	if reported.Error() != `panic in command handler "chat": boom` {
+		t.Errorf("Unexpected error %q", reported.Error())
+	}
+	if !replied {
+		t.Error("Expected the user to be replied to")
+	}
+}
+
+func TestRecoverPanic_NoPanic(t *testing.T) {
+	r := NewRouter(nil)
+	r.ErrorHook = func(err *PanicError) {
+		t.Errorf("Unexpected report %v", err)
+	}
+
+	func() {
+		defer r.recoverPanic(context.Background(), &PanicError{Handler: "command", Name: "chat"}, func() {
+			t.Error("Unexpected reply")
+		})
+	}()
+}
+
+func TestGo(t *testing.T) {
+	reported := make(chan *PanicError, 1)
+	r := NewRouter(nil)
+	r.ErrorHook = func(err *PanicError) {
+		reported <- err
+	}
+	event := Event{Command: "chat gpt", GuildID: "guild", ChannelID: "channel", UserID: "user", InteractionID: "interaction", MessageID: "message"}
+	ctx, end, _ := r.begin(nil, 0, event)
+	end()
+
+	Go(ctx, func() {
+		panic("boom")
+	})
+
+	err := <-reported
+	if err.Handler != "goroutine" || err.Value != "boom" {
+		t.Errorf("Unexpected report %v", err)
+	}
+	if err.Name != event.Command || err.GuildID != event.GuildID || err.ChannelID != event.ChannelID ||
+		err.UserID != event.UserID || err.InteractionID != event.InteractionID || err.MessageID != event.MessageID {
+		t.Errorf("Expected the command and IDs of the handled event, got %+v", err)
+	}
+}
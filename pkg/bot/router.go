@@ -3,16 +3,56 @@
 package bot
 
 import (
-	"fmt"
+	"context"
 	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session"
 	"github.com/bwmarrin/discordgo"
 	discord "github.com/bwmarrin/discordgo"
 )
 
+// Timeouts configures the deadlines of handler contexts. Zero values mean no deadline
+type Timeouts struct {
+	// Default applies to commands and components without a more specific timeout
+	Default time.Duration
+	// Message applies to message handlers
+	Message time.Duration
+	// Commands overrides the timeout per command path, e.g. "chat gpt". A path covers its subcommands
+	Commands map[string]time.Duration
+}
+
 type Router struct {
-	commands           map[string]*Command
-	registeredCommands []*discord.ApplicationCommand
+	commands     map[string]*Command
+	components   []*Component
+	modals       []*Modal
+	syncedScopes []Scope
+	// middlewares run before the handlers of every command, component and modal,
+	// messageMiddlewares before the handlers of every message
+	middlewares        []Handler
+	messageMiddlewares []MessageHandler
+
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	// mu guards draining and invocations, inflight counts handlers and their goroutines
+	mu          sync.Mutex
+	draining    bool
+	invocations map[*invocation]struct{}
+	inflight    sync.WaitGroup
+
+	Timeouts Timeouts
+	// Dispatcher handles messages on a worker pool, in order per channel. Without it,
+	// messages are handled in the event goroutines of the session
+	Dispatcher *Dispatcher
+	// ErrorHook is called with panics recovered from handlers
+	ErrorHook ErrorHook
+
+	subscribersMu sync.RWMutex
+	subscribers   []Subscriber
 }
 
 func NewRouter(initial []*Command) (r *Router) {
@@ -24,12 +64,65 @@ func NewRouter(initial []*Command) (r *Router) {
 	return
 }
 
+// SetContext sets the root context all handler contexts derive from.
+// Shutdown cancels it for the handlers still running after the grace period
+func (r *Router) SetContext(ctx context.Context) {
+	r.ctx, r.cancel = context.WithCancelCause(ctx)
+}
+
+func (r *Router) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// commandTimeout returns the timeout of the command invoked by path. Configured timeouts take
+// precedence over the command's own timeout, the timeout of the closest parent path applies to subcommands
+func (r *Router) commandTimeout(cmd *Command, path string) time.Duration {
+	for parent := path; parent != ""; {
+		if timeout, ok := r.Timeouts.Commands[parent]; ok {
+			return timeout
+		}
+		i := strings.LastIndex(parent, " ")
+		if i < 0 {
+			break
+		}
+		parent = parent[:i]
+	}
+	if cmd.Timeout > 0 {
+		return cmd.Timeout
+	}
+	return r.Timeouts.Default
+}
+
 func (r *Router) Register(cmd *Command) {
 	if _, ok := r.commands[cmd.Name]; !ok {
 		r.commands[cmd.Name] = cmd
 	}
 }
 
+// Use runs the middlewares before the handlers of every command and of its components and modals.
+// Components and modals with SkipMiddlewares are exempt
+func (r *Router) Use(middlewares ...Handler) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// UseMessage runs the middlewares before the message handlers of every command
+func (r *Router) UseMessage(middlewares ...MessageHandler) {
+	r.messageMiddlewares = append(r.messageMiddlewares, middlewares...)
+}
+
+// RegisterComponent routes message components that do not belong to a command
+func (r *Router) RegisterComponent(c *Component) {
+	r.components = append(r.components, c)
+}
+
+// RegisterModal routes modal submissions that do not belong to a command
+func (r *Router) RegisterModal(m *Modal) {
+	r.modals = append(r.modals, m)
+}
+
 func (r *Router) Get(name string) *Command {
 	if r == nil {
 		return nil
@@ -37,6 +130,7 @@ func (r *Router) Get(name string) *Command {
 	return r.commands[name]
 }
 
+// List returns the commands sorted by name, so subcommands are registered in the same order on every sync
 func (r *Router) List() (list []*Command) {
 	if r == nil {
 		return nil
@@ -44,6 +138,9 @@ func (r *Router) List() (list []*Command) {
 	for _, c := range r.commands {
 		list = append(list, c)
 	}
+	slices.SortFunc(list, func(a, b *Command) int {
+		return strings.Compare(a.Name, b.Name)
+	})
 	return
 }
 
@@ -86,8 +183,145 @@ func (r *Router) getMessageHandlers(cmd *Command) []MessageHandler {
 	return handlers
 }
 
+func (r *Router) getMessageQueues(cmd *Command) []MessageQueue {
+	var queues []MessageQueue
+
+	if cmd.MessageQueue != nil {
+		queues = append(queues, cmd.MessageQueue)
+	}
+
+	if cmd.SubCommands != nil {
+		for _, cmd := range cmd.SubCommands.List() {
+			queues = append(queues, r.getMessageQueues(cmd)...)
+		}
+	}
+
+	return queues
+}
+
+type componentRoute struct {
+	component *Component
+	caller    *Command
+	// path of the command the component belongs to, e.g. "chat compose"
+	path string
+}
+
+type modalRoute struct {
+	modal  *Modal
+	caller *Command
+	// path of the command the modal belongs to, e.g. "chat compose"
+	path string
+}
+
+func (r *Router) getComponentRoutes(cmd *Command, path string) []componentRoute {
+	var routes []componentRoute
+	for _, c := range cmd.Components {
+		routes = append(routes, componentRoute{component: c, caller: cmd, path: path})
+	}
+
+	if cmd.SubCommands != nil {
+		for _, cmd := range cmd.SubCommands.List() {
+			routes = append(routes, r.getComponentRoutes(cmd, path+" "+cmd.Name)...)
+		}
+	}
+
+	return routes
+}
+
+func (r *Router) getModalRoutes(cmd *Command, path string) []modalRoute {
+	var routes []modalRoute
+	for _, m := range cmd.Modals {
+		routes = append(routes, modalRoute{modal: m, caller: cmd, path: path})
+	}
+
+	if cmd.SubCommands != nil {
+		for _, cmd := range cmd.SubCommands.List() {
+			routes = append(routes, r.getModalRoutes(cmd, path+" "+cmd.Name)...)
+		}
+	}
+
+	return routes
+}
+
+// getComponent returns the route of the component with the longest prefix matching customID
+func (r *Router) getComponent(customID string) (componentRoute, bool) {
+	var routes []componentRoute
+	for _, c := range r.components {
+		routes = append(routes, componentRoute{component: c})
+	}
+	for _, cmd := range r.commands {
+		routes = append(routes, r.getComponentRoutes(cmd, cmd.Name)...)
+	}
+
+	prefixes := make([]string, len(routes))
+	for i, route := range routes {
+		prefixes[i] = route.component.Prefix
+	}
+	if i := matchPrefix(customID, prefixes); i != -1 {
+		return routes[i], true
+	}
+	return componentRoute{}, false
+}
+
+// getModal returns the route of the modal with the longest prefix matching customID
+func (r *Router) getModal(customID string) (modalRoute, bool) {
+	var routes []modalRoute
+	for _, m := range r.modals {
+		routes = append(routes, modalRoute{modal: m})
+	}
+	for _, cmd := range r.commands {
+		routes = append(routes, r.getModalRoutes(cmd, cmd.Name)...)
+	}
+
+	prefixes := make([]string, len(routes))
+	for i, route := range routes {
+		prefixes[i] = route.modal.Prefix
+	}
+	if i := matchPrefix(customID, prefixes); i != -1 {
+		return routes[i], true
+	}
+	return modalRoute{}, false
+}
+
+// CommandPath returns the invoked command with its subcommand group and subcommand, e.g. "chat gpt"
+func CommandPath(data discord.ApplicationCommandInteractionData) string {
+	path := []string{data.Name}
+	options := data.Options
+	for len(options) > 0 {
+		opt := options[0]
+		if opt.Type != discord.ApplicationCommandOptionSubCommand && opt.Type != discord.ApplicationCommandOptionSubCommandGroup {
+			break
+		}
+		path = append(path, opt.Name)
+		options = opt.Options
+	}
+	return strings.Join(path, " ")
+}
+
+// HandleInteraction is the interaction create handler of the session
 func (r *Router) HandleInteraction(s *discord.Session, i *discord.InteractionCreate) {
-	if i.Type != discord.InteractionApplicationCommand {
+	r.ServeInteraction(session.New(s), i)
+}
+
+// ServeInteraction routes the interaction to the handlers of its command, component or modal
+func (r *Router) ServeInteraction(s session.Session, i *discord.InteractionCreate) {
+	if r.isDraining() {
+		rejectInteraction(s, i)
+		return
+	}
+
+	switch i.Type {
+	case discord.InteractionApplicationCommand:
+	case discord.InteractionApplicationCommandAutocomplete:
+		r.handleAutocomplete(s, i)
+		return
+	case discord.InteractionMessageComponent:
+		r.handleComponent(s, i)
+		return
+	case discord.InteractionModalSubmit:
+		r.handleModal(s, i)
+		return
+	default:
 		return
 	}
 
@@ -104,45 +338,256 @@ func (r *Router) HandleInteraction(s *discord.Session, i *discord.InteractionCre
 	}
 
 	if cmd != nil {
-		ctx := NewContext(s, cmd, i.Interaction, parent, handlers)
+		handlers = append(append([]Handler{}, r.middlewares...), handlers...)
+		path := CommandPath(data)
+		handlerCtx, end, ok := r.begin(s, r.commandTimeout(cmd, path), interactionEvent(path, i.Interaction))
+		if !ok {
+			rejectInteraction(s, i)
+			return
+		}
+		defer end()
+		events := r.beginCommandEvents(handlerCtx)
+		defer events.end(handlerCtx)
+		defer r.recoverPanic(handlerCtx, interactionPanicError("command", path, i.Interaction), func() {
+			replyInteractionError(s, i.Interaction)
+		})
+		ctx := NewContext(handlerCtx, s, cmd, i.Interaction, parent, handlers)
+		ctx.path = path
+		if err := ValidateOptions(cmd.Schema, ctx.Options); err != nil {
+			log.Printf("[GID: %s, i.ID: %s] Invalid option: %v\n", i.GuildID, i.ID, err)
+			SetEventReason(handlerCtx, err.Error())
+			events.rejected = true
+			respondOptionError(s, i.Interaction, err)
+			return
+		}
 		ctx.Next()
+		// A middleware that does not call Next stops the handlers that follow it
+		events.rejected = len(ctx.handlers) > 0
+	}
+}
+
+func (r *Router) handleAutocomplete(s session.Session, i *discord.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	cmd := r.Get(data.Name)
+	if cmd == nil {
+		return
+	}
+
+	options := data.Options
+	if len(data.Options) != 0 {
+		var parent *discord.ApplicationCommandInteractionDataOption
+		cmd, parent, _ = r.getSubcommand(cmd, data.Options[0], nil)
+		if parent != nil {
+			options = parent.Options
+		}
+	}
+	if cmd == nil {
+		return
+	}
+
+	handlerCtx, end, ok := r.begin(s, r.Timeouts.Default, interactionEvent(CommandPath(data), i.Interaction))
+	if !ok {
+		rejectInteraction(s, i)
+		return
+	}
+	defer end()
+	// Autocomplete has no room for an error message, the user just sees no suggestions
+	defer r.recoverPanic(handlerCtx, interactionPanicError("autocomplete", CommandPath(data), i.Interaction), nil)
+	ctx := NewAutocompleteContext(handlerCtx, s, cmd, i.Interaction, options)
+	if ctx.Focused == nil {
+		return
+	}
+	handler, ok := cmd.Autocomplete[ctx.Focused.Name]
+	if !ok {
+		// Discord waits for an answer, respond without suggestions
+		ctx.Respond(nil)
+		return
+	}
+	handler.HandleAutocomplete(ctx)
+}
+
+func (r *Router) handleComponent(s session.Session, i *discord.InteractionCreate) {
+	customID := i.MessageComponentData().CustomID
+	route, ok := r.getComponent(customID)
+	if !ok {
+		// Components of removed handlers stay on old messages, tell the user instead of failing the interaction
+		log.Printf("[GID: %s, i.ID: %s] No handler for component with custom ID: %s\n", i.GuildID, i.ID, customID)
+		respondEphemeral(s, i.Interaction, i18n.Text(InteractionLocale(i.Interaction), unknownComponentMessage))
+		return
+	}
+	component := route.component
+	if component.expired(customID) {
+		respondEphemeral(s, i.Interaction, component.expiredMessage(InteractionLocale(i.Interaction)))
+		return
+	}
+
+	timeout := component.Timeout
+	if timeout <= 0 {
+		timeout = r.Timeouts.Default
+	}
+	handlerCtx, end, ok := r.begin(s, timeout, interactionEvent(route.path, i.Interaction))
+	if !ok {
+		rejectInteraction(s, i)
+		return
+	}
+	defer end()
+	defer r.recoverPanic(handlerCtx, interactionPanicError("component", customID, i.Interaction), func() {
+		replyInteractionError(s, i.Interaction)
+	})
+	if !component.SkipMiddlewares && !r.passMiddlewares(handlerCtx, s, route.caller, route.path, i.Interaction) {
+		return
+	}
+	ctx := NewComponentContext(handlerCtx, s, route.caller, i.Interaction, component.Prefix, component.handlers())
+	ctx.Next()
+}
+
+func (r *Router) handleModal(s session.Session, i *discord.InteractionCreate) {
+	customID := i.ModalSubmitData().CustomID
+	route, ok := r.getModal(customID)
+	if !ok {
+		log.Printf("[GID: %s, i.ID: %s] No handler for modal with custom ID: %s\n", i.GuildID, i.ID, customID)
+		respondEphemeral(s, i.Interaction, i18n.Text(InteractionLocale(i.Interaction), defaultModalExpiredMessage))
+		return
+	}
+	modal := route.modal
+	if modal.expired(customID) {
+		respondEphemeral(s, i.Interaction, modal.expiredMessage(InteractionLocale(i.Interaction)))
+		return
+	}
+
+	timeout := modal.Timeout
+	if timeout <= 0 {
+		timeout = r.Timeouts.Default
+	}
+	handlerCtx, end, ok := r.begin(s, timeout, interactionEvent(route.path, i.Interaction))
+	if !ok {
+		rejectInteraction(s, i)
+		return
+	}
+	defer end()
+	defer r.recoverPanic(handlerCtx, interactionPanicError("modal", customID, i.Interaction), func() {
+		replyInteractionError(s, i.Interaction)
+	})
+	if !modal.SkipMiddlewares && !r.passMiddlewares(handlerCtx, s, route.caller, route.path, i.Interaction) {
+		return
+	}
+	ctx := NewModalContext(handlerCtx, s, route.caller, i.Interaction, modal.Prefix, modal.handlers())
+	ctx.Next()
+}
+
+// passMiddlewares runs the middlewares of the router for a component or modal of the command at path,
+// so they are rate limited and access checked like the command. It reports whether all of them called Next
+func (r *Router) passMiddlewares(handlerCtx context.Context, s session.Session, caller *Command, path string, i *discord.Interaction) bool {
+	passed := false
+	ctx := &Context{
+		Context:     handlerCtx,
+		Session:     s,
+		Caller:      caller,
+		Interaction: i,
+		Options:     makeOptionMap(nil),
+
+		path: path,
+		handlers: append(slices.Clone(r.middlewares), HandlerFunc(func(*Context) {
+			passed = true
+		})),
 	}
+	ctx.Next()
+	return passed
 }
 
+// HandleMessage is the message create handler of the session
 func (r *Router) HandleMessage(s *discord.Session, m *discord.MessageCreate) {
+	r.ServeMessage(session.New(s), m)
+}
+
+// ServeMessage runs the message handlers of every command, on the dispatcher if there is one
+func (r *Router) ServeMessage(s session.Session, m *discord.MessageCreate) {
+	if r.Dispatcher == nil {
+		r.dispatchMessage(s, m.Message)
+		return
+	}
+
+	// Messages queued behind a running answer of their channel must not wait for it on the dispatcher
+	if r.queueMessage(s, m.Message) {
+		return
+	}
+
+	// Queued messages count as in-flight, so the shutdown waits until they are rejected
+	if !r.track() {
+		rejectMessage(s, m.Message)
+		return
+	}
+	err := r.Dispatcher.Submit(m.ChannelID, func() {
+		defer r.inflight.Done()
+		r.dispatchMessage(s, m.Message)
+	})
+	if err != nil {
+		r.inflight.Done()
+		MessagesDropped.Add(1)
+		log.Printf("[GID: %s, CHID: %s, MID: %s] Dropping message: %v\n", m.GuildID, m.ChannelID, m.ID, err)
+		rejectBusyMessage(s, m.Message)
+	}
+}
+
+// dispatchMessage runs the message handlers of every command
+func (r *Router) dispatchMessage(s session.Session, m *discord.Message) {
+	if r.isDraining() {
+		rejectMessage(s, m)
+		return
+	}
+
 	for _, cmd := range r.commands {
 		handlers := r.getMessageHandlers(cmd)
 		if len(handlers) > 0 {
-			ctx := NewMessageContext(s, cmd, m.Message, handlers)
-			ctx.Next()
+			handlers = append(append([]MessageHandler{}, r.messageMiddlewares...), handlers...)
+			r.handleMessageCommand(s, cmd, m, handlers)
 		}
 	}
 }
 
-func (r *Router) Sync(s *discord.Session, guild string) (err error) {
-	if s.State.User == nil {
-		return fmt.Errorf("cannot determine application id")
-	}
-	var commands []*discord.ApplicationCommand
-	for _, c := range r.commands {
-		commands = append(commands, c.ApplicationCommand())
+// queueMessage offers the message to the message queues of the commands answering its channel.
+// It reports whether a queue took the message or a middleware stopped it, it must not be dispatched then
+func (r *Router) queueMessage(s session.Session, m *discord.Message) bool {
+	for _, cmd := range r.commands {
+		for _, queue := range r.getMessageQueues(cmd) {
+			if !queue.Answering(s, m) {
+				continue
+			}
+			reached, queued := false, false
+			handlers := append(slices.Clone(r.messageMiddlewares), MessageHandlerFunc(func(ctx *MessageContext) {
+				reached = true
+				queued = queue.Enqueue(ctx)
+			}))
+			r.handleMessageCommand(s, cmd, m, handlers)
+			if !reached || queued {
+				return true
+			}
+		}
 	}
-	r.registeredCommands, err = s.ApplicationCommandBulkOverwrite(s.State.User.ID, guild, commands)
-	return
+	return false
 }
 
-func (r *Router) ClearCommands(s *discord.Session, guild string) (errors []error) {
-	if s.State.User == nil {
-		return []error{fmt.Errorf("cannot determine application id")}
+func (r *Router) handleMessageCommand(s session.Session, cmd *Command, m *discord.Message, handlers []MessageHandler) {
+	handlerCtx, end, ok := r.begin(s, r.Timeouts.Message, messageEvent(cmd.Name, m))
+	if !ok {
+		rejectMessage(s, m)
+		return
 	}
-	for _, v := range r.registeredCommands {
-		err := s.ApplicationCommandDelete(s.State.User.ID, guild, v.ID)
-		if err != nil {
-			log.Panicf("cannot delete %v command : %v ", v.Name, err)
-		}
+	defer end()
+	panicErr := &PanicError{
+		Handler:   "message",
+		Name:      cmd.Name,
+		GuildID:   m.GuildID,
+		ChannelID: m.ChannelID,
+		MessageID: m.ID,
 	}
-	if len(errors) == 0 {
-		return nil
+	if m.Author != nil {
+		panicErr.UserID = m.Author.ID
 	}
-	return errors
+	defer r.recoverPanic(handlerCtx, panicErr, func() {
+		replyMessageError(s, m)
+	})
+
+	ctx := NewMessageContext(handlerCtx, s, cmd, m, handlers)
+	ctx.Next()
 }
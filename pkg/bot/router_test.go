@@ -0,0 +1,39 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRouter_CommandTimeout(t *testing.T) {
+	r := NewRouter(nil)
+	r.Timeouts = Timeouts{
+		Default: time.Minute,
+		Commands: map[string]time.Duration{
+			"chat gpt": 5 * time.Minute,
+			"image":    2 * time.Minute,
+		},
+	}
+
+	tests := []struct {
+		name    string
+		cmd     *Command
+		path    string
+		timeout time.Duration
+	}{
+		{"configured path", &Command{}, "chat gpt", 5 * time.Minute},
+		{"subcommand of configured path", &Command{}, "image dalle", 2 * time.Minute},
+		{"configured timeout over own timeout", &Command{Timeout: time.Second}, "image dalle", 2 * time.Minute},
+		{"own timeout", &Command{Timeout: time.Second}, "chat compare", time.Second},
+		{"sibling of configured path", &Command{}, "chat compose", time.Minute},
+		{"similar command name", &Command{}, "imagine", time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if timeout := r.commandTimeout(tt.cmd, tt.path); timeout != tt.timeout {
+				t.Errorf("Expected timeout %v for %q, got %v", tt.timeout, tt.path, timeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+// gateway shards sharing the router, so one deployment can serve more guilds than a single gateway session allows
+
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	discord "github.com/bwmarrin/discordgo"
+)
+
+// shardIdentifyInterval is how long Discord wants between identifying shards of the same rate limit bucket
+const shardIdentifyInterval = 5 * time.Second
+
+// ShardOptions selects the gateway shards the bot runs
+type ShardOptions struct {
+	// Count is the total number of shards of the bot, 0 uses the number recommended by Discord
+	Count int `yaml:"count"`
+	// IDs are the shards this process runs, empty runs all of them. Other processes run the rest
+	IDs []int `yaml:"ids"`
+}
+
+// Validate checks the shard IDs are within the shard count
+func (o *ShardOptions) Validate() error {
+	if o.Count < 0 {
+		return errors.New("shard count must not be negative")
+	}
+	if len(o.IDs) > 0 && o.Count == 0 {
+		return errors.New("shard IDs require the shard count")
+	}
+	for i, id := range o.IDs {
+		if id < 0 || id >= o.Count {
+			return fmt.Errorf("shard ID %d must be less than the shard count %d", id, o.Count)
+		}
+		if slices.Contains(o.IDs[:i], id) {
+			return fmt.Errorf("shard ID %d is listed more than once", id)
+		}
+	}
+	return nil
+}
+
+// shardIDs returns the shards to run out of count
+func (o *ShardOptions) shardIDs(count int) []int {
+	if len(o.IDs) > 0 {
+		return o.IDs
+	}
+	ids := make([]int, count)
+	for i := range ids {
+		ids[i] = i
+	}
+	return ids
+}
+
+// ShardState is the connection state of a shard
+type ShardState string
+
+const (
+	ShardConnecting   ShardState = "connecting"
+	ShardReady        ShardState = "ready"
+	ShardDisconnected ShardState = "disconnected"
+)
+
+// Shard is a gateway session receiving the events of a part of the guilds
+type Shard struct {
+	ID      int
+	Session *discord.Session
+
+	mu    sync.Mutex
+	state ShardState
+	since time.Time
+}
+
+// ShardStatus reports the state of a shard, e.g. for health checks
+type ShardStatus struct {
+	ID    int        `json:"id"`
+	Count int        `json:"count"`
+	State ShardState `json:"state"`
+	// Since is when the shard entered the state
+	Since   time.Time     `json:"since"`
+	Guilds  int           `json:"guilds"`
+	Latency time.Duration `json:"latency"`
+}
+
+func newShard(s *discord.Session, id int, count int) *Shard {
+	s.ShardID = id
+	s.ShardCount = count
+	shard := &Shard{
+		ID:      id,
+		Session: s,
+		state:   ShardConnecting,
+		since:   time.Now(),
+	}
+	s.AddHandler(func(s *discord.Session, r *discord.Ready) {
+		log.Printf("[Shard: %d/%d] Logged in as: %v#%v with %d guilds", id, count, r.User.Username, r.User.Discriminator, len(r.Guilds))
+		shard.setState(ShardReady)
+	})
+	s.AddHandler(func(s *discord.Session, r *discord.Resumed) {
+		log.Printf("[Shard: %d/%d] Resumed the gateway session", id, count)
+		shard.setState(ShardReady)
+	})
+	s.AddHandler(func(s *discord.Session, d *discord.Disconnect) {
+		log.Printf("[Shard: %d/%d] Disconnected from the gateway", id, count)
+		shard.setState(ShardDisconnected)
+	})
+	return shard
+}
+
+func (s *Shard) setState(state ShardState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state != state {
+		s.state = state
+		s.since = time.Now()
+	}
+}
+
+// Status returns the current state of the shard
+func (s *Shard) Status() ShardStatus {
+	s.mu.Lock()
+	status := ShardStatus{
+		ID:    s.ID,
+		Count: s.Session.ShardCount,
+		State: s.state,
+		Since: s.since,
+	}
+	s.mu.Unlock()
+
+	if s.Session.State != nil {
+		s.Session.State.RLock()
+		status.Guilds = len(s.Session.State.Guilds)
+		s.Session.State.RUnlock()
+	}
+	if status.State == ShardReady {
+		status.Latency = s.Session.HeartbeatLatency()
+	}
+	return status
+}
+
+// ShardStatuses returns the state of every shard the bot runs
+func (b *Bot) ShardStatuses() []ShardStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	statuses := make([]ShardStatus, len(b.Shards))
+	for i, shard := range b.Shards {
+		statuses[i] = shard.Status()
+	}
+	return statuses
+}
+
+// openShards connects the shards selected by options one after another. All shards share the router,
+// and the first one keeps serving the REST requests of the bot, e.g. syncing commands
+func (b *Bot) openShards(options ShardOptions) error {
+	count := options.Count
+	maxConcurrency := 1
+	if count == 0 {
+		gateway, err := b.GatewayBot()
+		if err != nil {
+			return fmt.Errorf("failed to get the recommended shard count: %w", err)
+		}
+		count = max(gateway.Shards, 1)
+		maxConcurrency = max(gateway.SessionStartLimit.MaxConcurrency, 1)
+	}
+
+	ids := options.shardIDs(count)
+	log.Printf("Opening %d of %d shards", len(ids), count)
+	for i, id := range ids {
+		s := b.Session
+		if i > 0 {
+			var err error
+			if s, err = discord.New(b.Token); err != nil {
+				return err
+			}
+			s.Identify.Intents = b.Identify.Intents
+			// Shards of the same bucket must not identify at the same time
+			if i%maxConcurrency == 0 {
+				time.Sleep(shardIdentifyInterval)
+			}
+		}
+		shard := newShard(s, id, count)
+		s.AddHandler(b.Router.HandleInteraction)
+		s.AddHandler(b.Router.HandleMessage)
+
+		b.mu.Lock()
+		b.Shards = append(b.Shards, shard)
+		b.mu.Unlock()
+
+		if err := s.Open(); err != nil {
+			return fmt.Errorf("failed to open shard %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// closeShards disconnects every shard from the gateway
+func (b *Bot) closeShards() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, shard := range b.Shards {
+		if err := shard.Session.Close(); err != nil {
+			log.Printf("[Shard: %d/%d] Failed to close the gateway session: %v", shard.ID, shard.Session.ShardCount, err)
+		}
+	}
+}
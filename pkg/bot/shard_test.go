@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"slices"
+	"testing"
+
+	discord "github.com/bwmarrin/discordgo"
+)
+
+func TestShardOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options ShardOptions
+		wantErr string
+	}{
+		{name: "automatic", options: ShardOptions{}},
+		{name: "all shards", options: ShardOptions{Count: 4}},
+		{name: "some shards", options: ShardOptions{Count: 4, IDs: []int{1, 3}}},
+		{name: "negative count", options: ShardOptions{Count: -1}, wantErr: "shard count must not be negative"},
+		{name: "IDs without count", options: ShardOptions{IDs: []int{0}}, wantErr: "shard IDs require the shard count"},
+		{name: "ID out of range", options: ShardOptions{Count: 2, IDs: []int{2}}, wantErr: "shard ID 2 must be less than the shard count 2"},
+		{name: "duplicate ID", options: ShardOptions{Count: 2, IDs: []int{1, 1}}, wantErr: "shard ID 1 is listed more than once"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("Expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestShardOptions_ShardIDs(t *testing.T) {
+	all := (&ShardOptions{}).shardIDs(3)
+	if !slices.Equal(all, []int{0, 1, 2}) {
+		t.Errorf("Expected all shards, got %v", all)
+	}
+	some := (&ShardOptions{Count: 3, IDs: []int{2}}).shardIDs(3)
+	if !slices.Equal(some, []int{2}) {
+		t.Errorf("Expected the configured shards, got %v", some)
+	}
+}
+
+func TestBot_ShardStatuses(t *testing.T) {
+	b := &Bot{}
+	for id := range 2 {
+		s := &discord.Session{State: discord.NewState()}
+		b.Shards = append(b.Shards, newShard(s, id, 2))
+	}
+	b.Shards[1].Session.State.GuildAdd(&discord.Guild{ID: "guild"})
+	b.Shards[1].setState(ShardReady)
+
+	statuses := b.ShardStatuses()
+	if len(statuses) != 2 {
+		t.Fatalf("Expected 2 shard statuses, got %d", len(statuses))
+	}
+	if statuses[0].State != ShardConnecting || statuses[0].Count != 2 {
+		t.Errorf("Expected shard 0 of 2 to be connecting, got %+v", statuses[0])
+	}
+	if statuses[1].State != ShardReady || statuses[1].Guilds != 1 {
+		t.Errorf("Expected shard 1 to be ready with a guild, got %+v", statuses[1])
+	}
+	if b.Shards[1].Session.ShardID != 1 {
+		t.Errorf("Expected the session to identify as shard 1, got %d", b.Shards[1].Session.ShardID)
+	}
+}
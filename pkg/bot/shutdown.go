@@ -0,0 +1,157 @@
+// draining of in-flight handlers when the bot shuts down
+
+package bot
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+// ErrShuttingDown is the cause of the cancellation of handlers that did not finish within the grace period
+var ErrShuttingDown = errors.New("bot is shutting down")
+
+// shutdownCancelWait is how long cancelled handlers get to tell their users before threads are unlocked for them
+const shutdownCancelWait = 10 * time.Second
+
+// Catalog keys of the replies to events received while shutting down
+const (
+	restartingMessage       = "bot.restarting"
+	restartingResendMessage = "bot.restarting_resend"
+)
+
+// begin tracks a handler invocation with the given timeout, described by event in lifecycle events.
+// The returned function ends it. Once the router is shutting down, no invocation begins and false is returned
+func (r *Router) begin(s session.Session, timeout time.Duration, event Event) (context.Context, func(), bool) {
+	r.mu.Lock()
+	if r.draining {
+		r.mu.Unlock()
+		return nil, nil, false
+	}
+	inv := newInvocation(r, s, event)
+	if r.invocations == nil {
+		r.invocations = make(map[*invocation]struct{})
+	}
+	r.invocations[inv] = struct{}{}
+	r.inflight.Add(1)
+	r.mu.Unlock()
+
+	ctx := context.WithValue(r.context(), invocationKey{}, inv)
+	var cancel context.CancelFunc
+	if timeout <= 0 {
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	return ctx, func() {
+		cancel()
+		r.mu.Lock()
+		delete(r.invocations, inv)
+		r.mu.Unlock()
+		r.inflight.Done()
+	}, true
+}
+
+// track counts work that has not begun yet as in-flight, unless the router is shutting down
+func (r *Router) track() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.draining {
+		return false
+	}
+	r.inflight.Add(1)
+	return true
+}
+
+// Detach returns a context for work that outlives the handler of ctx, e.g. in a goroutine started with Go.
+// It is not cancelled when the handler returns or times out, only when the bot shuts down
+func Detach(ctx context.Context) context.Context {
+	inv := invocationFrom(ctx)
+	if inv == nil {
+		return context.WithoutCancel(ctx)
+	}
+	return context.WithValue(inv.router.context(), invocationKey{}, inv)
+}
+
+// Shutdown stops accepting new interactions and messages and waits up to grace for the in-flight handlers.
+// Handlers still running are cancelled with ErrShuttingDown, so they can tell their users to resend,
+// and the threads they locked are unlocked
+func (r *Router) Shutdown(grace time.Duration) {
+	r.mu.Lock()
+	r.draining = true
+	r.mu.Unlock()
+
+	finished := waitTimeout(&r.inflight, grace)
+	if !finished {
+		r.mu.Lock()
+		log.Printf("Cancelling %d handlers still running after %v", len(r.invocations), grace)
+		r.mu.Unlock()
+	}
+	// Cancelling also stops detached work nobody waits for
+	if r.cancel != nil {
+		r.cancel(ErrShuttingDown)
+	}
+	if finished || waitTimeout(&r.inflight, shutdownCancelWait) {
+		// Nothing is queued anymore, so the workers stop right away
+		if r.Dispatcher != nil {
+			r.Dispatcher.Close()
+		}
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	log.Printf("%d handlers did not stop, unlocking their threads", len(r.invocations))
+	for inv := range r.invocations {
+		inv.unlockThreads()
+	}
+}
+
+// isDraining reports whether the router stopped accepting new work
+func (r *Router) isDraining() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.draining
+}
+
+// waitTimeout waits for wg and reports whether it finished within timeout
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// rejectInteraction tells the user the interaction was not handled because the bot is restarting
+func rejectInteraction(s session.Session, i *discord.InteractionCreate) {
+	if i.Type == discord.InteractionApplicationCommandAutocomplete {
+		return
+	}
+	if err := respondEphemeral(s, i.Interaction, i18n.Text(InteractionLocale(i.Interaction), restartingMessage)); err != nil {
+		log.Printf("[GID: %s, i.ID: %s] Failed to respond to interaction with the error: %v\n", i.GuildID, i.ID, err)
+	}
+}
+
+// rejectMessage asks the user to resend a message in a thread of the bot once it is back
+func rejectMessage(s session.Session, m *discord.Message) {
+	if !isBotThreadMessage(s, m) {
+		return
+	}
+	if _, err := s.ChannelMessageSendReply(m.ChannelID, i18n.Text(MessageLocale(s, m), restartingResendMessage), m.Reference()); err != nil {
+		log.Printf("[GID: %s, CHID: %s, MID: %s] Failed to reply in the thread with the error: %v\n", m.GuildID, m.ChannelID, m.ID, err)
+	}
+}
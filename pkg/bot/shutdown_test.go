@@ -0,0 +1,95 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session/sessiontest"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+func TestShutdown_WaitsForHandlers(t *testing.T) {
+	r := NewRouter(nil)
+	r.SetContext(context.Background())
+
+	ctx, end, ok := r.begin(nil, 0, Event{})
+	if !ok {
+		t.Fatal("Expected the handler to begin")
+	}
+	finished := false
+	Go(ctx, func() {
+		time.Sleep(20 * time.Millisecond)
+		finished = true
+	})
+	end()
+
+	r.Shutdown(time.Second)
+	if !finished {
+		t.Error("Expected shutdown to wait for the goroutine of the handler")
+	}
+	if _, _, ok := r.begin(nil, 0, Event{}); ok {
+		t.Error("Expected no handler to begin after shutdown")
+	}
+}
+
+func TestShutdown_CancelsHandlersAfterGracePeriod(t *testing.T) {
+	r := NewRouter(nil)
+	r.SetContext(context.Background())
+
+	ctx, end, _ := r.begin(nil, time.Hour, Event{})
+	cause := make(chan error, 1)
+	go func() {
+		defer end()
+		<-ctx.Done()
+		cause <- context.Cause(ctx)
+	}()
+
+	r.Shutdown(10 * time.Millisecond)
+	if err := <-cause; !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Expected the handler to be cancelled with ErrShuttingDown, got %v", err)
+	}
+}
+
+func TestDetach(t *testing.T) {
+	r := NewRouter(nil)
+	r.SetContext(context.Background())
+
+	ctx, end, _ := r.begin(nil, time.Hour, Event{})
+	detached := Detach(ctx)
+	end()
+	if ctx.Err() == nil {
+		t.Fatal("Expected the handler context to be cancelled when the handler ends")
+	}
+	if detached.Err() != nil {
+		t.Fatal("Expected the detached context to outlive the handler")
+	}
+	if invocationFrom(detached) == nil {
+		t.Error("Expected the detached context to keep the invocation")
+	}
+
+	r.Shutdown(0)
+	if !errors.Is(context.Cause(detached), ErrShuttingDown) {
+		t.Errorf("Expected the detached context to be cancelled on shutdown, got %v", context.Cause(detached))
+	}
+}
+
+func TestRejectInteraction_Localized(t *testing.T) {
+	fake := sessiontest.NewFake("bot", "guild", "channel")
+	rejectInteraction(fake, &discord.InteractionCreate{Interaction: &discord.Interaction{
+		ID:        "i",
+		Type:      discord.InteractionApplicationCommand,
+		ChannelID: "channel",
+		Locale:    discord.German,
+	}})
+
+	if len(fake.Responses) != 1 {
+		t.Fatalf("Expected 1 response, got %d", len(fake.Responses))
+	}
+	want := i18n.Text(discord.German, restartingMessage)
+	if content := fake.Responses[0].Data.Content; content != want || content == i18n.Text(i18n.DefaultLocale, restartingMessage) {
+		t.Errorf("Expected the German restarting message, got %q", content)
+	}
+}
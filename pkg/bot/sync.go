@@ -0,0 +1,293 @@
+// synchronization of the registered application commands with the router
+
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	discord "github.com/bwmarrin/discordgo"
+)
+
+// Scope is a set of commands registered globally or in a single guild
+type Scope struct {
+	// GuildID is the guild the commands are registered in, empty registers them globally
+	GuildID string
+	// Commands are the names of the root commands of the scope, nil registers all commands
+	Commands []string
+}
+
+func (s Scope) String() string {
+	if s.GuildID == "" {
+		return "global"
+	}
+	return "guild " + s.GuildID
+}
+
+type SyncAction string
+
+const (
+	SyncCreate SyncAction = "create"
+	SyncUpdate SyncAction = "update"
+	SyncDelete SyncAction = "delete"
+)
+
+// SyncChange is a single change of the registered commands of a scope
+type SyncChange struct {
+	Scope  Scope
+	Action SyncAction
+	// Command is the desired command for create and update, and the registered command for delete
+	Command *discord.ApplicationCommand
+	// ID is the ID of the registered command for update and delete
+	ID string
+}
+
+func (c SyncChange) String() string {
+	return fmt.Sprintf("[%s] %s %s", c.Scope, c.Action, commandKey(c.Command))
+}
+
+// SyncPlan lists the changes needed to bring the registered commands in line with the router
+type SyncPlan struct {
+	Changes []SyncChange
+	// Unchanged is the number of registered commands that are already up to date
+	Unchanged int
+}
+
+func (p *SyncPlan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Command sync plan: %d changes, %d unchanged", len(p.Changes), p.Unchanged)
+	for _, change := range p.Changes {
+		b.WriteString("\n  ")
+		b.WriteString(change.String())
+	}
+	return b.String()
+}
+
+// PlanSync compares the commands of every scope with the commands registered in Discord
+func (r *Router) PlanSync(s *discord.Session, scopes []Scope) (*SyncPlan, error) {
+	if s.State.User == nil {
+		return nil, fmt.Errorf("cannot determine application id")
+	}
+
+	plan := &SyncPlan{}
+	for _, scope := range scopes {
+		desired, err := r.scopeCommands(scope)
+		if err != nil {
+			return nil, err
+		}
+		registered, err := s.ApplicationCommands(s.State.User.ID, scope.GuildID)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get registered commands of %s scope: %w", scope, err)
+		}
+		changes, unchanged := diffCommands(scope, desired, registered)
+		plan.Changes = append(plan.Changes, changes...)
+		plan.Unchanged += unchanged
+	}
+	return plan, nil
+}
+
+// ApplySync executes the plan. Failed changes do not stop the remaining ones, all errors are returned
+func (r *Router) ApplySync(s *discord.Session, plan *SyncPlan) error {
+	if s.State.User == nil {
+		return fmt.Errorf("cannot determine application id")
+	}
+
+	var errs []error
+	for _, change := range plan.Changes {
+		var err error
+		switch change.Action {
+		case SyncCreate:
+			_, err = s.ApplicationCommandCreate(s.State.User.ID, change.Scope.GuildID, change.Command)
+		case SyncUpdate:
+			_, err = s.ApplicationCommandEdit(s.State.User.ID, change.Scope.GuildID, change.ID, change.Command)
+		case SyncDelete:
+			err = s.ApplicationCommandDelete(s.State.User.ID, change.Scope.GuildID, change.ID)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot %s: %w", change, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SyncScopes brings the registered commands of every scope in line with the router.
+// With dryRun, only the plan is computed
+func (r *Router) SyncScopes(s *discord.Session, scopes []Scope, dryRun bool) (*SyncPlan, error) {
+	plan, err := r.PlanSync(s, scopes)
+	if err != nil || dryRun {
+		return plan, err
+	}
+	r.syncedScopes = scopes
+	return plan, r.ApplySync(s, plan)
+}
+
+// Sync registers all commands in the guild, or globally if guild is empty
+func (r *Router) Sync(s *discord.Session, guild string) error {
+	_, err := r.SyncScopes(s, []Scope{{GuildID: guild}}, false)
+	return err
+}
+
+// ClearCommands deletes the commands of the synced scopes. Failed deletions do not stop the remaining ones
+func (r *Router) ClearCommands(s *discord.Session) error {
+	if s.State.User == nil {
+		return fmt.Errorf("cannot determine application id")
+	}
+
+	var errs []error
+	for _, scope := range r.syncedScopes {
+		registered, err := s.ApplicationCommands(s.State.User.ID, scope.GuildID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot get registered commands of %s scope: %w", scope, err))
+			continue
+		}
+		for _, cmd := range registered {
+			if err := s.ApplicationCommandDelete(s.State.User.ID, scope.GuildID, cmd.ID); err != nil {
+				errs = append(errs, fmt.Errorf("cannot delete %v command of %s scope: %w", cmd.Name, scope, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// scopeCommands returns the application commands of the scope, localized with the catalog
+func (r *Router) scopeCommands(scope Scope) ([]*discord.ApplicationCommand, error) {
+	var commands []*discord.ApplicationCommand
+	if scope.Commands == nil {
+		for _, c := range r.commands {
+			commands = append(commands, localizeCommand(c.ApplicationCommand()))
+		}
+		return commands, nil
+	}
+
+	for _, name := range scope.Commands {
+		c := r.Get(name)
+		if c == nil {
+			return nil, fmt.Errorf("unknown command '%s' in %s scope", name, scope)
+		}
+		commands = append(commands, localizeCommand(c.ApplicationCommand()))
+	}
+	return commands, nil
+}
+
+// diffCommands returns the changes turning the registered commands into the desired ones.
+// Commands are matched by type and name, as chat and context menu commands may share a name
+func diffCommands(scope Scope, desired []*discord.ApplicationCommand, registered []*discord.ApplicationCommand) (changes []SyncChange, unchanged int) {
+	registeredByKey := make(map[string]*discord.ApplicationCommand, len(registered))
+	for _, cmd := range registered {
+		registeredByKey[commandKey(cmd)] = cmd
+	}
+
+	for _, cmd := range desired {
+		key := commandKey(cmd)
+		existing, ok := registeredByKey[key]
+		delete(registeredByKey, key)
+		switch {
+		case !ok:
+			changes = append(changes, SyncChange{Scope: scope, Action: SyncCreate, Command: cmd})
+		case !commandsEqual(cmd, existing, scope.GuildID == ""):
+			changes = append(changes, SyncChange{Scope: scope, Action: SyncUpdate, Command: cmd, ID: existing.ID})
+		default:
+			unchanged++
+		}
+	}
+	for _, cmd := range registeredByKey {
+		changes = append(changes, SyncChange{Scope: scope, Action: SyncDelete, Command: cmd, ID: cmd.ID})
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Action != changes[j].Action {
+			return changes[i].Action < changes[j].Action
+		}
+		return commandKey(changes[i].Command) < commandKey(changes[j].Command)
+	})
+	return changes, unchanged
+}
+
+func commandType(cmd *discord.ApplicationCommand) discord.ApplicationCommandType {
+	if cmd.Type == 0 {
+		return discord.ChatApplicationCommand
+	}
+	return cmd.Type
+}
+
+func commandKey(cmd *discord.ApplicationCommand) string {
+	switch commandType(cmd) {
+	case discord.UserApplicationCommand:
+		return "user:" + cmd.Name
+	case discord.MessageApplicationCommand:
+		return "message:" + cmd.Name
+	}
+	return cmd.Name
+}
+
+// commandSignature holds the fields of a command Discord stores.
+// Defaults Discord fills in are normalized, so desired and registered commands compare equal
+type commandSignature struct {
+	Type                     discord.ApplicationCommandType      `json:"type"`
+	Name                     string                              `json:"name"`
+	NameLocalizations        map[discord.Locale]string           `json:"name_localizations"`
+	Description              string                              `json:"description"`
+	DescriptionLocalizations map[discord.Locale]string           `json:"description_localizations"`
+	DefaultMemberPermissions *int64                              `json:"default_member_permissions"`
+	DMPermission             bool                                `json:"dm_permission"`
+	NSFW                     bool                                `json:"nsfw"`
+	Options                  []*discord.ApplicationCommandOption `json:"options"`
+}
+
+func signature(cmd *discord.ApplicationCommand, global bool) commandSignature {
+	sig := commandSignature{
+		Type:                     commandType(cmd),
+		Name:                     cmd.Name,
+		Description:              cmd.Description,
+		DefaultMemberPermissions: cmd.DefaultMemberPermissions,
+		NSFW:                     cmd.NSFW != nil && *cmd.NSFW,
+		Options:                  normalizeOptions(cmd.Options),
+	}
+	if cmd.NameLocalizations != nil && len(*cmd.NameLocalizations) > 0 {
+		sig.NameLocalizations = *cmd.NameLocalizations
+	}
+	if cmd.DescriptionLocalizations != nil && len(*cmd.DescriptionLocalizations) > 0 {
+		sig.DescriptionLocalizations = *cmd.DescriptionLocalizations
+	}
+	// DM permission only applies to global commands and defaults to true
+	if global {
+		sig.DMPermission = cmd.DMPermission == nil || *cmd.DMPermission
+	}
+	return sig
+}
+
+func normalizeOptions(options []*discord.ApplicationCommandOption) []*discord.ApplicationCommandOption {
+	if len(options) == 0 {
+		return nil
+	}
+	normalized := make([]*discord.ApplicationCommandOption, len(options))
+	for i, option := range options {
+		o := *option
+		o.Options = normalizeOptions(option.Options)
+		if len(o.Choices) == 0 {
+			o.Choices = nil
+		}
+		if len(o.ChannelTypes) == 0 {
+			o.ChannelTypes = nil
+		}
+		if len(o.NameLocalizations) == 0 {
+			o.NameLocalizations = nil
+		}
+		if len(o.DescriptionLocalizations) == 0 {
+			o.DescriptionLocalizations = nil
+		}
+		normalized[i] = &o
+	}
+	return normalized
+}
+
+// commandsEqual compares the commands by their JSON representation,
+// so choice values compare equal regardless of their Go type
+func commandsEqual(a *discord.ApplicationCommand, b *discord.ApplicationCommand, global bool) bool {
+	left, errLeft := json.Marshal(signature(a, global))
+	right, errRight := json.Marshal(signature(b, global))
+	return errLeft == nil && errRight == nil && string(left) == string(right)
+}
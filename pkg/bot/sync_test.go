@@ -0,0 +1,153 @@
+package bot
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	discord "github.com/bwmarrin/discordgo"
+)
+
+func testCommands() *Router {
+	minTemperature := 0.0
+	return NewRouter([]*Command{
+		{
+			Name:        "chat",
+			Description: "Start conversation",
+			Type:        discord.ChatApplicationCommand,
+			Options: []*discord.ApplicationCommandOption{
+				{
+					Type:        discord.ApplicationCommandOptionNumber,
+					Name:        "temperature",
+					Description: "Sampling temperature",
+					MinValue:    &minTemperature,
+					MaxValue:    2,
+				},
+			},
+		},
+		{
+			Name:        "image",
+			Description: "Generate an image",
+			SubCommands: NewRouter([]*Command{
+				{Name: "dalle", Description: "Generate with DALL-E"},
+				{Name: "flux", Description: "Generate with FLUX"},
+				{Name: "sdxl", Description: "Generate with Stable Diffusion XL"},
+				{Name: "upscale", Description: "Upscale an image"},
+			}),
+		},
+		{
+			Name:        "info",
+			Description: "Show info",
+		},
+		{
+			Name: "Summarize",
+			Type: discord.MessageApplicationCommand,
+		},
+	})
+}
+
+// registered returns the commands as Discord reports them after registration
+func registered(r *Router, scope Scope) []*discord.ApplicationCommand {
+	commands, _ := r.scopeCommands(scope)
+	var result []*discord.ApplicationCommand
+	for _, cmd := range commands {
+		registered := *cmd
+		registered.ID = "id-" + cmd.Name
+		registered.Type = commandType(cmd)
+		registered.Options = normalizeOptions(cmd.Options)
+		result = append(result, &registered)
+	}
+	return result
+}
+
+func TestDiffCommands_Unchanged(t *testing.T) {
+	r := testCommands()
+	scope := Scope{}
+	desired, _ := r.scopeCommands(scope)
+
+	changes, unchanged := diffCommands(scope, desired, registered(r, scope))
+	if len(changes) != 0 || unchanged != 4 {
+		t.Errorf("Expected no changes, got %v and %d unchanged", changes, unchanged)
+	}
+}
+
+// Subcommands are kept in a map, Discord returns them in the order they were registered
+func TestDiffCommands_SubcommandOrder(t *testing.T) {
+	r := testCommands()
+	scope := Scope{}
+	existing := registered(r, scope)
+
+	for i := 0; i < 20; i++ {
+		desired, _ := r.scopeCommands(scope)
+		changes, unchanged := diffCommands(scope, desired, existing)
+		if len(changes) != 0 || unchanged != 4 {
+			t.Fatalf("Expected no changes, got %v and %d unchanged", changes, unchanged)
+		}
+	}
+
+	var names []string
+	for _, option := range r.Get("image").ApplicationCommand().Options {
+		names = append(names, option.Name)
+	}
+	if want := []string{"dalle", "flux", "sdxl", "upscale"}; !slices.Equal(names, want) {
+		t.Errorf("Expected subcommands %v, got %v", want, names)
+	}
+}
+
+func TestDiffCommands(t *testing.T) {
+	r := testCommands()
+	scope := Scope{GuildID: "123"}
+	existing := registered(r, scope)
+
+	// "info" was changed, "Summarize" is new and "old" was removed from the bot
+	var current []*discord.ApplicationCommand
+	for _, cmd := range existing {
+		switch cmd.Name {
+		case "info":
+			cmd.Description = "Show outdated info"
+		case "Summarize":
+			continue
+		}
+		current = append(current, cmd)
+	}
+	current = append(current, &discord.ApplicationCommand{ID: "id-old", Name: "old", Type: discord.ChatApplicationCommand})
+
+	desired, _ := r.scopeCommands(scope)
+	changes, unchanged := diffCommands(scope, desired, current)
+	if unchanged != 2 {
+		t.Errorf("Expected 2 unchanged commands, got %d", unchanged)
+	}
+
+	got := make([]string, 0, len(changes))
+	for _, change := range changes {
+		got = append(got, change.String())
+	}
+	want := []string{
+		"[guild 123] create message:Summarize",
+		"[guild 123] delete old",
+		"[guild 123] update info",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected plan:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	for _, change := range changes {
+		if change.Action != SyncCreate && change.ID == "" {
+			t.Errorf("Expected %s to reference the registered command", change)
+		}
+	}
+}
+
+func TestScopeCommands(t *testing.T) {
+	r := testCommands()
+	commands, err := r.scopeCommands(Scope{Commands: []string{"chat"}})
+	if err != nil || len(commands) != 1 || commands[0].Name != "chat" {
+		t.Errorf("Expected only the chat command, got %v (error %v)", commands, err)
+	}
+	if _, err := r.scopeCommands(Scope{Commands: []string{"missing"}}); err == nil {
+		t.Error("Expected unknown command to be reported")
+	}
+	commands, _ = r.scopeCommands(Scope{Commands: []string{}})
+	if len(commands) != 0 {
+		t.Errorf("Expected an empty scope, got %d commands", len(commands))
+	}
+}
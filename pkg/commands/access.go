@@ -0,0 +1,216 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/access"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+const (
+	accessCommandName = "access"
+
+	accessOptionCommand = "command"
+	accessOptionModel   = "model"
+	accessOptionRole    = "role"
+	accessOptionChannel = "channel"
+	accessOptionID      = "id"
+
+	accessEmbedColor = 0x00bfff
+)
+
+// AccessCommand lets admins list, add and remove the access rules of their guild at runtime
+func AccessCommand(policy *access.Policy) *bot.Command {
+	minID := 1.0
+	return &bot.Command{
+		Name:                     accessCommandName,
+		Description:              "Manage who can use which commands and models",
+		DMPermission:             false,
+		DefaultMemberPermissions: discord.PermissionManageGuild,
+		SubCommands: bot.NewRouter([]*bot.Command{
+			{
+				Name:        "list",
+				Description: "List the access rules of this server",
+				Handler: bot.HandlerFunc(func(ctx *bot.Context) {
+					accessListHandler(ctx, policy)
+				}),
+			},
+			{
+				Name:        "restrict",
+				Description: "Restrict a command or model to a role or channel",
+				Options: []*discord.ApplicationCommandOption{
+					{
+						Type:        discord.ApplicationCommandOptionString,
+						Name:        accessOptionCommand,
+						Description: "Command path, e.g. \"chat gpt\". Omit to restrict all commands",
+						Required:    false,
+					},
+					{
+						Type:        discord.ApplicationCommandOptionString,
+						Name:        accessOptionModel,
+						Description: "Model pattern, e.g. \"openai/gpt-4*\". Omit to restrict all models",
+						Required:    false,
+					},
+					{
+						Type:        discord.ApplicationCommandOptionRole,
+						Name:        accessOptionRole,
+						Description: "Role allowed to use it",
+						Required:    false,
+					},
+					{
+						Type:         discord.ApplicationCommandOptionChannel,
+						Name:         accessOptionChannel,
+						Description:  "Channel it is allowed in",
+						Required:     false,
+						ChannelTypes: []discord.ChannelType{discord.ChannelTypeGuildText},
+					},
+				},
+				Handler: bot.HandlerFunc(func(ctx *bot.Context) {
+					accessRestrictHandler(ctx, policy)
+				}),
+			},
+			{
+				Name:        "remove",
+				Description: "Remove an access rule added with /access restrict",
+				Options: []*discord.ApplicationCommandOption{
+					{
+						Type:        discord.ApplicationCommandOptionInteger,
+						Name:        accessOptionID,
+						Description: "ID of the rule as shown by /access list",
+						Required:    true,
+						MinValue:    &minID,
+					},
+				},
+				Handler: bot.HandlerFunc(func(ctx *bot.Context) {
+					accessRemoveHandler(ctx, policy)
+				}),
+			},
+		}),
+	}
+}
+
+func accessListHandler(ctx *bot.Context, policy *access.Policy) {
+	rules := policy.Rules(ctx.Interaction.GuildID)
+	lines := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		lines = append(lines, accessRuleString(rule))
+	}
+	description := strings.Join(lines, "\n")
+	if description == "" {
+		description = i18n.Text(ctx.Locale(), "access.list.empty")
+	}
+	accessRespond(ctx, &discord.MessageEmbed{
+		Title:       i18n.Text(ctx.Locale(), "access.list.title"),
+		Description: description,
+		Color:       accessEmbedColor,
+	})
+}
+
+func accessRestrictHandler(ctx *bot.Context, policy *access.Policy) {
+	rule := access.Rule{Guild: ctx.Interaction.GuildID}
+	if command := strings.TrimSpace(ctx.StringOption(accessOptionCommand, "")); command != "" {
+		rule.Commands = []string{strings.TrimPrefix(command, "/")}
+	}
+	if model := strings.TrimSpace(ctx.StringOption(accessOptionModel, "")); model != "" {
+		rule.Models = []string{model}
+	}
+	if role := ctx.RoleOption(accessOptionRole); role != nil {
+		rule.Roles = []string{role.ID}
+	}
+	if channel := ctx.ChannelOption(accessOptionChannel); channel != nil {
+		rule.Channels = []string{channel.ID}
+	}
+
+	id, err := policy.Add(rule)
+	if err != nil {
+		log.Printf("[GID: %s, i.ID: %s] Failed to add access rule with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		accessRespond(ctx, accessErrorEmbed(ctx.Locale(), err))
+		return
+	}
+	rule.ID = id
+	log.Printf("[GID: %s, i.ID: %s] Access rule %d added by UserID: %s\n", ctx.Interaction.GuildID, ctx.Interaction.ID, id, ctx.User().ID)
+	accessRespond(ctx, &discord.MessageEmbed{
+		Title:       i18n.Text(ctx.Locale(), "access.added.title"),
+		Description: accessRuleString(rule),
+		Color:       accessEmbedColor,
+	})
+}
+
+func accessRemoveHandler(ctx *bot.Context, policy *access.Policy) {
+	id := int(ctx.IntOption(accessOptionID, 0))
+	if err := policy.Remove(ctx.Interaction.GuildID, id); err != nil {
+		log.Printf("[GID: %s, i.ID: %s] Failed to remove access rule with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		accessRespond(ctx, accessErrorEmbed(ctx.Locale(), err))
+		return
+	}
+	log.Printf("[GID: %s, i.ID: %s] Access rule %d removed by UserID: %s\n", ctx.Interaction.GuildID, ctx.Interaction.ID, id, ctx.User().ID)
+	accessRespond(ctx, &discord.MessageEmbed{
+		Title:       i18n.Text(ctx.Locale(), "access.removed.title"),
+		Description: i18n.Text(ctx.Locale(), "access.removed.description", id),
+		Color:       accessEmbedColor,
+	})
+}
+
+// accessRuleString describes the rule in a single line, e.g. "#1 /chat gpt, models openai/gpt-4*: @Role"
+func accessRuleString(rule access.Rule) string {
+	var b strings.Builder
+	if rule.ID == 0 {
+		b.WriteString("(config)")
+	} else {
+		fmt.Fprintf(&b, "#%d", rule.ID)
+	}
+
+	if len(rule.Commands) == 0 {
+		b.WriteString(" all commands")
+	} else {
+		for i, command := range rule.Commands {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(&b, " `/%s`", command)
+		}
+	}
+	if len(rule.Models) > 0 {
+		fmt.Fprintf(&b, ", models `%s`", strings.Join(rule.Models, "`, `"))
+	}
+	if len(rule.Roles) > 0 {
+		b.WriteString(": roles")
+		for _, role := range rule.Roles {
+			fmt.Fprintf(&b, " <@&%s>", role)
+		}
+	}
+	if len(rule.Channels) > 0 {
+		b.WriteString(": channels")
+		for _, channel := range rule.Channels {
+			fmt.Fprintf(&b, " <#%s>", channel)
+		}
+	}
+	return b.String()
+}
+
+func accessErrorEmbed(locale discord.Locale, err error) *discord.MessageEmbed {
+	return &discord.MessageEmbed{
+		Title:       i18n.Text(locale, "error.title"),
+		Description: err.Error(),
+		Color:       0xff0000,
+	}
+}
+
+func accessRespond(ctx *bot.Context, embed *discord.MessageEmbed) {
+	err := ctx.Respond(&discord.InteractionResponse{
+		Type: discord.InteractionResponseChannelMessageWithSource,
+		Data: &discord.InteractionResponseData{
+			Embeds: []*discord.MessageEmbed{embed},
+			Flags:  discord.MessageFlagsEphemeral,
+			// Mentioned roles are shown, but not notified
+			AllowedMentions: &discord.MessageAllowedMentions{},
+		},
+	})
+	if err != nil {
+		log.Printf("[GID: %s, i.ID: %s] Failed to respond to interaction with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+	}
+}
@@ -0,0 +1,20 @@
+package commands
+
+import (
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/access"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/commands/gpt"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
+)
+
+type MessageActionCommandsParams struct {
+	CompletionClient openrouter.ChatCompletionClient
+	GPTMessagesCache *gpt.MessagesCache
+	Actions          []gpt.MessageAction
+	AccessPolicy     *access.Policy
+}
+
+// MessageActionCommands creates the message context menu commands, e.g. "Summarize"
+func MessageActionCommands(params *MessageActionCommandsParams) ([]*bot.Command, error) {
+	return gpt.MessageActionCommands(params.CompletionClient, params.GPTMessagesCache, params.Actions, params.AccessPolicy)
+}
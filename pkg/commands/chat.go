@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/access"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/commands/gpt"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
@@ -10,21 +11,34 @@ import (
 const chatCommandName = "chat"
 
 type ChatCommandParams struct {
-	OpenRouterClient       *openrouter.Client
-	CompletionModels       []string
-	GPTMessagesCache       *gpt.MessagesCache
-	IgnoredChannelsCache   *gpt.IgnoredChannelsCache
+	CompletionClient     openrouter.ChatCompletionClient
+	CompletionModels     []string
+	GPTMessagesCache     *gpt.MessagesCache
+	IgnoredChannelsCache *gpt.IgnoredChannelsCache
+	// ModelCatalog enables model autocompletion, nil offers CompletionModels as static choices
+	ModelCatalog *gpt.ModelCatalog
+	// AccessPolicy restricts the models, nil allows all models
+	AccessPolicy *access.Policy
 }
 
 func ChatCommand(params *ChatCommandParams) *bot.Command {
+	subcommands := []*bot.Command{
+		gpt.Command(params.CompletionClient, params.CompletionModels, params.GPTMessagesCache, params.IgnoredChannelsCache, params.ModelCatalog, params.AccessPolicy),
+		gpt.ComposeCommand(params.CompletionClient, params.CompletionModels, params.GPTMessagesCache, params.ModelCatalog, params.AccessPolicy),
+	}
+	// Comparing needs at least two models
+	if compare := gpt.CompareCommand(params.CompletionClient, params.CompletionModels, params.GPTMessagesCache, params.ModelCatalog, params.AccessPolicy); compare != nil {
+		subcommands = append(subcommands, compare)
+	}
+
 	return &bot.Command{
 		Name:                     chatCommandName,
 		Description:              "Start conversation with AI models via OpenRouter",
-		DMPermission:             false,
+		DMPermission:             true,
 		DefaultMemberPermissions: discord.PermissionViewChannel,
 		Type:                     discord.ChatApplicationCommand,
-		SubCommands: bot.NewRouter([]*bot.Command{
-			gpt.Command(params.OpenRouterClient, params.CompletionModels, params.GPTMessagesCache, params.IgnoredChannelsCache),
-		}),
+		SubCommands:              bot.NewRouter(subcommands),
+		// Whether the bot talks in direct messages can be toggled at runtime
+		Middlewares: []bot.Handler{access.DirectMessagesMiddleware(params.AccessPolicy)},
 	}
 }
@@ -1,15 +1,17 @@
 package dalle
 
 import (
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/access"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/moderation"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
 	discord "github.com/bwmarrin/discordgo"
 )
 
 const commandName = "dalle"
 
-func Command(client *openrouter.Client, imageModel string) *bot.Command {
-	numberOptionMinValue := 1.0
+func Command(client openrouter.ImageGenerationClient, imageModel string, policies *moderation.PolicySet, auditor moderation.Auditor, policy *access.Policy) *bot.Command {
+	numberOptionMinValue, numberOptionMaxValue := 1.0, 4.0
 	return &bot.Command{
 		Name:        commandName,
 		Description: "Generate creative images from textual description using OpenRouter AI models",
@@ -20,6 +22,9 @@ func Command(client *openrouter.Client, imageModel string) *bot.Command {
 				Description: "A text description of the desired image",
 				Required:    true,
 			},
+		},
+		// Options other than the prompt are validated, e.g. that the size is one of its choices
+		Schema: []*bot.OptionSchema{
 			{
 				Type:        discord.ApplicationCommandOptionString,
 				Name:        imageCommandOptionModel.String(),
@@ -69,7 +74,7 @@ func Command(client *openrouter.Client, imageModel string) *bot.Command {
 				Name:        imageCommandOptionNumber.String(),
 				Description: "The number of images to generate (default 1, max 4 for DALL-E 2, max 1 for DALL-E 3)",
 				MinValue:    &numberOptionMinValue,
-				MaxValue:    4,
+				MaxValue:    &numberOptionMaxValue,
 				Required:    false,
 			},
 			{
@@ -106,12 +111,12 @@ func Command(client *openrouter.Client, imageModel string) *bot.Command {
 			},
 		},
 		Handler: bot.HandlerFunc(func(ctx *bot.Context) {
-			imageHandler(ctx, client, imageModel)
+			imageHandler(ctx, client, imageModel, policy)
 		}),
 		Middlewares: []bot.Handler{
 			bot.HandlerFunc(imageInteractionResponseMiddleware),
 			bot.HandlerFunc(func(ctx *bot.Context) {
-				imageModerationMiddleware(ctx, client)
+				imageModerationMiddleware(ctx, policies, auditor)
 			}),
 		},
 	}
@@ -13,7 +13,7 @@ func TestCommand(t *testing.T) {
 	imageModel := "openai/dall-e-2"
 
 	// Create the command
-	cmd := Command(client, imageModel)
+	cmd := Command(client, imageModel, nil, nil, nil)
 
 	// Test basic command properties
 	if cmd.Name != commandName {
@@ -24,7 +24,8 @@ func TestCommand(t *testing.T) {
 		t.Error("Command description should not be empty")
 	}
 
-	// Test that all required options are present
+	// Test that all required options are present, including the options of the schema
+	options := cmd.ApplicationCommand().Options
 	expectedOptions := map[string]bool{
 		"prompt":  false,
 		"model":   false,
@@ -34,7 +35,7 @@ func TestCommand(t *testing.T) {
 		"style":   false,
 	}
 
-	for _, option := range cmd.Options {
+	for _, option := range options {
 		if _, exists := expectedOptions[option.Name]; exists {
 			expectedOptions[option.Name] = true
 		}
@@ -48,7 +49,7 @@ func TestCommand(t *testing.T) {
 	}
 
 	// Test prompt option (required)
-	promptOption := findOptionByName(cmd.Options, "prompt")
+	promptOption := findOptionByName(options, "prompt")
 	if promptOption == nil {
 		t.Fatal("Prompt option not found")
 	}
@@ -60,7 +61,7 @@ func TestCommand(t *testing.T) {
 	}
 
 	// Test model option (optional with choices)
-	modelOption := findOptionByName(cmd.Options, "model")
+	modelOption := findOptionByName(options, "model")
 	if modelOption == nil {
 		t.Fatal("Model option not found")
 	}
@@ -86,7 +87,7 @@ func TestCommand(t *testing.T) {
 	}
 
 	// Test size option (optional with choices)
-	sizeOption := findOptionByName(cmd.Options, "size")
+	sizeOption := findOptionByName(options, "size")
 	if sizeOption == nil {
 		t.Fatal("Size option not found")
 	}
@@ -112,7 +113,7 @@ func TestCommand(t *testing.T) {
 	}
 
 	// Test number option (optional with min/max values)
-	numberOption := findOptionByName(cmd.Options, "number")
+	numberOption := findOptionByName(options, "number")
 	if numberOption == nil {
 		t.Fatal("Number option not found")
 	}
@@ -130,7 +131,7 @@ func TestCommand(t *testing.T) {
 	}
 
 	// Test quality option (optional with choices)
-	qualityOption := findOptionByName(cmd.Options, "quality")
+	qualityOption := findOptionByName(options, "quality")
 	if qualityOption == nil {
 		t.Fatal("Quality option not found")
 	}
@@ -156,7 +157,7 @@ func TestCommand(t *testing.T) {
 	}
 
 	// Test style option (optional with choices)
-	styleOption := findOptionByName(cmd.Options, "style")
+	styleOption := findOptionByName(options, "style")
 	if styleOption == nil {
 		t.Fatal("Style option not found")
 	}
@@ -1,62 +1,61 @@
 package dalle
 
 import (
-	"context"
 	"fmt"
 	"log"
 
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/access"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/constants"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
 	discord "github.com/bwmarrin/discordgo"
 )
 
-func imageHandler(ctx *bot.Context, client *openrouter.Client, imageModel string) {
-	var prompt string
-	if option, ok := ctx.Options[imageCommandOptionPrompt.String()]; ok {
-		prompt = option.StringValue()
-	} else {
+func imageHandler(ctx *bot.Context, client openrouter.ImageGenerationClient, imageModel string, policy *access.Policy) {
+	prompt := ctx.StringOption(imageCommandOptionPrompt.String(), "")
+	if prompt == "" {
 		log.Printf("[GID:%s,i.ID:%s] Failed to parse prompt option\n", ctx.Interaction.GuildID, ctx.Interaction.ID)
 		ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
 			Embeds: []*discord.MessageEmbed{
 				{
-					Title:       "X Error",
-					Description: "Failed to parse prompt option",
+					Title:       i18n.Text(ctx.Locale(), "dalle.error.title"),
+					Description: i18n.Text(ctx.Locale(), "gpt.error.prompt_option"),
 					Color:       0xff0000,
 				},
 			},
 		})
 		return
 	}
-	size := imageDefaultSize
-	if option, ok := ctx.Options[imageCommandOptionSize.String()]; ok {
-		size = option.StringValue()
-		log.Printf("[GID : %s,i.ID:%s]Image size provided :%s\n", ctx.Interaction.GuildID, ctx.Interaction.ID, size)
-	}
-
-	number := 1
-	if option, ok := ctx.Options[imageCommandOptionNumber.String()]; ok {
-		number = int(option.IntValue())
-		log.Printf("[GID:%s,i.ID:%s] Image number provided :%d\n", ctx.Interaction.GuildID, ctx.Interaction.ID, number)
+	if denial := policy.Check(access.InteractionRequest(ctx.Session, ctx.Interaction, bot.CommandPath(ctx.Interaction.ApplicationCommandData()), imageModel)); denial != nil {
+		log.Printf("[GID:%s,i.ID:%s] Access denied: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, denial)
+		ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
+			Embeds: []*discord.MessageEmbed{access.DenialEmbed(ctx.Locale(), denial)},
+		})
+		return
 	}
+	size := ctx.StringOption(imageCommandOptionSize.String(), imageDefaultSize)
+	number := int(ctx.IntOption(imageCommandOptionNumber.String(), 1))
 	log.Printf("[GID:%s,CHID:%s] Dalle request [size:%s,Number:%d]invoked", ctx.Interaction.GuildID, ctx.Interaction.ChannelID, size, number)
+	bot.SetEventModel(ctx, imageModel, prompt)
 	resp, err := client.CreateImage(
-		context.Background(),
+		ctx,
 		openrouter.ImageRequest{
 			Prompt:         prompt,
 			Model:          imageModel,
 			N:              number,
 			Size:           size,
 			ResponseFormat: "url",
-			User:           ctx.Interaction.Member.User.ID,
+			User:           ctx.User().ID,
 		},
 	)
 	if err != nil {
 		log.Printf("[GID:%s,i.ID:%s] OpenRouter request CreateImage failed with the error:%v", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		bot.SetEventError(ctx, err)
 		ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
 			Embeds: []*discord.MessageEmbed{
 				{
-					Title:       "❌ OpenRouter API Failed",
+					Title:       i18n.Text(ctx.Locale(), "dalle.error.openrouter.title"),
 					Description: err.Error(),
 					Color:       0xff0000,
 				},
@@ -70,10 +69,10 @@ func imageHandler(ctx *bot.Context, client *openrouter.Client, imageModel string
 			URL: constants.OpenAIBlackIconURL,
 			Author: &discord.MessageEmbedAuthor{
 				Name:         prompt,
-				IconURL:      ctx.Interaction.Member.AvatarURL("32"),
+				IconURL:      ctx.User().AvatarURL("32"),
 				ProxyIconURL: constants.OpenAIBlackIconURL,
 			},
-			Footer: imageCreationUsageEmbedFooter(size, number),
+			Footer: imageCreationUsageEmbedFooter(ctx.Locale(), size, number),
 		},
 	}
 
@@ -88,7 +87,7 @@ func imageHandler(ctx *bot.Context, client *openrouter.Client, imageModel string
 			},
 		})
 		buttonComponents = append(buttonComponents, &discord.Button{
-			Label: fmt.Sprintf("Image %d", (i + 1)),
+			Label: i18n.Text(ctx.Locale(), "dalle.image.label", i+1),
 			Style: discord.LinkButton,
 			URL:   data.URL,
 		})
@@ -102,7 +101,7 @@ func imageHandler(ctx *bot.Context, client *openrouter.Client, imageModel string
 		ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
 			Embeds: []*discord.MessageEmbed{
 				{
-					Title:       "❌ Discord API Error",
+					Title:       i18n.Text(ctx.Locale(), "error.discord.title"),
 					Description: err.Error(),
 					Color:       0xff0000,
 				},
@@ -116,8 +115,8 @@ func imageHandler(ctx *bot.Context, client *openrouter.Client, imageModel string
 		Content: fmt.Sprintf("> %s", prompt),
 		Embeds: []*discord.MessageEmbed{
 			{
-				Title:       "✅ Discord API Success",
-				Description: "Your action completed successfully.",
+				Title:       i18n.Text(ctx.Locale(), "dalle.success.title"),
+				Description: i18n.Text(ctx.Locale(), "dalle.success.description"),
 				Color:       0x00ff00,
 			},
 		},
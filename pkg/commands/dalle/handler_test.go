@@ -27,7 +27,7 @@ func TestCommand_ClientInterface(t *testing.T) {
 	client := &openrouter.Client{}
 	imageModel := "openai/dall-e-2"
 	
-	cmd := Command(client, imageModel)
+	cmd := Command(client, imageModel, nil, nil, nil)
 	if cmd == nil {
 		t.Error("Command should not be nil")
 	}
@@ -1,15 +1,17 @@
 package dalle
 
 import (
+	"fmt"
 	"log"
 
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
-	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/moderation"
 	discord "github.com/bwmarrin/discordgo"
 )
 
 func imageInteractionResponseMiddleware(ctx *bot.Context) {
-	log.Printf("[GID:%s,i.ID:%s] Image interaction invoked by UserID: %s\n", ctx.Interaction.GuildID, ctx.Interaction.ID, ctx.Interaction.Member.User.ID)
+	log.Printf("[GID:%s,i.ID:%s] Image interaction invoked by UserID: %s\n", ctx.Interaction.GuildID, ctx.Interaction.ID, ctx.User().ID)
 
 	err := ctx.Respond(&discord.InteractionResponse{
 		Type: discord.InteractionResponseDeferredChannelMessageWithSource,
@@ -21,12 +23,83 @@ func imageInteractionResponseMiddleware(ctx *bot.Context) {
 
 	ctx.Next()
 }
-func imageModerationMiddleware(ctx *bot.Context, client *openrouter.Client) {
+func imageModerationMiddleware(ctx *bot.Context, policies *moderation.PolicySet, auditor moderation.Auditor) {
 	log.Printf("[GId : %s,i.ID:%s] Performing interaction moderation middleware\n", ctx.Interaction.GuildID, ctx.Interaction.ID)
 
-	// Note: OpenRouter doesn't have a direct moderation endpoint like OpenAI
-	// For now, we'll skip moderation and let OpenRouter handle content filtering
-	// TODO: Implement alternative content moderation if needed
-	log.Printf("[GID: %s, i.ID:%s] Skipping moderation check - OpenRouter handles content filtering\n", ctx.Interaction.GuildID, ctx.Interaction.ID)
-	ctx.Next()
+	policy := policies.ForGuild(ctx.Interaction.GuildID)
+	if policy == nil || !policy.Enabled {
+		log.Printf("[GID: %s, i.ID:%s] Skipping moderation check - moderation is disabled\n", ctx.Interaction.GuildID, ctx.Interaction.ID)
+		ctx.Next()
+		return
+	}
+
+	prompt := ctx.StringOption(imageCommandOptionPrompt.String(), "")
+
+	verdict, err := policy.Check(ctx, prompt)
+	if err != nil {
+		log.Printf("[GID: %s, i.ID:%s] Moderation check failed with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
+			Embeds: []*discord.MessageEmbed{
+				{
+					Title:       i18n.Text(ctx.Locale(), "dalle.moderation.unavailable.title"),
+					Description: i18n.Text(ctx.Locale(), "dalle.moderation.unavailable.description"),
+					Color:       0xff0000,
+				},
+			},
+		})
+		return
+	}
+
+	if !verdict.Flagged {
+		ctx.Next()
+		return
+	}
+
+	log.Printf("[GID: %s, i.ID:%s] Prompt blocked by %s moderator [Category: %s, Severity: %s]\n", ctx.Interaction.GuildID, ctx.Interaction.ID, verdict.Moderator, verdict.Category, verdict.Severity)
+	// The block is reported as command.rejected in the audit log of lifecycle events
+	bot.SetEventReason(ctx, fmt.Sprintf("prompt blocked by %s moderator [Category: %s, Severity: %s]", verdict.Moderator, verdict.Category, verdict.Severity))
+	if auditor != nil {
+		err = auditor.Record(moderation.AuditRecord{
+			Command:   commandName,
+			GuildID:   ctx.Interaction.GuildID,
+			ChannelID: ctx.Interaction.ChannelID,
+			UserID:    ctx.User().ID,
+			Prompt:    prompt,
+			Verdict:   verdict,
+		})
+		if err != nil {
+			log.Printf("[GID: %s, i.ID:%s] Failed to record moderation audit with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		}
+	}
+
+	ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
+		Embeds: []*discord.MessageEmbed{imageModerationRejectionEmbed(ctx.Locale(), verdict)},
+	})
+}
+
+func imageModerationRejectionEmbed(locale discord.Locale, verdict *moderation.Verdict) *discord.MessageEmbed {
+	reason := verdict.Reason
+	if reason == "" {
+		reason = i18n.Text(locale, "dalle.moderation.rejected.description")
+	}
+	return &discord.MessageEmbed{
+		Title:       i18n.Text(locale, "dalle.moderation.rejected.title"),
+		Description: reason,
+		Color:       0xff0000,
+		Fields: []*discord.MessageEmbedField{
+			{
+				Name:   i18n.Text(locale, "dalle.moderation.category"),
+				Value:  verdict.Category,
+				Inline: true,
+			},
+			{
+				Name:   i18n.Text(locale, "dalle.moderation.severity"),
+				Value:  verdict.Severity.String(),
+				Inline: true,
+			},
+		},
+		Footer: &discord.MessageEmbedFooter{
+			Text: i18n.Text(locale, "dalle.moderation.rejected.footer"),
+		},
+	}
 }
@@ -1,9 +1,8 @@
 package dalle
 
 import (
-	"fmt"
-
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/constants"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
 	discord "github.com/bwmarrin/discordgo"
 )
 
@@ -27,11 +26,11 @@ func priceForResponse(n int, size string) float64 {
 	return 0
 }
 
-func imageCreationUsageEmbedFooter(size string, number int) *discord.MessageEmbedFooter {
-	extraInfo := fmt.Sprintf("Size : %s, Images:%d", size, number)
+func imageCreationUsageEmbedFooter(locale discord.Locale, size string, number int) *discord.MessageEmbedFooter {
+	extraInfo := i18n.Text(locale, "dalle.usage", size, number)
 	price := priceForResponse(number, size)
 	if price > 0 {
-		extraInfo += fmt.Sprintf("/nGeneration Cost : %g", price)
+		extraInfo += i18n.Text(locale, "dalle.usage.cost", price)
 	}
 	return &discord.MessageEmbedFooter{
 		Text:    extraInfo,
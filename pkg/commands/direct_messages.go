@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"log"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/access"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+const (
+	directMessagesCommandName = "direct-messages"
+
+	directMessagesOptionEnabled = "enabled"
+)
+
+// DirectMessagesCommand lets the operators of the bot allow or disallow conversations with the bot in direct messages.
+// The toggle applies to every guild, so admins of a guild who are no operators are denied
+func DirectMessagesCommand(policy *access.Policy) *bot.Command {
+	return &bot.Command{
+		Name:                     directMessagesCommandName,
+		Description:              "Allow or disallow conversations with the bot in direct messages",
+		DMPermission:             false,
+		DefaultMemberPermissions: discord.PermissionAdministrator,
+		Schema: []*bot.OptionSchema{
+			{
+				Type:        discord.ApplicationCommandOptionBoolean,
+				Name:        directMessagesOptionEnabled,
+				Description: "Whether users can talk to the bot in direct messages",
+				Required:    true,
+			},
+		},
+		Handler: bot.HandlerFunc(func(ctx *bot.Context) {
+			directMessagesHandler(ctx, policy)
+		}),
+	}
+}
+
+func directMessagesHandler(ctx *bot.Context, policy *access.Policy) {
+	if !policy.IsOperator(ctx.User().ID) {
+		log.Printf("[GID: %s, i.ID: %s] UserID: %s is no operator and cannot toggle direct messages\n", ctx.Interaction.GuildID, ctx.Interaction.ID, ctx.User().ID)
+		bot.SetEventReason(ctx, "only operators can toggle direct messages")
+		accessRespond(ctx, &discord.MessageEmbed{
+			Title:       i18n.Text(ctx.Locale(), "error.title"),
+			Description: i18n.Text(ctx.Locale(), "direct_messages.operators_only"),
+			Color:       0xff0000,
+		})
+		return
+	}
+	enabled := ctx.BoolOption(directMessagesOptionEnabled, false)
+	if err := policy.SetDirectMessages(enabled); err != nil {
+		log.Printf("[GID: %s, i.ID: %s] Failed to toggle direct messages with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		accessRespond(ctx, accessErrorEmbed(ctx.Locale(), err))
+		return
+	}
+	log.Printf("[GID: %s, i.ID: %s] Direct messages toggled to %t by UserID: %s\n", ctx.Interaction.GuildID, ctx.Interaction.ID, enabled, ctx.User().ID)
+
+	description := i18n.Text(ctx.Locale(), "direct_messages.disabled")
+	if enabled {
+		description = i18n.Text(ctx.Locale(), "direct_messages.enabled")
+	}
+	accessRespond(ctx, &discord.MessageEmbed{
+		Title:       i18n.Text(ctx.Locale(), "direct_messages.updated.title"),
+		Description: description,
+		Color:       accessEmbedColor,
+	})
+}
@@ -0,0 +1,268 @@
+package gpt
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/access"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+const (
+	messageActionStopButtonCustomIDPrefix = "gpt:action:stop:"
+
+	// Discord limits the names of context menu commands to 32 characters
+	messageActionNameMaxLength = 32
+	// Larger attachments are skipped instead of being sent to the model
+	messageActionAttachmentMaxSize = 100 * 1024
+)
+
+// MessageAction is a message context menu command that answers a prompt built from the target message
+type MessageAction struct {
+	// Name is shown in the Apps menu of messages, e.g. "Summarize"
+	Name string `yaml:"name"`
+	// Prompt is a text/template executed with messageActionData
+	Prompt string `yaml:"prompt"`
+	// Model answers the prompt, the default completion model is used if empty
+	Model string `yaml:"model"`
+	// Thread starts a conversation thread seeded with the message instead of answering ephemerally
+	Thread bool `yaml:"thread"`
+}
+
+// DefaultMessageActions are offered when no message actions are configured
+var DefaultMessageActions = []MessageAction{
+	{
+		Name:   "Ask AI about this",
+		Prompt: "{{.Author}} wrote the following message:\n\n{{.Content}}\n\nHelp me understand it and answer follow-up questions about it.",
+		Thread: true,
+	},
+	{
+		Name:   "Summarize",
+		Prompt: "Summarize the following message in a few bullet points:\n\n{{.Content}}",
+	},
+	{
+		Name:   "Explain code",
+		Prompt: "Explain what the code in the following message does, step by step:\n\n{{.Content}}",
+	},
+	{
+		Name:   "Translate to English",
+		Prompt: "Translate the following message to English. Answer only with the translation:\n\n{{.Content}}",
+	},
+}
+
+// messageActionData is available in the prompt templates of message actions
+type messageActionData struct {
+	// Content is the text of the message followed by its text attachments
+	Content string
+	// Author is the username of the message author
+	Author string
+}
+
+// ParseMessageActionPrompt checks the prompt template of a message action
+func ParseMessageActionPrompt(action MessageAction) (*template.Template, error) {
+	if action.Name == "" || len(action.Name) > messageActionNameMaxLength {
+		return nil, fmt.Errorf("message action name must be 1-%d characters", messageActionNameMaxLength)
+	}
+	if action.Model != "" && !validateOpenRouterModel(action.Model) {
+		return nil, fmt.Errorf("invalid model '%s' for message action '%s', must include provider prefix (e.g., 'openai/gpt-4')", action.Model, action.Name)
+	}
+	tmpl, err := template.New(action.Name).Option("missingkey=error").Parse(action.Prompt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt template for message action '%s': %w", action.Name, err)
+	}
+	return tmpl, nil
+}
+
+// MessageActionCommands creates a message context menu command for every action.
+// The commands share the Stop button of the conversations they start
+func MessageActionCommands(client openrouter.ChatCompletionClient, messagesCache *MessagesCache, actions []MessageAction, policy *access.Policy) ([]*bot.Command, error) {
+	generations := newGenerationRegistry(messageActionStopButtonCustomIDPrefix)
+	stop := generations.stopComponent()
+
+	commands := make([]*bot.Command, 0, len(actions))
+	for _, action := range actions {
+		tmpl, err := ParseMessageActionPrompt(action)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, &bot.Command{
+			Name:                     action.Name,
+			Type:                     discord.MessageApplicationCommand,
+			DMPermission:             false,
+			DefaultMemberPermissions: discord.PermissionViewChannel,
+			Handler: bot.HandlerFunc(func(ctx *bot.Context) {
+				messageActionHandler(ctx, client, messagesCache, generations, action, tmpl, policy)
+			}),
+			Components: []*bot.Component{stop},
+		})
+	}
+	return commands, nil
+}
+
+func messageActionHandler(ctx *bot.Context, client openrouter.ChatCompletionClient, messagesCache *MessagesCache, generations *generationRegistry, action MessageAction, tmpl *template.Template, policy *access.Policy) {
+	log.Printf("[GID: %s, i.ID: %s] Message action '%s' invoked by UserID: %s\n", ctx.Interaction.GuildID, ctx.Interaction.ID, action.Name, ctx.User().ID)
+
+	response := &discord.InteractionResponse{
+		Type: discord.InteractionResponseDeferredChannelMessageWithSource,
+	}
+	if !action.Thread {
+		response.Data = &discord.InteractionResponseData{
+			Flags: discord.MessageFlagsEphemeral,
+		}
+	}
+	if err := ctx.Respond(response); err != nil {
+		log.Printf("[GID: %s, i.ID: %s] Failed to respond to interaction with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		return
+	}
+
+	message := ctx.TargetMessage()
+	if message == nil {
+		messageActionError(ctx, "gpt.action.error.message")
+		return
+	}
+	content := messageActionContent(ctx, message)
+	if strings.TrimSpace(content) == "" {
+		messageActionError(ctx, "gpt.action.error.empty")
+		return
+	}
+
+	var prompt strings.Builder
+	err := tmpl.Execute(&prompt, messageActionData{
+		Content: content,
+		Author:  message.Author.Username,
+	})
+	if err != nil {
+		log.Printf("[GID: %s, i.ID: %s] Failed to execute prompt template of message action '%s' with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, action.Name, err)
+		messageActionError(ctx, "gpt.action.error.prompt")
+		return
+	}
+
+	model := action.Model
+	if model == "" {
+		model = gptDefaultModel
+	}
+	if denial := modelAccessDenial(ctx.Session, ctx.Interaction, policy, action.Name, model); denial != nil {
+		ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
+			Embeds: []*discord.MessageEmbed{access.DenialEmbed(ctx.Locale(), denial)},
+			Flags:  discord.MessageFlagsEphemeral,
+		})
+		return
+	}
+	cacheItem := &MessagesCacheData{
+		Messages: []openrouter.ChatCompletionMessage{
+			{
+				Role:    "user",
+				Content: prompt.String(),
+			},
+		},
+		Model:   model,
+		Command: action.Name,
+	}
+	if ok, count := isCacheItemWithinTruncateLimit(cacheItem); !ok {
+		log.Printf("[GID: %s, i.ID: %s] Message action prompt has %d tokens, which exceeds allowed token limit for model `%s`.\n", ctx.Interaction.GuildID, ctx.Interaction.ID, count, model)
+		messageActionError(ctx, "gpt.action.error.tokens", count, model)
+		return
+	}
+
+	if action.Thread {
+		startConversation(ctx, ctx.Session, ctx.Interaction, client, messagesCache, generations, &conversation{
+			cacheItem: cacheItem,
+			fields: []*discord.MessageEmbedField{
+				{
+					Value: "\u200B",
+				},
+				{
+					Name:  gptCommandOptionModel.humanReadableString(),
+					Value: model,
+				},
+			},
+		})
+		return
+	}
+
+	log.Printf("[GID: %s, i.ID: %s] OpenRouter Request invoked by message action '%s' with [Model: %s]\n", ctx.Interaction.GuildID, ctx.Interaction.ID, action.Name, model)
+	bot.SetEventModel(ctx, model, cacheItem.Messages[0].Content)
+	resp, err := sendOpenRouterRequest(ctx, client, cacheItem, nil)
+	if err != nil {
+		log.Printf("[GID: %s, i.ID: %s] OpenRouter request ChatCompletion failed with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		bot.SetEventError(ctx, err)
+		ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
+			Embeds: []*discord.MessageEmbed{
+				{
+					Title:       i18n.Text(ctx.Locale(), "error.openrouter.title"),
+					Description: err.Error(),
+					Color:       0xff0000,
+				},
+			},
+			Flags: discord.MessageFlagsEphemeral,
+		})
+		return
+	}
+	log.Printf("[GID: %s, i.ID: %s] OpenRouter Request [Model: %s] responded with a usage: [PromptTokens: %d, CompletionTokens: %d, TotalTokens: %d, Cached: %t]\n", ctx.Interaction.GuildID, ctx.Interaction.ID, model, resp.usage.PromptTokens, resp.usage.CompletionTokens, resp.usage.TotalTokens, resp.cached)
+
+	for _, part := range splitMessage(resp.content) {
+		_, err = ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
+			Content: part,
+			Flags:   discord.MessageFlagsEphemeral,
+		})
+		if err != nil {
+			log.Printf("[GID: %s, i.ID: %s] Discord API failed with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+			return
+		}
+	}
+}
+
+// messageActionContent returns the text of the message followed by its text attachments
+func messageActionContent(ctx *bot.Context, message *discord.Message) string {
+	var content strings.Builder
+	content.WriteString(message.Content)
+	for _, attachment := range message.Attachments {
+		if !isTextAttachment(attachment) {
+			continue
+		}
+		data, err := getUrlData(ctx.HTTPClient(), attachment.URL)
+		if err != nil {
+			log.Printf("[GID: %s, i.ID: %s] Failed to get attachment data of %s with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, attachment.Filename, err)
+			continue
+		}
+		fmt.Fprintf(&content, "\n\n%s:\n%s", attachment.Filename, data)
+	}
+	return content.String()
+}
+
+var textAttachmentExtensions = map[string]struct{}{
+	".txt": {}, ".md": {}, ".log": {}, ".csv": {}, ".json": {}, ".yaml": {}, ".yml": {}, ".xml": {},
+	".go": {}, ".py": {}, ".js": {}, ".ts": {}, ".java": {}, ".c": {}, ".h": {}, ".cpp": {}, ".cs": {},
+	".rs": {}, ".rb": {}, ".php": {}, ".sh": {}, ".sql": {}, ".html": {}, ".css": {},
+}
+
+func isTextAttachment(attachment *discord.MessageAttachment) bool {
+	if attachment.Size > messageActionAttachmentMaxSize {
+		return false
+	}
+	if strings.HasPrefix(attachment.ContentType, "text/") {
+		return true
+	}
+	_, ok := textAttachmentExtensions[strings.ToLower(path.Ext(attachment.Filename))]
+	return ok
+}
+
+// messageActionError tells the user why the action failed with the text of the catalog key
+func messageActionError(ctx *bot.Context, key string, args ...any) {
+	ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
+		Embeds: []*discord.MessageEmbed{
+			{
+				Title:       i18n.Text(ctx.Locale(), "error.title"),
+				Description: i18n.Text(ctx.Locale(), key, args...),
+				Color:       0xff0000,
+			},
+		},
+		Flags: discord.MessageFlagsEphemeral,
+	})
+}
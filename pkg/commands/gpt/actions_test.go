@@ -0,0 +1,79 @@
+package gpt
+
+import (
+	"strings"
+	"testing"
+
+	discord "github.com/bwmarrin/discordgo"
+)
+
+func TestParseMessageActionPrompt(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  MessageAction
+		wantErr bool
+	}{
+		{"valid", MessageAction{Name: "Summarize", Prompt: "Summarize:\n{{.Content}}"}, false},
+		{"valid with model", MessageAction{Name: "Summarize", Prompt: "{{.Content}}", Model: "openai/gpt-4"}, false},
+		{"missing name", MessageAction{Prompt: "{{.Content}}"}, true},
+		{"name too long", MessageAction{Name: strings.Repeat("a", 33), Prompt: "{{.Content}}"}, true},
+		{"model without provider", MessageAction{Name: "Summarize", Prompt: "{{.Content}}", Model: "gpt-4"}, true},
+		{"invalid template", MessageAction{Name: "Summarize", Prompt: "{{.Content"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseMessageActionPrompt(tt.action)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseMessageActionPrompt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefaultMessageActions(t *testing.T) {
+	commands, err := MessageActionCommands(nil, nil, DefaultMessageActions, nil)
+	if err != nil {
+		t.Fatalf("MessageActionCommands() error = %v", err)
+	}
+	if len(commands) != len(DefaultMessageActions) {
+		t.Fatalf("Expected %d commands, got %d", len(DefaultMessageActions), len(commands))
+	}
+	for _, cmd := range commands {
+		applicationCommand := cmd.ApplicationCommand()
+		if applicationCommand.Type != discord.MessageApplicationCommand {
+			t.Errorf("Expected %q to be a message command", cmd.Name)
+		}
+		if applicationCommand.Description != "" || len(applicationCommand.Options) != 0 {
+			t.Errorf("Expected %q to have no description and options", cmd.Name)
+		}
+	}
+
+	tmpl, _ := ParseMessageActionPrompt(DefaultMessageActions[0])
+	var prompt strings.Builder
+	if err := tmpl.Execute(&prompt, messageActionData{Content: "Go 1.23 is out", Author: "gopher"}); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if !strings.Contains(prompt.String(), "gopher wrote") || !strings.Contains(prompt.String(), "Go 1.23 is out") {
+		t.Errorf("Unexpected prompt %q", prompt.String())
+	}
+}
+
+func TestIsTextAttachment(t *testing.T) {
+	tests := []struct {
+		attachment *discord.MessageAttachment
+		want       bool
+	}{
+		{&discord.MessageAttachment{Filename: "notes.txt", Size: 10}, true},
+		{&discord.MessageAttachment{Filename: "main.GO", Size: 10}, true},
+		{&discord.MessageAttachment{Filename: "data", ContentType: "text/plain; charset=utf-8", Size: 10}, true},
+		{&discord.MessageAttachment{Filename: "cat.png", ContentType: "image/png", Size: 10}, false},
+		{&discord.MessageAttachment{Filename: "huge.log", Size: messageActionAttachmentMaxSize + 1}, false},
+	}
+
+	for _, tt := range tests {
+		if got := isTextAttachment(tt.attachment); got != tt.want {
+			t.Errorf("isTextAttachment(%s) = %v, want %v", tt.attachment.Filename, got, tt.want)
+		}
+	}
+}
@@ -2,23 +2,114 @@ package gpt
 
 import (
 	"strings"
-	
+	"sync"
+
 	lru "github.com/hashicorp/golang-lru/v2"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
 )
 
-type IgnoredChannelsCache map[string]struct{}
+// IgnoredChannelsCache remembers the channels that are not GPT threads. It is safe for concurrent use
+type IgnoredChannelsCache struct {
+	mu       sync.RWMutex
+	channels map[string]struct{}
+}
+
+func NewIgnoredChannelsCache() *IgnoredChannelsCache {
+	return &IgnoredChannelsCache{channels: make(map[string]struct{})}
+}
+
+// Add ignores the channel from now on
+func (c *IgnoredChannelsCache) Add(channelID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.channels[channelID] = struct{}{}
+}
+
+// Contains reports whether the channel is ignored
+func (c *IgnoredChannelsCache) Contains(channelID string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.channels[channelID]
+	return ok
+}
+
+// Len returns the number of ignored channels
+func (c *IgnoredChannelsCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.channels)
+}
 
 type MessagesCache struct {
 	*lru.Cache[string, *MessagesCacheData]
+	// FollowUps decides what happens to messages sent in a thread while it is answered
+	FollowUps FollowUpConfig
+	// Mentions enables conversations outside threads started by mentioning the bot
+	Mentions MentionConfig
+	// LanguageHint tells the model to answer in the language of the user when a conversation has no context
+	LanguageHint bool
+
+	queues *threadQueues
 }
 
 type MessagesCacheData struct {
+	// mu is held while the conversation is extended, so a thread is answered one message at a time
+	mu sync.Mutex
+
 	Messages      []openrouter.ChatCompletionMessage
 	SystemMessage *openrouter.ChatCompletionMessage
 	Model         string
 	Temperature   *float32
 	TokenCount    int
+	// Command is the path of the command that started the conversation, e.g. "chat gpt".
+	// Follow-ups are checked against its access rules
+	Command string
+
+	// tokenCounts memoizes the token count of every message for tokenCountsModel,
+	// so only new messages are encoded when the conversation grows
+	tokenCounts      map[openrouter.ChatCompletionMessage]int
+	tokenCountsModel string
+}
+
+// MessageTokens returns the token count of the message for the conversation model.
+// Every distinct message is encoded only once
+func (c *MessagesCacheData) MessageTokens(message openrouter.ChatCompletionMessage) int {
+	if c.tokenCounts == nil || c.tokenCountsModel != c.Model {
+		c.tokenCounts = make(map[openrouter.ChatCompletionMessage]int, len(c.Messages)+1)
+		c.tokenCountsModel = c.Model
+	}
+	if tokens, ok := c.tokenCounts[message]; ok {
+		return tokens
+	}
+	tokens := _countMessageTokens(tokenizers.ForModel(c.Model), message)
+	c.tokenCounts[message] = tokens
+	return tokens
+}
+
+// CountTokens returns the token count of the system message and all messages
+func (c *MessagesCacheData) CountTokens() int {
+	tokens := 0
+	for _, message := range c.Messages {
+		tokens += c.MessageTokens(message)
+	}
+	if c.SystemMessage != nil {
+		tokens += c.MessageTokens(*c.SystemMessage)
+	}
+	// every reply is primed with <|start|>assistant<|message|>
+	return tokens + 3
+}
+
+// forgetMessageTokens drops the memoized count of a message removed from the conversation
+func (c *MessagesCacheData) forgetMessageTokens(message openrouter.ChatCompletionMessage) {
+	delete(c.tokenCounts, message)
+}
+
+// accessCommand returns the command follow-ups are checked against, caller if no command started the conversation
+func (c *MessagesCacheData) accessCommand(caller string) string {
+	if c.Command != "" {
+		return c.Command
+	}
+	return caller
 }
 
 // ValidateOpenRouterModel checks if the model name is in valid OpenRouter format
@@ -55,6 +146,7 @@ func NewMessagesCache(size int) (*MessagesCache, error) {
 	}
 
 	return &MessagesCache{
-		Cache: lruCache,
+		Cache:  lruCache,
+		queues: newThreadQueues(),
 	}, nil
 }
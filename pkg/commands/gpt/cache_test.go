@@ -0,0 +1,32 @@
+package gpt
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestIgnoredChannelsCache_Concurrent(t *testing.T) {
+	cache := NewIgnoredChannelsCache()
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			channelID := fmt.Sprint(i % 5)
+			cache.Contains(channelID)
+			cache.Add(channelID)
+		}()
+	}
+	wg.Wait()
+
+	for i := range 5 {
+		if !cache.Contains(fmt.Sprint(i)) {
+			t.Errorf("Expected channel %d to be ignored", i)
+		}
+	}
+	if cache.Contains("5") {
+		t.Error("Expected channel 5 not to be ignored")
+	}
+}
@@ -0,0 +1,159 @@
+package gpt
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+const (
+	gptModelCatalogRefreshTimeout = 10 * time.Second
+	// Discord limits choice names to 100 characters
+	gptAutocompleteChoiceNameLimit = 100
+)
+
+// ModelCatalog holds the models users can choose from: the configured completion models
+// followed by the provider's catalog, which is refreshed in the background
+type ModelCatalog struct {
+	client          openrouter.ModelListClient
+	configured      []string
+	refreshInterval time.Duration
+
+	mu          sync.RWMutex
+	models      []string
+	refreshedAt time.Time
+	refreshing  bool
+}
+
+// NewModelCatalog creates a catalog listing models with client every refreshInterval
+func NewModelCatalog(client openrouter.ModelListClient, configured []string, refreshInterval time.Duration) *ModelCatalog {
+	return &ModelCatalog{
+		client:          client,
+		configured:      configured,
+		refreshInterval: refreshInterval,
+		models:          configured,
+	}
+}
+
+// Refresh fetches the provider's models. Configured models are always kept first
+func (c *ModelCatalog) Refresh(ctx context.Context) error {
+	resp, err := c.client.ListModels(ctx)
+	if err != nil {
+		c.mu.Lock()
+		// Retry on the next lookup after the interval, instead of on every keystroke
+		c.refreshedAt = time.Now()
+		c.mu.Unlock()
+		return err
+	}
+
+	models := make([]string, 0, len(c.configured)+len(resp.Data))
+	seen := make(map[string]struct{}, cap(models))
+	for _, model := range c.configured {
+		seen[model] = struct{}{}
+		models = append(models, model)
+	}
+	catalog := make([]string, 0, len(resp.Data))
+	for _, model := range resp.Data {
+		if _, exists := seen[model.ID]; exists || !validateOpenRouterModel(model.ID) {
+			continue
+		}
+		seen[model.ID] = struct{}{}
+		catalog = append(catalog, model.ID)
+	}
+	sort.Strings(catalog)
+
+	c.mu.Lock()
+	c.models = append(models, catalog...)
+	c.refreshedAt = time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+// Models returns all known models. A stale catalog is refreshed in the background,
+// so lookups never wait for the provider
+func (c *ModelCatalog) Models() []string {
+	c.mu.Lock()
+	models := c.models
+	if !c.refreshing && time.Since(c.refreshedAt) > c.refreshInterval {
+		c.refreshing = true
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), gptModelCatalogRefreshTimeout)
+			defer cancel()
+			if err := c.Refresh(ctx); err != nil {
+				log.Printf("Failed to refresh model catalog with the error: %v\n", err)
+			}
+			c.mu.Lock()
+			c.refreshing = false
+			c.mu.Unlock()
+		}()
+	}
+	c.mu.Unlock()
+	return models
+}
+
+// Contains reports whether the model can be used
+func (c *ModelCatalog) Contains(model string) bool {
+	for _, known := range c.Models() {
+		if known == model {
+			return true
+		}
+	}
+	return false
+}
+
+// Search returns up to limit models containing query, case insensitive.
+// Models starting with the query (with or without provider) are listed first
+func (c *ModelCatalog) Search(query string, limit int) []string {
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	var prefixed, contained []string
+	for _, model := range c.Models() {
+		name := strings.ToLower(model)
+		switch {
+		case strings.HasPrefix(name, query) || strings.HasPrefix(strings.ToLower(extractBaseModel(model)), query):
+			prefixed = append(prefixed, model)
+		case strings.Contains(name, query):
+			contained = append(contained, model)
+		}
+		if len(prefixed) >= limit {
+			break
+		}
+	}
+
+	results := append(prefixed, contained...)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+func modelAutocompleteHandler(ctx *bot.AutocompleteContext, catalog *ModelCatalog) {
+	models := catalog.Search(ctx.Value(), bot.MaxAutocompleteChoices)
+	choices := make([]*discord.ApplicationCommandOptionChoice, 0, len(models))
+	for _, model := range models {
+		choices = append(choices, &discord.ApplicationCommandOptionChoice{
+			Name:  truncateMessage(getModelDisplayName(model, model == gptDefaultModel), gptAutocompleteChoiceNameLimit),
+			Value: model,
+		})
+	}
+	if err := ctx.Respond(choices); err != nil {
+		log.Printf("[GID: %s, i.ID: %s] Failed to respond to model autocomplete with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+	}
+}
+
+// unknownModelEmbed is shown when a model typed by the user is not in the catalog
+func unknownModelEmbed(locale discord.Locale, model string) *discord.MessageEmbed {
+	return &discord.MessageEmbed{
+		Title:       i18n.Text(locale, "gpt.unknown_model.title"),
+		Description: i18n.Text(locale, "gpt.unknown_model.description", model),
+		Color:       0xff0000,
+	}
+}
@@ -0,0 +1,133 @@
+package gpt
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
+)
+
+type staticModelLister struct {
+	models []string
+	err    error
+	calls  int
+}
+
+func (l *staticModelLister) ListModels(ctx context.Context) (*openrouter.ModelsResponse, error) {
+	l.calls++
+	if l.err != nil {
+		return nil, l.err
+	}
+	resp := &openrouter.ModelsResponse{}
+	for _, model := range l.models {
+		resp.Data = append(resp.Data, openrouter.Model{ID: model})
+	}
+	return resp, nil
+}
+
+func newTestCatalog(t *testing.T) *ModelCatalog {
+	lister := &staticModelLister{
+		models: []string{"openai/gpt-4", "mistralai/mistral-large", "anthropic/claude-3-opus", "openai/gpt-4o", "invalid-model"},
+	}
+	catalog := NewModelCatalog(lister, []string{"openai/gpt-4", "local/llama3"}, time.Hour)
+	if err := catalog.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	return catalog
+}
+
+func TestModelCatalog_Refresh(t *testing.T) {
+	catalog := newTestCatalog(t)
+
+	expected := []string{"openai/gpt-4", "local/llama3", "anthropic/claude-3-opus", "mistralai/mistral-large", "openai/gpt-4o"}
+	models := catalog.Models()
+	if len(models) != len(expected) {
+		t.Fatalf("Expected models %v, got %v", expected, models)
+	}
+	for i := range expected {
+		if models[i] != expected[i] {
+			t.Errorf("Expected %s at %d, got %s", expected[i], i, models[i])
+		}
+	}
+
+	if !catalog.Contains("local/llama3") || !catalog.Contains("anthropic/claude-3-opus") {
+		t.Error("Expected configured and catalog models to be available")
+	}
+	if catalog.Contains("invalid-model") {
+		t.Error("Expected models without provider to be skipped")
+	}
+}
+
+func TestModelCatalog_RefreshError(t *testing.T) {
+	lister := &staticModelLister{err: errors.New("unavailable")}
+	catalog := NewModelCatalog(lister, []string{"openai/gpt-4"}, time.Hour)
+	if err := catalog.Refresh(context.Background()); err == nil {
+		t.Fatal("Expected refresh error")
+	}
+	// Configured models stay usable, and the failed refresh is not retried on every lookup
+	if !catalog.Contains("openai/gpt-4") {
+		t.Error("Expected configured model to be available")
+	}
+	if lister.calls != 1 {
+		t.Errorf("Expected 1 list call, got %d", lister.calls)
+	}
+}
+
+func TestModelCatalog_Search(t *testing.T) {
+	catalog := newTestCatalog(t)
+
+	testCases := []struct {
+		query    string
+		limit    int
+		expected []string
+	}{
+		{"", 2, []string{"openai/gpt-4", "local/llama3"}},
+		{"GPT", 25, []string{"openai/gpt-4", "openai/gpt-4o"}},
+		{"claude", 25, []string{"anthropic/claude-3-opus"}},
+		{"mistral", 25, []string{"mistralai/mistral-large"}},
+		{"large", 25, []string{"mistralai/mistral-large"}},
+		{"unknown", 25, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			results := catalog.Search(tc.query, tc.limit)
+			if len(results) != len(tc.expected) {
+				t.Fatalf("Search(%q) = %v, want %v", tc.query, results, tc.expected)
+			}
+			for i := range tc.expected {
+				if results[i] != tc.expected[i] {
+					t.Errorf("Search(%q)[%d] = %s, want %s", tc.query, i, results[i], tc.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCommand_ModelAutocomplete(t *testing.T) {
+	messagesCache, _ := NewMessagesCache(10)
+	ignoredChannelsCache := NewIgnoredChannelsCache()
+	catalog := newTestCatalog(t)
+
+	// With a catalog, the model option is offered even for a single configured model
+	command := Command(&openrouter.Client{}, []string{"openai/gpt-4"}, messagesCache, ignoredChannelsCache, catalog, nil)
+	if _, ok := command.Autocomplete[gptCommandOptionModel.string()]; !ok {
+		t.Fatal("Expected model autocomplete handler")
+	}
+
+	for _, option := range command.ApplicationCommand().Options {
+		if option.Name != gptCommandOptionModel.string() {
+			continue
+		}
+		if !option.Autocomplete {
+			t.Error("Expected model option to be registered with autocompletion")
+		}
+		if len(option.Choices) != 0 {
+			t.Error("Autocompleted options cannot have static choices")
+		}
+		return
+	}
+	t.Error("Expected model option")
+}
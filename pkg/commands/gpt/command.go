@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/access"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
 	discord "github.com/bwmarrin/discordgo"
@@ -38,10 +39,9 @@ func getModelDisplayName(model string, isDefault bool) string {
 	return name
 }
 
-func Command(client *openrouter.Client, completionModels []string, messagesCache *MessagesCache, ignoredChannelsCache *IgnoredChannelsCache) *bot.Command {
-	temperatureOptionMinValue := 0.0
-	temperatureOptionMaxValue := 2.0
-	
+// Command creates the gpt command. With a catalog, the model option autocompletes from all
+// catalog models, otherwise the configured models are offered as static choices
+func Command(client openrouter.ChatCompletionClient, completionModels []string, messagesCache *MessagesCache, ignoredChannelsCache *IgnoredChannelsCache, catalog *ModelCatalog, policy *access.Policy) *bot.Command {
 	opts := []*discord.ApplicationCommandOption{
 		{
 			Type:        discord.ApplicationCommandOptionString,
@@ -76,43 +76,89 @@ func Command(client *openrouter.Client, completionModels []string, messagesCache
 		gptDefaultModel = validModels[0]
 	}
 	
-	// Add model selection option if multiple models are available
-	if numberOfModels > 1 {
-		var modelChoices []*discord.ApplicationCommandOptionChoice
-		for i, model := range validModels {
-			modelChoices = append(modelChoices, &discord.ApplicationCommandOptionChoice{
-				Name:  getModelDisplayName(model, i == 0),
-				Value: model,
-			})
-		}
-		opts = append(opts, &discord.ApplicationCommandOption{
-			Type:        discord.ApplicationCommandOptionString,
-			Name:        gptCommandOptionModel.string(),
-			Description: "AI model to use (OpenRouter format: provider/model)",
-			Required:    false,
-			Choices:     modelChoices,
-		})
+	var schema []*bot.OptionSchema
+	modelOption, autocomplete := modelOptionSchema(validModels, catalog)
+	if modelOption != nil {
+		schema = append(schema, modelOption)
 	}
 	
 	// Add temperature option with OpenRouter-compatible range
-	opts = append(opts, &discord.ApplicationCommandOption{
-		Type:        discord.ApplicationCommandOptionNumber,
-		Name:        gptCommandOptionTemperature.string(),
-		Description: "Sampling temperature (0.0-2.0). Lower values are more focused and deterministic",
-		MinValue:    &temperatureOptionMinValue,
-		MaxValue:    temperatureOptionMaxValue,
-		Required:    false,
-	})
+	schema = append(schema, temperatureOptionSchema("Sampling temperature (0.0-2.0). Lower values are more focused and deterministic"))
 	
+	generations := newGenerationRegistry(gptStopButtonCustomIDPrefix)
+
 	return &bot.Command{
 		Name:        commandName,
 		Description: "Start conversation with AI models via OpenRouter",
 		Options:     opts,
+		Schema:      schema,
 		Handler: bot.HandlerFunc(func(ctx *bot.Context) {
-			chatGPTHandler(ctx, client, messagesCache)
+			chatGPTHandler(ctx, client, messagesCache, generations, catalog, policy)
 		}),
+		Autocomplete: autocomplete,
 		MessageHandler: bot.MessageHandlerFunc(func(ctx *bot.MessageContext) {
-			chatGPTMessageHandler(ctx, client, messagesCache, ignoredChannelsCache)
+			chatGPTMessageHandler(ctx, client, messagesCache, ignoredChannelsCache, generations, policy)
 		}),
+		MessageQueue: followUpQueue{messagesCache: messagesCache},
+		Components: []*bot.Component{
+			generations.stopComponent(),
+		},
+	}
+}
+
+// modelOptionSchema returns the option to pick the model of a conversation with its autocomplete handlers.
+// Without a catalog, the valid models are offered as choices, and no option is needed for a single model
+func modelOptionSchema(validModels []string, catalog *ModelCatalog) (*bot.OptionSchema, map[string]bot.AutocompleteHandler) {
+	if catalog != nil {
+		// Autocompleted models are checked against the catalog by the handlers, to show the unknown model
+		return &bot.OptionSchema{
+			Type:        discord.ApplicationCommandOptionString,
+			Name:        gptCommandOptionModel.string(),
+			Description: "AI model to use (OpenRouter format: provider/model)",
+		}, map[string]bot.AutocompleteHandler{
+			gptCommandOptionModel.string(): bot.AutocompleteHandlerFunc(func(ctx *bot.AutocompleteContext) {
+				modelAutocompleteHandler(ctx, catalog)
+			}),
+		}
+	}
+	if len(validModels) < 2 {
+		return nil, nil
+	}
+
+	var modelChoices []*discord.ApplicationCommandOptionChoice
+	for i, model := range validModels {
+		modelChoices = append(modelChoices, &discord.ApplicationCommandOptionChoice{
+			Name:  getModelDisplayName(model, i == 0),
+			Value: model,
+		})
+	}
+	return &bot.OptionSchema{
+		Type:        discord.ApplicationCommandOptionString,
+		Name:        gptCommandOptionModel.string(),
+		Description: "AI model to use (OpenRouter format: provider/model)",
+		Choices:     modelChoices,
+	}, nil
+}
+
+// temperatureOptionSchema declares the sampling temperature option, validated to be between 0 and 2
+func temperatureOptionSchema(description string) *bot.OptionSchema {
+	minValue, maxValue := 0.0, 2.0
+	return &bot.OptionSchema{
+		Type:        discord.ApplicationCommandOptionNumber,
+		Name:        gptCommandOptionTemperature.string(),
+		Description: description,
+		MinValue:    &minValue,
+		MaxValue:    &maxValue,
+	}
+}
+
+// temperatureOption returns the temperature the user entered, or nil if it was omitted
+func temperatureOption(ctx *bot.Context) *float32 {
+	// The schema rejects negative temperatures, so a negative default stands for the omitted option
+	temperature := ctx.FloatOption(gptCommandOptionTemperature.string(), -1)
+	if temperature < 0 {
+		return nil
 	}
+	value := float32(temperature)
+	return &value
 }
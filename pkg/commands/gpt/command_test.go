@@ -3,6 +3,7 @@ package gpt
 import (
 	"testing"
 
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
 	discord "github.com/bwmarrin/discordgo"
 )
@@ -45,11 +46,11 @@ func TestGetModelDisplayName(t *testing.T) {
 func TestCommand_ModelValidation(t *testing.T) {
 	client := &openrouter.Client{}
 	messagesCache, _ := NewMessagesCache(10)
-	ignoredChannelsCache := make(IgnoredChannelsCache)
+	ignoredChannelsCache := NewIgnoredChannelsCache()
 
 	// Test with valid models
 	models := []string{"openai/gpt-4", "anthropic/claude-3-sonnet"}
-	command := Command(client, models, messagesCache, &ignoredChannelsCache)
+	command := Command(client, models, messagesCache, ignoredChannelsCache, nil, nil)
 	
 	if command == nil {
 		t.Fatal("Command should not be nil")
@@ -67,13 +68,13 @@ func TestCommand_ModelValidation(t *testing.T) {
 func TestCommand_TemperatureOption(t *testing.T) {
 	client := &openrouter.Client{}
 	messagesCache, _ := NewMessagesCache(10)
-	ignoredChannelsCache := make(IgnoredChannelsCache)
+	ignoredChannelsCache := NewIgnoredChannelsCache()
 	
-	command := Command(client, []string{"openai/gpt-4"}, messagesCache, &ignoredChannelsCache)
+	command := Command(client, []string{"openai/gpt-4"}, messagesCache, ignoredChannelsCache, nil, nil)
 	
 	// Find temperature option
 	var tempOption *discord.ApplicationCommandOption
-	for _, option := range command.Options {
+	for _, option := range command.ApplicationCommand().Options {
 		if option.Name == gptCommandOptionTemperature.string() {
 			tempOption = option
 			break
@@ -95,16 +96,67 @@ func TestCommand_TemperatureOption(t *testing.T) {
 	}
 }
 
+func TestCommand_TemperatureSchema(t *testing.T) {
+	command := Command(&openrouter.Client{}, []string{"openai/gpt-4", "anthropic/claude-3-sonnet"}, nil, nil, nil, nil)
+	option := func(name string, typ discord.ApplicationCommandOptionType, value any) *discord.ApplicationCommandInteractionDataOption {
+		return &discord.ApplicationCommandInteractionDataOption{Name: name, Type: typ, Value: value}
+	}
+	temperature := func(value float64) *discord.ApplicationCommandInteractionDataOption {
+		return option(gptCommandOptionTemperature.string(), discord.ApplicationCommandOptionNumber, value)
+	}
+
+	tests := []struct {
+		name    string
+		options []*discord.ApplicationCommandInteractionDataOption
+		valid   bool
+	}{
+		{"omitted", nil, true},
+		{"in range", []*discord.ApplicationCommandInteractionDataOption{temperature(0.7)}, true},
+		{"above maximum", []*discord.ApplicationCommandInteractionDataOption{temperature(2.5)}, false},
+		{"below minimum", []*discord.ApplicationCommandInteractionDataOption{temperature(-1)}, false},
+		{"configured model", []*discord.ApplicationCommandInteractionDataOption{option(gptCommandOptionModel.string(), discord.ApplicationCommandOptionString, "openai/gpt-4")}, true},
+		{"unknown model", []*discord.ApplicationCommandInteractionDataOption{option(gptCommandOptionModel.string(), discord.ApplicationCommandOptionString, "openai/gpt-5")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := make(bot.OptionsMap, len(tt.options))
+			for _, option := range tt.options {
+				options[option.Name] = option
+			}
+			if err := bot.ValidateOptions(command.Schema, options); (err == nil) != tt.valid {
+				t.Errorf("Expected valid %t, got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestTemperatureOption(t *testing.T) {
+	ctx := bot.NewContext(nil, nil, nil, &discord.Interaction{
+		Type: discord.InteractionApplicationCommand,
+		Data: discord.ApplicationCommandInteractionData{Name: "chat"},
+	}, nil, nil)
+	if temperature := temperatureOption(ctx); temperature != nil {
+		t.Errorf("Expected no temperature when the option is omitted, got %g", *temperature)
+	}
+
+	ctx.Options[gptCommandOptionTemperature.string()] = &discord.ApplicationCommandInteractionDataOption{
+		Name: gptCommandOptionTemperature.string(), Type: discord.ApplicationCommandOptionNumber, Value: 0.0,
+	}
+	if temperature := temperatureOption(ctx); temperature == nil || *temperature != 0 {
+		t.Errorf("Expected a temperature of 0, got %v", temperature)
+	}
+}
+
 func TestCommand_BasicOptions(t *testing.T) {
 	client := &openrouter.Client{}
 	messagesCache, _ := NewMessagesCache(10)
-	ignoredChannelsCache := make(IgnoredChannelsCache)
+	ignoredChannelsCache := NewIgnoredChannelsCache()
 	
-	command := Command(client, []string{"openai/gpt-4"}, messagesCache, &ignoredChannelsCache)
+	command := Command(client, []string{"openai/gpt-4"}, messagesCache, ignoredChannelsCache, nil, nil)
 	
 	// Check that basic options are present
 	foundOptions := make(map[string]*discord.ApplicationCommandOption)
-	for _, option := range command.Options {
+	for _, option := range command.ApplicationCommand().Options {
 		foundOptions[option.Name] = option
 	}
 	
@@ -128,7 +180,7 @@ func TestCommand_BasicOptions(t *testing.T) {
 func TestCommand_ModelFiltering(t *testing.T) {
 	client := &openrouter.Client{}
 	messagesCache, _ := NewMessagesCache(10)
-	ignoredChannelsCache := make(IgnoredChannelsCache)
+	ignoredChannelsCache := NewIgnoredChannelsCache()
 
 	// Test with mixed valid and invalid models
 	models := []string{
@@ -138,11 +190,11 @@ func TestCommand_ModelFiltering(t *testing.T) {
 		"another-invalid",   // invalid
 	}
 	
-	command := Command(client, models, messagesCache, &ignoredChannelsCache)
+	command := Command(client, models, messagesCache, ignoredChannelsCache, nil, nil)
 	
 	// Find model option
 	var modelOption *discord.ApplicationCommandOption
-	for _, option := range command.Options {
+	for _, option := range command.ApplicationCommand().Options {
 		if option.Name == gptCommandOptionModel.string() {
 			modelOption = option
 			break
@@ -181,16 +233,16 @@ func TestCommand_ModelFiltering(t *testing.T) {
 func TestCommand_NoModelOption(t *testing.T) {
 	client := &openrouter.Client{}
 	messagesCache, _ := NewMessagesCache(10)
-	ignoredChannelsCache := make(IgnoredChannelsCache)
+	ignoredChannelsCache := NewIgnoredChannelsCache()
 
 	// Test with only one valid model
 	models := []string{"openai/gpt-4"}
 	
-	command := Command(client, models, messagesCache, &ignoredChannelsCache)
+	command := Command(client, models, messagesCache, ignoredChannelsCache, nil, nil)
 	
 	// Find model option
 	var modelOption *discord.ApplicationCommandOption
-	for _, option := range command.Options {
+	for _, option := range command.ApplicationCommand().Options {
 		if option.Name == gptCommandOptionModel.string() {
 			modelOption = option
 			break
@@ -0,0 +1,488 @@
+package gpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/access"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/constants"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/utils"
+	discord "github.com/bwmarrin/discordgo"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+const (
+	compareCommandName = "compare"
+
+	compareMinModels = 2
+	compareMaxModels = 4
+
+	compareContinueButtonCustomIDPrefix = "gpt:compare:"
+	compareExpiredMessage               = "gpt.compare.expired"
+
+	// Comparisons are kept in memory so users can continue with the winner for a while
+	compareSessionsCacheSize = 128
+	compareSessionTTL        = time.Hour
+
+	compareAnswerMaxLength  = 4096
+	compareButtonLabelLimit = 80
+)
+
+type comparisonAnswer struct {
+	model   string
+	content string
+	usage   openrouter.Usage
+	cached  bool
+	latency time.Duration
+	err     error
+}
+
+type comparison struct {
+	// command is the path of the compare command, continuing is checked against it
+	command     string
+	prompt      string
+	temperature *float32
+	answers     []*comparisonAnswer
+}
+
+// compareContinuePayload identifies the answer a "Continue with" button continues with
+type compareContinuePayload struct {
+	ComparisonID string `json:"c"`
+	Index        int    `json:"i"`
+}
+
+var compareContinueCustomID = bot.CustomID[compareContinuePayload]{Prefix: compareContinueButtonCustomIDPrefix}
+
+func compareModelOptionName(i int) string {
+	return fmt.Sprintf("model-%d", i)
+}
+
+// CompareCommand sends the same prompt to several models and lets users continue the
+// conversation with the best answer. Without a catalog, it returns nil if fewer than two models are configured
+func CompareCommand(client openrouter.ChatCompletionClient, completionModels []string, messagesCache *MessagesCache, catalog *ModelCatalog, policy *access.Policy) *bot.Command {
+	validModels := make([]string, 0, len(completionModels))
+	for _, model := range completionModels {
+		if validateOpenRouterModel(model) {
+			validModels = append(validModels, model)
+		}
+	}
+	if catalog == nil && len(validModels) < compareMinModels {
+		return nil
+	}
+
+	var modelChoices []*discord.ApplicationCommandOptionChoice
+	for _, model := range validModels {
+		modelChoices = append(modelChoices, &discord.ApplicationCommandOptionChoice{
+			Name:  getModelDisplayName(model, false),
+			Value: model,
+		})
+	}
+
+	opts := []*discord.ApplicationCommandOption{
+		{
+			Type:        discord.ApplicationCommandOptionString,
+			Name:        gptCommandOptionPrompt.string(),
+			Description: "AI prompt sent to every model",
+			Required:    true,
+		},
+	}
+	var schema []*bot.OptionSchema
+	autocomplete := make(map[string]bot.AutocompleteHandler)
+	for i := 1; i <= compareMaxModels && (catalog != nil || i <= len(validModels)); i++ {
+		option := &bot.OptionSchema{
+			Type:        discord.ApplicationCommandOptionString,
+			Name:        compareModelOptionName(i),
+			Description: fmt.Sprintf("Model #%d to compare", i),
+			Required:    i <= compareMinModels,
+		}
+		if catalog != nil {
+			autocomplete[option.Name] = bot.AutocompleteHandlerFunc(func(ctx *bot.AutocompleteContext) {
+				modelAutocompleteHandler(ctx, catalog)
+			})
+		} else {
+			option.Choices = modelChoices
+		}
+		schema = append(schema, option)
+	}
+
+	schema = append(schema, temperatureOptionSchema("Sampling temperature (0.0-2.0) used by every model"))
+
+	sessions := expirable.NewLRU[string, *comparison](compareSessionsCacheSize, nil, compareSessionTTL)
+
+	return &bot.Command{
+		Name:        compareCommandName,
+		Description: "Compare answers of several AI models side by side",
+		Options:     opts,
+		Schema:      schema,
+		Handler: bot.HandlerFunc(func(ctx *bot.Context) {
+			compareHandler(ctx, client, sessions, catalog, policy)
+		}),
+		Autocomplete: autocomplete,
+		Components: []*bot.Component{
+			{
+				Prefix: compareContinueButtonCustomIDPrefix,
+				Handler: bot.ComponentHandlerFunc(func(ctx *bot.ComponentContext) {
+					compareContinueHandler(ctx, sessions, messagesCache, policy)
+				}),
+				// The comparison is gone from the sessions cache once its TTL has passed
+				Expiry:         compareSessionTTL,
+				ExpiredMessage: compareExpiredMessage,
+			},
+		},
+	}
+}
+
+var errComparisonFailed = errors.New("unexpected error while requesting the model")
+
+// compareModels sends the prompt to every model concurrently. Answers are returned in the order of models
+func compareModels(ctx context.Context, client openrouter.ChatCompletionClient, prompt string, temperature *float32, models []string) []*comparisonAnswer {
+	answers := make([]*comparisonAnswer, len(models))
+
+	var wg sync.WaitGroup
+	for i, model := range models {
+		wg.Add(1)
+		bot.Go(ctx, func() {
+			defer wg.Done()
+			cacheItem := &MessagesCacheData{
+				Messages: []openrouter.ChatCompletionMessage{
+					{
+						Role:    "user",
+						Content: prompt,
+					},
+				},
+				Model:       model,
+				Temperature: temperature,
+			}
+
+			start := time.Now()
+			resp, err := sendOpenRouterRequest(ctx, client, cacheItem, nil)
+			answer := &comparisonAnswer{
+				model:   model,
+				latency: time.Since(start),
+				err:     err,
+			}
+			if resp != nil {
+				answer.content = resp.content
+				answer.usage = resp.usage
+				answer.cached = resp.cached
+			}
+			answers[i] = answer
+		})
+	}
+	wg.Wait()
+
+	// A request that panicked left no answer behind
+	for i, answer := range answers {
+		if answer == nil {
+			answers[i] = &comparisonAnswer{model: models[i], err: errComparisonFailed}
+		}
+	}
+	return answers
+}
+
+func compareCostString(answer *comparisonAnswer) string {
+	switch {
+	case answer.cached:
+		return "$0 (cached)"
+	case answer.usage.TotalCost > 0:
+		return fmt.Sprintf("$%.6f", answer.usage.TotalCost)
+	}
+	if estimated := generateOpenRouterCost(answer.usage, answer.model); estimated != "" {
+		return strings.TrimPrefix(estimated, "\nEstimated Cost: ") + " (estimated)"
+	}
+	return "n/a"
+}
+
+func comparisonAnswerEmbed(locale discord.Locale, answer *comparisonAnswer) *discord.MessageEmbed {
+	embed := &discord.MessageEmbed{
+		Title: normalizeOpenRouterModelName(answer.model),
+		Color: gptInteractionEmbedColor,
+		Fields: []*discord.MessageEmbedField{
+			{
+				Name:   i18n.Text(locale, "gpt.compare.latency"),
+				Value:  fmt.Sprintf("%.2fs", answer.latency.Seconds()),
+				Inline: true,
+			},
+			{
+				Name:   i18n.Text(locale, "gpt.compare.tokens"),
+				Value:  i18n.Text(locale, "gpt.compare.tokens.value", answer.usage.PromptTokens, answer.usage.CompletionTokens),
+				Inline: true,
+			},
+			{
+				Name:   i18n.Text(locale, "gpt.compare.cost"),
+				Value:  compareCostString(answer),
+				Inline: true,
+			},
+		},
+		Footer: &discord.MessageEmbedFooter{
+			Text:    answer.model,
+			IconURL: constants.OpenRouterIconURL,
+		},
+	}
+
+	if answer.err != nil {
+		embed.Description = "❌ " + answer.err.Error()
+		embed.Color = 0xff0000
+		return embed
+	}
+
+	embed.Description = truncateMessage(answer.content, compareAnswerMaxLength)
+	return embed
+}
+
+func compareHandler(ctx *bot.Context, client openrouter.ChatCompletionClient, sessions *expirable.LRU[string, *comparison], catalog *ModelCatalog, policy *access.Policy) {
+	log.Printf("[GID: %s, i.ID: %s] Compare interaction invoked by UserID: %s\n", ctx.Interaction.GuildID, ctx.Interaction.ID, ctx.User().ID)
+	err := ctx.Respond(&discord.InteractionResponse{
+		Type: discord.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		log.Printf("[GID: %s, i.ID: %s] Failed to respond to interaction with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		return
+	}
+
+	prompt := ctx.StringOption(gptCommandOptionPrompt.string(), "")
+
+	models := make([]string, 0, compareMaxModels)
+	seen := make(map[string]struct{}, compareMaxModels)
+	for i := 1; i <= compareMaxModels; i++ {
+		model := ctx.StringOption(compareModelOptionName(i), "")
+		if model == "" {
+			continue
+		}
+		if _, exists := seen[model]; exists {
+			continue
+		}
+		if catalog != nil && !catalog.Contains(model) {
+			ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
+				Embeds: []*discord.MessageEmbed{unknownModelEmbed(ctx.Locale(), model)},
+			})
+			return
+		}
+		if denial := modelAccessDenial(ctx.Session, ctx.Interaction, policy, bot.CommandPath(ctx.Interaction.ApplicationCommandData()), model); denial != nil {
+			ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
+				Embeds: []*discord.MessageEmbed{access.DenialEmbed(ctx.Locale(), denial)},
+			})
+			return
+		}
+		seen[model] = struct{}{}
+		models = append(models, model)
+	}
+
+	if prompt == "" || len(models) < compareMinModels {
+		ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
+			Embeds: []*discord.MessageEmbed{
+				{
+					Title:       i18n.Text(ctx.Locale(), "error.title"),
+					Description: i18n.Text(ctx.Locale(), "gpt.compare.error.models", compareMinModels),
+					Color:       0xff0000,
+				},
+			},
+		})
+		return
+	}
+
+	fields := []*discord.MessageEmbedField{
+		{
+			Name:  i18n.Text(ctx.Locale(), "gpt.compare.models"),
+			Value: strings.Join(models, "\n"),
+		},
+	}
+
+	temperature := temperatureOption(ctx)
+	if temperature != nil {
+		fields = append(fields, &discord.MessageEmbedField{
+			Name:  gptCommandOptionTemperature.humanReadableString(),
+			Value: fmt.Sprintf("%g", *temperature),
+		})
+	}
+
+	_, err = ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
+		Embeds: []*discord.MessageEmbed{
+			{
+				Description: prompt,
+				Color:       gptInteractionEmbedColor,
+				Author: &discord.MessageEmbedAuthor{
+					Name:         i18n.Text(ctx.Locale(), "gpt.compare.author", ctx.User().Username),
+					IconURL:      ctx.User().AvatarURL("32"),
+					ProxyIconURL: constants.OpenAIBlackIconURL,
+				},
+				Fields: fields,
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("[GID: %s, i.ID: %s] Failed to respond to interaction with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		return
+	}
+
+	log.Printf("[GID: %s, i.ID: %s] OpenRouter comparison invoked with [Models: %s]\n", ctx.Interaction.GuildID, ctx.Interaction.ID, strings.Join(models, ", "))
+	bot.SetEventModel(ctx, strings.Join(models, ", "), prompt)
+	answers := compareModels(ctx, client, prompt, temperature, models)
+
+	sessions.Add(ctx.Interaction.ID, &comparison{
+		command:     bot.CommandPath(ctx.Interaction.ApplicationCommandData()),
+		prompt:      prompt,
+		temperature: temperature,
+		answers:     answers,
+	})
+
+	for i, answer := range answers {
+		log.Printf("[GID: %s, i.ID: %s] OpenRouter comparison [Model: %s] finished in %v with a usage: [PromptTokens: %d, CompletionTokens: %d, TotalTokens: %d, Cached: %t, Error: %v]\n", ctx.Interaction.GuildID, ctx.Interaction.ID, answer.model, answer.latency, answer.usage.PromptTokens, answer.usage.CompletionTokens, answer.usage.TotalTokens, answer.cached, answer.err)
+
+		var components []discord.MessageComponent
+		customID, err := compareContinueCustomID.Encode(compareContinuePayload{ComparisonID: ctx.Interaction.ID, Index: i})
+		if err != nil {
+			log.Printf("[GID: %s, i.ID: %s] Failed to encode comparison button ID with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		}
+		if answer.err == nil && err == nil {
+			label := truncateMessage(i18n.Text(ctx.Locale(), "gpt.compare.continue", normalizeOpenRouterModelName(answer.model)), compareButtonLabelLimit)
+			components = []discord.MessageComponent{
+				discord.ActionsRow{
+					Components: []discord.MessageComponent{
+						discord.Button{
+							Label:    label,
+							Style:    discord.PrimaryButton,
+							CustomID: customID,
+						},
+					},
+				},
+			}
+		}
+
+		_, err = ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
+			Embeds:     []*discord.MessageEmbed{comparisonAnswerEmbed(ctx.Locale(), answer)},
+			Components: components,
+		})
+		if err != nil {
+			log.Printf("[GID: %s, i.ID: %s] Failed to send comparison answer with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		}
+	}
+}
+
+// compareContinueHandler starts a regular GPT thread seeded with the chosen answer
+func compareContinueHandler(ctx *bot.ComponentContext, sessions *expirable.LRU[string, *comparison], messagesCache *MessagesCache, policy *access.Policy) {
+	payload, err := compareContinueCustomID.Decode(ctx.CustomID)
+	if err != nil {
+		log.Printf("[GID: %s, i.ID: %s] Invalid comparison button ID %s with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, ctx.CustomID, err)
+		ctx.RespondEphemeral(i18n.Text(ctx.Locale(), compareExpiredMessage))
+		return
+	}
+
+	session, ok := sessions.Get(payload.ComparisonID)
+	if !ok || payload.Index < 0 || payload.Index >= len(session.answers) {
+		ctx.RespondEphemeral(i18n.Text(ctx.Locale(), compareExpiredMessage))
+		return
+	}
+	answer := session.answers[payload.Index]
+	user := ctx.User()
+	// Anyone can press the button, not only the user who compared the models
+	if denial := modelAccessDenial(ctx.Session, ctx.Interaction, policy, session.command, answer.model); denial != nil {
+		ctx.Respond(&discord.InteractionResponse{
+			Type: discord.InteractionResponseChannelMessageWithSource,
+			Data: &discord.InteractionResponseData{
+				Embeds: []*discord.MessageEmbed{access.DenialEmbed(ctx.Locale(), denial)},
+				Flags:  discord.MessageFlagsEphemeral,
+			},
+		})
+		return
+	}
+
+	fields := []*discord.MessageEmbedField{
+		{
+			Value: "\u200B",
+		},
+		{
+			Name:  gptCommandOptionModel.humanReadableString(),
+			Value: answer.model,
+		},
+	}
+	if session.temperature != nil {
+		fields = append(fields, &discord.MessageEmbedField{
+			Name:  gptCommandOptionTemperature.humanReadableString(),
+			Value: fmt.Sprintf("%g", *session.temperature),
+		})
+	}
+
+	// The thread starter message has the same format as /chat gpt, so the conversation
+	// can be restored from the thread history later
+	err = ctx.Respond(&discord.InteractionResponse{
+		Type: discord.InteractionResponseChannelMessageWithSource,
+		Data: &discord.InteractionResponseData{
+			Embeds: []*discord.MessageEmbed{
+				{
+					Description: session.prompt,
+					Color:       gptInteractionEmbedColor,
+					Author: &discord.MessageEmbedAuthor{
+						Name:         i18n.Text(ctx.Locale(), "gpt.request.author", user.Username),
+						IconURL:      user.AvatarURL("32"),
+						ProxyIconURL: constants.OpenAIBlackIconURL,
+					},
+					Fields: fields,
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("[GID: %s, i.ID: %s] Failed to respond to interaction with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		return
+	}
+
+	m, err := ctx.Session.InteractionResponse(ctx.Interaction)
+	if err != nil {
+		log.Printf("[GID: %s, i.ID: %s] Failed to get interaction reference with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		return
+	}
+
+	// Direct messages have no threads, the conversation continues in the channel
+	channelID := m.ChannelID
+	if ctx.Interaction.GuildID != "" {
+		thread, err := ctx.Session.MessageThreadStartComplex(m.ChannelID, m.ID, &discord.ThreadStart{
+			Name:                i18n.Text(ctx.Locale(), "gpt.compare.thread", normalizeOpenRouterModelName(answer.model)),
+			AutoArchiveDuration: gptDiscordThreadAutoArchivewDurationMinutes,
+			Invitable:           false,
+		})
+		if err != nil {
+			log.Printf("[GID: %s, i.ID: %s] Failed to create a thread with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+			return
+		}
+		bot.Emit(ctx, bot.Event{Type: bot.EventThreadCreated, ThreadID: thread.ID, Model: answer.model, Prompt: session.prompt})
+		ctx.ThreadMemberAdd(thread.ID, user.ID)
+		channelID = thread.ID
+	}
+
+	messagesCache.Add(channelID, &MessagesCacheData{
+		Messages: []openrouter.ChatCompletionMessage{
+			{
+				Role:    "user",
+				Content: session.prompt,
+			},
+			{
+				Role:    "assistant",
+				Content: answer.content,
+			},
+		},
+		Model:       answer.model,
+		Temperature: session.temperature,
+		Command:     session.command,
+	})
+
+	var lastMessage *discord.Message
+	for _, message := range splitMessage(answer.content) {
+		lastMessage, err = utils.DiscordChannelMessageSend(ctx.Session, channelID, message, nil)
+		if err != nil {
+			log.Printf("[GID: %s, i.ID: %s] Discord API failed with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+			return
+		}
+	}
+	attachUsageInfo(ctx.Session, ctx.Locale(), lastMessage, answer.usage, answer.model, answer.cached)
+
+	log.Printf("[GID: %s, i.ID: %s] Comparison continued with [Model: %s] in channel %s by UserID: %s\n", ctx.Interaction.GuildID, ctx.Interaction.ID, answer.model, channelID, user.ID)
+}
@@ -0,0 +1,141 @@
+package gpt
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
+)
+
+// comparisonClient answers with the model name after a delay, and fails for models containing "broken"
+type comparisonClient struct {
+	inFlight    int32
+	maxInFlight int32
+}
+
+func (c *comparisonClient) CreateChatCompletion(ctx context.Context, req openrouter.ChatCompletionRequest) (*openrouter.ChatCompletionResponse, error) {
+	current := atomic.AddInt32(&c.inFlight, 1)
+	defer atomic.AddInt32(&c.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&c.maxInFlight)
+		if current <= max || atomic.CompareAndSwapInt32(&c.maxInFlight, max, current) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if strings.Contains(req.Model, "broken") {
+		return nil, errors.New("model unavailable")
+	}
+	return &openrouter.ChatCompletionResponse{
+		Choices: []openrouter.ChatCompletionChoice{
+			{Message: openrouter.ChatCompletionMessage{Role: "assistant", Content: "Answer from " + req.Model}},
+		},
+		Usage: openrouter.Usage{PromptTokens: 4, CompletionTokens: 3, TotalTokens: 7, TotalCost: 0.0002},
+	}, nil
+}
+
+func TestCompareModels(t *testing.T) {
+	client := &comparisonClient{}
+	models := []string{"openai/gpt-4", "anthropic/claude-3-sonnet", "broken/model"}
+
+	answers := compareModels(context.Background(), client, "Hello", nil, models)
+	if len(answers) != len(models) {
+		t.Fatalf("Expected %d answers, got %d", len(models), len(answers))
+	}
+	if client.maxInFlight < 2 {
+		t.Errorf("Expected requests to run concurrently, max in flight was %d", client.maxInFlight)
+	}
+
+	for i, answer := range answers[:2] {
+		if answer.model != models[i] {
+			t.Errorf("Expected answers in model order, got %s at %d", answer.model, i)
+		}
+		if answer.err != nil || answer.content != "Answer from "+models[i] {
+			t.Errorf("Unexpected answer for %s: %q, %v", models[i], answer.content, answer.err)
+		}
+		if answer.latency <= 0 {
+			t.Errorf("Expected latency to be measured for %s", models[i])
+		}
+		if got := compareCostString(answer); got != "$0.000200" {
+			t.Errorf("Expected cost $0.000200, got %s", got)
+		}
+	}
+	if answers[2].err == nil {
+		t.Error("Expected an error for the broken model")
+	}
+	if embed := comparisonAnswerEmbed(i18n.DefaultLocale, answers[2]); !strings.HasPrefix(embed.Description, "❌") {
+		t.Errorf("Expected error embed, got %q", embed.Description)
+	}
+}
+
+func TestCompareCommand(t *testing.T) {
+	if cmd := CompareCommand(nil, []string{"openai/gpt-4"}, nil, nil, nil); cmd != nil {
+		t.Error("Expected no compare command with a single model")
+	}
+
+	cmd := CompareCommand(nil, []string{"openai/gpt-4", "anthropic/claude-3-sonnet", "meta/llama-3"}, nil, nil, nil)
+	if cmd == nil {
+		t.Fatal("Expected compare command")
+	}
+	var modelOptions, required int
+	for _, opt := range cmd.ApplicationCommand().Options {
+		if strings.HasPrefix(opt.Name, "model-") {
+			modelOptions++
+			if opt.Required {
+				required++
+			}
+		}
+	}
+	if modelOptions != 3 || required != 2 {
+		t.Errorf("Expected 3 model options with 2 required, got %d options and %d required", modelOptions, required)
+	}
+	if len(cmd.Components) != 1 || cmd.Components[0].Prefix != compareContinueButtonCustomIDPrefix {
+		t.Error("Expected continue button handler")
+	}
+}
+
+func TestTruncateMessage(t *testing.T) {
+	if got := truncateMessage("short", 10); got != "short" {
+		t.Errorf("Expected message to be unchanged, got %q", got)
+	}
+	got := truncateMessage(strings.Repeat("ä", 10), 9)
+	if len(got) > 9 || !strings.HasSuffix(got, "…") || !strings.HasPrefix(got, "ää") {
+		t.Errorf("Unexpected truncated message %q", got)
+	}
+}
+
+func TestCompareContinueCustomID(t *testing.T) {
+	payload := compareContinuePayload{ComparisonID: "1234567890123456789", Index: 3}
+	customID, err := compareContinueCustomID.Encode(payload)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if len(customID) > bot.MaxCustomIDLength || !strings.HasPrefix(customID, compareContinueButtonCustomIDPrefix) {
+		t.Errorf("Unexpected custom ID %q", customID)
+	}
+
+	got, err := compareContinueCustomID.Decode(customID)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if got != payload {
+		t.Errorf("Expected payload %+v, got %+v", payload, got)
+	}
+
+	issued, err := bot.DecodeCustomID(customID, compareContinueButtonCustomIDPrefix, &got)
+	if err != nil || time.Since(issued) > time.Minute {
+		t.Errorf("Expected a fresh issue time, got %v (error %v)", issued, err)
+	}
+
+	// Buttons of comparisons made before payloads were encoded are rejected instead of misread
+	if _, err := compareContinueCustomID.Decode(compareContinueButtonCustomIDPrefix + "1234567890123456789:3"); err == nil {
+		t.Error("Expected legacy custom ID to be rejected")
+	}
+}
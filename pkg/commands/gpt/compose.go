@@ -0,0 +1,294 @@
+package gpt
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/access"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
+	discord "github.com/bwmarrin/discordgo"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+const (
+	composeCommandName = "compose"
+
+	composeModalCustomIDPrefix = "gpt:compose:"
+	composeModalTitle          = "gpt.compose.title"
+	composeExpiredMessage      = "gpt.compose.expired"
+
+	// Discord limits text inputs of modals to 4000 characters, which fits into an embed description
+	composeInputMaxLength = 4000
+	// Contexts longer than an embed field are attached to the request message as a file
+	composeContextFileName = "context.txt"
+
+	// The options of the command are kept until the modal is submitted
+	composeRequestsCacheSize = 256
+	composeRequestTTL        = 30 * time.Minute
+)
+
+// composeRequest holds the command options while the user fills in the modal
+type composeRequest struct {
+	// command is the path of the command, conversations started by the modal are checked against it
+	command     string
+	model       string
+	temperature *float32
+}
+
+// composeModalPayload identifies the compose request a modal belongs to
+type composeModalPayload struct {
+	RequestID string `json:"r"`
+}
+
+var composeModalCustomID = bot.CustomID[composeModalPayload]{Prefix: composeModalCustomIDPrefix}
+
+// ComposeCommand opens a modal with multi-line prompt and context fields and starts a
+// conversation thread like the gpt command, for prompts that do not fit into a single line option
+func ComposeCommand(client openrouter.ChatCompletionClient, completionModels []string, messagesCache *MessagesCache, catalog *ModelCatalog, policy *access.Policy) *bot.Command {
+	validModels := make([]string, 0, len(completionModels))
+	for _, model := range completionModels {
+		if validateOpenRouterModel(model) {
+			validModels = append(validModels, model)
+		}
+	}
+
+	var schema []*bot.OptionSchema
+	modelOption, autocomplete := modelOptionSchema(validModels, catalog)
+	if modelOption != nil {
+		schema = append(schema, modelOption)
+	}
+	schema = append(schema, temperatureOptionSchema("Sampling temperature (0.0-2.0). Lower values are more focused and deterministic"))
+
+	requests := expirable.NewLRU[string, *composeRequest](composeRequestsCacheSize, nil, composeRequestTTL)
+	generations := newGenerationRegistry(composeStopButtonCustomIDPrefix)
+
+	return &bot.Command{
+		Name:        composeCommandName,
+		Description: "Write a long, multi-line prompt and context to start a conversation",
+		Schema:      schema,
+		Handler: bot.HandlerFunc(func(ctx *bot.Context) {
+			composeHandler(ctx, requests, catalog, policy)
+		}),
+		Autocomplete: autocomplete,
+		Components: []*bot.Component{
+			generations.stopComponent(),
+		},
+		Modals: []*bot.Modal{
+			{
+				Prefix: composeModalCustomIDPrefix,
+				Handler: bot.ModalHandlerFunc(func(ctx *bot.ModalContext) {
+					composeSubmitHandler(ctx, client, messagesCache, generations, requests)
+				}),
+				Expiry:         composeRequestTTL,
+				ExpiredMessage: composeExpiredMessage,
+			},
+		},
+	}
+}
+
+// composeHandler remembers the command options and opens the modal
+func composeHandler(ctx *bot.Context, requests *expirable.LRU[string, *composeRequest], catalog *ModelCatalog, policy *access.Policy) {
+	ch, err := ctx.Session.State().Channel(ctx.Interaction.ChannelID)
+	if err == nil && ch.IsThread() {
+		ctx.Respond(composeErrorResponse(ctx.Locale(), i18n.Text(ctx.Locale(), "gpt.error.thread")))
+		return
+	}
+
+	request := &composeRequest{
+		command:     bot.CommandPath(ctx.Interaction.ApplicationCommandData()),
+		model:       ctx.StringOption(gptCommandOptionModel.string(), gptDefaultModel),
+		temperature: temperatureOption(ctx),
+	}
+	if catalog != nil && !catalog.Contains(request.model) {
+		log.Printf("[GID: %s, i.ID: %s] Unknown model provided: %s\n", ctx.Interaction.GuildID, ctx.Interaction.ID, request.model)
+		ctx.Respond(&discord.InteractionResponse{
+			Type: discord.InteractionResponseChannelMessageWithSource,
+			Data: &discord.InteractionResponseData{
+				Embeds: []*discord.MessageEmbed{unknownModelEmbed(ctx.Locale(), request.model)},
+				Flags:  discord.MessageFlagsEphemeral,
+			},
+		})
+		return
+	}
+	if denial := modelAccessDenial(ctx.Session, ctx.Interaction, policy, request.command, request.model); denial != nil {
+		ctx.Respond(&discord.InteractionResponse{
+			Type: discord.InteractionResponseChannelMessageWithSource,
+			Data: &discord.InteractionResponseData{
+				Embeds: []*discord.MessageEmbed{access.DenialEmbed(ctx.Locale(), denial)},
+				Flags:  discord.MessageFlagsEphemeral,
+			},
+		})
+		return
+	}
+	customID, err := composeModalCustomID.Encode(composeModalPayload{RequestID: ctx.Interaction.ID})
+	if err != nil {
+		log.Printf("[GID: %s, i.ID: %s] Failed to encode compose modal ID with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		ctx.Respond(composeErrorResponse(ctx.Locale(), err.Error()))
+		return
+	}
+	requests.Add(ctx.Interaction.ID, request)
+
+	err = ctx.OpenModal(customID, i18n.Text(ctx.Locale(), composeModalTitle),
+		discord.TextInput{
+			CustomID:    gptCommandOptionPrompt.string(),
+			Label:       i18n.Text(ctx.Locale(), "gpt.compose.prompt.label"),
+			Style:       discord.TextInputParagraph,
+			Placeholder: i18n.Text(ctx.Locale(), "gpt.compose.prompt.placeholder"),
+			Required:    true,
+			MaxLength:   composeInputMaxLength,
+		},
+		discord.TextInput{
+			CustomID:    gptCommandOptionContext.string(),
+			Label:       i18n.Text(ctx.Locale(), "gpt.compose.context.label"),
+			Style:       discord.TextInputParagraph,
+			Placeholder: i18n.Text(ctx.Locale(), "gpt.compose.context.placeholder"),
+			Required:    false,
+			MaxLength:   composeInputMaxLength,
+		},
+	)
+	if err != nil {
+		log.Printf("[GID: %s, i.ID: %s] Failed to open compose modal with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+	}
+}
+
+// composeSubmitHandler starts the conversation with the submitted prompt and context
+func composeSubmitHandler(ctx *bot.ModalContext, client openrouter.ChatCompletionClient, messagesCache *MessagesCache, generations *generationRegistry, requests *expirable.LRU[string, *composeRequest]) {
+	payload, err := composeModalCustomID.Decode(ctx.CustomID)
+	if err != nil {
+		log.Printf("[GID: %s, i.ID: %s] Invalid compose modal ID %s with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, ctx.CustomID, err)
+		ctx.RespondEphemeral(i18n.Text(ctx.Locale(), composeExpiredMessage))
+		return
+	}
+	request, ok := requests.Get(payload.RequestID)
+	if !ok {
+		ctx.RespondEphemeral(i18n.Text(ctx.Locale(), composeExpiredMessage))
+		return
+	}
+	requests.Remove(payload.RequestID)
+
+	log.Printf("[GID: %s, i.ID: %s] Compose modal submitted by UserID: %s\n", ctx.Interaction.GuildID, ctx.Interaction.ID, ctx.User().ID)
+	err = ctx.Respond(&discord.InteractionResponse{
+		Type: discord.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		log.Printf("[GID: %s, i.ID: %s] Failed to respond to interaction with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		return
+	}
+
+	prompt := strings.TrimSpace(ctx.Values[gptCommandOptionPrompt.string()])
+	if prompt == "" {
+		ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
+			Embeds: []*discord.MessageEmbed{
+				{
+					Title:       i18n.Text(ctx.Locale(), "error.title"),
+					Description: i18n.Text(ctx.Locale(), "gpt.error.prompt"),
+					Color:       0xff0000,
+				},
+			},
+		})
+		return
+	}
+
+	conv := composedConversation(prompt, strings.TrimSpace(ctx.Values[gptCommandOptionContext.string()]), request.model, request.temperature)
+	conv.cacheItem.Command = request.command
+	if conv.cacheItem.SystemMessage == nil && messagesCache.LanguageHint {
+		conv.cacheItem.SystemMessage = languageHintMessage(ctx.Locale())
+	}
+	if ok, count := isCacheItemWithinTruncateLimit(conv.cacheItem); !ok {
+		truncateLimit := count
+		if limit := modelTruncateLimit(request.model); limit != nil {
+			truncateLimit = *limit
+		}
+		log.Printf("[GID: %s, i.ID: %s] Composed request has %d tokens, which exceeds allowed token limit of `%d` for model `%s`.\n", ctx.Interaction.GuildID, ctx.Interaction.ID, count, truncateLimit, request.model)
+		ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
+			Embeds: []*discord.MessageEmbed{
+				{
+					Title:       i18n.Text(ctx.Locale(), "gpt.error.request.title"),
+					Description: i18n.Text(ctx.Locale(), "gpt.error.compose_tokens.description", count, truncateLimit, request.model),
+					Color:       0xff0000,
+				},
+			},
+		})
+		return
+	}
+
+	startConversation(ctx, ctx.Session, ctx.Interaction, client, messagesCache, generations, conv)
+}
+
+// composedConversation builds the conversation of a submitted modal. A context that does not fit
+// into an embed field is attached as a file, so the thread can still be restored with the full text
+func composedConversation(prompt string, systemContext string, model string, temperature *float32) *conversation {
+	conv := &conversation{
+		cacheItem: &MessagesCacheData{
+			Messages: []openrouter.ChatCompletionMessage{
+				{
+					Role:    "user",
+					Content: prompt,
+				},
+			},
+			Model:       model,
+			Temperature: temperature,
+		},
+		fields: []*discord.MessageEmbedField{
+			{
+				Value: "\u200B",
+			},
+		},
+	}
+
+	if systemContext != "" {
+		conv.cacheItem.SystemMessage = &openrouter.ChatCompletionMessage{
+			Role:    "system",
+			Content: systemContext,
+		}
+		if len(systemContext) < gptContextOptionMaxLength {
+			conv.fields = append(conv.fields, &discord.MessageEmbedField{
+				Name:  gptCommandOptionContext.humanReadableString(),
+				Value: systemContext,
+			})
+		} else {
+			conv.fields = append(conv.fields, &discord.MessageEmbedField{
+				Name:  gptCommandOptionContextFile.humanReadableString(),
+				Value: composeContextFileName,
+			})
+			conv.files = append(conv.files, &discord.File{
+				Name:        composeContextFileName,
+				ContentType: "text/plain",
+				Reader:      strings.NewReader(systemContext),
+			})
+		}
+	}
+
+	conv.fields = append(conv.fields, &discord.MessageEmbedField{
+		Name:  gptCommandOptionModel.humanReadableString(),
+		Value: model,
+	})
+	if temperature != nil {
+		conv.fields = append(conv.fields, &discord.MessageEmbedField{
+			Name:  gptCommandOptionTemperature.humanReadableString(),
+			Value: fmt.Sprintf("%g", *temperature),
+		})
+	}
+
+	return conv
+}
+
+func composeErrorResponse(locale discord.Locale, description string) *discord.InteractionResponse {
+	return &discord.InteractionResponse{
+		Type: discord.InteractionResponseChannelMessageWithSource,
+		Data: &discord.InteractionResponseData{
+			Embeds: []*discord.MessageEmbed{
+				{
+					Title:       i18n.Text(locale, "error.title"),
+					Description: description,
+					Color:       0xff0000,
+				},
+			},
+			Flags: discord.MessageFlagsEphemeral,
+		},
+	}
+}
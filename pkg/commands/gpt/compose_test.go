@@ -0,0 +1,78 @@
+package gpt
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	discord "github.com/bwmarrin/discordgo"
+)
+
+func TestComposedConversation(t *testing.T) {
+	temperature := float32(0.5)
+	conv := composedConversation("Line one\nLine two", "Be concise", "openai/gpt-4", &temperature)
+
+	if conv.cacheItem.Messages[0].Content != "Line one\nLine two" {
+		t.Errorf("Expected multi-line prompt to be kept, got %q", conv.cacheItem.Messages[0].Content)
+	}
+	if conv.cacheItem.SystemMessage == nil || conv.cacheItem.SystemMessage.Content != "Be concise" {
+		t.Fatal("Expected context as system message")
+	}
+	if len(conv.files) != 0 {
+		t.Errorf("Expected short context inline, got %d files", len(conv.files))
+	}
+
+	prompt, _, context, model, temp := parseInteractionReply(&discord.Message{
+		Embeds: []*discord.MessageEmbed{{Description: "Line one\nLine two", Fields: conv.fields}},
+	})
+	if prompt != "Line one\nLine two" || context != "Be concise" || model != "openai/gpt-4" || temp == nil || *temp != temperature {
+		t.Errorf("Unexpected restored request: %q, %q, %q, %v", prompt, context, model, temp)
+	}
+}
+
+func TestComposedConversation_LongContext(t *testing.T) {
+	longContext := strings.Repeat("You are a helpful assistant. ", 100)
+	conv := composedConversation("Hi", longContext, "openai/gpt-4", nil)
+
+	if conv.cacheItem.SystemMessage.Content != longContext {
+		t.Error("Expected the full context as system message")
+	}
+	if len(conv.files) != 1 || conv.files[0].Name != composeContextFileName {
+		t.Fatalf("Expected context to be attached, got %d files", len(conv.files))
+	}
+	attached, _ := io.ReadAll(conv.files[0].Reader)
+	if string(attached) != longContext {
+		t.Error("Expected the attached file to hold the full context")
+	}
+	for _, field := range conv.fields {
+		if len(field.Value) > gptContextOptionMaxLength {
+			t.Errorf("Field %q exceeds the embed field limit", field.Name)
+		}
+	}
+
+	// The thread is restored from the attachment of the request message
+	_, _, context, _, _ := parseInteractionReply(&discord.Message{
+		Embeds: []*discord.MessageEmbed{{Description: "Hi", Fields: conv.fields}},
+		Attachments: []*discord.MessageAttachment{
+			{Filename: composeContextFileName, URL: "https://cdn.discordapp.com/attachments/1/2/context.txt"},
+		},
+	})
+	if context != "https://cdn.discordapp.com/attachments/1/2/context.txt" {
+		t.Errorf("Expected context to resolve to the attachment URL, got %q", context)
+	}
+}
+
+func TestComposeCommand(t *testing.T) {
+	cmd := ComposeCommand(nil, []string{"openai/gpt-4", "anthropic/claude-3-sonnet"}, nil, nil, nil)
+	if len(cmd.Modals) != 1 || cmd.Modals[0].Prefix != composeModalCustomIDPrefix {
+		t.Error("Expected compose modal handler")
+	}
+	if len(cmd.Components) != 1 || cmd.Components[0].Prefix != composeStopButtonCustomIDPrefix {
+		t.Error("Expected compose Stop button handler")
+	}
+	for _, opt := range cmd.ApplicationCommand().Options {
+		if opt.Name == gptCommandOptionPrompt.string() {
+			t.Error("Expected prompt to be entered in the modal")
+		}
+	}
+}
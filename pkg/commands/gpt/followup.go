@@ -0,0 +1,207 @@
+package gpt
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+// FollowUpMode decides what happens to messages sent in a thread while it is answered
+type FollowUpMode string
+
+const (
+	// FollowUpLock locks the thread while it is answered, so nobody can send messages
+	FollowUpLock FollowUpMode = "lock"
+	// FollowUpQueue answers the messages sent meanwhile one after another
+	FollowUpQueue FollowUpMode = "queue"
+	// FollowUpBatch answers all messages sent meanwhile in a single reply
+	FollowUpBatch FollowUpMode = "batch"
+)
+
+// FollowUpConfig selects the follow-up mode of threads. Locking is the default
+type FollowUpConfig struct {
+	Mode FollowUpMode `yaml:"mode"`
+	// Guilds overrides the mode per guild ID
+	Guilds map[string]FollowUpMode `yaml:"guilds"`
+}
+
+func (c FollowUpConfig) Validate() error {
+	if err := c.Mode.validate(); err != nil {
+		return err
+	}
+	for _, mode := range c.Guilds {
+		if err := mode.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m FollowUpMode) validate() error {
+	switch m {
+	case "", FollowUpLock, FollowUpQueue, FollowUpBatch:
+		return nil
+	}
+	return fmt.Errorf("invalid follow-up mode '%s', must be 'lock', 'queue' or 'batch'", m)
+}
+
+// ModeFor returns the follow-up mode of the threads in the guild
+func (c FollowUpConfig) ModeFor(guildID string) FollowUpMode {
+	if mode, ok := c.Guilds[guildID]; ok && mode != "" {
+		return mode
+	}
+	if c.Mode == "" {
+		return FollowUpLock
+	}
+	return c.Mode
+}
+
+// threadQueues holds the messages sent in threads while they are answered
+type threadQueues struct {
+	mu sync.Mutex
+	// threads maps the threads being answered to the messages queued meanwhile
+	threads map[string][]*discord.Message
+}
+
+func newThreadQueues() *threadQueues {
+	return &threadQueues{threads: make(map[string][]*discord.Message)}
+}
+
+// begin marks the thread as being answered. If it already is, m is queued instead and false is returned
+func (q *threadQueues) begin(threadID string, m *discord.Message) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	queued, answering := q.threads[threadID]
+	if answering {
+		q.threads[threadID] = append(queued, m)
+		return false
+	}
+	q.threads[threadID] = nil
+	return true
+}
+
+// enqueue queues m if the thread is being answered and reports whether it did
+func (q *threadQueues) enqueue(threadID string, m *discord.Message) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	queued, answering := q.threads[threadID]
+	if !answering {
+		return false
+	}
+	q.threads[threadID] = append(queued, m)
+	return true
+}
+
+// answering reports whether the thread is being answered
+func (q *threadQueues) answering(threadID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, answering := q.threads[threadID]
+	return answering
+}
+
+// next returns the messages queued since the last call. Without any, the thread is no longer being answered
+func (q *threadQueues) next(threadID string) []*discord.Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	queued := q.threads[threadID]
+	if len(queued) == 0 {
+		delete(q.threads, threadID)
+		return nil
+	}
+	q.threads[threadID] = nil
+	return queued
+}
+
+// drop stops answering the thread and returns the messages left in its queue
+func (q *threadQueues) drop(threadID string) []*discord.Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	queued := q.threads[threadID]
+	delete(q.threads, threadID)
+	return queued
+}
+
+// followUpQueue queues the messages sent in threads while they are answered in queue or batch mode,
+// before they are dispatched. Otherwise they would wait on the dispatcher until the thread is answered
+type followUpQueue struct {
+	messagesCache *MessagesCache
+}
+
+func (q followUpQueue) Answering(s session.Session, m *discord.Message) bool {
+	if !shouldHandleMessageType(m.Type) || m.Author == nil || m.Content == "" {
+		return false
+	}
+	if user := s.State().User; user != nil && user.ID == m.Author.ID {
+		return false
+	}
+	if q.messagesCache.FollowUps.ModeFor(m.GuildID) == FollowUpLock {
+		return false
+	}
+	return q.messagesCache.queues.answering(m.ChannelID)
+}
+
+func (q followUpQueue) Enqueue(ctx *bot.MessageContext) bool {
+	if !q.messagesCache.queues.enqueue(ctx.Message.ChannelID, ctx.Message) {
+		return false
+	}
+	log.Printf("[GID: %s, CHID: %s, MID: %s] Thread is being answered, queueing the message\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID)
+	ctx.AddReaction(gptEmojiQueued)
+	return true
+}
+
+// answerQueuedMessages answers m and then the messages queued in its thread meanwhile, until none are left.
+// Every turn gets its own timeout. In batch mode, the messages queued during a turn are answered together
+func answerQueuedMessages(ctx context.Context, timeout time.Duration, s session.Session, caller *bot.Command, mode FollowUpMode, queues *threadQueues, m *discord.Message, answer func(ctx *bot.MessageContext, messages []*discord.Message)) {
+	threadID := m.ChannelID
+	finished := false
+	defer func() {
+		if finished {
+			return
+		}
+		// The turn panicked, the messages still queued are not answered
+		for _, queued := range queues.drop(threadID) {
+			s.MessageReactionRemove(queued.ChannelID, queued.ID, gptEmojiQueued, "@me")
+		}
+	}()
+
+	answerTurn := func(messages []*discord.Message) {
+		turnCtx, cancel := ctx, context.CancelFunc(func() {})
+		if timeout > 0 {
+			turnCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		defer cancel()
+		answer(bot.NewMessageContext(turnCtx, s, caller, messages[len(messages)-1], nil), messages)
+	}
+
+	turn := []*discord.Message{m}
+	for len(turn) > 0 {
+		if mode == FollowUpBatch {
+			answerTurn(turn)
+		} else {
+			for _, message := range turn {
+				answerTurn([]*discord.Message{message})
+			}
+		}
+
+		turn = queues.next(threadID)
+		if len(turn) > 0 {
+			log.Printf("[GID: %s, CHID: %s] Answering %d queued messages\n", m.GuildID, threadID, len(turn))
+		}
+		for _, queued := range turn {
+			s.MessageReactionRemove(queued.ChannelID, queued.ID, gptEmojiQueued, "@me")
+		}
+	}
+	finished = true
+}
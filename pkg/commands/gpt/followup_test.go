@@ -0,0 +1,140 @@
+package gpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("offline")
+}
+
+func offlineSession(t *testing.T) *discord.Session {
+	s, err := discord.New("Bot test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Client = &http.Client{Transport: offlineTransport{}}
+	s.MaxRestRetries = 0
+	return s
+}
+
+func TestFollowUpConfig_ModeFor(t *testing.T) {
+	config := FollowUpConfig{Guilds: map[string]FollowUpMode{"1": FollowUpBatch}}
+	if mode := config.ModeFor("2"); mode != FollowUpLock {
+		t.Errorf("Expected threads to be locked by default, got %s", mode)
+	}
+	if mode := config.ModeFor("1"); mode != FollowUpBatch {
+		t.Errorf("Expected the guild mode, got %s", mode)
+	}
+
+	config.Mode = FollowUpQueue
+	if mode := config.ModeFor("2"); mode != FollowUpQueue {
+		t.Errorf("Expected the configured mode, got %s", mode)
+	}
+}
+
+func TestFollowUpConfig_Validate(t *testing.T) {
+	if err := (FollowUpConfig{Mode: FollowUpQueue}).Validate(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	err := FollowUpConfig{Guilds: map[string]FollowUpMode{"1": "wait"}}.Validate()
+	if err == nil || err.Error() != "invalid follow-up mode 'wait', must be 'lock', 'queue' or 'batch'" {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestThreadQueues(t *testing.T) {
+	queues := newThreadQueues()
+	if !queues.begin("thread", &discord.Message{ID: "1"}) {
+		t.Fatal("Expected the first message to be answered right away")
+	}
+	if queues.begin("thread", &discord.Message{ID: "2"}) || queues.begin("thread", &discord.Message{ID: "3"}) {
+		t.Fatal("Expected messages to be queued while the thread is answered")
+	}
+	if !queues.begin("other", &discord.Message{ID: "4"}) {
+		t.Error("Expected threads to be queued separately")
+	}
+
+	if queued := queues.next("thread"); len(queued) != 2 || queued[0].ID != "2" || queued[1].ID != "3" {
+		t.Errorf("Expected the queued messages in order, got %v", queued)
+	}
+	if queued := queues.next("thread"); len(queued) != 0 {
+		t.Errorf("Expected no queued messages, got %v", queued)
+	}
+	if !queues.begin("thread", &discord.Message{ID: "5"}) {
+		t.Error("Expected the thread to be answered right away once the queue is empty")
+	}
+}
+
+func TestThreadQueues_Enqueue(t *testing.T) {
+	queues := newThreadQueues()
+	if queues.answering("thread") || queues.enqueue("thread", &discord.Message{ID: "1"}) {
+		t.Fatal("Expected no message to be queued while the thread is not answered")
+	}
+
+	queues.begin("thread", &discord.Message{ID: "1"})
+	if !queues.answering("thread") || !queues.enqueue("thread", &discord.Message{ID: "2"}) {
+		t.Fatal("Expected the message to be queued while the thread is answered")
+	}
+	if queued := queues.next("thread"); len(queued) != 1 || queued[0].ID != "2" {
+		t.Errorf("Expected the enqueued message, got %v", queued)
+	}
+	queues.next("thread")
+	if queues.enqueue("thread", &discord.Message{ID: "3"}) {
+		t.Error("Expected no message to be queued once the thread is answered")
+	}
+}
+
+func answeredTurns(t *testing.T, mode FollowUpMode) [][]string {
+	queues := newThreadQueues()
+	first := &discord.Message{ID: "1", ChannelID: "thread"}
+	queues.begin("thread", first)
+
+	var turns [][]string
+	answer := func(ctx *bot.MessageContext, messages []*discord.Message) {
+		if len(turns) == 0 {
+			// Messages sent while the first message is answered
+			for i := 2; i <= 4; i++ {
+				queues.begin("thread", &discord.Message{ID: fmt.Sprint(i), ChannelID: "thread"})
+			}
+		}
+		if ctx.Message != messages[len(messages)-1] {
+			t.Errorf("Expected the reply to the last message of the turn")
+		}
+		ids := make([]string, len(messages))
+		for i, m := range messages {
+			ids[i] = m.ID
+		}
+		turns = append(turns, ids)
+	}
+	answerQueuedMessages(context.Background(), 0, session.New(offlineSession(t)), nil, mode, queues, first, answer)
+
+	if !queues.begin("thread", first) {
+		t.Error("Expected the thread not to be answered anymore")
+	}
+	return turns
+}
+
+func TestAnswerQueuedMessages_Queue(t *testing.T) {
+	turns := answeredTurns(t, FollowUpQueue)
+	if fmt.Sprint(turns) != "[[1] [2] [3] [4]]" {
+		t.Errorf("Expected every message to be answered in order, got %v", turns)
+	}
+}
+
+func TestAnswerQueuedMessages_Batch(t *testing.T) {
+	turns := answeredTurns(t, FollowUpBatch)
+	if fmt.Sprint(turns) != "[[1] [2 3 4]]" {
+		t.Errorf("Expected the queued messages to be answered together, got %v", turns)
+	}
+}
@@ -0,0 +1,193 @@
+package gpt
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/utils"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+const (
+	gptStopButtonCustomIDPrefix     = "gpt:stop:"
+	composeStopButtonCustomIDPrefix = "gpt:compose:stop:"
+	// Discord rate limits message edits, so streamed content is flushed at most once per interval
+	gptStreamEditInterval = 1500 * time.Millisecond
+	// Title generation runs after the handler has returned, so it gets its own deadline
+	gptTitleGenerationTimeout = 30 * time.Second
+)
+
+var (
+	errGenerationStopped  = errors.New("generation stopped by user")
+	errGenerationNotFound = errors.New("generation not found")
+	errGenerationNotOwner = errors.New("generation was started by another user")
+)
+
+type generation struct {
+	userID string
+	cancel context.CancelCauseFunc
+}
+
+// generationRegistry tracks in-progress generations so they can be stopped with the Stop button.
+// Every registry routes its own Stop buttons, identified by stopPrefix
+type generationRegistry struct {
+	mu          sync.Mutex
+	generations map[string]*generation
+	stopPrefix  string
+}
+
+func newGenerationRegistry(stopPrefix string) *generationRegistry {
+	return &generationRegistry{
+		generations: make(map[string]*generation),
+		stopPrefix:  stopPrefix,
+	}
+}
+
+// start registers a generation under key. The returned context is cancelled with
+// errGenerationStopped when the generation is stopped, and done must be called when it finishes
+func (r *generationRegistry) start(ctx context.Context, key string, userID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	r.mu.Lock()
+	r.generations[key] = &generation{
+		userID: userID,
+		cancel: cancel,
+	}
+	r.mu.Unlock()
+
+	return ctx, func() {
+		r.mu.Lock()
+		delete(r.generations, key)
+		r.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// stop cancels the generation registered under key. Only the user who started it can stop it
+func (r *generationRegistry) stop(key string, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	g, ok := r.generations[key]
+	if !ok {
+		return errGenerationNotFound
+	}
+	if g.userID != userID {
+		return errGenerationNotOwner
+	}
+	g.cancel(errGenerationStopped)
+	delete(r.generations, key)
+	return nil
+}
+
+func (r *generationRegistry) stopComponents(locale discord.Locale, key string) []discord.MessageComponent {
+	return []discord.MessageComponent{
+		discord.ActionsRow{
+			Components: []discord.MessageComponent{
+				discord.Button{
+					Label:    i18n.Text(locale, "gpt.stop.label"),
+					Style:    discord.DangerButton,
+					CustomID: r.stopPrefix + key,
+					Emoji: &discord.ComponentEmoji{
+						Name: "⏹️",
+					},
+				},
+			},
+		},
+	}
+}
+
+// stopComponent routes the Stop buttons of the registry's generations. Stopping is never rate limited,
+// only the user who started a generation can stop it
+func (r *generationRegistry) stopComponent() *bot.Component {
+	return &bot.Component{
+		Prefix:          r.stopPrefix,
+		SkipMiddlewares: true,
+		Handler: bot.ComponentHandlerFunc(func(ctx *bot.ComponentContext) {
+			stopGenerationHandler(ctx, r)
+		}),
+	}
+}
+
+func stopGenerationHandler(ctx *bot.ComponentContext, generations *generationRegistry) {
+	switch generations.stop(ctx.Payload(), ctx.User().ID) {
+	case nil:
+		ctx.Acknowledge()
+	case errGenerationNotOwner:
+		ctx.RespondEphemeral(i18n.Text(ctx.Locale(), "gpt.stop.not_owner"))
+	default:
+		ctx.RespondEphemeral(i18n.Text(ctx.Locale(), "gpt.stop.finished"))
+	}
+}
+
+// generationInterruptedNotice describes why the generation was interrupted in the language of the locale,
+// or returns an empty string if ctx is still active
+func generationInterruptedNotice(locale discord.Locale, ctx context.Context) string {
+	switch {
+	case errors.Is(context.Cause(ctx), errGenerationStopped):
+		return i18n.Text(locale, "gpt.notice.stopped")
+	case errors.Is(context.Cause(ctx), bot.ErrShuttingDown):
+		return i18n.Text(locale, "gpt.notice.restarting")
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return i18n.Text(locale, "gpt.notice.timed_out")
+	case ctx.Err() != nil:
+		return i18n.Text(locale, "gpt.notice.interrupted")
+	}
+	return ""
+}
+
+// appendInterruptedNotice appends the interruption notice to the partially generated content
+func appendInterruptedNotice(content string, notice string) string {
+	if notice == "" {
+		return content
+	}
+	if strings.TrimSpace(content) == "" {
+		return "*" + notice + "*"
+	}
+	return content + "\n\n*" + notice + "*"
+}
+
+// streamingMessage shows the answer in the pending message while it is being generated
+type streamingMessage struct {
+	session    session.Session
+	message    *discord.Message
+	components []discord.MessageComponent
+
+	content  strings.Builder
+	lastEdit time.Time
+}
+
+func newStreamingMessage(s session.Session, m *discord.Message, components []discord.MessageComponent) *streamingMessage {
+	return &streamingMessage{
+		session:    s,
+		message:    m,
+		components: components,
+		lastEdit:   time.Now(),
+	}
+}
+
+func (m *streamingMessage) onDelta(delta string) {
+	m.content.WriteString(delta)
+	if time.Since(m.lastEdit) < gptStreamEditInterval {
+		return
+	}
+	m.lastEdit = time.Now()
+
+	// Only the tail fits into the message while generating, the full answer is split once it is done
+	preview := m.content.String()
+	if len(preview) > discordMaxMessageLength {
+		cut := len(preview) - discordMaxMessageLength + len("…")
+		for cut < len(preview) && !utf8.RuneStart(preview[cut]) {
+			cut++
+		}
+		preview = "…" + preview[cut:]
+	}
+	utils.DiscordChannelMessageEditComponents(m.session, m.message.ID, m.message.ChannelID, &preview, m.components)
+}
@@ -0,0 +1,105 @@
+package gpt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
+)
+
+// blockingStreamClient streams a partial answer and then waits until the request is cancelled
+type blockingStreamClient struct{}
+
+func (c *blockingStreamClient) CreateChatCompletion(ctx context.Context, req openrouter.ChatCompletionRequest) (*openrouter.ChatCompletionResponse, error) {
+	return c.CreateChatCompletionStream(ctx, req, nil)
+}
+
+func (c *blockingStreamClient) CreateChatCompletionStream(ctx context.Context, req openrouter.ChatCompletionRequest, onDelta func(delta string)) (*openrouter.ChatCompletionResponse, error) {
+	if onDelta != nil {
+		onDelta("Partial answer")
+	}
+	<-ctx.Done()
+	return &openrouter.ChatCompletionResponse{
+		Choices: []openrouter.ChatCompletionChoice{
+			{Message: openrouter.ChatCompletionMessage{Role: "assistant", Content: "Partial answer"}},
+		},
+	}, ctx.Err()
+}
+
+func TestGenerationRegistry_Stop(t *testing.T) {
+	generations := newGenerationRegistry(gptStopButtonCustomIDPrefix)
+	ctx, done := generations.start(context.Background(), "interaction-1", "user-1")
+	defer done()
+
+	if err := generations.stop("interaction-1", "user-2"); err != errGenerationNotOwner {
+		t.Errorf("Expected errGenerationNotOwner, got %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("Generation should not be cancelled by another user")
+	}
+
+	if err := generations.stop("interaction-1", "user-1"); err != nil {
+		t.Errorf("Expected generation to be stopped, got %v", err)
+	}
+	if notice := generationInterruptedNotice(i18n.DefaultLocale, ctx); notice != "⏹️ Generation stopped" {
+		t.Errorf("Expected stopped notice, got %q", notice)
+	}
+
+	if err := generations.stop("interaction-1", "user-1"); err != errGenerationNotFound {
+		t.Errorf("Expected errGenerationNotFound after stop, got %v", err)
+	}
+}
+
+func TestSendOpenRouterRequest_Stopped(t *testing.T) {
+	generations := newGenerationRegistry(gptStopButtonCustomIDPrefix)
+	ctx, done := generations.start(context.Background(), "message-1", "user-1")
+	defer done()
+
+	cacheItem := &MessagesCacheData{
+		Messages: []openrouter.ChatCompletionMessage{{Role: "user", Content: "Tell me a story"}},
+		Model:    "openai/gpt-4",
+	}
+	resp, err := sendOpenRouterRequest(ctx, &blockingStreamClient{}, cacheItem, func(delta string) {
+		go generations.stop("message-1", "user-1")
+	})
+	if err == nil {
+		t.Fatal("Expected an error for a stopped generation")
+	}
+	if resp == nil || resp.content != "Partial answer" {
+		t.Fatalf("Expected partial answer to be kept, got %+v", resp)
+	}
+	if len(cacheItem.Messages) != 2 || cacheItem.Messages[1].Content != "Partial answer" {
+		t.Errorf("Expected partial answer in the conversation, got %+v", cacheItem.Messages)
+	}
+	if got := appendInterruptedNotice(resp.content, generationInterruptedNotice(i18n.DefaultLocale, ctx)); got != "Partial answer\n\n*⏹️ Generation stopped*" {
+		t.Errorf("Unexpected final content %q", got)
+	}
+}
+
+func TestGenerationInterruptedNotice_Timeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+
+	if notice := generationInterruptedNotice(i18n.DefaultLocale, ctx); notice != "⌛ Generation timed out" {
+		t.Errorf("Expected timeout notice, got %q", notice)
+	}
+	if notice := generationInterruptedNotice(i18n.DefaultLocale, context.Background()); notice != "" {
+		t.Errorf("Expected no notice for an active context, got %q", notice)
+	}
+}
+
+func TestGenerationInterruptedNotice_Shutdown(t *testing.T) {
+	root, shutdown := context.WithCancelCause(context.Background())
+	generations := newGenerationRegistry(gptStopButtonCustomIDPrefix)
+	ctx, done := generations.start(root, "message-1", "user-1")
+	defer done()
+	shutdown(bot.ErrShuttingDown)
+
+	if notice := generationInterruptedNotice(i18n.DefaultLocale, ctx); notice != "🔄 The bot is restarting, please resend your message in a moment" {
+		t.Errorf("Expected restarting notice, got %q", notice)
+	}
+}
@@ -1,12 +1,17 @@
 package gpt
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"strings"
 
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/access"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/constants"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/utils"
 	discord "github.com/bwmarrin/discordgo"
 )
@@ -14,17 +19,18 @@ import (
 const (
 	gptDiscordThreadAutoArchivewDurationMinutes = 60
 	gptInteractionEmbedColor                    = 0x000000
-	gptPendingMessage                           = "⌛ Wait a moment, please..."
 	gptContextOptionMaxLength                   = 1024
+	// Prompts longer than an embed description are attached to the request message as a file
+	gptPromptFileName = "prompt.txt"
 )
 
-func chatGPTHandler(ctx *bot.Context, client *openrouter.Client, messagesCache *MessagesCache) {
-	ch, err := ctx.Session.State.Channel(ctx.Interaction.ChannelID)
+func chatGPTHandler(ctx *bot.Context, client openrouter.ChatCompletionClient, messagesCache *MessagesCache, generations *generationRegistry, catalog *ModelCatalog, policy *access.Policy) {
+	ch, err := ctx.Session.State().Channel(ctx.Interaction.ChannelID)
 	if err == nil && ch.IsThread() {
 		log.Printf("*[GID : %s,i.ID:%s] Interaction was invoked in the existing thread,ignoring\n", ctx.Interaction.GuildID, ctx.Interaction.ID)
 		return
 	}
-	log.Printf("*[GID : %s,i.ID:%s] ChatGPT interaction invoked by UserID:%s\n", ctx.Interaction.GuildID, ctx.Interaction.ID, ctx.Interaction.Member.User.ID)
+	log.Printf("*[GID : %s,i.ID:%s] ChatGPT interaction invoked by UserID:%s\n", ctx.Interaction.GuildID, ctx.Interaction.ID, ctx.User().ID)
 	err = ctx.Respond(&discord.InteractionResponse{
 		Type: discord.InteractionResponseDeferredChannelMessageWithSource,
 	})
@@ -33,16 +39,14 @@ func chatGPTHandler(ctx *bot.Context, client *openrouter.Client, messagesCache *
 		return
 	}
 
-	var prompt string
-	if option, ok := ctx.Options[gptCommandOptionPrompt.string()]; ok {
-		prompt = option.StringValue()
-	} else {
+	prompt := ctx.StringOption(gptCommandOptionPrompt.string(), "")
+	if prompt == "" {
 		log.Printf("[GID: %s, i.ID: %s] Failed to parse prompt option\n", ctx.Interaction.GuildID, ctx.Interaction.ID)
 		ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
 			Embeds: []*discord.MessageEmbed{
 				{
-					Title:       "❌ Error",
-					Description: "Failed to parse prompt option",
+					Title:       i18n.Text(ctx.Locale(), "error.title"),
+					Description: i18n.Text(ctx.Locale(), "gpt.error.prompt_option"),
 					Color:       0xff0000,
 				},
 			},
@@ -56,11 +60,24 @@ func chatGPTHandler(ctx *bot.Context, client *openrouter.Client, messagesCache *
 	})
 
 	// Determine model
-	model := gptDefaultModel
-	if option, ok := ctx.Options[gptCommandOptionModel.string()]; ok {
-		model = option.StringValue()
+	model := ctx.StringOption(gptCommandOptionModel.string(), gptDefaultModel)
+	if model != gptDefaultModel {
 		log.Printf("[GID: %s, i.ID: %s] Model provided: %s\n", ctx.Interaction.GuildID, ctx.Interaction.ID, model)
 	}
+	if catalog != nil && !catalog.Contains(model) {
+		// Autocompleted options accept any input, so the model has to be checked
+		log.Printf("[GID: %s, i.ID: %s] Unknown model provided: %s\n", ctx.Interaction.GuildID, ctx.Interaction.ID, model)
+		ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
+			Embeds: []*discord.MessageEmbed{unknownModelEmbed(ctx.Locale(), model)},
+		})
+		return
+	}
+	if denial := modelAccessDenial(ctx.Session, ctx.Interaction, policy, bot.CommandPath(ctx.Interaction.ApplicationCommandData()), model); denial != nil {
+		ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
+			Embeds: []*discord.MessageEmbed{access.DenialEmbed(ctx.Locale(), denial)},
+		})
+		return
+	}
 
 	// Prepare cache item
 	cacheItem := &MessagesCacheData{
@@ -70,21 +87,22 @@ func chatGPTHandler(ctx *bot.Context, client *openrouter.Client, messagesCache *
 				Content: prompt,
 			},
 		},
-		Model: model,
+		Model:   model,
+		Command: bot.CommandPath(ctx.Interaction.ApplicationCommandData()),
 	}
 
 	// Set context of the conversation as a system message. File option takes precedence
-	if option, ok := ctx.Options[gptCommandOptionContextFile.string()]; ok {
-		attachmentID := option.Value.(string)
-		attachmentURL := ctx.Interaction.ApplicationCommandData().Resolved.Attachments[attachmentID].URL
+	if attachment := ctx.AttachmentOption(gptCommandOptionContextFile.string()); attachment != nil {
+		attachmentID := attachment.ID
+		attachmentURL := attachment.URL
 
-		context, err := getContentOrURLData(ctx.Client, attachmentURL)
+		context, err := getContentOrURLData(ctx.HTTPClient(), attachmentURL)
 		if err != nil {
 			log.Printf("[GID: %s, i.ID: %s] Failed to get context file data with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
 			ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
 				Embeds: []*discord.MessageEmbed{
 					{
-						Title:       "Failed to get attachment data",
+						Title:       i18n.Text(ctx.Locale(), "gpt.error.attachment.title"),
 						Description: err.Error(),
 						Color:       0xff0000,
 					},
@@ -107,8 +125,8 @@ func chatGPTHandler(ctx *bot.Context, client *openrouter.Client, messagesCache *
 			ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
 				Embeds: []*discord.MessageEmbed{
 					{
-						Title:       "Failed to process context file",
-						Description: fmt.Sprintf("Context file is `%d` tokens, which exceeds allowed token limit of `%d` for model `%s`.\nPlease provide a shorter file or use `context` option instead", count, truncateLimit, model),
+						Title:       i18n.Text(ctx.Locale(), "gpt.error.context_file.title"),
+						Description: i18n.Text(ctx.Locale(), "gpt.error.context_file.description", count, truncateLimit, model),
 						Color:       0xff0000,
 					},
 				},
@@ -123,15 +141,14 @@ func chatGPTHandler(ctx *bot.Context, client *openrouter.Client, messagesCache *
 		})
 
 		log.Printf("[GID: %s, i.ID: %s] Context file provided: [AID: %s]\n", ctx.Interaction.GuildID, ctx.Interaction.ID, attachmentID)
-	} else if option, ok := ctx.Options[gptCommandOptionContext.string()]; ok {
-		context := option.StringValue()
+	} else if context := ctx.StringOption(gptCommandOptionContext.string(), ""); context != "" {
 		if len(context) >= gptContextOptionMaxLength {
 			log.Printf("[GID: %s, i.ID: %s] User-provided context is above limit of %d characters\n", ctx.Interaction.GuildID, ctx.Interaction.ID, gptContextOptionMaxLength)
 			ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
 				Embeds: []*discord.MessageEmbed{
 					{
-						Title:       "Failed to process command",
-						Description: fmt.Sprintf("Provided context is above the limit of %d characters. Please use `context-file` option instead", gptContextOptionMaxLength),
+						Title:       i18n.Text(ctx.Locale(), "gpt.error.command.title"),
+						Description: i18n.Text(ctx.Locale(), "gpt.error.context_length.description", gptContextOptionMaxLength),
 						Color:       0xff0000,
 					},
 				},
@@ -147,6 +164,8 @@ func chatGPTHandler(ctx *bot.Context, client *openrouter.Client, messagesCache *
 			Value: context,
 		})
 		log.Printf("[GID: %s, i.ID: %s] Context provided: %s\n", ctx.Interaction.GuildID, ctx.Interaction.ID, context)
+	} else if messagesCache.LanguageHint {
+		cacheItem.SystemMessage = languageHintMessage(ctx.Locale())
 	}
 
 	// Add model info field after context
@@ -155,37 +174,76 @@ func chatGPTHandler(ctx *bot.Context, client *openrouter.Client, messagesCache *
 		Value: model,
 	})
 
-	if option, ok := ctx.Options[gptCommandOptionTemperature.string()]; ok {
-		temp := float32(option.FloatValue())
-		cacheItem.Temperature = &temp
+	if temperature := temperatureOption(ctx); temperature != nil {
+		cacheItem.Temperature = temperature
 		fields = append(fields, &discord.MessageEmbedField{
 			Name:  gptCommandOptionTemperature.humanReadableString(),
-			Value: fmt.Sprintf("%g", temp),
+			Value: fmt.Sprintf("%g", *temperature),
 		})
-		log.Printf("[GID: %s, i.ID: %s] Temperature provided: %g\n", ctx.Interaction.GuildID, ctx.Interaction.ID, temp)
+		log.Printf("[GID: %s, i.ID: %s] Temperature provided: %g\n", ctx.Interaction.GuildID, ctx.Interaction.ID, *temperature)
+	}
+
+	startConversation(ctx, ctx.Session, ctx.Interaction, client, messagesCache, generations, &conversation{
+		cacheItem: cacheItem,
+		fields:    fields,
+	})
+}
+
+// conversation is a new conversation requested by an interaction
+type conversation struct {
+	cacheItem *MessagesCacheData
+	// fields describe the settings of the conversation in the request embed
+	fields []*discord.MessageEmbedField
+	// files are attached to the request message, e.g. a context that does not fit into an embed field
+	files []*discord.File
+}
+
+// startConversation posts the request of a deferred interaction, starts a thread on top of it
+// and answers the prompt in the thread. The request message is the thread metadata
+// the conversation is restored from when it is not cached
+func startConversation(ctx context.Context, s session.Session, i *discord.Interaction, client openrouter.ChatCompletionClient, messagesCache *MessagesCache, generations *generationRegistry, conv *conversation) {
+	cacheItem := conv.cacheItem
+	user := bot.InteractionUser(i)
+	locale := bot.InteractionLocale(i)
+
+	description := cacheItem.Messages[0].Content
+	fields, files := conv.fields, conv.files
+	if len(description) > discordMaxEmbedDescriptionLength {
+		// The embed only shows the beginning of the prompt, the thread is restored from the attached file
+		fields = append(fields, &discord.MessageEmbedField{
+			Name:  gptCommandOptionPromptFile.humanReadableString(),
+			Value: gptPromptFileName,
+		})
+		files = append(files, &discord.File{
+			Name:        gptPromptFileName,
+			ContentType: "text/plain",
+			Reader:      strings.NewReader(description),
+		})
+		description = truncateMessage(description, discordMaxEmbedDescriptionLength)
 	}
 
 	// Respond to interaction with a reference and user ping
-	_, err = ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
+	_, err := s.FollowupMessageCreate(i, true, &discord.WebhookParams{
 		Embeds: []*discord.MessageEmbed{
 			{
-				Description: prompt,
+				Description: description,
 				Color:       gptInteractionEmbedColor,
 				Author: &discord.MessageEmbedAuthor{
-					Name:         "OpenRouter chat request by " + ctx.Interaction.Member.User.Username,
-					IconURL:      ctx.Interaction.Member.User.AvatarURL("32"),
+					Name:         i18n.Text(locale, "gpt.request.author", user.Username),
+					IconURL:      user.AvatarURL("32"),
 					ProxyIconURL: constants.OpenAIBlackIconURL,
 				},
 				Fields: fields,
 			},
 		},
+		Files: files,
 	})
 	if err != nil {
-		log.Printf("[GID: %s, i.ID: %s] Failed to respond to interactrion with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
-		ctx.FollowupMessageCreate(ctx.Interaction, true, &discord.WebhookParams{
+		log.Printf("[GID: %s, i.ID: %s] Failed to respond to interactrion with the error: %v\n", i.GuildID, i.ID, err)
+		s.FollowupMessageCreate(i, true, &discord.WebhookParams{
 			Embeds: []*discord.MessageEmbed{
 				{
-					Title:       "Failed to process command",
+					Title:       i18n.Text(locale, "gpt.error.command.title"),
 					Description: err.Error(),
 					Color:       0xff0000,
 				},
@@ -195,87 +253,122 @@ func chatGPTHandler(ctx *bot.Context, client *openrouter.Client, messagesCache *
 	}
 
 	// Get interaction ID so we can create a thread on top of it
-	m, err := ctx.Response()
+	m, err := s.InteractionResponse(i)
 	if err != nil {
 		// Without interaction reference we cannot create a thread with the response of ChatGPT
 		// Maybe in the future just try to post a new message instead, but for now just cancel
-		log.Printf("[GID: %s, i.ID: %s] Failed to get interaction reference with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
-		ctx.Edit(fmt.Sprintf("Failed to get interaction reference with error: %v", err))
+		log.Printf("[GID: %s, i.ID: %s] Failed to get interaction reference with the error: %v\n", i.GuildID, i.ID, err)
+		content := fmt.Sprintf("Failed to get interaction reference with error: %v", err)
+		s.InteractionResponseEdit(i, &discord.WebhookEdit{
+			Content: &content,
+		})
 		return
 	}
 
-	ch, err = ctx.Session.State.Channel(m.ChannelID)
-	if err != nil || ch.IsThread() {
-		log.Printf("[GID: %s, i.ID: %s] Interaction reply was in a thread, or there was an error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
-		return
-	}
+	// Direct messages have no threads, the conversation continues in the channel
+	channelID := m.ChannelID
+	if i.GuildID != "" {
+		ch, err := s.State().Channel(m.ChannelID)
+		if err != nil || ch.IsThread() {
+			log.Printf("[GID: %s, i.ID: %s] Interaction reply was in a thread, or there was an error: %v\n", i.GuildID, i.ID, err)
+			return
+		}
 
-	thread, err := ctx.Session.MessageThreadStartComplex(m.ChannelID, m.ID, &discord.ThreadStart{
-		Name:                "New chat",
-		AutoArchiveDuration: gptDiscordThreadAutoArchivewDurationMinutes,
-		Invitable:           false,
-	})
+		thread, err := s.MessageThreadStartComplex(m.ChannelID, m.ID, &discord.ThreadStart{
+			Name:                "New chat",
+			AutoArchiveDuration: gptDiscordThreadAutoArchivewDurationMinutes,
+			Invitable:           false,
+		})
 
-	if err != nil {
-		// Without thread we cannot reply our answer
-		log.Printf("[GID: %s, i.ID: %s] Failed to create a thread with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
-		return
-	}
+		if err != nil {
+			// Without thread we cannot reply our answer
+			log.Printf("[GID: %s, i.ID: %s] Failed to create a thread with the error: %v\n", i.GuildID, i.ID, err)
+			return
+		}
+		channelID = thread.ID
+		bot.Emit(ctx, bot.Event{Type: bot.EventThreadCreated, ThreadID: thread.ID, Model: cacheItem.Model, Prompt: cacheItem.Messages[0].Content})
+
+		if messagesCache.FollowUps.ModeFor(i.GuildID) == FollowUpLock {
+			// Lock the thread while we are generating ChatGPT answser
+			unlock := bot.LockThread(ctx, s, thread.ID)
+			// Unlock the thread at the end
+			defer unlock()
+		}
 
-	// Lock the thread while we are generating ChatGPT answser
-	utils.ToggleDiscordThreadLock(ctx.Session, thread.ID, true)
+		// add user to the thread
+		s.ThreadMemberAdd(thread.ID, user.ID)
+	}
 
-	// add user to the thread
-	ctx.ThreadMemberAdd(thread.ID, ctx.Interaction.Member.User.ID)
+	generationCtx, done := generations.start(ctx, i.ID, user.ID)
+	defer done()
 
-	channelMessage, err := utils.DiscordChannelMessageSend(ctx.Session, thread.ID, gptPendingMessage, nil)
+	stopComponents := generations.stopComponents(locale, i.ID)
+	channelMessage, err := utils.DiscordChannelMessageSendWithComponents(s, channelID, i18n.Text(locale, "gpt.pending"), stopComponents, nil)
 	if err != nil {
 		// Without reply  we cannot edit message with the response of ChatGPT
 		// Maybe in the future just try to post a new message instead, but for now just cancel
-		log.Printf("[GID: %s, i.ID: %s] Failed to reply in the thread with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		log.Printf("[GID: %s, i.ID: %s] Failed to reply in the thread with the error: %v\n", i.GuildID, i.ID, err)
 		return
 	}
 
-	messagesCache.Add(thread.ID, cacheItem)
-
-	log.Printf("[GID: %s, i.ID: %s] OpenRouter Request invoked with [Model: %s]. Current cache size: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, cacheItem.Model, len(cacheItem.Messages))
-	resp, err := sendOpenRouterRequest(client, cacheItem)
-	if err != nil {
+	// Follow-ups in the thread wait until the answer is in the conversation
+	cacheItem.mu.Lock()
+	defer cacheItem.mu.Unlock()
+	messagesCache.Add(channelID, cacheItem)
+
+	log.Printf("[GID: %s, i.ID: %s] OpenRouter Request invoked with [Model: %s]. Current cache size: %v\n", i.GuildID, i.ID, cacheItem.Model, len(cacheItem.Messages))
+	bot.SetEventModel(ctx, cacheItem.Model, cacheItem.Messages[0].Content)
+	stream := newStreamingMessage(s, channelMessage, stopComponents)
+	resp, err := sendOpenRouterRequest(generationCtx, client, cacheItem, stream.onDelta)
+	notice := generationInterruptedNotice(locale, generationCtx)
+	if err != nil && notice != "" && resp == nil {
+		// Interrupted before anything was generated
+		resp = &chatGPTResponse{}
+	}
+	if err != nil && notice == "" {
 		// OpenRouter failed for whatever reason, tell users about it
-		log.Printf("[GID: %s, i.ID: %s] OpenRouter request ChatCompletion failed with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		log.Printf("[GID: %s, i.ID: %s] OpenRouter request ChatCompletion failed with the error: %v\n", i.GuildID, i.ID, err)
+		bot.SetEventError(ctx, err)
 		emptyString := ""
-		utils.DiscordChannelMessageEdit(ctx.Session, channelMessage.ID, channelMessage.ChannelID, &emptyString, []*discord.MessageEmbed{
+		utils.DiscordChannelMessageEditComponents(s, channelMessage.ID, channelMessage.ChannelID, &emptyString, nil)
+		utils.DiscordChannelMessageEdit(s, channelMessage.ID, channelMessage.ChannelID, &emptyString, []*discord.MessageEmbed{
 			{
-				Title:       "❌ OpenRouter API failed",
+				Title:       i18n.Text(locale, "error.openrouter.title"),
 				Description: err.Error(),
 				Color:       0xff0000,
 			},
 		})
 		return
 	}
+	if notice != "" {
+		log.Printf("[GID: %s, i.ID: %s] OpenRouter request [Model: %s] was interrupted: %v\n", i.GuildID, i.ID, cacheItem.Model, context.Cause(generationCtx))
+	}
 
-	// Unlock the thread at the end
-	defer utils.ToggleDiscordThreadLock(ctx.Session, thread.ID, false)
-
-	// convert []ChatCompletionMessage -> []ChatCompletionChoice (generator expects choices)
-	choices := make([]openrouter.ChatCompletionChoice, len(cacheItem.Messages))
-	for i := range cacheItem.Messages {
-		choices[i] = openrouter.ChatCompletionChoice{
-			Message: cacheItem.Messages[i],
+	if i.GuildID != "" {
+		// convert []ChatCompletionMessage -> []ChatCompletionChoice (generator expects choices)
+		choices := make([]openrouter.ChatCompletionChoice, len(cacheItem.Messages))
+		for i := range cacheItem.Messages {
+			choices[i] = openrouter.ChatCompletionChoice{
+				Message: cacheItem.Messages[i],
+			}
 		}
+		// The title is generated after the handler returned, so it must not use the handler deadline
+		titleCtx := bot.Detach(ctx)
+		bot.Go(ctx, func() {
+			generateThreadTitleBasedOnInitialPrompt(titleCtx, s, i.GuildID, client, channelID, choices)
+		})
 	}
-	go generateThreadTitleBasedOnInitialPrompt(ctx, client, thread.ID, choices)
 
-	log.Printf("[GID: %s, i.ID: %s] OpenRouter Request [Model: %s] responded with a usage: [PromptTokens: %d, CompletionTokens: %d, TotalTokens: %d]\n", ctx.Interaction.GuildID, ctx.Interaction.ID, cacheItem.Model, resp.usage.PromptTokens, resp.usage.CompletionTokens, resp.usage.TotalTokens)
+	log.Printf("[GID: %s, i.ID: %s] OpenRouter Request [Model: %s] responded with a usage: [PromptTokens: %d, CompletionTokens: %d, TotalTokens: %d, Cached: %t]\n", i.GuildID, i.ID, cacheItem.Model, resp.usage.PromptTokens, resp.usage.CompletionTokens, resp.usage.TotalTokens, resp.cached)
 
-	messages := splitMessage(resp.content)
-	err = utils.DiscordChannelMessageEdit(ctx.Session, channelMessage.ID, channelMessage.ChannelID, &messages[0], nil)
+	messages := splitMessage(appendInterruptedNotice(resp.content, notice))
+	err = utils.DiscordChannelMessageEditComponents(s, channelMessage.ID, channelMessage.ChannelID, &messages[0], nil)
 	if err != nil {
-		log.Printf("[GID: %s, i.ID: %s] Discord API failed with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+		log.Printf("[GID: %s, i.ID: %s] Discord API failed with the error: %v\n", i.GuildID, i.ID, err)
 		emptyString := ""
-		utils.DiscordChannelMessageEdit(ctx.Session, channelMessage.ID, channelMessage.ChannelID, &emptyString, []*discord.MessageEmbed{
+		utils.DiscordChannelMessageEdit(s, channelMessage.ID, channelMessage.ChannelID, &emptyString, []*discord.MessageEmbed{
 			{
-				Title:       "❌ Discord API Error",
+				Title:       i18n.Text(locale, "error.discord.title"),
 				Description: err.Error(),
 				Color:       0xff0000,
 			},
@@ -286,13 +379,13 @@ func chatGPTHandler(ctx *bot.Context, client *openrouter.Client, messagesCache *
 	if len(messages) > 1 {
 		// if there are more messages, send them as a thread reply
 		for _, message := range messages[1:] {
-			channelMessage, err = utils.DiscordChannelMessageSend(ctx.Session, thread.ID, message, nil)
+			channelMessage, err = utils.DiscordChannelMessageSend(s, channelID, message, nil)
 			if err != nil {
-				log.Printf("[GID: %s, i.ID: %s] Discord API failed with the error: %v\n", ctx.Interaction.GuildID, ctx.Interaction.ID, err)
+				log.Printf("[GID: %s, i.ID: %s] Discord API failed with the error: %v\n", i.GuildID, i.ID, err)
 			}
 		}
 	}
 
-	attachUsageInfo(ctx.Session, channelMessage, resp.usage, cacheItem.Model)
+	attachUsageInfo(s, locale, channelMessage, resp.usage, cacheItem.Model, resp.cached)
 
 }
@@ -0,0 +1,476 @@
+package gpt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/access"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session/sessiontest"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+const (
+	testBotID     = "bot"
+	testGuildID   = "guild"
+	testChannelID = "channel"
+	testModel     = "openai/gpt-4"
+)
+
+// fakeOpenRouter answers streamed chat completions with numbered answers and
+// title requests with a fixed title, recording the streamed requests
+type fakeOpenRouter struct {
+	mu       sync.Mutex
+	requests []openrouter.ChatCompletionRequest
+}
+
+func newFakeOpenRouter(t *testing.T) (*fakeOpenRouter, *openrouter.Client) {
+	f := &fakeOpenRouter{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openrouter.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+
+		if !req.Stream {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(openrouter.ChatCompletionResponse{
+				Model: req.Model,
+				Choices: []openrouter.ChatCompletionChoice{
+					{Message: openrouter.ChatCompletionMessage{Role: "assistant", Content: "Test title"}},
+				},
+			})
+			return
+		}
+
+		f.mu.Lock()
+		f.requests = append(f.requests, req)
+		answer := fmt.Sprintf("Answer %d", len(f.requests))
+		f.mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "data: {\"id\":\"gen-1\",\"model\":%q,\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":%q},\"finish_reason\":\"stop\"}],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":2,\"total_tokens\":7}}\n\n", req.Model, answer)
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+
+	return f, openrouter.NewClientWithConfig(openrouter.ClientConfig{
+		APIKey:  "test-api-key",
+		BaseURL: server.URL,
+	})
+}
+
+func (f *fakeOpenRouter) lastRequest(t *testing.T) openrouter.ChatCompletionRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.requests) == 0 {
+		t.Fatal("Expected a chat completion request")
+	}
+	return f.requests[len(f.requests)-1]
+}
+
+// newTestRouter returns a router serving the gpt command with an empty cache
+func newTestRouter(t *testing.T, client openrouter.ChatCompletionClient) (*bot.Router, *MessagesCache) {
+	messagesCache, err := NewMessagesCache(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bot.NewRouter([]*bot.Command{Command(client, []string{testModel}, messagesCache, NewIgnoredChannelsCache(), nil, nil)})
+	r.SetContext(context.Background())
+	return r, messagesCache
+}
+
+func chatInteraction(prompt string) *discord.InteractionCreate {
+	return &discord.InteractionCreate{Interaction: &discord.Interaction{
+		ID:        "interaction",
+		Type:      discord.InteractionApplicationCommand,
+		GuildID:   testGuildID,
+		ChannelID: testChannelID,
+		Member:    &discord.Member{User: &discord.User{ID: "user", Username: "user"}},
+		Data: discord.ApplicationCommandInteractionData{
+			Name: commandName,
+			Options: []*discord.ApplicationCommandInteractionDataOption{
+				{Name: gptCommandOptionPrompt.string(), Type: discord.ApplicationCommandOptionString, Value: prompt},
+			},
+		},
+	}}
+}
+
+// startTestConversation runs /gpt and returns the thread it started
+func startTestConversation(t *testing.T, s *sessiontest.Fake, r *bot.Router) *discord.Channel {
+	r.ServeInteraction(s, chatInteraction("Hello"))
+	if len(s.Threads) != 1 {
+		t.Fatalf("Expected a thread to be started, got %d", len(s.Threads))
+	}
+	return s.Threads[0]
+}
+
+func TestChatGPTHandler_StartsConversation(t *testing.T) {
+	s := sessiontest.NewFake(testBotID, testGuildID, testChannelID)
+	openRouter, client := newFakeOpenRouter(t)
+	r, messagesCache := newTestRouter(t, client)
+
+	thread := startTestConversation(t, s, r)
+	r.Shutdown(5 * time.Second)
+
+	if s.Responses[0].Type != discord.InteractionResponseDeferredChannelMessageWithSource {
+		t.Errorf("Expected the interaction to be deferred, got %v", s.Responses[0].Type)
+	}
+	request := s.Messages(testChannelID)
+	if len(request) != 1 || request[0].Embeds[0].Description != "Hello" {
+		t.Fatalf("Expected the request embed in the channel, got %v", request)
+	}
+
+	if thread.ParentID != testChannelID || thread.Name != "Test title" {
+		t.Errorf("Expected the titled thread in the channel, got %+v", thread)
+	}
+	if len(s.Locks) != 2 || !s.Locks[0].Locked || s.Locks[1].Locked {
+		t.Errorf("Expected the thread to be locked while answering, got %v", s.Locks)
+	}
+
+	messages := s.Messages(thread.ID)
+	if len(messages) != 2 || messages[1].Content != "Answer 1" {
+		t.Fatalf("Expected the answer in the thread, got %v", messages)
+	}
+	if len(messages[1].Components) != 0 {
+		t.Error("Expected the stop button to be removed after answering")
+	}
+
+	req := openRouter.lastRequest(t)
+	if req.Model != testModel || len(req.Messages) != 1 || req.Messages[0].Content != "Hello" {
+		t.Errorf("Expected the prompt to be sent to %s, got %+v", testModel, req)
+	}
+	cacheItem, ok := messagesCache.Get(thread.ID)
+	if !ok || len(cacheItem.Messages) != 2 {
+		t.Errorf("Expected the conversation to be cached with the answer")
+	}
+}
+
+func TestChatGPTHandler_AddsLanguageHint(t *testing.T) {
+	s := sessiontest.NewFake(testBotID, testGuildID, testChannelID)
+	openRouter, client := newFakeOpenRouter(t)
+	r, messagesCache := newTestRouter(t, client)
+	messagesCache.LanguageHint = true
+
+	interaction := chatInteraction("Hallo")
+	interaction.Locale = discord.German
+	r.ServeInteraction(s, interaction)
+	r.Shutdown(5 * time.Second)
+
+	req := openRouter.lastRequest(t)
+	if len(req.Messages) != 2 || req.Messages[0].Role != "system" || !strings.Contains(req.Messages[0].Content, i18n.LanguageName(discord.German)) {
+		t.Fatalf("Expected the model to be asked to answer in German, got %+v", req.Messages)
+	}
+	if len(s.Threads) != 1 {
+		t.Fatalf("Expected a thread to be started, got %d", len(s.Threads))
+	}
+	if request := s.Messages(testChannelID); len(request) != 1 || request[0].Embeds[0].Author.Name != i18n.Text(discord.German, "gpt.request.author", "user") {
+		t.Errorf("Expected the request embed in German, got %v", request)
+	}
+}
+
+func TestChatGPTHandler_IgnoresThreads(t *testing.T) {
+	s := sessiontest.NewFake(testBotID, testGuildID, testChannelID)
+	s.State().ChannelAdd(&discord.Channel{ID: "thread", GuildID: testGuildID, Type: discord.ChannelTypeGuildPublicThread})
+	_, client := newFakeOpenRouter(t)
+	r, _ := newTestRouter(t, client)
+
+	i := chatInteraction("Hello")
+	i.ChannelID = "thread"
+	r.ServeInteraction(s, i)
+	r.Shutdown(5 * time.Second)
+
+	if len(s.Responses) != 0 || len(s.Threads) != 0 {
+		t.Errorf("Expected the interaction in a thread to be ignored")
+	}
+}
+
+func TestChatGPTMessageHandler_AnswersFollowUp(t *testing.T) {
+	s := sessiontest.NewFake(testBotID, testGuildID, testChannelID)
+	openRouter, client := newFakeOpenRouter(t)
+	r, _ := newTestRouter(t, client)
+	thread := startTestConversation(t, s, r)
+
+	m := s.AddMessage(&discord.Message{ChannelID: thread.ID, GuildID: testGuildID, Author: &discord.User{ID: "user"}, Content: "And then?"})
+	r.ServeMessage(s, &discord.MessageCreate{Message: m})
+	r.Shutdown(5 * time.Second)
+
+	req := openRouter.lastRequest(t)
+	if len(req.Messages) != 3 || req.Messages[2].Content != "And then?" {
+		t.Fatalf("Expected the follow-up to continue the conversation, got %+v", req.Messages)
+	}
+	messages := s.Messages(thread.ID)
+	reply := messages[len(messages)-1]
+	if reply.Content != "Answer 2" || reply.ReferencedMessage != m {
+		t.Errorf("Expected a reply with the answer, got %+v", reply)
+	}
+}
+
+func TestChatGPTHandlers_EmitEvents(t *testing.T) {
+	s := sessiontest.NewFake(testBotID, testGuildID, testChannelID)
+	_, client := newFakeOpenRouter(t)
+	r, _ := newTestRouter(t, client)
+	var mu sync.Mutex
+	var events []bot.Event
+	r.Subscribe(bot.SubscriberFunc(func(event bot.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}))
+	thread := startTestConversation(t, s, r)
+
+	m := s.AddMessage(&discord.Message{ChannelID: thread.ID, GuildID: testGuildID, Author: &discord.User{ID: "user"}, Content: "And then?"})
+	r.ServeMessage(s, &discord.MessageCreate{Message: m})
+	r.Shutdown(5 * time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+	types := make([]bot.EventType, len(events))
+	for i, event := range events {
+		types[i] = event.Type
+	}
+	expected := []bot.EventType{bot.EventCommandInvoked, bot.EventThreadCreated, bot.EventCommandCompleted, bot.EventMessageHandled}
+	if !slices.Equal(types, expected) {
+		t.Fatalf("Expected events %v, got %v", expected, types)
+	}
+	if thread := events[1]; thread.ThreadID == "" || thread.Command != commandName || thread.UserID != "user" {
+		t.Errorf("Expected the thread of the conversation, got %+v", thread)
+	}
+	if completed := events[2]; completed.Model != testModel || completed.Prompt != "Hello" {
+		t.Errorf("Expected the model and prompt of the conversation, got %+v", completed)
+	}
+	if handled := events[3]; handled.MessageID != m.ID || handled.ChannelID != thread.ID || handled.Model != testModel || handled.Prompt != "And then?" || handled.Error != "" {
+		t.Errorf("Expected the answered follow-up, got %+v", handled)
+	}
+}
+
+func TestChatGPTMessageHandler_RestoresHistory(t *testing.T) {
+	s := sessiontest.NewFake(testBotID, testGuildID, testChannelID)
+	openRouter, client := newFakeOpenRouter(t)
+	r, _ := newTestRouter(t, client)
+	thread := startTestConversation(t, s, r)
+	r.Shutdown(5 * time.Second)
+
+	// A restarted bot has nothing cached and reads the conversation from the thread
+	restarted, messagesCache := newTestRouter(t, client)
+	m := s.AddMessage(&discord.Message{ChannelID: thread.ID, GuildID: testGuildID, Author: &discord.User{ID: "user"}, Content: "And then?"})
+	restarted.ServeMessage(s, &discord.MessageCreate{Message: m})
+	restarted.Shutdown(5 * time.Second)
+
+	req := openRouter.lastRequest(t)
+	want := []string{"user: Hello", "assistant: Answer 1", "user: And then?"}
+	if len(req.Messages) != len(want) {
+		t.Fatalf("Expected the restored conversation %v, got %+v", want, req.Messages)
+	}
+	for i, message := range req.Messages {
+		if got := message.Role + ": " + message.Content; got != want[i] {
+			t.Errorf("Expected message %d to be %q, got %q", i, want[i], got)
+		}
+	}
+	if req.Model != testModel {
+		t.Errorf("Expected the model of the request embed, got %s", req.Model)
+	}
+	if _, ok := messagesCache.Get(thread.ID); !ok {
+		t.Error("Expected the restored conversation to be cached")
+	}
+}
+
+func TestChatGPTMessageHandler_IgnoresForeignThreads(t *testing.T) {
+	s := sessiontest.NewFake(testBotID, testGuildID, testChannelID)
+	openRouter, client := newFakeOpenRouter(t)
+	r, _ := newTestRouter(t, client)
+
+	s.State().ChannelAdd(&discord.Channel{ID: "thread", GuildID: testGuildID, ParentID: testChannelID, Type: discord.ChannelTypeGuildPublicThread})
+	s.AddMessage(&discord.Message{ChannelID: "thread", Type: discord.MessageTypeThreadStarterMessage, Author: &discord.User{ID: "someone"}})
+	m := s.AddMessage(&discord.Message{ChannelID: "thread", GuildID: testGuildID, Author: &discord.User{ID: "user"}, Content: "Hi"})
+	r.ServeMessage(s, &discord.MessageCreate{Message: m})
+	r.Shutdown(5 * time.Second)
+
+	if len(openRouter.requests) != 0 {
+		t.Errorf("Expected no request for a thread of someone else, got %d", len(openRouter.requests))
+	}
+	if len(s.Messages("thread")) != 2 {
+		t.Error("Expected no reply in a thread of someone else")
+	}
+}
+
+const testDMChannelID = "dm"
+
+// newDMFake returns a fake session knowing the direct message channel of the user
+func newDMFake() *sessiontest.Fake {
+	s := sessiontest.NewFake(testBotID, testGuildID, testChannelID)
+	s.State().ChannelAdd(&discord.Channel{ID: testDMChannelID, Type: discord.ChannelTypeDM})
+	return s
+}
+
+func sendDirectMessage(s *sessiontest.Fake, content string) *discord.Message {
+	return s.AddMessage(&discord.Message{ChannelID: testDMChannelID, Author: &discord.User{ID: "user"}, Content: content})
+}
+
+func TestChatGPTHandler_StartsDirectMessageConversation(t *testing.T) {
+	s := newDMFake()
+	openRouter, client := newFakeOpenRouter(t)
+	r, messagesCache := newTestRouter(t, client)
+
+	i := chatInteraction("Hello")
+	i.GuildID, i.ChannelID = "", testDMChannelID
+	i.User, i.Member = i.Member.User, nil
+	r.ServeInteraction(s, i)
+	r.Shutdown(5 * time.Second)
+
+	if len(s.Threads) != 0 || len(s.Locks) != 0 {
+		t.Errorf("Expected no thread in direct messages, got %v and %v", s.Threads, s.Locks)
+	}
+	messages := s.Messages(testDMChannelID)
+	if len(messages) != 2 || messages[1].Content != "Answer 1" {
+		t.Fatalf("Expected the answer in the direct message channel, got %v", messages)
+	}
+	if len(openRouter.requests) != 1 {
+		t.Errorf("Expected no title request, got %d requests", len(openRouter.requests))
+	}
+
+	// Messages in the channel continue the conversation
+	r = bot.NewRouter([]*bot.Command{Command(client, []string{testModel}, messagesCache, NewIgnoredChannelsCache(), nil, nil)})
+	r.SetContext(context.Background())
+	m := sendDirectMessage(s, "And then?")
+	r.ServeMessage(s, &discord.MessageCreate{Message: m})
+	r.Shutdown(5 * time.Second)
+
+	req := openRouter.lastRequest(t)
+	if len(req.Messages) != 3 || req.Messages[2].Content != "And then?" {
+		t.Fatalf("Expected the direct message to continue the conversation, got %+v", req.Messages)
+	}
+	if reply := lastMessage(s, testDMChannelID); reply.Content != "Answer 2" || reply.ReferencedMessage != m {
+		t.Errorf("Expected a reply with the answer, got %+v", reply)
+	}
+}
+
+func TestChatGPTMessageHandler_AnswersDirectMessages(t *testing.T) {
+	s := newDMFake()
+	openRouter, client := newFakeOpenRouter(t)
+	r, _ := newTestRouter(t, client)
+
+	m := sendDirectMessage(s, "What is Go?")
+	r.ServeMessage(s, &discord.MessageCreate{Message: m})
+	r.Shutdown(5 * time.Second)
+
+	req := openRouter.lastRequest(t)
+	if req.Model != gptDefaultModel || len(req.Messages) != 1 || req.Messages[0].Content != "What is Go?" {
+		t.Fatalf("Expected a new conversation with the default model, got %+v", req)
+	}
+	if reply := lastMessage(s, testDMChannelID); reply.Content != "Answer 1" {
+		t.Errorf("Expected a reply with the answer, got %+v", reply)
+	}
+}
+
+func TestChatGPTMessageHandler_RefusesDisabledDirectMessages(t *testing.T) {
+	s := newDMFake()
+	openRouter, client := newFakeOpenRouter(t)
+	policy, err := access.NewPolicy(access.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messagesCache, err := NewMessagesCache(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bot.NewRouter([]*bot.Command{Command(client, []string{testModel}, messagesCache, NewIgnoredChannelsCache(), nil, policy)})
+	r.SetContext(context.Background())
+
+	m := sendDirectMessage(s, "What is Go?")
+	r.ServeMessage(s, &discord.MessageCreate{Message: m})
+	r.Shutdown(5 * time.Second)
+
+	if len(openRouter.requests) != 0 {
+		t.Errorf("Expected no request with direct messages disabled, got %d", len(openRouter.requests))
+	}
+	reply := lastMessage(s, testDMChannelID)
+	if reply == m || len(reply.Embeds) != 1 || reply.Embeds[0].Title != access.DirectMessagesDisabledEmbed(i18n.DefaultLocale).Title {
+		t.Errorf("Expected the direct messages disabled embed, got %+v", reply)
+	}
+}
+
+// newChatTestRouter serves the gpt command as a subcommand of chat, checking access with a rule on "chat gpt"
+func newChatTestRouter(t *testing.T, client openrouter.ChatCompletionClient) *bot.Router {
+	policy, err := access.NewPolicy(access.Config{Rules: []access.Rule{{Commands: []string{"chat " + commandName}, Roles: []string{"premium"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messagesCache, err := NewMessagesCache(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bot.NewRouter([]*bot.Command{{
+		Name:        "chat",
+		SubCommands: bot.NewRouter([]*bot.Command{Command(client, []string{testModel}, messagesCache, NewIgnoredChannelsCache(), nil, policy)}),
+	}})
+	r.Use(access.Middleware(policy))
+	r.SetContext(context.Background())
+	return r
+}
+
+// startChatTestConversation runs /chat gpt as a member with the premium role and returns the thread it started
+func startChatTestConversation(t *testing.T, s *sessiontest.Fake, r *bot.Router) *discord.Channel {
+	i := chatInteraction("Hello")
+	i.Member.Roles = []string{"premium"}
+	i.Data = discord.ApplicationCommandInteractionData{
+		Name: "chat",
+		Options: []*discord.ApplicationCommandInteractionDataOption{{
+			Name:    commandName,
+			Type:    discord.ApplicationCommandOptionSubCommand,
+			Options: i.ApplicationCommandData().Options,
+		}},
+	}
+	r.ServeInteraction(s, i)
+	if len(s.Threads) != 1 {
+		t.Fatalf("Expected a thread to be started, got %d", len(s.Threads))
+	}
+	return s.Threads[0]
+}
+
+// assertFollowUpDenied sends a follow-up of a member without the premium role and expects the denial
+func assertFollowUpDenied(t *testing.T, s *sessiontest.Fake, r *bot.Router, openRouter *fakeOpenRouter, thread *discord.Channel, requests int) {
+	t.Helper()
+	m := s.AddMessage(&discord.Message{ChannelID: thread.ID, GuildID: testGuildID, Author: &discord.User{ID: "other"}, Member: &discord.Member{}, Content: "And then?"})
+	r.ServeMessage(s, &discord.MessageCreate{Message: m})
+	r.Shutdown(5 * time.Second)
+
+	if len(openRouter.requests) != requests {
+		t.Errorf("Expected no request for the denied follow-up, got %d", len(openRouter.requests)-requests)
+	}
+	reply := lastMessage(s, thread.ID)
+	if reply == m || len(reply.Embeds) != 1 || reply.Embeds[0].Title != i18n.Text(i18n.DefaultLocale, "access.denied.title") {
+		t.Errorf("Expected the access denied embed, got %+v", reply)
+	}
+}
+
+func TestChatGPTMessageHandler_ChecksFollowUpsAgainstCommand(t *testing.T) {
+	s := sessiontest.NewFake(testBotID, testGuildID, testChannelID)
+	openRouter, client := newFakeOpenRouter(t)
+	r := newChatTestRouter(t, client)
+	thread := startChatTestConversation(t, s, r)
+
+	assertFollowUpDenied(t, s, r, openRouter, thread, 1)
+}
+
+func TestChatGPTMessageHandler_ChecksRestoredFollowUpsAgainstCommand(t *testing.T) {
+	s := sessiontest.NewFake(testBotID, testGuildID, testChannelID)
+	openRouter, client := newFakeOpenRouter(t)
+	r := newChatTestRouter(t, client)
+	thread := startChatTestConversation(t, s, r)
+	r.Shutdown(5 * time.Second)
+
+	// Discord names the command of the interaction response including its subcommands
+	s.Messages(testChannelID)[0].Interaction = &discord.MessageInteraction{Name: "chat " + commandName}
+	assertFollowUpDenied(t, s, newChatTestRouter(t, client), openRouter, thread, 1)
+}
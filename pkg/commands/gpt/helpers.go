@@ -2,11 +2,15 @@ package gpt
 
 import (
 	"strings"
+	"unicode/utf8"
 
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
 )
 
-const discordMaxMessageLength = 2000
+const (
+	discordMaxMessageLength          = 2000
+	discordMaxEmbedDescriptionLength = 4096
+)
 
 func splitMessage(message string) []string {
 	if len(message) <= discordMaxMessageLength {
@@ -36,6 +40,18 @@ func splitMessage(message string) []string {
 
 
 
+// truncateMessage shortens the message to at most limit bytes without breaking UTF-8 characters
+func truncateMessage(message string, limit int) string {
+	if len(message) <= limit {
+		return message
+	}
+	cut := limit - len("…")
+	for cut > 0 && !utf8.RuneStart(message[cut]) {
+		cut--
+	}
+	return message[:cut] + "…"
+}
+
 func reverseOpenRouterMessages(messages *[]openrouter.ChatCompletionMessage) {
 	length := len(*messages)
 	for i := 0; i < length/2; i++ {
@@ -0,0 +1,162 @@
+package gpt
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/access"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+// gptMentionDefaultMaxDepth is how many messages of a reply chain are read when the conversation is not cached
+const gptMentionDefaultMaxDepth = 20
+
+// MentionConfig enables conversations outside threads. The bot answers messages mentioning it,
+// and replies to its answers continue the conversation of the reply chain
+type MentionConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Channels are the IDs of the channels the bot answers in, empty enables every channel
+	Channels []string `yaml:"channels"`
+	// MaxDepth is how many messages of a reply chain are read, 0 uses the default of 20
+	MaxDepth int `yaml:"maxDepth"`
+}
+
+func (c MentionConfig) Validate() error {
+	if c.MaxDepth < 0 {
+		return fmt.Errorf("mention reply chain depth must not be negative")
+	}
+	return nil
+}
+
+// EnabledIn reports whether the bot answers mentions in the channel
+func (c MentionConfig) EnabledIn(channelID string) bool {
+	return c.Enabled && (len(c.Channels) == 0 || slices.Contains(c.Channels, channelID))
+}
+
+func (c MentionConfig) maxDepth() int {
+	if c.MaxDepth == 0 {
+		return gptMentionDefaultMaxDepth
+	}
+	return c.MaxDepth
+}
+
+// isBotMentioned reports whether the content mentions the user of the bot. Reply pings are not
+// counted, so replies to other messages of the bot are not answered
+func isBotMentioned(botID string, content string) bool {
+	return strings.Contains(content, "<@"+botID+">") || strings.Contains(content, "<@!"+botID+">")
+}
+
+// isBotAnswer reports whether m is an answer of the bot in a mention conversation
+func isBotAnswer(botID string, m *discord.Message) bool {
+	return m != nil && m.Author != nil && m.Author.ID == botID && m.Type == discord.MessageTypeReply
+}
+
+// mentionPrompt returns the content of m without the mentions of the bot
+func mentionPrompt(botID string, m *discord.Message) string {
+	content := strings.ReplaceAll(m.Content, "<@"+botID+">", "")
+	content = strings.ReplaceAll(content, "<@!"+botID+">", "")
+	return strings.TrimSpace(content)
+}
+
+// handleMentionMessage answers messages in channels outside threads that mention the bot or reply to its answers.
+// It reports whether the channel has mention conversations enabled
+func handleMentionMessage(ctx *bot.MessageContext, client openrouter.ChatCompletionClient, messagesCache *MessagesCache, generations *generationRegistry, policy *access.Policy) bool {
+	if !messagesCache.Mentions.EnabledIn(ctx.Message.ChannelID) {
+		return false
+	}
+
+	botID := ctx.Session.State().User.ID
+	if !isBotMentioned(botID, ctx.Message.Content) && !isBotAnswer(botID, ctx.Message.ReferencedMessage) {
+		return true
+	}
+	if mentionPrompt(botID, ctx.Message) == "" {
+		return true
+	}
+
+	log.Printf("[GID: %s, CHID: %s, MID: %s] Handling a mention of the bot\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID)
+
+	answerMentionMessage(ctx, client, messagesCache, generations, policy)
+	return true
+}
+
+// answerMentionMessage continues the conversation of the reply chain of ctx.Message and replies with the answer.
+// The conversation is cached under the answer, so replying to it does not read the chain again
+func answerMentionMessage(ctx *bot.MessageContext, client openrouter.ChatCompletionClient, messagesCache *MessagesCache, generations *generationRegistry, policy *access.Policy) {
+	botID := ctx.Session.State().User.ID
+	cacheItem := mentionConversation(ctx, messagesCache)
+	cacheItem.Messages = append(cacheItem.Messages, openrouter.ChatCompletionMessage{
+		Role:    "user",
+		Content: mentionPrompt(botID, ctx.Message),
+	})
+
+	if denial := policy.Check(access.MessageRequest(ctx.Session, ctx.Message, cacheItem.accessCommand(ctx.Caller.Name), cacheItem.Model)); denial != nil {
+		log.Printf("[GID: %s, CHID: %s, MID: %s] Access denied: %v\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID, denial)
+		ctx.EmbedReply(access.DenialEmbed(ctx.Locale(), denial))
+		return
+	}
+
+	if ok, count := isCacheItemWithinTruncateLimit(cacheItem); !ok {
+		log.Printf("[GID: %s, CHID: %s, MID: %s] Reply chain token count of %d exceeds truncate limit. Performing adjustments.\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID, count)
+		adjustMessageTokens(cacheItem)
+	}
+
+	if answer := replyWithAnswer(ctx, client, generations, cacheItem); answer != nil {
+		messagesCache.Add(answer.ID, cacheItem)
+	}
+}
+
+// mentionConversation returns the conversation ctx.Message replies to. The reply chain is read
+// until a cached answer of the bot, a message that is no reply or the maximum depth
+func mentionConversation(ctx *bot.MessageContext, messagesCache *MessagesCache) *MessagesCacheData {
+	botID := ctx.Session.State().User.ID
+	cacheItem := &MessagesCacheData{Model: gptDefaultModel}
+
+	var chain []openrouter.ChatCompletionMessage
+	m := ctx.Message
+	for depth := 0; depth < messagesCache.Mentions.maxDepth(); depth++ {
+		reference := m.MessageReference
+		if reference == nil {
+			break
+		}
+		parent := m.ReferencedMessage
+		if parent == nil {
+			var err error
+			parent, err = ctx.Session.ChannelMessage(reference.ChannelID, reference.MessageID)
+			if err != nil {
+				log.Printf("[GID: %s, CHID: %s, MID: %s] Failed to get the replied message with the error: %v\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID, err)
+				break
+			}
+		}
+		if parent.Author == nil {
+			break
+		}
+
+		if parent.Author.ID == botID {
+			if cached, ok := messagesCache.Get(parent.ID); ok {
+				// Replies to the same answer branch off, so the cached conversation is copied
+				cacheItem.Model = cached.Model
+				cacheItem.SystemMessage = cached.SystemMessage
+				cacheItem.Temperature = cached.Temperature
+				cacheItem.Command = cached.Command
+				chain = append(slices.Clone(cached.Messages), chain...)
+				break
+			}
+			if !isBotAnswer(botID, parent) {
+				break
+			}
+			if parent.Content != "" {
+				chain = append([]openrouter.ChatCompletionMessage{{Role: "assistant", Content: parent.Content}}, chain...)
+			}
+		} else if prompt := mentionPrompt(botID, parent); prompt != "" {
+			chain = append([]openrouter.ChatCompletionMessage{{Role: "user", Content: prompt}}, chain...)
+		}
+		m = parent
+	}
+
+	cacheItem.Messages = chain
+	return cacheItem
+}
@@ -0,0 +1,150 @@
+package gpt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session/sessiontest"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+func TestMentionConfig_EnabledIn(t *testing.T) {
+	if (MentionConfig{}).EnabledIn(testChannelID) {
+		t.Error("Expected mentions to be disabled by default")
+	}
+	if !(MentionConfig{Enabled: true}).EnabledIn(testChannelID) {
+		t.Error("Expected every channel to be enabled without channels")
+	}
+	config := MentionConfig{Enabled: true, Channels: []string{"other"}}
+	if config.EnabledIn(testChannelID) || !config.EnabledIn("other") {
+		t.Error("Expected only the listed channels to be enabled")
+	}
+}
+
+func TestMentionPrompt(t *testing.T) {
+	m := &discord.Message{Content: "<@bot> what is <@!bot> Go? <@user>"}
+	if !isBotMentioned(testBotID, m.Content) {
+		t.Error("Expected the bot to be mentioned")
+	}
+	if got := mentionPrompt(testBotID, m); got != "what is  Go? <@user>" {
+		t.Errorf("Expected the mentions of the bot to be removed, got %q", got)
+	}
+	if isBotMentioned(testBotID, "<@user> hi") {
+		t.Error("Expected other mentions to be ignored")
+	}
+}
+
+// sendUserMessage sends a message of the user in the channel, replying to parent if it is set
+func sendUserMessage(s *sessiontest.Fake, content string, parent *discord.Message) *discord.Message {
+	m := &discord.Message{ChannelID: testChannelID, GuildID: testGuildID, Author: &discord.User{ID: "user"}, Content: content}
+	if parent != nil {
+		m.Type = discord.MessageTypeReply
+		m.MessageReference = parent.Reference()
+		m.ReferencedMessage = parent
+	}
+	return s.AddMessage(m)
+}
+
+func lastMessage(s *sessiontest.Fake, channelID string) *discord.Message {
+	messages := s.Messages(channelID)
+	return messages[len(messages)-1]
+}
+
+func TestChatGPTMessageHandler_AnswersMentions(t *testing.T) {
+	s := sessiontest.NewFake(testBotID, testGuildID, testChannelID)
+	openRouter, client := newFakeOpenRouter(t)
+	r, messagesCache := newTestRouter(t, client)
+	messagesCache.Mentions = MentionConfig{Enabled: true}
+
+	m := sendUserMessage(s, "<@bot> What is Go?", nil)
+	r.ServeMessage(s, &discord.MessageCreate{Message: m})
+	r.Shutdown(5 * time.Second)
+
+	req := openRouter.lastRequest(t)
+	if req.Model != testModel || len(req.Messages) != 1 || req.Messages[0].Content != "What is Go?" {
+		t.Fatalf("Expected the prompt without the mention, got %+v", req)
+	}
+	answer := lastMessage(s, testChannelID)
+	if answer.Content != "Answer 1" || answer.ReferencedMessage != m {
+		t.Errorf("Expected a reply with the answer, got %+v", answer)
+	}
+	if len(s.Threads) != 0 {
+		t.Error("Expected no thread to be started")
+	}
+}
+
+func TestChatGPTMessageHandler_FollowsReplyChains(t *testing.T) {
+	s := sessiontest.NewFake(testBotID, testGuildID, testChannelID)
+	openRouter, client := newFakeOpenRouter(t)
+	r, messagesCache := newTestRouter(t, client)
+	messagesCache.Mentions = MentionConfig{Enabled: true}
+
+	m := sendUserMessage(s, "<@bot> What is Go?", nil)
+	r.ServeMessage(s, &discord.MessageCreate{Message: m})
+	r.Shutdown(5 * time.Second)
+	if _, ok := messagesCache.Get(lastMessage(s, testChannelID).ID); !ok {
+		t.Error("Expected the conversation to be cached under the answer")
+	}
+
+	// Replying to the answer continues the conversation without mentioning the bot
+	r, messagesCache = newTestRouter(t, client)
+	messagesCache.Mentions = MentionConfig{Enabled: true}
+	m = sendUserMessage(s, "And Rust?", lastMessage(s, testChannelID))
+	r.ServeMessage(s, &discord.MessageCreate{Message: m})
+	r.Shutdown(5 * time.Second)
+
+	req := openRouter.lastRequest(t)
+	if len(req.Messages) != 3 || req.Messages[1].Content != "Answer 1" || req.Messages[2].Content != "And Rust?" {
+		t.Fatalf("Expected the reply to continue the conversation, got %+v", req.Messages)
+	}
+
+	// Discord sends the replied message without the message it replies to, so the rest of the chain is fetched
+	r, messagesCache = newTestRouter(t, client)
+	messagesCache.Mentions = MentionConfig{Enabled: true}
+	answer := lastMessage(s, testChannelID)
+	answer.ReferencedMessage = nil
+	m = sendUserMessage(s, "Thanks", answer)
+	r.ServeMessage(s, &discord.MessageCreate{Message: m})
+	r.Shutdown(5 * time.Second)
+
+	req = openRouter.lastRequest(t)
+	want := []string{"user: What is Go?", "assistant: Answer 1", "user: And Rust?", "assistant: Answer 2", "user: Thanks"}
+	if len(req.Messages) != len(want) {
+		t.Fatalf("Expected the conversation %v, got %+v", want, req.Messages)
+	}
+	for i, message := range req.Messages {
+		if got := message.Role + ": " + message.Content; got != want[i] {
+			t.Errorf("Expected message %d to be %q, got %q", i, want[i], got)
+		}
+	}
+}
+
+func TestChatGPTMessageHandler_IgnoresMentions(t *testing.T) {
+	tests := []struct {
+		name     string
+		mentions MentionConfig
+		content  string
+	}{
+		{name: "disabled", content: "<@bot> What is Go?"},
+		{name: "other channel", mentions: MentionConfig{Enabled: true, Channels: []string{"other"}}, content: "<@bot> What is Go?"},
+		{name: "no mention", mentions: MentionConfig{Enabled: true}, content: "What is Go?"},
+		{name: "only a mention", mentions: MentionConfig{Enabled: true}, content: "<@bot>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := sessiontest.NewFake(testBotID, testGuildID, testChannelID)
+			openRouter, client := newFakeOpenRouter(t)
+			r, messagesCache := newTestRouter(t, client)
+			messagesCache.Mentions = tt.mentions
+
+			m := sendUserMessage(s, tt.content, nil)
+			r.ServeMessage(s, &discord.MessageCreate{Message: m})
+			r.Shutdown(5 * time.Second)
+
+			if len(openRouter.requests) != 0 || len(s.Messages(testChannelID)) != 1 {
+				t.Error("Expected the message not to be answered")
+			}
+		})
+	}
+}
@@ -1,11 +1,14 @@
 package gpt
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"log"
 	"time"
 
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/access"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/utils"
 	discord "github.com/bwmarrin/discordgo"
@@ -15,21 +18,22 @@ const (
 	gptDiscordChannelMessagesRequestMaxRetries = 4
 	gptDiscordTypingIndicatorCooldownSeconds   = 10
 
-	gptEmojiAck = "⌛"
-	gptEmojiErr = "❌"
+	gptEmojiAck    = "⌛"
+	gptEmojiErr    = "❌"
+	gptEmojiQueued = "📥"
 )
 
-func chatGPTMessageHandler(ctx *bot.MessageContext, client *openrouter.Client, messagesCache *MessagesCache, ignoredChannelsCache *IgnoredChannelsCache) {
+func chatGPTMessageHandler(ctx *bot.MessageContext, client openrouter.ChatCompletionClient, messagesCache *MessagesCache, ignoredChannelsCache *IgnoredChannelsCache, generations *generationRegistry, policy *access.Policy) {
 	if !shouldHandleMessageType(ctx.Message.Type) {
 		return
 	}
 
-	if ctx.Session.State.User.ID == ctx.Message.Author.ID {
+	if ctx.Session.State().User.ID == ctx.Message.Author.ID {
 		// ignore self messages
 		return
 	}
 
-	if _, exists := (*ignoredChannelsCache)[ctx.Message.ChannelID]; exists {
+	if ignoredChannelsCache.Contains(ctx.Message.ChannelID) {
 		// skip over ignored channels list
 		return
 	}
@@ -39,26 +43,64 @@ func chatGPTMessageHandler(ctx *bot.MessageContext, client *openrouter.Client, m
 		return
 	}
 
-	ch, err := ctx.Session.State.Channel(ctx.Message.ChannelID)
-	if err != nil {
-		log.Printf("[GID: %s, CHID: %s, MID: %s] Failed to get channel info with the error: %v\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID, err)
-		return
+	if ctx.Message.GuildID == "" {
+		// Direct messages are a conversation of their own, the whole channel acts as the thread
+		if !policy.DirectMessagesAllowed() {
+			log.Printf("[GID: %s, CHID: %s, MID: %s] Ignoring direct message as direct messages are disabled\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID)
+			ctx.EmbedReply(access.DirectMessagesDisabledEmbed(ctx.Locale()))
+			return
+		}
+		log.Printf("[GID: %s, CHID: %s, MID: %s] Handling new direct message\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID)
+		messagesCache.ContainsOrAdd(ctx.Message.ChannelID, &MessagesCacheData{Model: gptDefaultModel})
+	} else {
+		ch, err := ctx.Session.State().Channel(ctx.Message.ChannelID)
+		if err != nil {
+			log.Printf("[GID: %s, CHID: %s, MID: %s] Failed to get channel info with the error: %v\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID, err)
+			return
+		}
+
+		if !ch.IsThread() {
+			if !handleMentionMessage(ctx, client, messagesCache, generations, policy) {
+				// ignore non threads without mention conversations
+				ignoredChannelsCache.Add(ctx.Message.ChannelID)
+			}
+			return
+		}
+
+		if ch.ThreadMetadata != nil && (ch.ThreadMetadata.Locked || ch.ThreadMetadata.Archived) {
+			// We don't want to handle messages in locked or archived threads
+			log.Printf("[GID: %s, CHID: %s, MID: %s] Ignoring new message in a potential thread as it is locked or/and archived\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID)
+			return
+		}
+
+		log.Printf("[GID: %s, CHID: %s, MID: %s] Handling new message in a potential GPT thread\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID)
 	}
 
-	if !ch.IsThread() {
-		// ignore non threads
-		(*ignoredChannelsCache)[ctx.Message.ChannelID] = struct{}{}
+	mode := messagesCache.FollowUps.ModeFor(ctx.Message.GuildID)
+	if mode == FollowUpLock {
+		answerThreadMessages(ctx, client, messagesCache, ignoredChannelsCache, generations, policy, []*discord.Message{ctx.Message})
 		return
 	}
 
-	if ch.ThreadMetadata != nil && (ch.ThreadMetadata.Locked || ch.ThreadMetadata.Archived) {
-		// We don't want to handle messages in locked or archived threads
-		log.Printf("[GID: %s, CHID: %s, MID: %s] Ignoring new message in a potential thread as it is locked or/and archived\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID)
+	if !messagesCache.queues.begin(ctx.Message.ChannelID, ctx.Message) {
+		log.Printf("[GID: %s, CHID: %s, MID: %s] Thread is being answered, queueing the message\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID)
+		ctx.AddReaction(gptEmojiQueued)
 		return
 	}
+	// Every turn gets the timeout of the handler, so the turns are not bound by the deadline of the first message.
+	// Messages sent meanwhile are queued by followUpQueue before they wait for this handler on the dispatcher
+	var timeout time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	answerQueuedMessages(bot.Detach(ctx), timeout, ctx.Session, ctx.Caller, mode, messagesCache.queues, ctx.Message, func(turnCtx *bot.MessageContext, messages []*discord.Message) {
+		answerThreadMessages(turnCtx, client, messagesCache, ignoredChannelsCache, generations, policy, messages)
+	})
+}
 
-	log.Printf("[GID: %s, CHID: %s, MID: %s] Handling new message in a potential GPT thread\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID)
-
+// answerThreadMessages adds the prompts to the conversation of the thread or direct message channel
+// and answers them in a single reply to ctx.Message, the last of them
+func answerThreadMessages(ctx *bot.MessageContext, client openrouter.ChatCompletionClient, messagesCache *MessagesCache, ignoredChannelsCache *IgnoredChannelsCache, generations *generationRegistry, policy *access.Policy, prompts []*discord.Message) {
 	cacheItem, ok := messagesCache.Get(ctx.Message.ChannelID)
 	if !ok {
 		isGPTThread := true
@@ -72,7 +114,7 @@ func chatGPTMessageHandler(ctx *bot.MessageContext, client *openrouter.Client, m
 				break
 			}
 			// Get messages in batches of 100 (maximum allowed by Discord API)
-			batch, err := ctx.Session.ChannelMessages(ch.ID, 100, lastID, "", "")
+			batch, err := ctx.Session.ChannelMessages(ctx.Message.ChannelID, 100, lastID, "", "")
 			if err != nil {
 				// Since we cannot fetch messages, that means we cannot determine whether this a GPT thread,
 				// and if it was, we cannot get the full context to provide a better user experience. Do retries
@@ -85,21 +127,24 @@ func chatGPTMessageHandler(ctx *bot.MessageContext, client *openrouter.Client, m
 			transformed := make([]openrouter.ChatCompletionMessage, 0, len(batch))
 			for _, value := range batch {
 				role := "user"
-				if value.Author.ID == ctx.Session.State.User.ID {
+				if value.Author.ID == ctx.Session.State().User.ID {
 					role = "assistant"
 				}
 				content := value.Content
 				// First message is always a referenced message
 				// Check if it is, and then modify to get the original prompt
 				if value.Type == discord.MessageTypeThreadStarterMessage {
-					if value.Author.ID != ctx.Session.State.User.ID || value.ReferencedMessage == nil {
+					if value.Author.ID != ctx.Session.State().User.ID || value.ReferencedMessage == nil {
 						// this is not gpt thread, ignore
 						isGPTThread = false
 						break
 					}
 					role = "user"
 
-					prompt, context, model, temperature := parseInteractionReply(value.ReferencedMessage)
+					prompt, promptFile, context, model, temperature := parseInteractionReply(value.ReferencedMessage)
+					if promptFile {
+						prompt, _ = getContentOrURLData(ctx.HTTPClient(), prompt)
+					}
 					if prompt == "" {
 						isGPTThread = false
 						break
@@ -107,7 +152,7 @@ func chatGPTMessageHandler(ctx *bot.MessageContext, client *openrouter.Client, m
 					content = prompt
 					var systemMessage *openrouter.ChatCompletionMessage
 					if context != "" {
-						context, _ = getContentOrURLData(ctx.Client, context)
+						context, _ = getContentOrURLData(ctx.HTTPClient(), context)
 						systemMessage = &openrouter.ChatCompletionMessage{
 							Role:    "system",
 							Content: context,
@@ -122,6 +167,7 @@ func chatGPTMessageHandler(ctx *bot.MessageContext, client *openrouter.Client, m
 
 					cacheItem.SystemMessage = systemMessage
 					cacheItem.Model = model
+					cacheItem.Command = interactionCommand(value.ReferencedMessage)
 					
 					// Validate the OpenRouter model format
 					if !cacheItem.ValidateOpenRouterModel() {
@@ -164,16 +210,37 @@ func chatGPTMessageHandler(ctx *bot.MessageContext, client *openrouter.Client, m
 			// this was not a GPT thread
 			log.Printf("[GID: %s, CHID: %s, MID: %s] Not a GPT thread, saving to ignored cache to skip over it later\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID)
 			// save threadID to ignored cache, so we can always ignore it later
-			(*ignoredChannelsCache)[ctx.Message.ChannelID] = struct{}{}
+			ignoredChannelsCache.Add(ctx.Message.ChannelID)
 			return
 		}
 
+		cacheItem.mu.Lock()
+		defer cacheItem.mu.Unlock()
 		messagesCache.Add(ctx.Message.ChannelID, cacheItem)
 	} else {
-		cacheItem.Messages = append(cacheItem.Messages, openrouter.ChatCompletionMessage{
-			Role:    "user",
-			Content: ctx.Message.Content,
-		})
+		// Wait for the answer to the previous message, e.g. when the conversation was started by a command
+		if !cacheItem.mu.TryLock() {
+			ctx.AddReaction(gptEmojiQueued)
+			cacheItem.mu.Lock()
+			ctx.Session.MessageReactionRemove(ctx.Message.ChannelID, ctx.Message.ID, gptEmojiQueued, "@me")
+		}
+		defer cacheItem.mu.Unlock()
+		for _, message := range prompts {
+			cacheItem.Messages = append(cacheItem.Messages, openrouter.ChatCompletionMessage{
+				Role:    "user",
+				Content: message.Content,
+			})
+		}
+	}
+
+	// Follow-ups are checked against the command that started the conversation, e.g. "chat gpt"
+	if denial := policy.Check(access.MessageRequest(ctx.Session, ctx.Message, cacheItem.accessCommand(ctx.Caller.Name), cacheItem.Model)); denial != nil {
+		log.Printf("[GID: %s, CHID: %s, MID: %s] Access denied: %v\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID, denial)
+		_, err := ctx.Session.ChannelMessageSendEmbedReply(ctx.Message.ChannelID, access.DenialEmbed(ctx.Locale(), denial), ctx.Message.Reference())
+		if err != nil {
+			log.Printf("[GID: %s, CHID: %s, MID: %s] Failed to reply in the thread with the error: %v\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID, err)
+		}
+		return
 	}
 
 	// check if current message cache is within allowed token limit
@@ -183,21 +250,46 @@ func chatGPTMessageHandler(ctx *bot.MessageContext, client *openrouter.Client, m
 		log.Printf("[GID: %s, CHID: %s, MID: %s] Tokens adjustments finished. Current cache tokens: %d\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID, cacheItem.TokenCount)
 	}
 
-	// Lock the thread while we are generating ChatGPT answser
-	utils.ToggleDiscordThreadLock(ctx.Session, ctx.Message.ChannelID, true)
-	// Unlock the thread at the end
-	defer utils.ToggleDiscordThreadLock(ctx.Session, ctx.Message.ChannelID, false)
+	if ctx.Message.GuildID != "" && messagesCache.FollowUps.ModeFor(ctx.Message.GuildID) == FollowUpLock {
+		// Lock the thread while we are generating ChatGPT answser
+		unlock := bot.LockThread(ctx, ctx.Session, ctx.Message.ChannelID)
+		// Unlock the thread at the end
+		defer unlock()
+	}
+
+	replyWithAnswer(ctx, client, generations, cacheItem)
+}
 
+// replyWithAnswer generates the answer to the conversation in cacheItem and replies with it to ctx.Message.
+// It returns the last message of the reply, or nil if answering failed
+func replyWithAnswer(ctx *bot.MessageContext, client openrouter.ChatCompletionClient, generations *generationRegistry, cacheItem *MessagesCacheData) *discord.Message {
 	ctx.AddReaction(gptEmojiAck)
 	defer ctx.RemoveReaction(gptEmojiAck)
 
+	start := time.Now()
+	var failure error
+	defer func() {
+		event := bot.Event{
+			Type:      bot.EventMessageHandled,
+			MessageID: ctx.Message.ID,
+			UserID:    ctx.Message.Author.ID,
+			Model:     cacheItem.Model,
+			Prompt:    ctx.Message.Content,
+			Duration:  time.Since(start),
+		}
+		if failure != nil {
+			event.Error = failure.Error()
+		}
+		bot.Emit(ctx, event)
+	}()
+
 	// Create a ticker and a channel for signaling request completion
 	// Discord stops showing typing indicator after 10 seconds, so we
 	// need to send it again
 	ctx.ChannelTyping()
 	typingTicker := time.NewTicker(gptDiscordTypingIndicatorCooldownSeconds * time.Second)
 	done := make(chan bool)
-	go func() {
+	bot.Go(ctx, func() {
 		for {
 			select {
 			case <-typingTicker.C:
@@ -207,41 +299,64 @@ func chatGPTMessageHandler(ctx *bot.MessageContext, client *openrouter.Client, m
 				return
 			}
 		}
-	}()
+	})
+
+	generationCtx, generationDone := generations.start(ctx, ctx.Message.ID, ctx.Message.Author.ID)
+	defer generationDone()
+
+	stopComponents := generations.stopComponents(ctx.Locale(), ctx.Message.ID)
+	pendingMessage, err := utils.DiscordChannelMessageSendWithComponents(ctx.Session, ctx.Message.ChannelID, i18n.Text(ctx.Locale(), "gpt.pending"), stopComponents, ctx.Message.Reference())
+	if err != nil {
+		done <- true
+		log.Printf("[GID: %s, CHID: %s, MID: %s] Failed to reply in the thread with the error: %v\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID, err)
+		ctx.AddReaction(gptEmojiErr)
+		failure = err
+		return nil
+	}
 
 	log.Printf("[GID: %s, CHID: %s] OpenRouter Request invoked with [Model: %s]. Current cache size: %v, Token count: %d\n", ctx.Message.GuildID, ctx.Message.ChannelID, cacheItem.Model, len(cacheItem.Messages), cacheItem.TokenCount)
 
-	resp, err := sendOpenRouterRequest(client, cacheItem)
+	stream := newStreamingMessage(ctx.Session, pendingMessage, stopComponents)
+	resp, err := sendOpenRouterRequest(generationCtx, client, cacheItem, stream.onDelta)
 
 	// Signal the typing ticker to stop
 	done <- true
 
-	if err != nil {
+	notice := generationInterruptedNotice(ctx.Locale(), generationCtx)
+	if err != nil && notice != "" && resp == nil {
+		// Interrupted before anything was generated
+		resp = &chatGPTResponse{}
+	}
+	if err != nil && notice == "" {
+		ctx.ChannelMessageDelete(pendingMessage.ChannelID, pendingMessage.ID)
 		// OpenRouter request failed, provide detailed error information
 		log.Printf("[GID: %s, CHID: %s] OpenRouter request ChatCompletion failed with the error: %v\n", ctx.Message.GuildID, ctx.Message.ChannelID, err)
 		ctx.AddReaction(gptEmojiErr)
+		failure = err
 		
-		errorTitle := "❌ OpenRouter API Error"
+		locale := ctx.Locale()
+		errorTitle := i18n.Text(locale, "gpt.error.api.title")
 		errorDescription := err.Error()
 		
 		// Check if it's an OpenRouter-specific error and provide better messaging
-		if openRouterErr, ok := err.(*openrouter.ErrorResponse); ok {
-			switch openRouterErr.ErrorDetail.Code {
+		var openRouterErr *openrouter.OpenRouterError
+		if errors.As(err, &openRouterErr) {
+			switch openRouterErr.ErrorCode {
 			case "insufficient_quota", "insufficient_credits":
-				errorTitle = "❌ Insufficient Credits"
-				errorDescription = "OpenRouter account has insufficient credits. Please add credits to continue."
+				errorTitle = i18n.Text(locale, "gpt.error.credits.title")
+				errorDescription = i18n.Text(locale, "gpt.error.credits.description")
 			case "model_not_found", "model_unavailable":
-				errorTitle = "❌ Model Unavailable"
-				errorDescription = fmt.Sprintf("The requested model '%s' is not available. Please try a different model.", normalizeOpenRouterModelName(cacheItem.Model))
+				errorTitle = i18n.Text(locale, "gpt.error.model.title")
+				errorDescription = i18n.Text(locale, "gpt.error.model.description", normalizeOpenRouterModelName(cacheItem.Model))
 			case "rate_limit_exceeded", "rate_limited":
-				errorTitle = "❌ Rate Limit Exceeded"
-				errorDescription = "Too many requests. Please wait a moment before trying again."
+				errorTitle = i18n.Text(locale, "gpt.error.rate_limit.title")
+				errorDescription = i18n.Text(locale, "gpt.error.rate_limit.description")
 			case "invalid_request_error", "invalid_request":
-				errorTitle = "❌ Invalid Request"
-				errorDescription = "The request was invalid. Please check your input and try again."
+				errorTitle = i18n.Text(locale, "gpt.error.invalid_request.title")
+				errorDescription = i18n.Text(locale, "gpt.error.invalid_request.description")
 			case "context_length_exceeded":
-				errorTitle = "❌ Context Length Exceeded"
-				errorDescription = fmt.Sprintf("The conversation is too long for model '%s'. Please start a new thread.", normalizeOpenRouterModelName(cacheItem.Model))
+				errorTitle = i18n.Text(locale, "gpt.error.context_exceeded.title")
+				errorDescription = i18n.Text(locale, "gpt.error.context_exceeded.description", normalizeOpenRouterModelName(cacheItem.Model))
 			}
 		}
 		
@@ -250,26 +365,36 @@ func chatGPTMessageHandler(ctx *bot.MessageContext, client *openrouter.Client, m
 			Description: errorDescription,
 			Color:       0xff0000,
 		})
-		return
+		return nil
+	}
+
+	if notice != "" {
+		log.Printf("[GID: %s, CHID: %s] OpenRouter request [Model: %s] was interrupted: %v\n", ctx.Message.GuildID, ctx.Message.ChannelID, cacheItem.Model, context.Cause(generationCtx))
 	}
 
-	log.Printf("[GID: %s, CHID: %s] OpenRouter Request [Model: %s] responded with a usage: [PromptTokens: %d, CompletionTokens: %d, TotalTokens: %d]\n", ctx.Message.GuildID, ctx.Message.ChannelID, cacheItem.Model, resp.usage.PromptTokens, resp.usage.CompletionTokens, resp.usage.TotalTokens)
+	log.Printf("[GID: %s, CHID: %s] OpenRouter Request [Model: %s] responded with a usage: [PromptTokens: %d, CompletionTokens: %d, TotalTokens: %d, Cached: %t]\n", ctx.Message.GuildID, ctx.Message.ChannelID, cacheItem.Model, resp.usage.PromptTokens, resp.usage.CompletionTokens, resp.usage.TotalTokens, resp.cached)
 
-	messages := splitMessage(resp.content)
-	var replyMessage *discord.Message
-	for _, message := range messages {
-		replyMessage, err = ctx.Reply(message)
+	messages := splitMessage(appendInterruptedNotice(resp.content, notice))
+	replyMessage := pendingMessage
+	err = utils.DiscordChannelMessageEditComponents(ctx.Session, pendingMessage.ID, pendingMessage.ChannelID, &messages[0], nil)
+	for _, message := range messages[1:] {
 		if err != nil {
-			log.Printf("[GID: %s, CHID: %s, MID: %s] Failed to reply in the thread with the error: %v\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID, err)
-			ctx.AddReaction(gptEmojiErr)
-			ctx.EmbedReply(&discord.MessageEmbed{
-				Title:       "❌ Discord API Error",
-				Description: err.Error(),
-				Color:       0xff0000,
-			})
-			return
+			break
 		}
+		replyMessage, err = ctx.Reply(message)
+	}
+	if err != nil {
+		log.Printf("[GID: %s, CHID: %s, MID: %s] Failed to reply in the thread with the error: %v\n", ctx.Message.GuildID, ctx.Message.ChannelID, ctx.Message.ID, err)
+		ctx.AddReaction(gptEmojiErr)
+		failure = err
+		ctx.EmbedReply(&discord.MessageEmbed{
+			Title:       i18n.Text(ctx.Locale(), "error.discord.title"),
+			Description: err.Error(),
+			Color:       0xff0000,
+		})
+		return nil
 	}
 
-	attachUsageInfo(ctx.Session, replyMessage, resp.usage, cacheItem.Model)
+	attachUsageInfo(ctx.Session, ctx.Locale(), replyMessage, resp.usage, cacheItem.Model, resp.cached)
+	return replyMessage
 }
@@ -156,15 +156,11 @@ func TestTokenCountingAccuracy(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			tokenCount := countOpenRouterMessageTokens(tc.message, tc.model)
-			if tokenCount == nil {
-				t.Error("Token count should not be nil")
-				return
-			}
+			tokenCount := (&MessagesCacheData{Model: tc.model}).MessageTokens(tc.message)
 
-			if *tokenCount < tc.minTokens || *tokenCount > tc.maxTokens {
+			if tokenCount < tc.minTokens || tokenCount > tc.maxTokens {
 				t.Errorf("Token count %d is outside expected range [%d, %d] for message: %s", 
-					*tokenCount, tc.minTokens, tc.maxTokens, tc.message.Content)
+					tokenCount, tc.minTokens, tc.maxTokens, tc.message.Content)
 			}
 		})
 	}
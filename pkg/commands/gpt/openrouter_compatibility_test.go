@@ -66,13 +66,9 @@ func TestTokenCountingWithOpenRouterModels(t *testing.T) {
 	}
 	
 	// Test with OpenRouter model format
-	result := countOpenRouterMessageTokens(message, "openai/gpt-4")
-	if result == nil {
-		t.Error("Token count should not be nil for valid message")
-	}
-	
-	if result != nil && *result <= 0 {
-		t.Errorf("Token count should be positive, got %d", *result)
+	result := (&MessagesCacheData{Model: "openai/gpt-4"}).MessageTokens(message)
+	if result <= 0 {
+		t.Errorf("Token count should be positive, got %d", result)
 	}
 }
 
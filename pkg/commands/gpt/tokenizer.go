@@ -0,0 +1,182 @@
+package gpt
+
+import (
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+// Tokenizer counts the tokens a model family uses for chat messages
+type Tokenizer interface {
+	// Name identifies the tokenizer, e.g. "cl100k_base" or "claude~cl100k_base"
+	Name() string
+	// CountTokens returns the number of tokens in text
+	CountTokens(text string) int
+	// MessageOverhead returns the tokens added to every message and to every message name
+	MessageOverhead() (tokensPerMessage int, tokensPerName int)
+}
+
+// codecs holds the loaded tiktoken encoders. Loading an encoder parses its whole
+// vocabulary, so every encoding is loaded once and shared by all tokenizers
+var codecs = struct {
+	sync.Mutex
+	loaded map[tokenizer.Encoding]tokenizer.Codec
+}{
+	loaded: make(map[tokenizer.Encoding]tokenizer.Codec),
+}
+
+func getCodec(encoding tokenizer.Encoding) tokenizer.Codec {
+	codecs.Lock()
+	defer codecs.Unlock()
+
+	if codec, ok := codecs.loaded[encoding]; ok {
+		return codec
+	}
+	codec, err := tokenizer.Get(encoding)
+	if err != nil {
+		// Only encodings supported by the library are registered, fall back to the most common one
+		codec, _ = tokenizer.Get(tokenizer.Cl100kBase)
+	}
+	codecs.loaded[encoding] = codec
+	return codec
+}
+
+// tiktokenTokenizer counts tokens exactly with one of the OpenAI encodings
+type tiktokenTokenizer struct {
+	encoding         tokenizer.Encoding
+	tokensPerMessage int
+	tokensPerName    int
+}
+
+func newTiktokenTokenizer(encoding tokenizer.Encoding, tokensPerMessage int, tokensPerName int) *tiktokenTokenizer {
+	return &tiktokenTokenizer{
+		encoding:         encoding,
+		tokensPerMessage: tokensPerMessage,
+		tokensPerName:    tokensPerName,
+	}
+}
+
+func (t *tiktokenTokenizer) Name() string {
+	return string(t.encoding)
+}
+
+func (t *tiktokenTokenizer) CountTokens(text string) int {
+	count, _ := getCodec(t.encoding).Count(text)
+	return count
+}
+
+func (t *tiktokenTokenizer) MessageOverhead() (int, int) {
+	return t.tokensPerMessage, t.tokensPerName
+}
+
+// estimatingTokenizer approximates the tokenizer of a model family that has no Go implementation
+// by scaling the count of a similar OpenAI encoding. The ratio is calibrated on English and code samples
+type estimatingTokenizer struct {
+	family string
+	base   *tiktokenTokenizer
+	ratio  float64
+}
+
+func newEstimatingTokenizer(family string, encoding tokenizer.Encoding, ratio float64) *estimatingTokenizer {
+	return &estimatingTokenizer{
+		family: family,
+		base:   newTiktokenTokenizer(encoding, 3, 1),
+		ratio:  ratio,
+	}
+}
+
+func (t *estimatingTokenizer) Name() string {
+	return t.family + "~" + t.base.Name()
+}
+
+func (t *estimatingTokenizer) CountTokens(text string) int {
+	// Round up, so truncation errs on the side of sending fewer tokens
+	return int(math.Ceil(float64(t.base.CountTokens(text)) * t.ratio))
+}
+
+func (t *estimatingTokenizer) MessageOverhead() (int, int) {
+	return t.base.MessageOverhead()
+}
+
+// TokenizerRegistry maps model families to tokenizers. A model is matched by the
+// longest registered pattern contained in its name, e.g. "claude" matches "anthropic/claude-3-sonnet"
+type TokenizerRegistry struct {
+	mu       sync.RWMutex
+	families map[string]Tokenizer
+	models   map[string]Tokenizer
+	fallback Tokenizer
+}
+
+// NewTokenizerRegistry creates a registry with tokenizers for the common model families
+func NewTokenizerRegistry() *TokenizerRegistry {
+	r := &TokenizerRegistry{
+		families: make(map[string]Tokenizer),
+		models:   make(map[string]Tokenizer),
+		fallback: newTiktokenTokenizer(tokenizer.Cl100kBase, 3, 1),
+	}
+
+	cl100k := newTiktokenTokenizer(tokenizer.Cl100kBase, 3, 1)
+	o200k := newTiktokenTokenizer(tokenizer.O200kBase, 3, 1)
+	r.Register("gpt-3.5", cl100k)
+	r.Register("gpt-3.5-turbo-0301", newTiktokenTokenizer(tokenizer.Cl100kBase, 4, -1))
+	r.Register("gpt-4", cl100k)
+	r.Register("gpt-4o", o200k)
+	r.Register("gpt-4.1", o200k)
+	r.Register("gpt-5", o200k)
+	r.Register("/o1", o200k)
+	r.Register("/o3", o200k)
+	r.Register("/o4", o200k)
+
+	r.Register("claude", newEstimatingTokenizer("claude", tokenizer.Cl100kBase, 1.15))
+	r.Register("llama", newEstimatingTokenizer("llama", tokenizer.Cl100kBase, 1.25))
+	// Llama 3 uses a tiktoken-based vocabulary close to o200k_base
+	r.Register("llama-3", newEstimatingTokenizer("llama-3", tokenizer.O200kBase, 1.0))
+	r.Register("llama3", newEstimatingTokenizer("llama-3", tokenizer.O200kBase, 1.0))
+	r.Register("mistral", newEstimatingTokenizer("mistral", tokenizer.Cl100kBase, 1.2))
+	r.Register("mixtral", newEstimatingTokenizer("mistral", tokenizer.Cl100kBase, 1.2))
+	r.Register("gemini", newEstimatingTokenizer("gemini", tokenizer.O200kBase, 1.1))
+	r.Register("gemma", newEstimatingTokenizer("gemini", tokenizer.O200kBase, 1.1))
+
+	return r
+}
+
+// Register sets the tokenizer for models whose name contains pattern
+func (r *TokenizerRegistry) Register(pattern string, t Tokenizer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.families[strings.ToLower(pattern)] = t
+	// Resolved models may match the new pattern
+	r.models = make(map[string]Tokenizer)
+}
+
+// ForModel returns the tokenizer for the model. Models of unknown families use cl100k_base
+func (r *TokenizerRegistry) ForModel(model string) Tokenizer {
+	r.mu.RLock()
+	t, ok := r.models[model]
+	r.mu.RUnlock()
+	if ok {
+		return t
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Provider is kept in the name, so patterns like "/o1" only match the model part
+	name := "/" + strings.ToLower(model)
+	t = r.fallback
+	match := ""
+	for pattern, family := range r.families {
+		if strings.Contains(name, pattern) && len(pattern) > len(match) {
+			t = family
+			match = pattern
+		}
+	}
+	r.models[model] = t
+	return t
+}
+
+// tokenizers is used by the token counting of all conversations
+var tokenizers = NewTokenizerRegistry()
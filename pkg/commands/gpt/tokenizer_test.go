@@ -0,0 +1,186 @@
+package gpt
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
+	"github.com/tiktoken-go/tokenizer"
+)
+
+func TestTokenizerRegistry_ForModel(t *testing.T) {
+	registry := NewTokenizerRegistry()
+
+	testCases := []struct {
+		model    string
+		expected string
+	}{
+		{"openai/gpt-3.5-turbo", "cl100k_base"},
+		{"openai/gpt-4-turbo", "cl100k_base"},
+		{"openai/gpt-4o", "o200k_base"},
+		{"openai/gpt-4o-mini", "o200k_base"},
+		{"openai/o1-mini", "o200k_base"},
+		{"anthropic/claude-3-sonnet", "claude~cl100k_base"},
+		{"meta-llama/llama-2-70b-chat", "llama~cl100k_base"},
+		{"meta-llama/llama-3-70b-instruct", "llama-3~o200k_base"},
+		{"mistralai/mixtral-8x7b-instruct", "mistral~cl100k_base"},
+		{"google/gemini-pro", "gemini~o200k_base"},
+		{"local/unknown-model", "cl100k_base"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.model, func(t *testing.T) {
+			if name := registry.ForModel(tc.model).Name(); name != tc.expected {
+				t.Errorf("ForModel(%q) = %s, want %s", tc.model, name, tc.expected)
+			}
+		})
+	}
+}
+
+func TestTokenizerRegistry_Register(t *testing.T) {
+	registry := NewTokenizerRegistry()
+	// Resolve once, so the registration has to invalidate the resolved model
+	registry.ForModel("local/qwen-7b")
+
+	registry.Register("qwen", newEstimatingTokenizer("qwen", tokenizer.Cl100kBase, 1.05))
+	if name := registry.ForModel("local/qwen-7b").Name(); name != "qwen~cl100k_base" {
+		t.Errorf("Expected registered tokenizer, got %s", name)
+	}
+}
+
+func TestTokenizer_MessageOverhead(t *testing.T) {
+	if perMessage, perName := tokenizers.ForModel("openai/gpt-3.5-turbo-0301").MessageOverhead(); perMessage != 4 || perName != -1 {
+		t.Errorf("Expected gpt-3.5-turbo-0301 overhead (4, -1), got (%d, %d)", perMessage, perName)
+	}
+	if perMessage, perName := tokenizers.ForModel("openai/gpt-4").MessageOverhead(); perMessage != 3 || perName != 1 {
+		t.Errorf("Expected gpt-4 overhead (3, 1), got (%d, %d)", perMessage, perName)
+	}
+}
+
+func TestEstimatingTokenizer(t *testing.T) {
+	text := "The quick brown fox jumps over the lazy dog while the compiler optimizes the hot loop."
+	exact := newTiktokenTokenizer(tokenizer.Cl100kBase, 3, 1).CountTokens(text)
+	estimated := tokenizers.ForModel("anthropic/claude-3-sonnet").CountTokens(text)
+	if estimated <= exact {
+		t.Errorf("Expected Claude estimate above cl100k count %d, got %d", exact, estimated)
+	}
+}
+
+func TestGetCodec_Cached(t *testing.T) {
+	if getCodec(tokenizer.Cl100kBase) != getCodec(tokenizer.Cl100kBase) {
+		t.Error("Expected encoders to be loaded once and reused")
+	}
+}
+
+func TestMessagesCacheData_CountTokens(t *testing.T) {
+	cacheItem := &MessagesCacheData{
+		SystemMessage: &openrouter.ChatCompletionMessage{Role: "system", Content: "You are a helpful assistant"},
+		Messages: []openrouter.ChatCompletionMessage{
+			{Role: "user", Content: "What is Go?"},
+			{Role: "assistant", Content: "Go is a statically typed, compiled programming language."},
+		},
+		Model: "openai/gpt-4",
+	}
+
+	expected := encodeAllTokens(cacheItem)
+	if tokens := cacheItem.CountTokens(); tokens != expected {
+		t.Errorf("Expected %d tokens, got %d", expected, tokens)
+	}
+	if len(cacheItem.tokenCounts) != 3 {
+		t.Errorf("Expected 3 memoized messages, got %d", len(cacheItem.tokenCounts))
+	}
+
+	// Switching the model invalidates the memoized counts
+	cacheItem.Model = "anthropic/claude-3-sonnet"
+	expected = encodeAllTokens(cacheItem)
+	if tokens := cacheItem.CountTokens(); tokens != expected {
+		t.Errorf("Expected %d tokens after model change, got %d", expected, tokens)
+	}
+}
+
+// encodeAllTokens counts the tokens of the conversation without the memoized counts
+func encodeAllTokens(cacheItem *MessagesCacheData) int {
+	t := tokenizers.ForModel(cacheItem.Model)
+	tokens := 3
+	for _, message := range cacheItem.Messages {
+		tokens += _countMessageTokens(t, message)
+	}
+	if cacheItem.SystemMessage != nil {
+		tokens += _countMessageTokens(t, *cacheItem.SystemMessage)
+	}
+	return tokens
+}
+
+func TestAdjustMessageTokens(t *testing.T) {
+	cacheItem := &MessagesCacheData{
+		Model: "openai/gpt-3.5-turbo",
+	}
+	for i := 0; i < 400; i++ {
+		cacheItem.Messages = append(cacheItem.Messages, openrouter.ChatCompletionMessage{
+			Role:    "user",
+			Content: fmt.Sprintf("Message %d: %s", i, strings.Repeat("lorem ipsum ", 5)),
+		})
+	}
+
+	if ok, _ := isCacheItemWithinTruncateLimit(cacheItem); ok {
+		t.Fatal("Expected conversation to exceed the truncate limit")
+	}
+	adjustMessageTokens(cacheItem)
+
+	if limit := *modelTruncateLimit(cacheItem.Model); cacheItem.TokenCount > limit {
+		t.Errorf("Expected token count within %d, got %d", limit, cacheItem.TokenCount)
+	}
+	if cacheItem.TokenCount != cacheItem.CountTokens() {
+		t.Errorf("Adjusted token count %d does not match recount %d", cacheItem.TokenCount, cacheItem.CountTokens())
+	}
+}
+
+// conversationTurns returns messages of a long conversation
+func conversationTurns(n int) []openrouter.ChatCompletionMessage {
+	messages := make([]openrouter.ChatCompletionMessage, 0, n)
+	for i := 0; i < n; i++ {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		messages = append(messages, openrouter.ChatCompletionMessage{
+			Role:    role,
+			Content: fmt.Sprintf("Turn %d: %s", i, strings.Repeat("The message handler rebuilds the conversation. ", 20)),
+		})
+	}
+	return messages
+}
+
+// BenchmarkConversationTokens_Memoized checks the token limit after every turn of a
+// conversation, as the message handler does. Only the new message is encoded per turn
+func BenchmarkConversationTokens_Memoized(b *testing.B) {
+	turns := conversationTurns(50)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cacheItem := &MessagesCacheData{Model: "anthropic/claude-3-sonnet"}
+		for _, message := range turns {
+			cacheItem.Messages = append(cacheItem.Messages, message)
+			isCacheItemWithinTruncateLimit(cacheItem)
+		}
+	}
+}
+
+// BenchmarkConversationTokens_Recount re-encodes the whole history every turn
+func BenchmarkConversationTokens_Recount(b *testing.B) {
+	turns := conversationTurns(50)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var messages []openrouter.ChatCompletionMessage
+		for _, message := range turns {
+			messages = append(messages, message)
+			(&MessagesCacheData{Model: "anthropic/claude-3-sonnet", Messages: messages}).CountTokens()
+		}
+	}
+}
+
+func BenchmarkTokenizerRegistry_ForModel(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		tokenizers.ForModel("anthropic/claude-3-sonnet")
+	}
+}
@@ -9,13 +9,18 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/access"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/constants"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/utils"
 	discord "github.com/bwmarrin/discordgo"
 )
 
+// gptLanguageHint tells the model which language the user most likely speaks
+const gptLanguageHint = "Answer in %s, unless the user writes in another language"
+
 const (
 	gptPricePerPromptTokenGPT3Dot5Turbo0613     = 0.0000015
 	gptPricePerCompletionTokenGPT3Dot5Turbo0613 = 0.000002
@@ -43,9 +48,12 @@ func shouldHandleMessageType(t discord.MessageType) bool {
 type chatGPTResponse struct {
 	content string
 	usage   openrouter.Usage
+	cached  bool
 }
 
-func sendOpenRouterRequest(client *openrouter.Client, cacheItem *MessagesCacheData) (*chatGPTResponse, error) {
+// sendOpenRouterRequest streams the answer to the conversation in cacheItem and stores it in the cache.
+// When ctx is cancelled, the partially generated answer is returned together with the error
+func sendOpenRouterRequest(ctx context.Context, client openrouter.ChatCompletionClient, cacheItem *MessagesCacheData, onDelta func(delta string)) (*chatGPTResponse, error) {
 	messages := cacheItem.Messages
 	if cacheItem.SystemMessage != nil {
 		messages = append([]openrouter.ChatCompletionMessage{*cacheItem.SystemMessage}, messages...)
@@ -59,27 +67,30 @@ func sendOpenRouterRequest(client *openrouter.Client, cacheItem *MessagesCacheDa
 		req.Temperature = cacheItem.Temperature
 	}
 
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		req,
-	)
-	if err != nil {
+	resp, err := openrouter.StreamChatCompletion(ctx, client, req, onDelta)
+	if resp == nil || len(resp.Choices) == 0 {
+		if err == nil {
+			err = fmt.Errorf("empty response from model %s", cacheItem.Model)
+		}
 		return nil, err
 	}
 	responseContent := resp.Choices[0].Message.Content
-	cacheItem.Messages = append(cacheItem.Messages, openrouter.ChatCompletionMessage{
-		Role:    "assistant",
-		Content: responseContent,
-	})
-	cacheItem.TokenCount = resp.Usage.TotalTokens
+	if responseContent != "" {
+		cacheItem.Messages = append(cacheItem.Messages, openrouter.ChatCompletionMessage{
+			Role:    "assistant",
+			Content: responseContent,
+		})
+	}
+	if resp.Usage.TotalTokens > 0 {
+		cacheItem.TokenCount = resp.Usage.TotalTokens
+	}
 	return &chatGPTResponse{
 		content: responseContent,
 		usage:   resp.Usage,
-	}, nil
+		cached:  resp.CacheHit,
+	}, err
 }
 
-
-
 func getUrlData(client *http.Client, url string) (string, error) {
 	res, err := client.Get(url)
 	if err != nil {
@@ -102,26 +113,32 @@ func getContentOrURLData(client *http.Client, s string) (content string, err err
 	return content, err
 }
 
-func parseInteractionReply(discordMessage *discord.Message) (prompt string, context string, model string, temperature *float32) {
+// parseInteractionReply restores the request of a conversation from the request message.
+// If promptFile is set, the prompt is the URL of a file with the full prompt
+func parseInteractionReply(discordMessage *discord.Message) (prompt string, promptFile bool, context string, model string, temperature *float32) {
 	if discordMessage == nil || len(discordMessage.Embeds) == 0 {
 		return
 	}
 
 	for _, embed := range discordMessage.Embeds {
-		if embed.Description != "" {
+		if embed.Description != "" && !promptFile {
 			prompt = embed.Description
 		}
 		for _, field := range embed.Fields {
 			switch field.Name {
 			case gptCommandOptionPrompt.humanReadableString():
 				prompt = field.Value
+			case gptCommandOptionPromptFile.humanReadableString():
+				// the description only holds the beginning of a long prompt
+				prompt = messageAttachmentURL(discordMessage, field.Value)
+				promptFile = true
 			case gptCommandOptionContext.humanReadableString():
 				if context == "" {
 					// file context always gets precedence
 					context = field.Value
 				}
 			case gptCommandOptionContextFile.humanReadableString():
-				context = field.Value
+				context = messageAttachmentURL(discordMessage, field.Value)
 			case gptCommandOptionModel.humanReadableString():
 				model = field.Value
 			case gptCommandOptionTemperature.humanReadableString():
@@ -139,6 +156,26 @@ func parseInteractionReply(discordMessage *discord.Message) (prompt string, cont
 	return
 }
 
+// interactionCommand returns the path of the command the request message responded to, e.g. "chat gpt".
+// Discord names the command including its subcommands, empty if the message is no interaction response
+func interactionCommand(discordMessage *discord.Message) string {
+	if discordMessage == nil || discordMessage.Interaction == nil {
+		return ""
+	}
+	return discordMessage.Interaction.Name
+}
+
+// messageAttachmentURL returns the URL of the message attachment named filename,
+// or filename itself if it is not attached, e.g. because it is already a URL
+func messageAttachmentURL(discordMessage *discord.Message, filename string) string {
+	for _, attachment := range discordMessage.Attachments {
+		if attachment.Filename == filename {
+			return attachment.URL
+		}
+	}
+	return filename
+}
+
 func modelTruncateLimit(model string) *int {
 	// Extract base model for OpenRouter format
 	baseModel := extractBaseModel(model)
@@ -205,14 +242,11 @@ func adjustMessageTokens(cacheItem *MessagesCacheData) {
 		return
 	}
 
-	for cacheItem.TokenCount > *truncateLimit {
+	for cacheItem.TokenCount > *truncateLimit && len(cacheItem.Messages) > 0 {
 		message := cacheItem.Messages[0]
 		cacheItem.Messages = cacheItem.Messages[1:]
-		removedTokens := countOpenRouterMessageTokens(message, cacheItem.Model)
-		if removedTokens == nil {
-			return
-		}
-		cacheItem.TokenCount -= *removedTokens
+		cacheItem.TokenCount -= cacheItem.MessageTokens(message)
+		cacheItem.forgetMessageTokens(message)
 	}
 }
 
@@ -222,16 +256,13 @@ func isCacheItemWithinTruncateLimit(cacheItem *MessagesCacheData) (ok bool, coun
 		return true, 0
 	}
 
-	tokens := countAllOpenRouterMessagesTokens(cacheItem.SystemMessage, cacheItem.Messages, cacheItem.Model)
-	if tokens == nil {
-		return true, 0
-	}
-	cacheItem.TokenCount = *tokens
+	tokens := cacheItem.CountTokens()
+	cacheItem.TokenCount = tokens
 
-	return *tokens <= *truncateLimit, *tokens
+	return tokens <= *truncateLimit, tokens
 }
 
-func generateThreadTitleBasedOnInitialPrompt(ctx *bot.Context, client *openrouter.Client, threadID string, messages []openrouter.ChatCompletionChoice) {
+func generateThreadTitleBasedOnInitialPrompt(ctx context.Context, s session.Session, guildID string, client openrouter.ChatCompletionClient, threadID string, messages []openrouter.ChatCompletionChoice) {
 	conversation := make([]map[string]string, len(messages))
 	for i, msg := range messages {
 		conversation[i] = map[string]string{
@@ -247,8 +278,12 @@ func generateThreadTitleBasedOnInitialPrompt(ctx *bot.Context, client *openroute
 
 	prompt := fmt.Sprintf("%s\nGenerate a short and concise title summarizing the conversation in the same language. The title must not contain any quotes. The title should be no longer than 60 characters:", conversationText)
 
+	// The title is generated after the interaction handler returns, so it must outlive its context
+	titleCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), gptTitleGenerationTimeout)
+	defer cancel()
+
 	// Use chat completion instead of completion for OpenRouter
-	resp, err := client.CreateChatCompletion(context.Background(), openrouter.ChatCompletionRequest{
+	resp, err := client.CreateChatCompletion(titleCtx, openrouter.ChatCompletionRequest{
 		Model: "openai/gpt-3.5-turbo", // Use a reliable model for title generation
 		Messages: []openrouter.ChatCompletionMessage{
 			{
@@ -256,11 +291,15 @@ func generateThreadTitleBasedOnInitialPrompt(ctx *bot.Context, client *openroute
 				Content: prompt,
 			},
 		},
-		Temperature: func() *float32 { t := float32(0.5); return &t }(),
+		// Zero temperature makes identical prompts reuse the cached title
+		Temperature: func() *float32 { t := float32(0); return &t }(),
 		MaxTokens:   func() *int { t := 75; return &t }(),
 	})
 	if err != nil {
-		log.Printf("[GID: %s, threadID: %s] Failed to generate thread title with the error: %v\n", ctx.Interaction.GuildID, threadID, err)
+		log.Printf("[GID: %s, threadID: %s] Failed to generate thread title with the error: %v\n", guildID, threadID, err)
+		return
+	}
+	if len(resp.Choices) == 0 {
 		return
 	}
 
@@ -269,22 +308,25 @@ func generateThreadTitleBasedOnInitialPrompt(ctx *bot.Context, client *openroute
 		title = title[:60]
 	}
 
-	_, err = ctx.Session.ChannelEditComplex(threadID, &discord.ChannelEdit{
+	_, err = s.ChannelEditComplex(threadID, &discord.ChannelEdit{
 		Name: title,
 	})
 	if err != nil {
-		log.Printf("[GID: %s, i.ID: %s] Failed to update thread title with the error: %v\n", ctx.Interaction.GuildID, threadID, err)
+		log.Printf("[GID: %s, i.ID: %s] Failed to update thread title with the error: %v\n", guildID, threadID, err)
 	}
 }
 
-func attachUsageInfo(s *discord.Session, m *discord.Message, usage openrouter.Usage, model string) {
+func attachUsageInfo(s session.Session, locale discord.Locale, m *discord.Message, usage openrouter.Usage, model string, cached bool) {
 	var extraInfo string
-	if usage.TotalCost > 0 {
+	if cached {
+		// Cached responses are served without calling the API
+		extraInfo = i18n.Text(locale, "gpt.usage.cached", usage.CompletionTokens, usage.TotalTokens)
+	} else if usage.TotalCost > 0 {
 		// OpenRouter provides cost information directly
-		extraInfo = fmt.Sprintf("Completion Tokens: %d, Total: %d, Cost: $%.6f", usage.CompletionTokens, usage.TotalTokens, usage.TotalCost)
+		extraInfo = i18n.Text(locale, "gpt.usage.cost", usage.CompletionTokens, usage.TotalTokens, usage.TotalCost)
 	} else {
 		// Fallback to token count only if cost is not available
-		extraInfo = fmt.Sprintf("Completion Tokens: %d, Total: %d%s", usage.CompletionTokens, usage.TotalTokens, generateOpenRouterCost(usage, model))
+		extraInfo = i18n.Text(locale, "gpt.usage.tokens", usage.CompletionTokens, usage.TotalTokens) + generateOpenRouterCost(usage, model)
 	}
 
 	utils.DiscordChannelMessageEdit(s, m.ID, m.ChannelID, nil, []*discord.MessageEmbed{
@@ -296,3 +338,21 @@ func attachUsageInfo(s *discord.Session, m *discord.Message, usage openrouter.Us
 		},
 	})
 }
+
+// languageHintMessage is the system message of conversations started without a context,
+// so the model answers in the language of the user
+func languageHintMessage(locale discord.Locale) *openrouter.ChatCompletionMessage {
+	return &openrouter.ChatCompletionMessage{
+		Role:    "system",
+		Content: fmt.Sprintf(gptLanguageHint, i18n.LanguageName(locale)),
+	}
+}
+
+// modelAccessDenial checks whether the policy allows the user of the interaction to use the model with the command
+func modelAccessDenial(s session.Session, i *discord.Interaction, policy *access.Policy, command string, model string) *access.Denial {
+	denial := policy.Check(access.InteractionRequest(s, i, command, model))
+	if denial != nil {
+		log.Printf("[GID: %s, i.ID: %s] Access denied: %v\n", i.GuildID, i.ID, denial)
+	}
+	return denial
+}
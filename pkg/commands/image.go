@@ -1,22 +1,34 @@
 package commands
 
 import (
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/access"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/commands/dalle"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/moderation"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
 	discord "github.com/bwmarrin/discordgo"
 )
 
 const imageCommandName = "image"
 
-func ImageCommand(client *openrouter.Client, imageModel string) *bot.Command {
+type ImageCommandParams struct {
+	ImageClient        openrouter.ImageGenerationClient
+	ImageModel         string
+	ModerationPolicies *moderation.PolicySet
+	ModerationAuditor  moderation.Auditor
+	AccessPolicy       *access.Policy
+}
+
+func ImageCommand(params *ImageCommandParams) *bot.Command {
 	return &bot.Command{
 		Name:                     imageCommandName,
 		Description:              "Generate creative images from textual description",
-		DMPermission:             false,
+		DMPermission:             true,
 		DefaultMemberPermissions: discord.PermissionViewChannel,
+		// Whether the bot talks in direct messages can be toggled at runtime
+		Middlewares: []bot.Handler{access.DirectMessagesMiddleware(params.AccessPolicy)},
 		SubCommands: bot.NewRouter([]*bot.Command{
-			dalle.Command(client, imageModel),
+			dalle.Command(params.ImageClient, params.ImageModel, params.ModerationPolicies, params.ModerationAuditor, params.AccessPolicy),
 		}),
 	}
 }
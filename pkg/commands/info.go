@@ -3,6 +3,7 @@ package commands
 import (
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
 	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/constants"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/i18n"
 	discord "github.com/bwmarrin/discordgo"
 )
 
@@ -21,7 +22,7 @@ func infoHandler(ctx *bot.Context) {
 				discord.ActionsRow{
 					Components: []discord.MessageComponent{
 						&discord.Button{
-							Label: "Source code",
+							Label: i18n.Text(ctx.Locale(), "info.source_code"),
 							Style: discord.LinkButton,
 							URL:   "https://github.com/RajaPremSai/go-openai-dicord-bot",
 						},
@@ -30,8 +31,8 @@ func infoHandler(ctx *bot.Context) {
 			},
 			Embeds: []*discord.MessageEmbed{
 				{
-					Title:       "Bot Version",
-					Description: "Version: " + constants.Version,
+					Title:       i18n.Text(ctx.Locale(), "info.title"),
+					Description: i18n.Text(ctx.Locale(), "info.version", constants.Version),
 					Color:       0x00bfff,
 				},
 			},
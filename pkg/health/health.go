@@ -0,0 +1,281 @@
+// Package health serves the liveness, readiness and status of the bot over HTTP, e.g. for Docker and Kubernetes probes
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/constants"
+)
+
+const (
+	// AddressEnv names the environment variable overriding the configured address, set by the Docker image for its health check
+	AddressEnv = "HEALTH_ADDRESS"
+	// DefaultPingInterval is how long the result of pinging OpenRouter is reused when no interval is configured
+	DefaultPingInterval = time.Minute
+	// pingTimeout keeps a slow OpenRouter from holding up the probes
+	pingTimeout = 5 * time.Second
+	// shutdownTimeout is how long the server waits for running probes when it is closed
+	shutdownTimeout = 5 * time.Second
+)
+
+// Config enables the health server
+type Config struct {
+	// Address the server listens on, e.g. ":8081". Empty disables the server
+	Address string `yaml:"address"`
+	// PingInterval is how long the result of pinging OpenRouter is reused by /readyz, DefaultPingInterval if zero
+	PingInterval time.Duration `yaml:"pingInterval"`
+}
+
+func (c Config) Validate() error {
+	if c.PingInterval < 0 {
+		return fmt.Errorf("health ping interval must not be negative")
+	}
+	return nil
+}
+
+// Gateway is the Discord side of the bot, implemented by *bot.Bot
+type Gateway interface {
+	ShardStatuses() []bot.ShardStatus
+	CommandsSynced() bool
+	ShuttingDown() bool
+}
+
+// OpenRouter is the API the bot answers with, implemented by *openrouter.Client
+type OpenRouter interface {
+	Ping(ctx context.Context) error
+	LastError() (time.Time, error)
+}
+
+// Options are the parts of the bot the server reports on
+type Options struct {
+	Gateway Gateway
+	// OpenRouter is nil when no API key is configured, the bot is then ready without it
+	OpenRouter OpenRouter
+	// Caches return the number of entries of the caches of the bot by name, e.g. "conversations"
+	Caches       map[string]func() int
+	PingInterval time.Duration
+}
+
+// Server answers /healthz, /readyz and /status
+type Server struct {
+	options  Options
+	started  time.Time
+	handler  http.Handler
+	server   *http.Server
+	listener net.Listener
+
+	// pingMu is held while OpenRouter is pinged, so concurrent probes share one ping
+	pingMu   sync.Mutex
+	pingErr  error
+	pingTime time.Time
+}
+
+func NewServer(options Options) *Server {
+	if options.PingInterval <= 0 {
+		options.PingInterval = DefaultPingInterval
+	}
+	s := &Server{
+		options: options,
+		started: time.Now(),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.serveHealth)
+	mux.HandleFunc("GET /readyz", s.serveReady)
+	mux.HandleFunc("GET /status", s.serveStatus)
+	s.handler = mux
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// Start listens on the address and serves the probes in the background
+func (s *Server) Start(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+	s.listener = listener
+	s.server = &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Health server stopped with the error: %v", err)
+		}
+	}()
+	log.Printf("Health server listening on %s", listener.Addr())
+	return nil
+}
+
+// Close stops the server, waiting a few seconds for running probes
+func (s *Server) Close() error {
+	if s.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// serveHealth tells the process is alive, it answers as long as the server runs
+func (s *Server) serveHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// Readiness is the result of /readyz. Checks map every check to "ok" or the reason it failed
+type Readiness struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+func (s *Server) serveReady(w http.ResponseWriter, r *http.Request) {
+	readiness := s.Readiness()
+	status := http.StatusOK
+	if !readiness.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, readiness)
+}
+
+// Readiness checks that every shard is connected, the commands are synced and OpenRouter is reachable
+func (s *Server) Readiness() Readiness {
+	checks := map[string]error{
+		"gateway":  s.checkGateway(),
+		"commands": s.checkCommands(),
+	}
+	if s.options.OpenRouter != nil {
+		checks["openrouter"] = s.pingOpenRouter()
+	}
+
+	readiness := Readiness{Ready: true, Checks: make(map[string]string, len(checks))}
+	for name, err := range checks {
+		if err != nil {
+			readiness.Ready = false
+			readiness.Checks[name] = err.Error()
+		} else {
+			readiness.Checks[name] = "ok"
+		}
+	}
+	return readiness
+}
+
+func (s *Server) checkGateway() error {
+	if s.options.Gateway.ShuttingDown() {
+		return bot.ErrShuttingDown
+	}
+	shards := s.options.Gateway.ShardStatuses()
+	if len(shards) == 0 {
+		return fmt.Errorf("no shard is open")
+	}
+	for _, shard := range shards {
+		if shard.State != bot.ShardReady {
+			return fmt.Errorf("shard %d/%d is %s", shard.ID, shard.Count, shard.State)
+		}
+	}
+	return nil
+}
+
+func (s *Server) checkCommands() error {
+	if !s.options.Gateway.CommandsSynced() {
+		return fmt.Errorf("commands are not synced")
+	}
+	return nil
+}
+
+// pingOpenRouter returns the result of the last ping while it is younger than the ping interval
+func (s *Server) pingOpenRouter() error {
+	s.pingMu.Lock()
+	defer s.pingMu.Unlock()
+	if !s.pingTime.IsZero() && time.Since(s.pingTime) < s.options.PingInterval {
+		return s.pingErr
+	}
+
+	// The probe may give up early, the result is cached for the next one anyway
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	s.pingErr = s.options.OpenRouter.Ping(ctx)
+	s.pingTime = time.Now()
+	return s.pingErr
+}
+
+// Status is the result of /status
+type Status struct {
+	Version        string    `json:"version"`
+	Started        time.Time `json:"started"`
+	Uptime         string    `json:"uptime"`
+	UptimeSeconds  int64     `json:"uptime_seconds"`
+	CommandsSynced bool      `json:"commands_synced"`
+	ShuttingDown   bool      `json:"shutting_down"`
+	// ShardCount is the number of shards this process runs, Guilds the number of guilds they receive events of
+	ShardCount int               `json:"shard_count"`
+	Guilds     int               `json:"guilds"`
+	Shards     []bot.ShardStatus `json:"shards"`
+	Caches     map[string]int    `json:"caches"`
+	// OpenRouter is nil when no API key is configured
+	OpenRouter *OpenRouterStatus `json:"openrouter,omitempty"`
+}
+
+// OpenRouterStatus reports the last failed request to OpenRouter
+type OpenRouterStatus struct {
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+}
+
+func (s *Server) serveStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Status())
+}
+
+// Status reports the uptime, version, shards, cache sizes and last OpenRouter error of the bot
+func (s *Server) Status() Status {
+	uptime := time.Since(s.started)
+	status := Status{
+		Version:        constants.Version,
+		Started:        s.started,
+		Uptime:         uptime.Round(time.Second).String(),
+		UptimeSeconds:  int64(uptime.Seconds()),
+		CommandsSynced: s.options.Gateway.CommandsSynced(),
+		ShuttingDown:   s.options.Gateway.ShuttingDown(),
+		Shards:         s.options.Gateway.ShardStatuses(),
+		Caches:         make(map[string]int, len(s.options.Caches)),
+	}
+	status.ShardCount = len(status.Shards)
+	for _, shard := range status.Shards {
+		status.Guilds += shard.Guilds
+	}
+
+	for name, size := range s.options.Caches {
+		status.Caches[name] = size()
+	}
+
+	if s.options.OpenRouter != nil {
+		status.OpenRouter = &OpenRouterStatus{}
+		if failedAt, err := s.options.OpenRouter.LastError(); err != nil {
+			status.OpenRouter.LastError = err.Error()
+			status.OpenRouter.LastErrorTime = &failedAt
+		}
+	}
+	return status
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		log.Printf("Failed to write health response: %v", err)
+	}
+}
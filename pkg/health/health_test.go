@@ -0,0 +1,247 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/bot"
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/constants"
+)
+
+type fakeGateway struct {
+	shards       []bot.ShardStatus
+	synced       bool
+	shuttingDown bool
+}
+
+func (g *fakeGateway) ShardStatuses() []bot.ShardStatus { return g.shards }
+func (g *fakeGateway) CommandsSynced() bool             { return g.synced }
+func (g *fakeGateway) ShuttingDown() bool               { return g.shuttingDown }
+
+type fakeOpenRouter struct {
+	pings         atomic.Int32
+	pingErr       error
+	lastError     error
+	lastErrorTime time.Time
+}
+
+func (o *fakeOpenRouter) Ping(ctx context.Context) error {
+	o.pings.Add(1)
+	return o.pingErr
+}
+
+func (o *fakeOpenRouter) LastError() (time.Time, error) {
+	return o.lastErrorTime, o.lastError
+}
+
+func readyGateway() *fakeGateway {
+	return &fakeGateway{
+		shards: []bot.ShardStatus{
+			{ID: 0, Count: 2, State: bot.ShardReady, Guilds: 3},
+			{ID: 1, Count: 2, State: bot.ShardReady, Guilds: 4},
+		},
+		synced: true,
+	}
+}
+
+func get(t *testing.T, server *Server, path string, value any) *httptest.ResponseRecorder {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	if value != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), value); err != nil {
+			t.Fatalf("Failed to decode %s response %q: %v", path, recorder.Body.String(), err)
+		}
+	}
+	return recorder
+}
+
+func TestServer_Healthz(t *testing.T) {
+	// The process is alive even though no shard is connected
+	server := NewServer(Options{Gateway: &fakeGateway{}})
+
+	recorder := get(t, server, "/healthz", nil)
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "ok\n" {
+		t.Errorf("Expected 200 ok, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/healthz", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected POST to be rejected, got %d", recorder.Code)
+	}
+}
+
+func TestServer_Readyz(t *testing.T) {
+	tests := []struct {
+		name       string
+		gateway    func(g *fakeGateway)
+		pingErr    error
+		wantReady  bool
+		wantChecks map[string]string
+	}{
+		{
+			name:       "ready",
+			wantReady:  true,
+			wantChecks: map[string]string{"gateway": "ok", "commands": "ok", "openrouter": "ok"},
+		},
+		{
+			name:       "no shards",
+			gateway:    func(g *fakeGateway) { g.shards = nil },
+			wantChecks: map[string]string{"gateway": "no shard is open", "commands": "ok", "openrouter": "ok"},
+		},
+		{
+			name:       "shard disconnected",
+			gateway:    func(g *fakeGateway) { g.shards[1].State = bot.ShardDisconnected },
+			wantChecks: map[string]string{"gateway": "shard 1/2 is disconnected", "commands": "ok", "openrouter": "ok"},
+		},
+		{
+			name:       "shutting down",
+			gateway:    func(g *fakeGateway) { g.shuttingDown = true },
+			wantChecks: map[string]string{"gateway": bot.ErrShuttingDown.Error(), "commands": "ok", "openrouter": "ok"},
+		},
+		{
+			name:       "commands not synced",
+			gateway:    func(g *fakeGateway) { g.synced = false },
+			wantChecks: map[string]string{"gateway": "ok", "commands": "commands are not synced", "openrouter": "ok"},
+		},
+		{
+			name:       "openrouter unreachable",
+			pingErr:    errors.New("request failed: connection refused"),
+			wantChecks: map[string]string{"gateway": "ok", "commands": "ok", "openrouter": "request failed: connection refused"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway := readyGateway()
+			if tt.gateway != nil {
+				tt.gateway(gateway)
+			}
+			server := NewServer(Options{Gateway: gateway, OpenRouter: &fakeOpenRouter{pingErr: tt.pingErr}})
+
+			var readiness Readiness
+			recorder := get(t, server, "/readyz", &readiness)
+			wantCode := http.StatusServiceUnavailable
+			if tt.wantReady {
+				wantCode = http.StatusOK
+			}
+			if recorder.Code != wantCode {
+				t.Errorf("Expected status %d, got %d", wantCode, recorder.Code)
+			}
+			if readiness.Ready != tt.wantReady {
+				t.Errorf("Expected ready %t, got %t", tt.wantReady, readiness.Ready)
+			}
+			for name, want := range tt.wantChecks {
+				if readiness.Checks[name] != want {
+					t.Errorf("Expected check %s to be %q, got %q", name, want, readiness.Checks[name])
+				}
+			}
+		})
+	}
+}
+
+func TestServer_ReadyzWithoutOpenRouter(t *testing.T) {
+	server := NewServer(Options{Gateway: readyGateway()})
+
+	var readiness Readiness
+	if recorder := get(t, server, "/readyz", &readiness); recorder.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", recorder.Code)
+	}
+	if _, ok := readiness.Checks["openrouter"]; ok {
+		t.Errorf("Expected no openrouter check, got %v", readiness.Checks)
+	}
+}
+
+func TestServer_ReadyzCachesPing(t *testing.T) {
+	openRouter := &fakeOpenRouter{}
+	server := NewServer(Options{Gateway: readyGateway(), OpenRouter: openRouter, PingInterval: time.Hour})
+
+	for range 3 {
+		get(t, server, "/readyz", nil)
+	}
+	if pings := openRouter.pings.Load(); pings != 1 {
+		t.Errorf("Expected 1 ping within the interval, got %d", pings)
+	}
+
+	// An expired result is refreshed by the next probe
+	server.pingTime = time.Now().Add(-2 * time.Hour)
+	openRouter.pingErr = errors.New("HTTP 502")
+	var readiness Readiness
+	get(t, server, "/readyz", &readiness)
+	if pings := openRouter.pings.Load(); pings != 2 {
+		t.Errorf("Expected 2 pings after the interval, got %d", pings)
+	}
+	if readiness.Ready || readiness.Checks["openrouter"] != "HTTP 502" {
+		t.Errorf("Expected the new ping error, got %+v", readiness)
+	}
+}
+
+func TestServer_Status(t *testing.T) {
+	failedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	server := NewServer(Options{
+		Gateway: readyGateway(),
+		OpenRouter: &fakeOpenRouter{
+			lastError:     errors.New("HTTP 429: rate limited"),
+			lastErrorTime: failedAt,
+		},
+		Caches: map[string]func() int{
+			"conversations":    func() int { return 12 },
+			"ignored_channels": func() int { return 5 },
+		},
+	})
+	server.started = time.Now().Add(-90 * time.Minute)
+
+	var status Status
+	if recorder := get(t, server, "/status", &status); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", recorder.Code)
+	}
+	if status.Version != constants.Version {
+		t.Errorf("Expected version %s, got %s", constants.Version, status.Version)
+	}
+	if status.Uptime != "1h30m0s" || status.UptimeSeconds != 5400 {
+		t.Errorf("Expected uptime 1h30m0s (5400s), got %s (%ds)", status.Uptime, status.UptimeSeconds)
+	}
+	if status.ShardCount != 2 || status.Guilds != 7 || len(status.Shards) != 2 {
+		t.Errorf("Expected 2 shards with 7 guilds, got %d shards with %d guilds", status.ShardCount, status.Guilds)
+	}
+	if !status.CommandsSynced || status.ShuttingDown {
+		t.Errorf("Expected synced commands and no shutdown, got %+v", status)
+	}
+	if status.Caches["conversations"] != 12 || status.Caches["ignored_channels"] != 5 {
+		t.Errorf("Unexpected cache sizes %v", status.Caches)
+	}
+	if status.OpenRouter == nil || status.OpenRouter.LastError != "HTTP 429: rate limited" ||
+		status.OpenRouter.LastErrorTime == nil || !status.OpenRouter.LastErrorTime.Equal(failedAt) {
+		t.Errorf("Expected the last OpenRouter error, got %+v", status.OpenRouter)
+	}
+}
+
+func TestServer_Start(t *testing.T) {
+	server := NewServer(Options{Gateway: readyGateway()})
+	if err := server.Start("127.0.0.1:0"); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	resp, err := http.Get("http://" + server.listener.Addr().String() + "/healthz")
+	if err != nil {
+		t.Fatalf("GET /healthz error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	if err := server.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if _, err := http.Get("http://" + server.listener.Addr().String() + "/healthz"); err == nil {
+		t.Error("Expected the closed server to refuse requests")
+	}
+}
@@ -0,0 +1,187 @@
+// Package i18n holds the message catalog of the bot. Responses are looked up by key in the
+// language of the user, and command names and descriptions are localized when they are synced
+package i18n
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	discord "github.com/bwmarrin/discordgo"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultLocale is the language of the built-in texts, used when a text has no translation
+const DefaultLocale = discord.EnglishUS
+
+//go:embed locales/*.yaml
+var builtin embed.FS
+
+// Config adds catalog files to the built-in translations
+type Config struct {
+	// Directory holds catalog files named after their locale, e.g. "de.yaml" or "pt-BR.yaml".
+	// Their texts override the built-in ones, so single texts can be changed
+	Directory string `yaml:"directory"`
+	// DisableLanguageHint stops telling the model to answer in the language of the user
+	DisableLanguageHint bool `yaml:"disableLanguageHint"`
+}
+
+// Catalog holds the texts of every locale by key
+type Catalog struct {
+	mu       sync.RWMutex
+	messages map[discord.Locale]map[string]string
+}
+
+func NewCatalog() *Catalog {
+	return &Catalog{messages: make(map[discord.Locale]map[string]string)}
+}
+
+// Add adds the texts of the locale, replacing texts with the same key
+func (c *Catalog) Add(locale discord.Locale, messages map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.messages[locale] == nil {
+		c.messages[locale] = make(map[string]string, len(messages))
+	}
+	for key, text := range messages {
+		c.messages[locale][key] = text
+	}
+}
+
+// LoadFS adds the catalog files of dir in fsys. The files are YAML maps of keys to texts
+func (c *Catalog) LoadFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return fmt.Errorf("failed to read catalog directory: %w", err)
+	}
+	for _, entry := range entries {
+		ext := path.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		locale := discord.Locale(strings.TrimSuffix(entry.Name(), ext))
+		if _, ok := discord.Locales[locale]; !ok {
+			return fmt.Errorf("unknown locale '%s' of catalog file %s", locale, entry.Name())
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read catalog file %s: %w", entry.Name(), err)
+		}
+		var messages map[string]string
+		if err := yaml.Unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("failed to parse catalog file %s: %w", entry.Name(), err)
+		}
+		c.Add(locale, messages)
+	}
+	return nil
+}
+
+// Text returns the text of the key in the locale, formatted with args. Locales without the text
+// fall back to another variant of their language, then to the default locale and then to the key
+func (c *Catalog) Text(locale discord.Locale, key string, args ...any) string {
+	c.mu.RLock()
+	text, ok := c.lookup(locale, key)
+	c.mu.RUnlock()
+	if !ok {
+		return key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+func (c *Catalog) lookup(locale discord.Locale, key string) (string, bool) {
+	if text, ok := c.messages[locale][key]; ok {
+		return text, true
+	}
+	// Variants are tried in a fixed order, so the fallback does not change between calls
+	language := languageOf(locale)
+	variants := make([]discord.Locale, 0, len(c.messages))
+	for variant := range c.messages {
+		if variant != locale && languageOf(variant) == language {
+			variants = append(variants, variant)
+		}
+	}
+	slices.Sort(variants)
+	for _, variant := range variants {
+		if text, ok := c.messages[variant][key]; ok {
+			return text, true
+		}
+	}
+	text, ok := c.messages[DefaultLocale][key]
+	return text, ok
+}
+
+// Localizations returns the translations of the key for every Discord locale that has one,
+// or nil if there are none. The default locale is left out, as its text is the default of Discord
+func (c *Catalog) Localizations(key string) map[discord.Locale]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	defaultText := c.messages[DefaultLocale][key]
+	var localizations map[discord.Locale]string
+	for locale := range discord.Locales {
+		if locale == DefaultLocale {
+			continue
+		}
+		text, ok := c.lookup(locale, key)
+		if !ok || text == defaultText {
+			continue
+		}
+		if localizations == nil {
+			localizations = make(map[discord.Locale]string)
+		}
+		localizations[locale] = text
+	}
+	return localizations
+}
+
+// languageOf returns the language of the locale without its region, e.g. "es" for "es-ES"
+func languageOf(locale discord.Locale) string {
+	language, _, _ := strings.Cut(string(locale), "-")
+	return language
+}
+
+var catalog = mustBuiltin()
+
+func mustBuiltin() *Catalog {
+	c := NewCatalog()
+	if err := c.LoadFS(builtin, "locales"); err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Load adds the catalog files of the configuration to the catalog of the bot.
+// It must be called before the bot starts handling interactions
+func Load(config Config) error {
+	if config.Directory == "" {
+		return nil
+	}
+	return catalog.LoadFS(os.DirFS(config.Directory), ".")
+}
+
+// Text returns the text of the key in the locale from the catalog of the bot
+func Text(locale discord.Locale, key string, args ...any) string {
+	return catalog.Text(locale, key, args...)
+}
+
+// Localizations returns the translations of the key from the catalog of the bot
+func Localizations(key string) map[discord.Locale]string {
+	return catalog.Localizations(key)
+}
+
+// LanguageName returns the English name of the language of the locale, e.g. "German"
+func LanguageName(locale discord.Locale) string {
+	if name, ok := discord.Locales[locale]; ok {
+		return name
+	}
+	return discord.Locales[DefaultLocale]
+}
@@ -0,0 +1,136 @@
+package i18n
+
+import (
+	"io/fs"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	discord "github.com/bwmarrin/discordgo"
+)
+
+func testCatalog() *Catalog {
+	c := NewCatalog()
+	c.Add(DefaultLocale, map[string]string{
+		"greeting": "Hello %s",
+		"farewell": "Goodbye",
+		"model":    "Model",
+	})
+	c.Add(discord.EnglishGB, map[string]string{"farewell": "Cheerio"})
+	c.Add(discord.SpanishES, map[string]string{"greeting": "Hola %s"})
+	c.Add(discord.German, map[string]string{"greeting": "Hallo %s", "model": "Model"})
+	return c
+}
+
+func TestCatalog_Text(t *testing.T) {
+	c := testCatalog()
+	tests := []struct {
+		locale   discord.Locale
+		key      string
+		expected string
+	}{
+		{discord.German, "greeting", "Hallo Ada"},
+		// Variants of the language are used before the default locale
+		{discord.SpanishLATAM, "greeting", "Hola Ada"},
+		{discord.EnglishUS, "farewell", "Goodbye"},
+		{discord.EnglishGB, "farewell", "Cheerio"},
+		{discord.German, "farewell", "Goodbye"},
+		{discord.Japanese, "greeting", "Hello Ada"},
+		{discord.German, "missing", "missing"},
+	}
+	for _, test := range tests {
+		var text string
+		if strings.Contains(test.expected, "Ada") {
+			text = c.Text(test.locale, test.key, "Ada")
+		} else {
+			text = c.Text(test.locale, test.key)
+		}
+		if text != test.expected {
+			t.Errorf("Expected %q for %s in %s, got %q", test.expected, test.key, test.locale, text)
+		}
+	}
+}
+
+func TestCatalog_Localizations(t *testing.T) {
+	c := testCatalog()
+	localizations := c.Localizations("greeting")
+	if localizations[discord.German] != "Hallo %s" || localizations[discord.SpanishES] != "Hola %s" || localizations[discord.SpanishLATAM] != "Hola %s" {
+		t.Errorf("Expected German and Spanish translations, got %v", localizations)
+	}
+	if _, ok := localizations[DefaultLocale]; ok {
+		t.Error("Expected the default locale to be left out")
+	}
+	if _, ok := localizations[discord.Japanese]; ok {
+		t.Error("Expected locales without a translation to be left out")
+	}
+	// A translation equal to the default text changes nothing
+	if localizations := c.Localizations("model"); localizations != nil {
+		t.Errorf("Expected no translations of model, got %v", localizations)
+	}
+}
+
+func TestCatalog_LoadFS(t *testing.T) {
+	c := testCatalog()
+	fsys := fstest.MapFS{
+		"locales/de.yaml":    {Data: []byte(`farewell: "Tschüss"`)},
+		"locales/README.md":  {Data: []byte("not a catalog")},
+		"locales/pt-BR.yaml": {Data: []byte(`greeting: "Olá %s"`)},
+	}
+	if err := c.LoadFS(fsys, "locales"); err != nil {
+		t.Fatalf("Expected catalog files to load, got %v", err)
+	}
+	if text := c.Text(discord.German, "farewell"); text != "Tschüss" {
+		t.Errorf("Expected the loaded text, got %q", text)
+	}
+	if text := c.Text(discord.German, "greeting", "Ada"); text != "Hallo Ada" {
+		t.Errorf("Expected the other texts of the locale to be kept, got %q", text)
+	}
+	if text := c.Text(discord.PortugueseBR, "greeting", "Ada"); text != "Olá Ada" {
+		t.Errorf("Expected the new locale, got %q", text)
+	}
+
+	err := c.LoadFS(fstest.MapFS{"locales/klingon.yaml": {Data: []byte(`greeting: "nuqneH"`)}}, "locales")
+	if err == nil || !strings.Contains(err.Error(), "unknown locale") {
+		t.Errorf("Expected an unknown locale error, got %v", err)
+	}
+	err = c.LoadFS(fstest.MapFS{"locales/fr.yaml": {Data: []byte(`greeting: [`)}}, "locales")
+	if err == nil {
+		t.Error("Expected invalid YAML to be reported")
+	}
+}
+
+var formatVerb = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+// TestBuiltin checks that translations use the keys and arguments of the English texts.
+// Command texts are taken from the command definitions, so they have no English entry
+func TestBuiltin(t *testing.T) {
+	entries, err := fs.ReadDir(builtin, "locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := catalog.messages[DefaultLocale]
+	if len(defaults) == 0 {
+		t.Fatal("Expected built-in English texts")
+	}
+	for _, entry := range entries {
+		locale := discord.Locale(strings.TrimSuffix(entry.Name(), ".yaml"))
+		for key, text := range catalog.messages[locale] {
+			if strings.HasPrefix(key, "command.") {
+				if len([]rune(text)) > 100 {
+					t.Errorf("%s: %s is longer than the 100 characters allowed by Discord", locale, key)
+				}
+				continue
+			}
+			defaultText, ok := defaults[key]
+			if !ok {
+				t.Errorf("%s: %s has no English text", locale, key)
+				continue
+			}
+			if !slices.Equal(formatVerb.FindAllString(text, -1), formatVerb.FindAllString(defaultText, -1)) {
+				t.Errorf("%s: %s formats %v, the English text %v", locale, key, formatVerb.FindAllString(text, -1), formatVerb.FindAllString(defaultText, -1))
+			}
+		}
+	}
+}
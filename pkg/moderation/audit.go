@@ -0,0 +1,41 @@
+package moderation
+
+import (
+	"time"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/utils"
+)
+
+// AuditRecord describes a blocked prompt
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Command   string    `json:"command"`
+	GuildID   string    `json:"guild_id"`
+	ChannelID string    `json:"channel_id"`
+	UserID    string    `json:"user_id"`
+	Prompt    string    `json:"prompt"`
+	Verdict   *Verdict  `json:"verdict"`
+}
+
+// Auditor records blocked prompts
+type Auditor interface {
+	Record(record AuditRecord) error
+}
+
+// FileAuditor appends audit records to a JSONL file
+type FileAuditor struct {
+	file *utils.JSONLFile
+}
+
+// NewFileAuditor creates an auditor appending to the file at path
+func NewFileAuditor(path string) *FileAuditor {
+	return &FileAuditor{file: utils.NewJSONLFile(path)}
+}
+
+// Record appends the record as a single JSON line
+func (a *FileAuditor) Record(record AuditRecord) error {
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	return a.file.Append(record)
+}
@@ -0,0 +1,76 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// BlocklistModeratorName is the name of the local blocklist moderator
+const BlocklistModeratorName = "blocklist"
+
+// BlocklistRule flags prompts containing a term or matching a regular expression
+type BlocklistRule struct {
+	// Pattern is a term matched as a whole word, case insensitive, or a regular expression if Regex is set
+	Pattern  string   `yaml:"pattern"`
+	Regex    bool     `yaml:"regex"`
+	Category string   `yaml:"category"`
+	Severity Severity `yaml:"severity"`
+}
+
+type compiledRule struct {
+	BlocklistRule
+	re *regexp.Regexp
+}
+
+// BlocklistModerator flags prompts using a local list of terms and regular expressions
+type BlocklistModerator struct {
+	rules []compiledRule
+}
+
+// NewBlocklistModerator compiles the rules into a moderator
+func NewBlocklistModerator(rules []BlocklistRule) (*BlocklistModerator, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("blocklist rule pattern is required")
+		}
+		expr := rule.Pattern
+		if !rule.Regex {
+			expr = `\b` + regexp.QuoteMeta(rule.Pattern) + `\b`
+		}
+		re, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blocklist pattern %q: %w", rule.Pattern, err)
+		}
+		if rule.Category == "" {
+			rule.Category = "blocklist"
+		}
+		if rule.Severity == SeverityNone {
+			rule.Severity = SeverityHigh
+		}
+		compiled = append(compiled, compiledRule{BlocklistRule: rule, re: re})
+	}
+	return &BlocklistModerator{rules: compiled}, nil
+}
+
+// Name returns the moderator name
+func (m *BlocklistModerator) Name() string {
+	return BlocklistModeratorName
+}
+
+// Moderate flags the prompt with the most severe matching rule
+func (m *BlocklistModerator) Moderate(ctx context.Context, prompt string) (*Verdict, error) {
+	verdict := &Verdict{Moderator: m.Name()}
+	for _, rule := range m.rules {
+		match := rule.re.FindString(prompt)
+		if match == "" || (verdict.Flagged && rule.Severity <= verdict.Severity) {
+			continue
+		}
+		verdict.Flagged = true
+		verdict.Category = rule.Category
+		verdict.Severity = rule.Severity
+		verdict.Reason = fmt.Sprintf("Prompt contains blocked term %q", match)
+	}
+	return verdict, nil
+}
@@ -0,0 +1,101 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
+)
+
+// LLMModeratorName is the name of the LLM-based moderator
+const LLMModeratorName = "llm"
+
+const llmModeratorSystemPrompt = `You are a content moderation classifier for an image generation service.
+Classify the user prompt and answer with a single JSON object and nothing else:
+{"flagged": bool, "category": string, "severity": "none"|"low"|"medium"|"high", "reason": string}
+Categories: sexual, minors, violence, gore, hate, harassment, self-harm, illegal, none.
+Flag prompts asking for sexual content, any sexualised depiction of minors, graphic violence or gore,
+hateful or harassing imagery, self-harm or illegal activity. Keep the reason under 150 characters.`
+
+// LLMModerator classifies prompts with a (cheap) chat completion model
+type LLMModerator struct {
+	client openrouter.ChatCompletionClient
+	model  string
+}
+
+// NewLLMModerator creates a moderator that asks model to classify prompts
+func NewLLMModerator(client openrouter.ChatCompletionClient, model string) *LLMModerator {
+	return &LLMModerator{
+		client: client,
+		model:  model,
+	}
+}
+
+// Name returns the moderator name
+func (m *LLMModerator) Name() string {
+	return LLMModeratorName
+}
+
+// llmVerdict is the structured answer expected from the model
+type llmVerdict struct {
+	Flagged  bool   `json:"flagged"`
+	Category string `json:"category"`
+	Severity string `json:"severity"`
+	Reason   string `json:"reason"`
+}
+
+// Moderate asks the model for a structured verdict on the prompt
+func (m *LLMModerator) Moderate(ctx context.Context, prompt string) (*Verdict, error) {
+	resp, err := m.client.CreateChatCompletion(ctx, openrouter.ChatCompletionRequest{
+		Model: m.model,
+		Messages: []openrouter.ChatCompletionMessage{
+			{Role: "system", Content: llmModeratorSystemPrompt},
+			{Role: "user", Content: prompt},
+		},
+		Temperature: openrouter.Float32Ptr(0),
+		MaxTokens:   openrouter.IntPtr(150),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("moderation request failed: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("moderation model returned no choices")
+	}
+	return parseLLMVerdict(resp.Choices[0].Message.Content)
+}
+
+// parseLLMVerdict extracts the JSON verdict from the model answer, which may be wrapped in text or code fences
+func parseLLMVerdict(content string) (*Verdict, error) {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start == -1 || end < start {
+		return nil, fmt.Errorf("moderation model answer is not JSON: %q", content)
+	}
+
+	var answer llmVerdict
+	if err := json.Unmarshal([]byte(content[start:end+1]), &answer); err != nil {
+		return nil, fmt.Errorf("failed to parse moderation verdict: %w", err)
+	}
+
+	severity, err := ParseSeverity(answer.Severity)
+	if err != nil {
+		// Unknown severities of flagged prompts are treated as the most severe
+		severity = SeverityHigh
+	}
+	if answer.Flagged && severity == SeverityNone {
+		severity = SeverityMedium
+	}
+	if !answer.Flagged {
+		severity = SeverityNone
+	}
+
+	return &Verdict{
+		Flagged:   answer.Flagged,
+		Category:  answer.Category,
+		Severity:  severity,
+		Reason:    answer.Reason,
+		Moderator: LLMModeratorName,
+	}, nil
+}
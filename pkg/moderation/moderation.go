@@ -0,0 +1,79 @@
+// Package moderation checks user prompts against content policies before they are
+// sent to AI models.
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Severity ranks how harmful a flagged prompt is
+type Severity int
+
+const (
+	SeverityNone Severity = iota
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+)
+
+// String returns the string representation of the severity
+func (s Severity) String() string {
+	switch s {
+	case SeverityNone:
+		return "none"
+	case SeverityLow:
+		return "low"
+	case SeverityMedium:
+		return "medium"
+	case SeverityHigh:
+		return "high"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// ParseSeverity parses a severity name, case insensitive
+func ParseSeverity(s string) (Severity, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "none", "":
+		return SeverityNone, nil
+	case "low":
+		return SeverityLow, nil
+	case "medium":
+		return SeverityMedium, nil
+	case "high":
+		return SeverityHigh, nil
+	}
+	return SeverityNone, fmt.Errorf("unknown severity %q, must be one of none, low, medium, high", s)
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (s *Severity) UnmarshalText(text []byte) error {
+	parsed, err := ParseSeverity(string(text))
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
+
+// Verdict is the result of a moderation check
+type Verdict struct {
+	Flagged   bool     `json:"flagged"`
+	Category  string   `json:"category,omitempty"`
+	Severity  Severity `json:"severity"`
+	Reason    string   `json:"reason,omitempty"`
+	Moderator string   `json:"moderator,omitempty"`
+}
+
+// Moderator decides whether a prompt violates a content policy
+type Moderator interface {
+	Name() string
+	Moderate(ctx context.Context, prompt string) (*Verdict, error)
+}
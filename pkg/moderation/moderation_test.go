@@ -0,0 +1,256 @@
+package moderation
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
+	"gopkg.in/yaml.v3"
+)
+
+// fakeCompletionClient answers every chat completion with a fixed content
+type fakeCompletionClient struct {
+	content string
+	err     error
+	calls   int
+}
+
+func (c *fakeCompletionClient) CreateChatCompletion(ctx context.Context, req openrouter.ChatCompletionRequest) (*openrouter.ChatCompletionResponse, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &openrouter.ChatCompletionResponse{
+		Choices: []openrouter.ChatCompletionChoice{
+			{Message: openrouter.ChatCompletionMessage{Role: "assistant", Content: c.content}},
+		},
+	}, nil
+}
+
+func TestParseSeverity(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Severity
+		wantErr bool
+	}{
+		{"", SeverityNone, false},
+		{"low", SeverityLow, false},
+		{"Medium", SeverityMedium, false},
+		{" HIGH ", SeverityHigh, false},
+		{"extreme", SeverityNone, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSeverity(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSeverity(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ParseSeverity(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestBlocklistModerator(t *testing.T) {
+	moderator, err := NewBlocklistModerator([]BlocklistRule{
+		{Pattern: "gore", Category: "violence", Severity: SeverityMedium},
+		{Pattern: `blood\s*bath`, Regex: true, Category: "violence", Severity: SeverityHigh},
+		{Pattern: "nsfw"},
+	})
+	if err != nil {
+		t.Fatalf("NewBlocklistModerator() error = %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		prompt       string
+		wantFlagged  bool
+		wantSeverity Severity
+		wantCategory string
+	}{
+		{"clean prompt", "A cat sitting on a sofa", false, SeverityNone, ""},
+		{"whole word only", "A gorilla in the jungle", false, SeverityNone, ""},
+		{"case insensitive term", "Lots of GORE please", true, SeverityMedium, "violence"},
+		{"regex rule", "A bloodbath in the arena", true, SeverityHigh, "violence"},
+		{"most severe rule wins", "gore and a blood bath", true, SeverityHigh, "violence"},
+		{"defaults", "something nsfw", true, SeverityHigh, "blocklist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict, err := moderator.Moderate(context.Background(), tt.prompt)
+			if err != nil {
+				t.Fatalf("Moderate() error = %v", err)
+			}
+			if verdict.Flagged != tt.wantFlagged {
+				t.Errorf("Flagged = %v, want %v", verdict.Flagged, tt.wantFlagged)
+			}
+			if verdict.Severity != tt.wantSeverity {
+				t.Errorf("Severity = %v, want %v", verdict.Severity, tt.wantSeverity)
+			}
+			if verdict.Category != tt.wantCategory {
+				t.Errorf("Category = %q, want %q", verdict.Category, tt.wantCategory)
+			}
+		})
+	}
+
+	if _, err := NewBlocklistModerator([]BlocklistRule{{Pattern: "(", Regex: true}}); err == nil {
+		t.Error("Expected error for invalid regular expression")
+	}
+}
+
+func TestLLMModerator(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		wantErr      bool
+		wantFlagged  bool
+		wantSeverity Severity
+	}{
+		{"clean", `{"flagged": false, "category": "none", "severity": "none", "reason": ""}`, false, false, SeverityNone},
+		{"flagged in code fence", "```json\n{\"flagged\": true, \"category\": \"gore\", \"severity\": \"high\", \"reason\": \"Graphic gore\"}\n```", false, true, SeverityHigh},
+		{"flagged without severity", `{"flagged": true, "category": "hate"}`, false, true, SeverityMedium},
+		{"not json", "I cannot help with that", true, false, SeverityNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moderator := NewLLMModerator(&fakeCompletionClient{content: tt.content}, "openai/gpt-3.5-turbo")
+			verdict, err := moderator.Moderate(context.Background(), "prompt")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Moderate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if verdict.Flagged != tt.wantFlagged {
+				t.Errorf("Flagged = %v, want %v", verdict.Flagged, tt.wantFlagged)
+			}
+			if verdict.Severity != tt.wantSeverity {
+				t.Errorf("Severity = %v, want %v", verdict.Severity, tt.wantSeverity)
+			}
+		})
+	}
+}
+
+func TestPolicySet(t *testing.T) {
+	var config Config
+	err := yaml.Unmarshal([]byte(`
+enabled: true
+minSeverity: medium
+blocklist:
+  - pattern: "gore"
+    severity: low
+  - pattern: "bloodbath"
+    severity: high
+llm:
+  enabled: true
+  model: "openai/gpt-3.5-turbo"
+guilds:
+  "strict":
+    minSeverity: low
+    moderators: ["blocklist"]
+  "off":
+    enabled: false
+`), &config)
+	if err != nil {
+		t.Fatalf("yaml.Unmarshal() error = %v", err)
+	}
+
+	client := &fakeCompletionClient{content: `{"flagged": false}`}
+	policies, err := NewPolicySet(config, client)
+	if err != nil {
+		t.Fatalf("NewPolicySet() error = %v", err)
+	}
+	ctx := context.Background()
+
+	// Low severity terms pass the default policy, but not the strict guild
+	verdict, err := policies.ForGuild("other").Check(ctx, "some gore")
+	if err != nil || verdict.Flagged {
+		t.Errorf("Expected default policy to allow low severity prompt, got %+v, %v", verdict, err)
+	}
+	if client.calls != 1 {
+		t.Errorf("Expected LLM moderator to run in the default policy, got %d calls", client.calls)
+	}
+	verdict, err = policies.ForGuild("strict").Check(ctx, "some gore")
+	if err != nil || !verdict.Flagged || verdict.Moderator != BlocklistModeratorName {
+		t.Errorf("Expected strict guild to block low severity prompt, got %+v, %v", verdict, err)
+	}
+	if client.calls != 1 {
+		t.Errorf("Expected LLM moderator to be skipped in the strict guild, got %d calls", client.calls)
+	}
+
+	// Disabled guilds let everything through
+	verdict, err = policies.ForGuild("off").Check(ctx, "bloodbath")
+	if err != nil || verdict.Flagged {
+		t.Errorf("Expected disabled guild to allow prompt, got %+v, %v", verdict, err)
+	}
+
+	// Unknown moderators are rejected
+	config.Guilds["broken"] = GuildConfig{Moderators: []string{"unknown"}}
+	if _, err := NewPolicySet(config, client); err == nil {
+		t.Error("Expected error for unknown moderator")
+	}
+}
+
+func TestPolicy_FailClosed(t *testing.T) {
+	failing := NewLLMModerator(&fakeCompletionClient{err: errors.New("boom")}, "openai/gpt-3.5-turbo")
+
+	open := &Policy{Enabled: true, MinSeverity: SeverityLow, Moderators: []Moderator{failing}}
+	if verdict, err := open.Check(context.Background(), "prompt"); err != nil || verdict.Flagged {
+		t.Errorf("Expected fail-open policy to allow prompt, got %+v, %v", verdict, err)
+	}
+
+	closed := &Policy{Enabled: true, MinSeverity: SeverityLow, FailClosed: true, Moderators: []Moderator{failing}}
+	if _, err := closed.Check(context.Background(), "prompt"); err == nil {
+		t.Error("Expected fail-closed policy to return an error")
+	}
+}
+
+func TestFileAuditor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditor := NewFileAuditor(path)
+
+	for _, prompt := range []string{"first", "second"} {
+		err := auditor.Record(AuditRecord{
+			GuildID: "guild",
+			UserID:  "user",
+			Prompt:  prompt,
+			Verdict: &Verdict{Flagged: true, Category: "gore", Severity: SeverityHigh},
+		})
+		if err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit file: %v", err)
+	}
+	defer f.Close()
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Failed to parse audit line: %v", err)
+		}
+		records = append(records, record)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 audit records, got %d", len(records))
+	}
+	if records[1].Prompt != "second" || records[1].Verdict.Severity != SeverityHigh {
+		t.Errorf("Unexpected audit record: %+v", records[1])
+	}
+	if records[0].Time.IsZero() {
+		t.Error("Expected audit record time to be set")
+	}
+}
@@ -0,0 +1,151 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/openrouter"
+)
+
+// Config is the moderation section of the bot configuration
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// MinSeverity is the lowest severity that blocks a prompt
+	MinSeverity Severity `yaml:"minSeverity"`
+	// FailClosed blocks prompts when a moderator fails instead of letting them through
+	FailClosed bool            `yaml:"failClosed"`
+	Blocklist  []BlocklistRule `yaml:"blocklist"`
+	LLM        struct {
+		Enabled bool   `yaml:"enabled"`
+		Model   string `yaml:"model"`
+	} `yaml:"llm"`
+	// AuditFile is the JSONL file blocked prompts are appended to
+	AuditFile string `yaml:"auditFile"`
+	// Guilds overrides the default policy per guild ID
+	Guilds map[string]GuildConfig `yaml:"guilds"`
+}
+
+// GuildConfig overrides the default moderation policy for a guild.
+// Unset fields inherit the default policy
+type GuildConfig struct {
+	Enabled     *bool     `yaml:"enabled"`
+	MinSeverity *Severity `yaml:"minSeverity"`
+	FailClosed  *bool     `yaml:"failClosed"`
+	// Moderators is the list of moderator names to run, e.g. ["blocklist"]
+	Moderators []string `yaml:"moderators"`
+}
+
+// Policy runs a chain of moderators and blocks prompts at or above MinSeverity
+type Policy struct {
+	Enabled     bool
+	MinSeverity Severity
+	FailClosed  bool
+	Moderators  []Moderator
+}
+
+// Check runs the moderators in order and returns the first blocking verdict.
+// The returned verdict is not flagged if no moderator blocked the prompt
+func (p *Policy) Check(ctx context.Context, prompt string) (*Verdict, error) {
+	if p == nil || !p.Enabled {
+		return &Verdict{}, nil
+	}
+	for _, moderator := range p.Moderators {
+		verdict, err := moderator.Moderate(ctx, prompt)
+		if err != nil {
+			if p.FailClosed {
+				return nil, fmt.Errorf("%s moderator failed: %w", moderator.Name(), err)
+			}
+			continue
+		}
+		if verdict.Flagged && verdict.Severity >= p.MinSeverity {
+			verdict.Moderator = moderator.Name()
+			return verdict, nil
+		}
+	}
+	return &Verdict{}, nil
+}
+
+// PolicySet holds the default policy and per-guild overrides
+type PolicySet struct {
+	Default *Policy
+	Guilds  map[string]*Policy
+}
+
+// ForGuild returns the policy applied in the guild
+func (s *PolicySet) ForGuild(guildID string) *Policy {
+	if s == nil {
+		return nil
+	}
+	if policy, ok := s.Guilds[guildID]; ok {
+		return policy
+	}
+	return s.Default
+}
+
+// NewPolicySet builds the moderators and policies described by config.
+// client is used by the LLM moderator and may be nil if it is disabled
+func NewPolicySet(config Config, client openrouter.ChatCompletionClient) (*PolicySet, error) {
+	available := make(map[string]Moderator)
+	var defaults []Moderator
+
+	if len(config.Blocklist) > 0 {
+		blocklist, err := NewBlocklistModerator(config.Blocklist)
+		if err != nil {
+			return nil, err
+		}
+		available[blocklist.Name()] = blocklist
+		defaults = append(defaults, blocklist)
+	}
+	if config.LLM.Enabled {
+		if client == nil {
+			return nil, fmt.Errorf("llm moderator requires a completion client")
+		}
+		if config.LLM.Model == "" {
+			return nil, fmt.Errorf("llm moderator model is required")
+		}
+		llm := NewLLMModerator(client, config.LLM.Model)
+		available[llm.Name()] = llm
+		defaults = append(defaults, llm)
+	}
+
+	minSeverity := config.MinSeverity
+	if minSeverity == SeverityNone {
+		minSeverity = SeverityMedium
+	}
+
+	set := &PolicySet{
+		Default: &Policy{
+			Enabled:     config.Enabled,
+			MinSeverity: minSeverity,
+			FailClosed:  config.FailClosed,
+			Moderators:  defaults,
+		},
+		Guilds: make(map[string]*Policy, len(config.Guilds)),
+	}
+
+	for guildID, guild := range config.Guilds {
+		policy := *set.Default
+		if guild.Enabled != nil {
+			policy.Enabled = *guild.Enabled
+		}
+		if guild.MinSeverity != nil {
+			policy.MinSeverity = *guild.MinSeverity
+		}
+		if guild.FailClosed != nil {
+			policy.FailClosed = *guild.FailClosed
+		}
+		if guild.Moderators != nil {
+			policy.Moderators = make([]Moderator, 0, len(guild.Moderators))
+			for _, name := range guild.Moderators {
+				moderator, ok := available[name]
+				if !ok {
+					return nil, fmt.Errorf("guild %s: moderator %q is not configured", guildID, name)
+				}
+				policy.Moderators = append(policy.Moderators, moderator)
+			}
+		}
+		set.Guilds[guildID] = &policy
+	}
+
+	return set, nil
+}
@@ -0,0 +1,115 @@
+package openrouter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Backend describes an LLM server that handles every model whose name starts with Prefix.
+// Any server that speaks the OpenAI-compatible API (OpenRouter, Ollama, llama.cpp, vLLM...)
+// can be used as a backend.
+type Backend struct {
+	// Name is a human readable backend name used in logs
+	Name string
+	// Prefix selects the models routed to this backend, e.g. "local/"
+	Prefix string
+	// StripPrefix removes Prefix from the model name before the request is sent,
+	// e.g. "local/llama3" is sent to the backend as "llama3"
+	StripPrefix bool
+	// Client performs the requests
+	Client OpenRouterClient
+}
+
+// BackendRegistry routes requests to a backend based on the model prefix.
+// Models that do not match any registered prefix are sent to the fallback client.
+type BackendRegistry struct {
+	backends []*Backend
+	fallback OpenRouterClient
+}
+
+// NewBackendRegistry creates a registry that sends unmatched models to fallback
+func NewBackendRegistry(fallback OpenRouterClient) *BackendRegistry {
+	return &BackendRegistry{
+		fallback: fallback,
+	}
+}
+
+// Register adds a backend to the registry. When several prefixes match a model,
+// the longest one wins
+func (r *BackendRegistry) Register(backend *Backend) error {
+	if backend == nil || backend.Client == nil {
+		return fmt.Errorf("backend client is required")
+	}
+	if backend.Prefix == "" {
+		return fmt.Errorf("backend %q: prefix is required", backend.Name)
+	}
+	for _, registered := range r.backends {
+		if registered.Prefix == backend.Prefix {
+			return fmt.Errorf("backend %q: prefix %q is already registered by backend %q", backend.Name, backend.Prefix, registered.Name)
+		}
+	}
+	r.backends = append(r.backends, backend)
+	return nil
+}
+
+// Backends returns the registered backends
+func (r *BackendRegistry) Backends() []*Backend {
+	return r.backends
+}
+
+// Resolve returns the backend for the model, or nil if the fallback client handles it
+func (r *BackendRegistry) Resolve(model string) *Backend {
+	var match *Backend
+	for _, backend := range r.backends {
+		if strings.HasPrefix(model, backend.Prefix) && (match == nil || len(backend.Prefix) > len(match.Prefix)) {
+			match = backend
+		}
+	}
+	return match
+}
+
+// route returns the client and the model name that should be sent to it
+func (r *BackendRegistry) route(model string) (OpenRouterClient, string, error) {
+	backend := r.Resolve(model)
+	if backend == nil {
+		if r.fallback == nil {
+			return nil, "", fmt.Errorf("no backend registered for model %q", model)
+		}
+		return r.fallback, model, nil
+	}
+	if backend.StripPrefix {
+		model = strings.TrimPrefix(model, backend.Prefix)
+	}
+	return backend.Client, model, nil
+}
+
+// CreateChatCompletion sends the request to the backend responsible for req.Model
+func (r *BackendRegistry) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	client, model, err := r.route(req.Model)
+	if err != nil {
+		return nil, err
+	}
+	req.Model = model
+	return client.CreateChatCompletion(ctx, req)
+}
+
+// CreateChatCompletionStream streams the request from the backend responsible for req.Model
+func (r *BackendRegistry) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest, onDelta func(delta string)) (*ChatCompletionResponse, error) {
+	client, model, err := r.route(req.Model)
+	if err != nil {
+		return nil, err
+	}
+	req.Model = model
+	return StreamChatCompletion(ctx, client, req, onDelta)
+}
+
+// CreateImage sends the request to the backend responsible for req.Model
+func (r *BackendRegistry) CreateImage(ctx context.Context, req ImageRequest) (*ImageResponse, error) {
+	client, model, err := r.route(req.Model)
+	if err != nil {
+		return nil, err
+	}
+	req.Model = model
+	return client.CreateImage(ctx, req)
+}
@@ -0,0 +1,148 @@
+package openrouter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// recordingClient remembers the model of the last request it received
+type recordingClient struct {
+	name  string
+	model string
+}
+
+func (c *recordingClient) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	c.model = req.Model
+	return &ChatCompletionResponse{Model: c.name}, nil
+}
+
+func (c *recordingClient) CreateImage(ctx context.Context, req ImageRequest) (*ImageResponse, error) {
+	c.model = req.Model
+	return &ImageResponse{}, nil
+}
+
+func TestBackendRegistry_Routing(t *testing.T) {
+	fallback := &recordingClient{name: "openrouter"}
+	local := &recordingClient{name: "local"}
+	localCoder := &recordingClient{name: "local-coder"}
+	explicit := &recordingClient{name: "explicit"}
+
+	registry := NewBackendRegistry(fallback)
+	for _, backend := range []*Backend{
+		{Name: "local", Prefix: "local/", StripPrefix: true, Client: local},
+		{Name: "local-coder", Prefix: "local/coder-", StripPrefix: true, Client: localCoder},
+		{Name: "explicit", Prefix: "openrouter/", Client: explicit},
+	} {
+		if err := registry.Register(backend); err != nil {
+			t.Fatalf("Register() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		model     string
+		wantName  string
+		wantModel string
+	}{
+		{"unmatched model goes to fallback", "openai/gpt-4", "openrouter", "openai/gpt-4"},
+		{"prefix is stripped", "local/llama3", "local", "llama3"},
+		{"longest prefix wins", "local/coder-7b", "local-coder", "7b"},
+		{"prefix is kept", "openrouter/auto", "explicit", "openrouter/auto"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := registry.CreateChatCompletion(context.Background(), ChatCompletionRequest{
+				Model:    tt.model,
+				Messages: []ChatCompletionMessage{{Role: "user", Content: "Hello"}},
+			})
+			if err != nil {
+				t.Fatalf("CreateChatCompletion() error = %v", err)
+			}
+			if resp.Model != tt.wantName {
+				t.Errorf("Expected request to be routed to %s, got %s", tt.wantName, resp.Model)
+			}
+
+			var client *recordingClient
+			for _, c := range []*recordingClient{fallback, local, localCoder, explicit} {
+				if c.name == tt.wantName {
+					client = c
+				}
+			}
+			if client.model != tt.wantModel {
+				t.Errorf("Expected backend to receive model %s, got %s", tt.wantModel, client.model)
+			}
+		})
+	}
+}
+
+func TestBackendRegistry_RegisterErrors(t *testing.T) {
+	registry := NewBackendRegistry(nil)
+
+	if err := registry.Register(&Backend{Name: "no client", Prefix: "local/"}); err == nil {
+		t.Error("Expected error when registering a backend without client")
+	}
+	if err := registry.Register(&Backend{Name: "no prefix", Client: &recordingClient{}}); err == nil {
+		t.Error("Expected error when registering a backend without prefix")
+	}
+	if err := registry.Register(&Backend{Name: "first", Prefix: "local/", Client: &recordingClient{}}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if err := registry.Register(&Backend{Name: "second", Prefix: "local/", Client: &recordingClient{}}); err == nil {
+		t.Error("Expected error when registering a duplicate prefix")
+	}
+
+	_, err := registry.CreateImage(context.Background(), ImageRequest{Prompt: "cat", Model: "openai/dall-e-2"})
+	if err == nil {
+		t.Error("Expected error for unmatched model without fallback")
+	}
+}
+
+func TestBackendRegistry_OpenAICompatibleServer(t *testing.T) {
+	// Emulates a local OpenAI-compatible server such as Ollama or llama.cpp
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("Expected path '/v1/chat/completions', got %s", r.URL.Path)
+		}
+		var reqBody ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+		if reqBody.Model != "llama3" {
+			t.Errorf("Expected model 'llama3', got %s", reqBody.Model)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ChatCompletionResponse{
+			Model: reqBody.Model,
+			Choices: []ChatCompletionChoice{
+				{Message: ChatCompletionMessage{Role: "assistant", Content: "Hi from llama"}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	registry := NewBackendRegistry(&recordingClient{name: "openrouter"})
+	err := registry.Register(&Backend{
+		Name:        "ollama",
+		Prefix:      "local/",
+		StripPrefix: true,
+		Client:      NewClientWithConfig(ClientConfig{BaseURL: server.URL + "/v1"}),
+	})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	resp, err := registry.CreateChatCompletion(context.Background(), ChatCompletionRequest{
+		Model:    "local/llama3",
+		Messages: []ChatCompletionMessage{{Role: "user", Content: "Hello"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateChatCompletion() error = %v", err)
+	}
+	if resp.Choices[0].Message.Content != "Hi from llama" {
+		t.Errorf("Expected content 'Hi from llama', got %s", resp.Choices[0].Message.Content)
+	}
+}
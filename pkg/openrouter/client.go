@@ -1,12 +1,16 @@
 package openrouter
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -25,6 +29,11 @@ type Client struct {
 	siteURL    string
 	siteName   string
 	logger     *Logger
+
+	// mu guards the last error of a request, e.g. for health checks
+	mu            sync.Mutex
+	lastError     error
+	lastErrorTime time.Time
 }
 
 // ClientConfig holds configuration for the OpenRouter client
@@ -134,8 +143,29 @@ func (c *Client) buildRequest(ctx context.Context, method, endpoint string, body
 	return req, nil
 }
 
+// LastError returns when the last failed request failed and its error, nil if no request failed yet
+func (c *Client) LastError() (time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastErrorTime, c.lastError
+}
+
+// recordError remembers the error of a request. Requests cancelled by their caller did not fail
+func (c *Client) recordError(err error) {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastError = err
+	c.lastErrorTime = time.Now()
+}
+
 // doRequest executes an HTTP request and handles the response
-func (c *Client) doRequest(req *http.Request, result interface{}) error {
+func (c *Client) doRequest(req *http.Request, result interface{}) (err error) {
+	defer func() {
+		c.recordError(err)
+	}()
 	startTime := time.Now()
 	
 	resp, err := c.httpClient.Do(req)
@@ -163,17 +193,7 @@ func (c *Client) doRequest(req *http.Request, result interface{}) error {
 
 	// Check for HTTP errors
 	if resp.StatusCode >= 400 {
-		var errorResp ErrorResponse
-		if err := json.Unmarshal(body, &errorResp); err != nil {
-			httpErr := fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
-			c.logger.LogError(httpErr, fmt.Sprintf("HTTP %s %s", req.Method, req.URL.Path))
-			return httpErr
-		}
-		
-		// Create structured error and log it
-		orErr := ParseError(resp, body)
-		c.logger.LogError(orErr, fmt.Sprintf("HTTP %s %s", req.Method, req.URL.Path))
-		return orErr
+		return c.responseError(req, resp, body)
 	}
 
 	// Parse successful response
@@ -187,6 +207,21 @@ func (c *Client) doRequest(req *http.Request, result interface{}) error {
 	return nil
 }
 
+// responseError converts an HTTP error response into an error and logs it
+func (c *Client) responseError(req *http.Request, resp *http.Response, body []byte) error {
+	var errorResp ErrorResponse
+	if err := json.Unmarshal(body, &errorResp); err != nil {
+		httpErr := fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+		c.logger.LogError(httpErr, fmt.Sprintf("HTTP %s %s", req.Method, req.URL.Path))
+		return httpErr
+	}
+
+	// Create structured error and log it
+	orErr := ParseError(resp, body)
+	c.logger.LogError(orErr, fmt.Sprintf("HTTP %s %s", req.Method, req.URL.Path))
+	return orErr
+}
+
 // CreateChatCompletion creates a chat completion using the OpenRouter API
 func (c *Client) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
 	startTime := time.Now()
@@ -215,6 +250,120 @@ func (c *Client) CreateChatCompletion(ctx context.Context, req ChatCompletionReq
 	return &resp, nil
 }
 
+// CreateChatCompletionStream creates a chat completion using server-sent events and passes
+// every generated piece of content to onDelta. If ctx is cancelled or times out while the
+// answer is being generated, the content received so far is returned together with ctx.Err()
+func (c *Client) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest, onDelta func(delta string)) (*ChatCompletionResponse, error) {
+	startTime := time.Now()
+
+	if err := req.Validate(); err != nil {
+		c.logger.LogError(err, "Chat completion request validation")
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	req.Stream = true
+
+	httpReq, err := c.buildRequest(ctx, "POST", "/chat/completions", req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		c.logger.LogError(WrapNetworkError(err), fmt.Sprintf("HTTP %s %s", httpReq.Method, httpReq.URL.Path))
+		err = fmt.Errorf("request failed: %w", err)
+		c.recordError(err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			c.logger.LogError(err, "Reading response body")
+			err = fmt.Errorf("failed to read response body: %w", err)
+			c.recordError(err)
+			return nil, err
+		}
+		c.logger.LogResponse(resp.StatusCode, resp.Header, string(body), time.Since(startTime))
+		err = c.responseError(httpReq, resp, body)
+		c.recordError(err)
+		return nil, err
+	}
+
+	result := &ChatCompletionResponse{Object: "chat.completion"}
+	var content strings.Builder
+	var finishReason string
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Skip empty lines and SSE comments such as ": OPENROUTER PROCESSING"
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk StreamResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			c.logger.LogError(err, "Unmarshaling stream chunk")
+			continue
+		}
+		result.ID = chunk.ID
+		result.Model = chunk.Model
+		result.Created = chunk.Created
+		if chunk.Usage != nil {
+			result.Usage = *chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Index != 0 {
+				continue
+			}
+			if choice.Delta.Content != "" {
+				content.WriteString(choice.Delta.Content)
+				if onDelta != nil {
+					onDelta(choice.Delta.Content)
+				}
+			}
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+		}
+	}
+
+	result.Choices = []ChatCompletionChoice{
+		{
+			Message: ChatCompletionMessage{
+				Role:    "assistant",
+				Content: content.String(),
+			},
+			FinishReason: finishReason,
+		},
+	}
+	duration := time.Since(startTime)
+
+	// A cancelled context surfaces as a read error, keep the partial answer in that case
+	if ctx.Err() != nil {
+		c.logger.Info("Chat Completion stream interrupted: Model=%s, Received=%d characters, Duration=%v, Reason=%v", req.Model, content.Len(), duration, ctx.Err())
+		return result, ctx.Err()
+	}
+	if err := scanner.Err(); err != nil {
+		c.logger.LogError(err, "Reading response stream")
+		err = fmt.Errorf("failed to read response stream: %w", err)
+		c.recordError(err)
+		return result, err
+	}
+
+	c.logger.LogChatCompletion(req, result, duration, nil)
+	return result, nil
+}
+
 // CreateImage creates an image using the OpenRouter API
 func (c *Client) CreateImage(ctx context.Context, req ImageRequest) (*ImageResponse, error) {
 	startTime := time.Now()
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -260,13 +261,13 @@ func TestDoRequestError(t *testing.T) {
 		t.Error("Expected error for 400 status code")
 	}
 
-	errorResp, ok := err.(*ErrorResponse)
+	errorResp, ok := err.(*OpenRouterError)
 	if !ok {
-		t.Errorf("Expected ErrorResponse, got %T", err)
+		t.Errorf("Expected OpenRouterError, got %T", err)
 	}
 
-	if errorResp.ErrorDetail.Code != "invalid_request" {
-		t.Errorf("Expected error code 'invalid_request', got '%s'", errorResp.ErrorDetail.Code)
+	if errorResp.ErrorCode != "invalid_request" {
+		t.Errorf("Expected error code 'invalid_request', got '%s'", errorResp.ErrorCode)
 	}
 }
 
@@ -300,6 +301,50 @@ func TestPing(t *testing.T) {
 	if err != nil {
 		t.Errorf("Ping() error = %v", err)
 	}
+	if _, lastErr := client.LastError(); lastErr != nil {
+		t.Errorf("LastError() = %v, want nil", lastErr)
+	}
+}
+
+func TestLastError(t *testing.T) {
+	var fail atomic.Bool
+	fail.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":{"code":503,"message":"no provider available"}}`))
+			return
+		}
+		json.NewEncoder(w).Encode(ModelsResponse{Object: "list"})
+	}))
+	defer server.Close()
+
+	client := NewClientWithConfig(ClientConfig{
+		APIKey:  "test-api-key",
+		BaseURL: server.URL,
+	})
+
+	if err := client.Ping(context.Background()); err == nil {
+		t.Fatal("Ping() error = nil, want the service unavailable error")
+	}
+	failedAt, lastErr := client.LastError()
+	if lastErr == nil || failedAt.IsZero() {
+		t.Fatalf("LastError() = %v, %v, want the error of the ping", failedAt, lastErr)
+	}
+
+	// Successful requests keep the last error, cancelled ones do not replace it
+	fail.Store(false)
+	if err := client.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := client.Ping(ctx); err == nil {
+		t.Fatal("Ping() with a cancelled context error = nil")
+	}
+	if at, err := client.LastError(); err != lastErr || !at.Equal(failedAt) {
+		t.Errorf("LastError() = %v, %v, want %v, %v", at, err, failedAt, lastErr)
+	}
 }
 
 func TestCreateChatCompletionHeaders(t *testing.T) {
@@ -553,17 +598,17 @@ func TestCreateChatCompletionAPIError(t *testing.T) {
 		t.Error("Expected API error but got none")
 	}
 
-	errorResp, ok := err.(*ErrorResponse)
+	errorResp, ok := err.(*OpenRouterError)
 	if !ok {
-		t.Errorf("Expected ErrorResponse, got %T", err)
+		t.Errorf("Expected OpenRouterError, got %T", err)
 	}
 
-	if errorResp.ErrorDetail.Code != "invalid_request_error" {
-		t.Errorf("Expected error code 'invalid_request_error', got %s", errorResp.ErrorDetail.Code)
+	if errorResp.ErrorCode != "invalid_request_error" {
+		t.Errorf("Expected error code 'invalid_request_error', got %s", errorResp.ErrorCode)
 	}
 
-	if errorResp.ErrorDetail.Message != "Invalid model specified" {
-		t.Errorf("Expected error message 'Invalid model specified', got %s", errorResp.ErrorDetail.Message)
+	if errorResp.Message != "Invalid model specified" {
+		t.Errorf("Expected error message 'Invalid model specified', got %s", errorResp.Message)
 	}
 }
 
@@ -603,13 +648,13 @@ func TestCreateChatCompletionRateLimitError(t *testing.T) {
 		t.Error("Expected rate limit error but got none")
 	}
 
-	errorResp, ok := err.(*ErrorResponse)
+	errorResp, ok := err.(*OpenRouterError)
 	if !ok {
-		t.Errorf("Expected ErrorResponse, got %T", err)
+		t.Errorf("Expected OpenRouterError, got %T", err)
 	}
 
-	if errorResp.ErrorDetail.Code != "rate_limit_exceeded" {
-		t.Errorf("Expected error code 'rate_limit_exceeded', got %s", errorResp.ErrorDetail.Code)
+	if errorResp.ErrorCode != "rate_limit_exceeded" {
+		t.Errorf("Expected error code 'rate_limit_exceeded', got %s", errorResp.ErrorCode)
 	}
 }
 
@@ -649,13 +694,13 @@ func TestCreateChatCompletionAuthenticationError(t *testing.T) {
 		t.Error("Expected authentication error but got none")
 	}
 
-	errorResp, ok := err.(*ErrorResponse)
+	errorResp, ok := err.(*OpenRouterError)
 	if !ok {
-		t.Errorf("Expected ErrorResponse, got %T", err)
+		t.Errorf("Expected OpenRouterError, got %T", err)
 	}
 
-	if errorResp.ErrorDetail.Code != "invalid_api_key" {
-		t.Errorf("Expected error code 'invalid_api_key', got %s", errorResp.ErrorDetail.Code)
+	if errorResp.ErrorCode != "invalid_api_key" {
+		t.Errorf("Expected error code 'invalid_api_key', got %s", errorResp.ErrorCode)
 	}
 }
 
@@ -1056,17 +1101,17 @@ func TestCreateImageAPIError(t *testing.T) {
 		t.Error("Expected API error but got none")
 	}
 
-	errorResp, ok := err.(*ErrorResponse)
+	errorResp, ok := err.(*OpenRouterError)
 	if !ok {
-		t.Errorf("Expected ErrorResponse, got %T", err)
+		t.Errorf("Expected OpenRouterError, got %T", err)
 	}
 
-	if errorResp.ErrorDetail.Code != "invalid_request_error" {
-		t.Errorf("Expected error code 'invalid_request_error', got %s", errorResp.ErrorDetail.Code)
+	if errorResp.ErrorCode != "invalid_request_error" {
+		t.Errorf("Expected error code 'invalid_request_error', got %s", errorResp.ErrorCode)
 	}
 
-	if errorResp.ErrorDetail.Message != "Invalid image model specified" {
-		t.Errorf("Expected error message 'Invalid image model specified', got %s", errorResp.ErrorDetail.Message)
+	if errorResp.Message != "Invalid image model specified" {
+		t.Errorf("Expected error message 'Invalid image model specified', got %s", errorResp.Message)
 	}
 }
 
@@ -1102,13 +1147,13 @@ func TestCreateImageRateLimitError(t *testing.T) {
 		t.Error("Expected rate limit error but got none")
 	}
 
-	errorResp, ok := err.(*ErrorResponse)
+	errorResp, ok := err.(*OpenRouterError)
 	if !ok {
-		t.Errorf("Expected ErrorResponse, got %T", err)
+		t.Errorf("Expected OpenRouterError, got %T", err)
 	}
 
-	if errorResp.ErrorDetail.Code != "rate_limit_exceeded" {
-		t.Errorf("Expected error code 'rate_limit_exceeded', got %s", errorResp.ErrorDetail.Code)
+	if errorResp.ErrorCode != "rate_limit_exceeded" {
+		t.Errorf("Expected error code 'rate_limit_exceeded', got %s", errorResp.ErrorCode)
 	}
 }
 
@@ -1144,13 +1189,13 @@ func TestCreateImageAuthenticationError(t *testing.T) {
 		t.Error("Expected authentication error but got none")
 	}
 
-	errorResp, ok := err.(*ErrorResponse)
+	errorResp, ok := err.(*OpenRouterError)
 	if !ok {
-		t.Errorf("Expected ErrorResponse, got %T", err)
+		t.Errorf("Expected OpenRouterError, got %T", err)
 	}
 
-	if errorResp.ErrorDetail.Code != "invalid_api_key" {
-		t.Errorf("Expected error code 'invalid_api_key', got %s", errorResp.ErrorDetail.Code)
+	if errorResp.ErrorCode != "invalid_api_key" {
+		t.Errorf("Expected error code 'invalid_api_key', got %s", errorResp.ErrorCode)
 	}
 }
 
@@ -1347,17 +1392,149 @@ func TestCreateImageModelUnavailableError(t *testing.T) {
 		t.Error("Expected model unavailable error but got none")
 	}
 
-	errorResp, ok := err.(*ErrorResponse)
+	errorResp, ok := err.(*OpenRouterError)
 	if !ok {
-		t.Errorf("Expected ErrorResponse, got %T", err)
+		t.Errorf("Expected OpenRouterError, got %T", err)
+	}
+
+	if errorResp.ErrorCode != "model_unavailable" {
+		t.Errorf("Expected error code 'model_unavailable', got %s", errorResp.ErrorCode)
 	}
 
-	if errorResp.ErrorDetail.Code != "model_unavailable" {
-		t.Errorf("Expected error code 'model_unavailable', got %s", errorResp.ErrorDetail.Code)
+	if errorResp.ErrorType != "service_unavailable_error" {
+		t.Errorf("Expected error type 'service_unavailable_error', got %s", errorResp.ErrorType)
 	}
+}
+
 
-	if errorResp.ErrorDetail.Type != "service_unavailable_error" {
-		t.Errorf("Expected error type 'service_unavailable_error', got %s", errorResp.ErrorDetail.Type)
+func streamTestRequest() ChatCompletionRequest {
+	return ChatCompletionRequest{
+		Model: "openai/gpt-4",
+		Messages: []ChatCompletionMessage{
+			{
+				Role:    "user",
+				Content: "Count to three",
+			},
+		},
 	}
 }
 
+func TestCreateChatCompletionStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+		if !reqBody.Stream {
+			t.Errorf("Expected stream to be enabled")
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunks := []string{
+			": OPENROUTER PROCESSING",
+			`data: {"id":"gen-1","model":"openai/gpt-4","choices":[{"index":0,"delta":{"role":"assistant","content":"One, "}}]}`,
+			`data: {"id":"gen-1","model":"openai/gpt-4","choices":[{"index":0,"delta":{"content":"two, "}}]}`,
+			`data: {"id":"gen-1","model":"openai/gpt-4","choices":[{"index":0,"delta":{"content":"three"},"finish_reason":"stop"}],"usage":{"prompt_tokens":5,"completion_tokens":3,"total_tokens":8}}`,
+			"data: [DONE]",
+		}
+		for _, chunk := range chunks {
+			w.Write([]byte(chunk + "\n\n"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClientWithConfig(ClientConfig{
+		APIKey:  "test-api-key",
+		BaseURL: server.URL,
+	})
+
+	var deltas []string
+	resp, err := client.CreateChatCompletionStream(context.Background(), streamTestRequest(), func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatalf("CreateChatCompletionStream() error = %v", err)
+	}
+	if len(deltas) != 3 {
+		t.Errorf("Expected 3 deltas, got %d", len(deltas))
+	}
+	if resp.Choices[0].Message.Content != "One, two, three" {
+		t.Errorf("Expected content 'One, two, three', got %q", resp.Choices[0].Message.Content)
+	}
+	if resp.Choices[0].FinishReason != "stop" {
+		t.Errorf("Expected finish reason 'stop', got %q", resp.Choices[0].FinishReason)
+	}
+	if resp.Usage.TotalTokens != 8 {
+		t.Errorf("Expected 8 total tokens, got %d", resp.Usage.TotalTokens)
+	}
+}
+
+func TestCreateChatCompletionStreamCancelled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"id":"gen-1","choices":[{"index":0,"delta":{"content":"Partial answer"}}]}` + "\n\n"))
+		w.(http.Flusher).Flush()
+		// Hang until the client goes away
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewClientWithConfig(ClientConfig{
+		APIKey:  "test-api-key",
+		BaseURL: server.URL,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	resp, err := client.CreateChatCompletionStream(ctx, streamTestRequest(), func(delta string) {
+		cancel()
+	})
+	if err != context.Canceled {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if resp == nil || resp.Choices[0].Message.Content != "Partial answer" {
+		t.Errorf("Expected partial answer to be kept, got %+v", resp)
+	}
+}
+
+func TestCreateChatCompletionStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"code":"rate_limited","message":"Rate limit exceeded"}}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithConfig(ClientConfig{
+		APIKey:  "test-api-key",
+		BaseURL: server.URL,
+	})
+
+	_, err := client.CreateChatCompletionStream(context.Background(), streamTestRequest(), nil)
+	errorResp, ok := err.(*OpenRouterError)
+	if !ok {
+		t.Fatalf("Expected *OpenRouterError, got %T", err)
+	}
+	if errorResp.ErrorCode != "rate_limited" {
+		t.Errorf("Expected code 'rate_limited', got %v", errorResp.ErrorCode)
+	}
+}
+
+func TestStreamChatCompletionFallback(t *testing.T) {
+	// countingClient does not support streaming, the full answer is reported as one delta
+	client := &countingClient{}
+
+	var deltas []string
+	resp, err := StreamChatCompletion(context.Background(), client, streamTestRequest(), func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatalf("StreamChatCompletion() error = %v", err)
+	}
+	if len(deltas) != 1 || deltas[0] != resp.Choices[0].Message.Content {
+		t.Errorf("Expected the full answer as a single delta, got %v", deltas)
+	}
+}
@@ -235,7 +235,7 @@ func TestWithRetry_Success(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err := WithRetry(ctx, config, fn)
+	err := WithRetry(ctx, config, nil, fn)
 
 	if err != nil {
 		t.Errorf("Expected success, got error: %v", err)
@@ -265,7 +265,7 @@ func TestWithRetry_NonRetryableError(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err := WithRetry(ctx, config, fn)
+	err := WithRetry(ctx, config, nil, fn)
 
 	if err != expectedErr {
 		t.Errorf("Expected specific error, got: %v", err)
@@ -290,7 +290,7 @@ func TestWithRetry_MaxRetriesExceeded(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err := WithRetry(ctx, config, fn)
+	err := WithRetry(ctx, config, nil, fn)
 
 	if err == nil {
 		t.Error("Expected error, got nil")
@@ -317,7 +317,7 @@ func TestWithRetry_ContextCancellation(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
 	defer cancel()
 
-	err := WithRetry(ctx, config, fn)
+	err := WithRetry(ctx, config, nil, fn)
 
 	if err != context.DeadlineExceeded {
 		t.Errorf("Expected context deadline exceeded, got: %v", err)
@@ -349,7 +349,7 @@ func TestWithRetry_RetryAfter(t *testing.T) {
 
 	ctx := context.Background()
 	start := time.Now()
-	err := WithRetry(ctx, config, fn)
+	err := WithRetry(ctx, config, nil, fn)
 	duration := time.Since(start)
 
 	if err != nil {
@@ -84,9 +84,6 @@ func TestIntegration_ChatCompletion(t *testing.T) {
 		if resp.Choices[0].Message.Content == "" {
 			t.Error("Response content is empty")
 		}
-		if resp.Usage == nil {
-			t.Error("Usage information is missing")
-		}
 		if resp.Usage.TotalTokens == 0 {
 			t.Error("Total tokens should be greater than 0")
 		}
@@ -267,7 +264,7 @@ func TestIntegration_ImageGeneration(t *testing.T) {
 
 // TestIntegration_ErrorScenarios tests various error scenarios with real API calls
 func TestIntegration_ErrorScenarios(t *testing.T) {
-	apiKey := skipIfNoAPIKey(t)
+	skipIfNoAPIKey(t)
 	
 	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
 	defer cancel()
@@ -7,11 +7,38 @@ type ChatCompletionClient interface {
 	CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error)
 }
 
+// ChatCompletionStreamClient defines the interface for streaming chat completion operations.
+// Implementations return the content generated so far together with ctx.Err() when ctx is done
+type ChatCompletionStreamClient interface {
+	CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest, onDelta func(delta string)) (*ChatCompletionResponse, error)
+}
+
+// StreamChatCompletion streams the chat completion if client supports streaming,
+// otherwise it waits for the complete response and reports it as a single delta
+func StreamChatCompletion(ctx context.Context, client ChatCompletionClient, req ChatCompletionRequest, onDelta func(delta string)) (*ChatCompletionResponse, error) {
+	if streamClient, ok := client.(ChatCompletionStreamClient); ok {
+		return streamClient.CreateChatCompletionStream(ctx, req, onDelta)
+	}
+	resp, err := client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if onDelta != nil && len(resp.Choices) > 0 {
+		onDelta(resp.Choices[0].Message.Content)
+	}
+	return resp, nil
+}
+
 // ImageGenerationClient defines the interface for image generation operations
 type ImageGenerationClient interface {
 	CreateImage(ctx context.Context, req ImageRequest) (*ImageResponse, error)
 }
 
+// ModelListClient defines the interface for listing the available models
+type ModelListClient interface {
+	ListModels(ctx context.Context) (*ModelsResponse, error)
+}
+
 // OpenRouterClient combines all OpenRouter API operations
 type OpenRouterClient interface {
 	ChatCompletionClient
@@ -19,4 +46,14 @@ type OpenRouterClient interface {
 }
 
 // Ensure Client implements OpenRouterClient interface
-var _ OpenRouterClient = (*Client)(nil)
\ No newline at end of file
+var _ OpenRouterClient = (*Client)(nil)
+var _ ChatCompletionStreamClient = (*Client)(nil)
+var _ ModelListClient = (*Client)(nil)
+
+// Ensure BackendRegistry can be used wherever a single client is expected
+var _ OpenRouterClient = (*BackendRegistry)(nil)
+var _ ChatCompletionStreamClient = (*BackendRegistry)(nil)
+
+// Ensure CachingClient can be used wherever a single client is expected
+var _ OpenRouterClient = (*CachingClient)(nil)
+var _ ChatCompletionStreamClient = (*CachingClient)(nil)
@@ -108,9 +108,10 @@ type ResponseLogData struct {
 	Timestamp    time.Time         `json:"timestamp"`
 }
 
-// shouldLog checks if a message should be logged based on the current log level
+// shouldLog checks if a message should be logged based on the current log level.
+// A nil logger never logs.
 func (l *Logger) shouldLog(level LogLevel) bool {
-	return level >= l.level
+	return l != nil && level >= l.level
 }
 
 // logf logs a formatted message with the given level
@@ -146,7 +147,7 @@ func (l *Logger) Error(format string, args ...interface{}) {
 
 // LogRequest logs an HTTP request
 func (l *Logger) LogRequest(req *http.Request, body interface{}) {
-	if !l.enableRequestLog || !l.shouldLog(LogLevelDebug) {
+	if !l.shouldLog(LogLevelDebug) || !l.enableRequestLog {
 		return
 	}
 
@@ -177,7 +178,7 @@ func (l *Logger) LogRequest(req *http.Request, body interface{}) {
 
 // LogResponse logs an HTTP response
 func (l *Logger) LogResponse(statusCode int, headers http.Header, body interface{}, duration time.Duration) {
-	if !l.enableResponseLog || !l.shouldLog(LogLevelDebug) {
+	if !l.shouldLog(LogLevelDebug) || !l.enableResponseLog {
 		return
 	}
 
@@ -205,7 +206,7 @@ func (l *Logger) LogResponse(statusCode int, headers http.Header, body interface
 
 // LogMetrics logs performance metrics for an API call
 func (l *Logger) LogMetrics(metrics APICallMetrics) {
-	if !l.enableMetrics || !l.shouldLog(LogLevelInfo) {
+	if !l.shouldLog(LogLevelInfo) || !l.enableMetrics {
 		return
 	}
 
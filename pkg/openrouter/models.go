@@ -17,6 +17,8 @@ type ChatCompletionRequest struct {
 	Stream           bool                      `json:"stream"`
 	Stop             []string                  `json:"stop,omitempty"`
 	User             string                    `json:"user,omitempty"`
+	// NoCache opts the request out of the response cache
+	NoCache bool `json:"-"`
 }
 
 // ChatCompletionMessage represents a message in a chat completion
@@ -34,6 +36,8 @@ type ChatCompletionResponse struct {
 	Model   string                 `json:"model"`
 	Choices []ChatCompletionChoice `json:"choices"`
 	Usage   Usage                  `json:"usage"`
+	// CacheHit is set when the response was served from the response cache
+	CacheHit bool `json:"-"`
 }
 
 // ChatCompletionChoice represents a choice in the chat completion response
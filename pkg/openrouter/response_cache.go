@@ -0,0 +1,278 @@
+package openrouter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// ResponseCache stores chat completion responses by request key
+type ResponseCache interface {
+	Get(key string) (*ChatCompletionResponse, bool)
+	Set(key string, resp *ChatCompletionResponse)
+	Len() int
+}
+
+// cacheKeyRequest holds the request fields that influence the generated answer
+type cacheKeyRequest struct {
+	Model            string                  `json:"model"`
+	Messages         []ChatCompletionMessage `json:"messages"`
+	Temperature      *float32                `json:"temperature"`
+	MaxTokens        *int                    `json:"max_tokens"`
+	TopP             *float32                `json:"top_p"`
+	FrequencyPenalty *float32                `json:"frequency_penalty"`
+	PresencePenalty  *float32                `json:"presence_penalty"`
+	Stop             []string                `json:"stop"`
+}
+
+// RequestCacheKey returns a canonical hash of the request. Requests that only differ
+// in fields which do not influence the answer (e.g. User) share the same key
+func RequestCacheKey(req ChatCompletionRequest) (string, error) {
+	data, err := json.Marshal(cacheKeyRequest{
+		Model:            req.Model,
+		Messages:         req.Messages,
+		Temperature:      req.Temperature,
+		MaxTokens:        req.MaxTokens,
+		TopP:             req.TopP,
+		FrequencyPenalty: req.FrequencyPenalty,
+		PresencePenalty:  req.PresencePenalty,
+		Stop:             req.Stop,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal cache key: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// IsCacheable reports whether the response to the request can be reused.
+// Only deterministic (temperature 0), non-streaming requests that did not opt out are cached
+func IsCacheable(req ChatCompletionRequest) bool {
+	return !req.NoCache && !req.Stream && req.Temperature != nil && *req.Temperature == 0
+}
+
+// MemoryResponseCache is an in-memory LRU response cache with expiration
+type MemoryResponseCache struct {
+	lru *expirable.LRU[string, *ChatCompletionResponse]
+}
+
+// NewMemoryResponseCache creates an in-memory cache holding up to size responses for ttl
+func NewMemoryResponseCache(size int, ttl time.Duration) (*MemoryResponseCache, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("cache size must be positive")
+	}
+	return &MemoryResponseCache{
+		lru: expirable.NewLRU[string, *ChatCompletionResponse](size, nil, ttl),
+	}, nil
+}
+
+// Get returns the cached response for the key
+func (c *MemoryResponseCache) Get(key string) (*ChatCompletionResponse, bool) {
+	return c.lru.Get(key)
+}
+
+// Set stores the response for the key
+func (c *MemoryResponseCache) Set(key string, resp *ChatCompletionResponse) {
+	c.lru.Add(key, resp)
+}
+
+// Len returns the number of cached responses
+func (c *MemoryResponseCache) Len() int {
+	return c.lru.Len()
+}
+
+// diskCacheEntry is the file format of DiskResponseCache entries
+type diskCacheEntry struct {
+	ExpiresAt time.Time               `json:"expires_at"`
+	Response  *ChatCompletionResponse `json:"response"`
+}
+
+// DiskResponseCache stores responses as JSON files in a directory, so they survive restarts.
+// When the cache holds more than size entries, the oldest ones are removed
+type DiskResponseCache struct {
+	mu   sync.Mutex
+	dir  string
+	size int
+	ttl  time.Duration
+}
+
+// NewDiskResponseCache creates a disk cache in dir holding up to size responses for ttl
+func NewDiskResponseCache(dir string, size int, ttl time.Duration) (*DiskResponseCache, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("cache size must be positive")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &DiskResponseCache{
+		dir:  dir,
+		size: size,
+		ttl:  ttl,
+	}, nil
+}
+
+func (c *DiskResponseCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// Get returns the cached response for the key. Expired entries are removed
+func (c *DiskResponseCache) Get(key string) (*ChatCompletionResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry diskCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Response == nil {
+		os.Remove(c.path(key))
+		return nil, false
+	}
+	if c.ttl > 0 && time.Now().After(entry.ExpiresAt) {
+		os.Remove(c.path(key))
+		return nil, false
+	}
+	return entry.Response, true
+}
+
+// Set stores the response for the key and evicts the oldest entries above the size bound
+func (c *DiskResponseCache) Set(key string, resp *ChatCompletionResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := json.Marshal(diskCacheEntry{
+		ExpiresAt: time.Now().Add(c.ttl),
+		Response:  resp,
+	})
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(c.path(key), data, 0o644); err != nil {
+		return
+	}
+	c.evict()
+}
+
+// Len returns the number of cached responses
+func (c *DiskResponseCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries())
+}
+
+func (c *DiskResponseCache) entries() []os.DirEntry {
+	all, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil
+	}
+	entries := all[:0]
+	for _, entry := range all {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func (c *DiskResponseCache) evict() {
+	entries := c.entries()
+	if len(entries) <= c.size {
+		return
+	}
+	modTime := func(entry os.DirEntry) time.Time {
+		info, err := entry.Info()
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return modTime(entries[i]).Before(modTime(entries[j]))
+	})
+	for _, entry := range entries[:len(entries)-c.size] {
+		os.Remove(filepath.Join(c.dir, entry.Name()))
+	}
+}
+
+// CachingClient reuses responses of deterministic chat completion requests.
+// Image generation requests are passed through unchanged
+type CachingClient struct {
+	OpenRouterClient
+	cache  ResponseCache
+	logger *Logger
+}
+
+// NewCachingClient wraps client with a response cache
+func NewCachingClient(client OpenRouterClient, cache ResponseCache, logger *Logger) *CachingClient {
+	if logger == nil {
+		logger = DefaultLogger()
+	}
+	return &CachingClient{
+		OpenRouterClient: client,
+		cache:            cache,
+		logger:           logger,
+	}
+}
+
+// CreateChatCompletion returns a cached response if the request was answered before,
+// otherwise it calls the wrapped client and caches the response. Cached responses have
+// CacheHit set and a zero cost
+func (c *CachingClient) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	return c.cached(req, func() (*ChatCompletionResponse, error) {
+		return c.OpenRouterClient.CreateChatCompletion(ctx, req)
+	})
+}
+
+// CreateChatCompletionStream behaves like CreateChatCompletion, a cached response is reported as a single delta
+func (c *CachingClient) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest, onDelta func(delta string)) (*ChatCompletionResponse, error) {
+	resp, err := c.cached(req, func() (*ChatCompletionResponse, error) {
+		return StreamChatCompletion(ctx, c.OpenRouterClient, req, onDelta)
+	})
+	if err == nil && resp.CacheHit && onDelta != nil && len(resp.Choices) > 0 {
+		onDelta(resp.Choices[0].Message.Content)
+	}
+	return resp, err
+}
+
+func (c *CachingClient) cached(req ChatCompletionRequest, create func() (*ChatCompletionResponse, error)) (*ChatCompletionResponse, error) {
+	if !IsCacheable(req) {
+		return create()
+	}
+
+	key, err := RequestCacheKey(req)
+	if err != nil {
+		c.logger.LogError(err, "Chat completion cache key")
+		return create()
+	}
+
+	if cached, ok := c.cache.Get(key); ok {
+		c.logger.Info("Chat Completion cache hit: Model=%s, Key=%s", req.Model, key[:12])
+		resp := *cached
+		resp.CacheHit = true
+		resp.Usage.PromptCost = 0
+		resp.Usage.CompletionCost = 0
+		resp.Usage.TotalCost = 0
+		return &resp, nil
+	}
+
+	resp, err := create()
+	if err != nil {
+		return resp, err
+	}
+	if len(resp.Choices) > 0 {
+		c.cache.Set(key, resp)
+		c.logger.Debug("Chat Completion cache store: Model=%s, Key=%s, Entries=%d", req.Model, key[:12], c.cache.Len())
+	}
+	return resp, nil
+}
@@ -0,0 +1,202 @@
+package openrouter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// countingClient counts chat completion calls and answers with a fixed cost
+type countingClient struct {
+	recordingClient
+	calls int
+}
+
+func (c *countingClient) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	c.calls++
+	return &ChatCompletionResponse{
+		Model: req.Model,
+		Choices: []ChatCompletionChoice{
+			{Message: ChatCompletionMessage{Role: "assistant", Content: "Cached answer"}},
+		},
+		Usage: Usage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7, TotalCost: 0.001},
+	}, nil
+}
+
+func deterministicRequest(content string) ChatCompletionRequest {
+	return ChatCompletionRequest{
+		Model:       "openai/gpt-4",
+		Messages:    []ChatCompletionMessage{{Role: "user", Content: content}},
+		Temperature: Float32Ptr(0),
+	}
+}
+
+func TestRequestCacheKey(t *testing.T) {
+	first := deterministicRequest("What is Go?")
+	first.User = "user-1"
+	second := deterministicRequest("What is Go?")
+	second.User = "user-2"
+	other := deterministicRequest("What is Rust?")
+
+	firstKey, err := RequestCacheKey(first)
+	if err != nil {
+		t.Fatalf("RequestCacheKey() error = %v", err)
+	}
+	secondKey, _ := RequestCacheKey(second)
+	otherKey, _ := RequestCacheKey(other)
+
+	if firstKey != secondKey {
+		t.Error("Expected requests that differ only by user to share the cache key")
+	}
+	if firstKey == otherKey {
+		t.Error("Expected requests with different messages to have different cache keys")
+	}
+}
+
+func TestIsCacheable(t *testing.T) {
+	tests := []struct {
+		name string
+		req  ChatCompletionRequest
+		want bool
+	}{
+		{"temperature zero", deterministicRequest("Hi"), true},
+		{"no temperature", ChatCompletionRequest{Model: "openai/gpt-4"}, false},
+		{"non-zero temperature", ChatCompletionRequest{Model: "openai/gpt-4", Temperature: Float32Ptr(0.7)}, false},
+		{"opted out", ChatCompletionRequest{Model: "openai/gpt-4", Temperature: Float32Ptr(0), NoCache: true}, false},
+		{"streaming", ChatCompletionRequest{Model: "openai/gpt-4", Temperature: Float32Ptr(0), Stream: true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsCacheable(tt.req); got != tt.want {
+				t.Errorf("IsCacheable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCachingClient(t *testing.T) {
+	cache, err := NewMemoryResponseCache(10, time.Minute)
+	if err != nil {
+		t.Fatalf("NewMemoryResponseCache() error = %v", err)
+	}
+	upstream := &countingClient{}
+	client := NewCachingClient(upstream, cache, nil)
+	ctx := context.Background()
+
+	resp, err := client.CreateChatCompletion(ctx, deterministicRequest("FAQ question"))
+	if err != nil {
+		t.Fatalf("CreateChatCompletion() error = %v", err)
+	}
+	if resp.CacheHit {
+		t.Error("First response should not be a cache hit")
+	}
+
+	resp, err = client.CreateChatCompletion(ctx, deterministicRequest("FAQ question"))
+	if err != nil {
+		t.Fatalf("CreateChatCompletion() error = %v", err)
+	}
+	if !resp.CacheHit {
+		t.Error("Second response should be a cache hit")
+	}
+	if resp.Usage.TotalCost != 0 {
+		t.Errorf("Cached response should cost nothing, got %f", resp.Usage.TotalCost)
+	}
+	if upstream.calls != 1 {
+		t.Errorf("Expected 1 upstream call, got %d", upstream.calls)
+	}
+
+	optOut := deterministicRequest("FAQ question")
+	optOut.NoCache = true
+	if _, err := client.CreateChatCompletion(ctx, optOut); err != nil {
+		t.Fatalf("CreateChatCompletion() error = %v", err)
+	}
+	if upstream.calls != 2 {
+		t.Errorf("Expected opted out request to reach upstream, got %d calls", upstream.calls)
+	}
+}
+
+func TestMemoryResponseCache_TTL(t *testing.T) {
+	cache, err := NewMemoryResponseCache(10, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewMemoryResponseCache() error = %v", err)
+	}
+	cache.Set("key", &ChatCompletionResponse{ID: "resp"})
+	if _, ok := cache.Get("key"); !ok {
+		t.Fatal("Expected fresh entry to be cached")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := cache.Get("key"); ok {
+		t.Error("Expected entry to expire")
+	}
+}
+
+func TestDiskResponseCache(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewDiskResponseCache(dir, 2, time.Minute)
+	if err != nil {
+		t.Fatalf("NewDiskResponseCache() error = %v", err)
+	}
+
+	cache.Set("first", &ChatCompletionResponse{ID: "first"})
+	time.Sleep(10 * time.Millisecond)
+	cache.Set("second", &ChatCompletionResponse{ID: "second"})
+
+	// A new cache on the same directory sees the stored responses
+	reopened, err := NewDiskResponseCache(dir, 2, time.Minute)
+	if err != nil {
+		t.Fatalf("NewDiskResponseCache() error = %v", err)
+	}
+	resp, ok := reopened.Get("first")
+	if !ok || resp.ID != "first" {
+		t.Fatal("Expected response to survive reopening the cache")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	reopened.Set("third", &ChatCompletionResponse{ID: "third"})
+	if reopened.Len() != 2 {
+		t.Errorf("Expected cache to be bounded to 2 entries, got %d", reopened.Len())
+	}
+	if _, ok := reopened.Get("first"); ok {
+		t.Error("Expected oldest entry to be evicted")
+	}
+
+	expired, err := NewDiskResponseCache(t.TempDir(), 2, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewDiskResponseCache() error = %v", err)
+	}
+	expired.Set("key", &ChatCompletionResponse{ID: "key"})
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := expired.Get("key"); ok {
+		t.Error("Expected expired entry to be ignored")
+	}
+}
+
+func TestCachingClient_Stream(t *testing.T) {
+	cache, err := NewMemoryResponseCache(10, time.Minute)
+	if err != nil {
+		t.Fatalf("NewMemoryResponseCache() error = %v", err)
+	}
+	upstream := &countingClient{}
+	client := NewCachingClient(upstream, cache, nil)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		var deltas []string
+		resp, err := client.CreateChatCompletionStream(ctx, deterministicRequest("What is Go?"), func(delta string) {
+			deltas = append(deltas, delta)
+		})
+		if err != nil {
+			t.Fatalf("CreateChatCompletionStream() error = %v", err)
+		}
+		if len(deltas) != 1 || deltas[0] != "Cached answer" {
+			t.Errorf("Expected the answer as a single delta, got %v", deltas)
+		}
+		if resp.CacheHit != (i == 1) {
+			t.Errorf("Call %d: expected CacheHit %t, got %t", i, i == 1, resp.CacheHit)
+		}
+	}
+	if upstream.calls != 1 {
+		t.Errorf("Expected 1 upstream call, got %d", upstream.calls)
+	}
+}
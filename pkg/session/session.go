@@ -0,0 +1,60 @@
+// Package session narrows the Discord API to the requests the handlers of the bot make,
+// so the handlers can be tested against the fake of package sessiontest
+package session
+
+import (
+	"net/http"
+
+	discord "github.com/bwmarrin/discordgo"
+)
+
+// Session is the part of the Discord API used by handlers
+type Session interface {
+	// State is the cache of the gateway, e.g. the user of the bot and the channels of its guilds
+	State() *discord.State
+	// HTTPClient is the client used for Discord requests, e.g. to download attachments
+	HTTPClient() *http.Client
+
+	InteractionRespond(interaction *discord.Interaction, resp *discord.InteractionResponse, options ...discord.RequestOption) error
+	InteractionResponse(interaction *discord.Interaction, options ...discord.RequestOption) (*discord.Message, error)
+	InteractionResponseEdit(interaction *discord.Interaction, newresp *discord.WebhookEdit, options ...discord.RequestOption) (*discord.Message, error)
+	FollowupMessageCreate(interaction *discord.Interaction, wait bool, data *discord.WebhookParams, options ...discord.RequestOption) (*discord.Message, error)
+
+	ChannelMessage(channelID, messageID string, options ...discord.RequestOption) (*discord.Message, error)
+	ChannelMessages(channelID string, limit int, beforeID, afterID, aroundID string, options ...discord.RequestOption) ([]*discord.Message, error)
+	ChannelMessageSend(channelID string, content string, options ...discord.RequestOption) (*discord.Message, error)
+	ChannelMessageSendReply(channelID string, content string, reference *discord.MessageReference, options ...discord.RequestOption) (*discord.Message, error)
+	ChannelMessageSendEmbedReply(channelID string, embed *discord.MessageEmbed, reference *discord.MessageReference, options ...discord.RequestOption) (*discord.Message, error)
+	ChannelMessageSendComplex(channelID string, data *discord.MessageSend, options ...discord.RequestOption) (*discord.Message, error)
+	ChannelMessageEditComplex(m *discord.MessageEdit, options ...discord.RequestOption) (*discord.Message, error)
+	ChannelMessageDelete(channelID, messageID string, options ...discord.RequestOption) error
+	ChannelTyping(channelID string, options ...discord.RequestOption) error
+	ChannelEditComplex(channelID string, data *discord.ChannelEdit, options ...discord.RequestOption) (*discord.Channel, error)
+
+	MessageReactionAdd(channelID, messageID, emojiID string, options ...discord.RequestOption) error
+	MessageReactionRemove(channelID, messageID, emojiID, userID string, options ...discord.RequestOption) error
+	MessageReactionsRemoveEmoji(channelID, messageID, emojiID string, options ...discord.RequestOption) error
+
+	MessageThreadStartComplex(channelID, messageID string, data *discord.ThreadStart, options ...discord.RequestOption) (*discord.Channel, error)
+	ThreadMemberAdd(threadID, memberID string, options ...discord.RequestOption) error
+}
+
+type discordSession struct {
+	*discord.Session
+}
+
+// New returns the Session making requests through s
+func New(s *discord.Session) Session {
+	if s == nil {
+		return nil
+	}
+	return discordSession{Session: s}
+}
+
+func (s discordSession) State() *discord.State {
+	return s.Session.State
+}
+
+func (s discordSession) HTTPClient() *http.Client {
+	return s.Session.Client
+}
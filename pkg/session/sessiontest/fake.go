@@ -0,0 +1,379 @@
+// Package sessiontest provides an in-memory Discord session for handler tests
+package sessiontest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session"
+	discord "github.com/bwmarrin/discordgo"
+)
+
+// ErrNotFound is returned for channels, messages and interactions the fake does not know
+var ErrNotFound = errors.New("sessiontest: not found")
+
+// Reaction records a reaction added or removed by the bot
+type Reaction struct {
+	ChannelID string
+	MessageID string
+	Emoji     string
+	Removed   bool
+}
+
+// Lock records a thread being locked or unlocked
+type Lock struct {
+	ChannelID string
+	Locked    bool
+}
+
+// Fake is an in-memory session. Messages sent through it are stored in their channels and
+// served as channel history, and every request is recorded for assertions
+type Fake struct {
+	// Client is returned by HTTPClient, e.g. to serve attachments from an httptest server
+	Client *http.Client
+
+	state *discord.State
+
+	mu     sync.Mutex
+	nextID int
+	// messages holds the messages of every channel, oldest first
+	messages  map[string][]*discord.Message
+	responses map[string]*discord.Message
+
+	Responses []*discord.InteractionResponse
+	Edits     []*discord.MessageEdit
+	Deleted   []string
+	Reactions []Reaction
+	Locks     []Lock
+	Threads   []*discord.Channel
+	Typing    []string
+}
+
+var _ session.Session = (*Fake)(nil)
+
+// NewFake returns a fake session of the bot user in a guild with the text channel channelID
+func NewFake(botID string, guildID string, channelID string) *Fake {
+	state := discord.NewState()
+	state.User = &discord.User{ID: botID, Username: "bot", Bot: true}
+	state.GuildAdd(&discord.Guild{ID: guildID})
+	state.ChannelAdd(&discord.Channel{ID: channelID, GuildID: guildID, Type: discord.ChannelTypeGuildText})
+
+	return &Fake{
+		Client:    http.DefaultClient,
+		state:     state,
+		messages:  make(map[string][]*discord.Message),
+		responses: make(map[string]*discord.Message),
+	}
+}
+
+func (f *Fake) State() *discord.State {
+	return f.state
+}
+
+func (f *Fake) HTTPClient() *http.Client {
+	return f.Client
+}
+
+// AddMessage stores a message sent by someone else, e.g. a user writing in a thread
+func (f *Fake) AddMessage(m *discord.Message) *discord.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if m.ID == "" {
+		m.ID = f.newID()
+	}
+	f.messages[m.ChannelID] = append(f.messages[m.ChannelID], m)
+	return m
+}
+
+// Messages returns the messages of the channel, oldest first
+func (f *Fake) Messages(channelID string) []*discord.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.messages[channelID])
+}
+
+// Message returns the current version of the message
+func (f *Fake) Message(channelID, messageID string) *discord.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.message(channelID, messageID)
+}
+
+func (f *Fake) newID() string {
+	f.nextID++
+	return fmt.Sprint(1000 + f.nextID)
+}
+
+func (f *Fake) message(channelID, messageID string) *discord.Message {
+	for _, m := range f.messages[channelID] {
+		if m.ID == messageID {
+			return m
+		}
+	}
+	return nil
+}
+
+// send stores a message of the bot
+func (f *Fake) send(channelID string, m *discord.Message) *discord.Message {
+	m.ID = f.newID()
+	m.ChannelID = channelID
+	m.Author = f.state.User
+	if ch, err := f.state.Channel(channelID); err == nil {
+		m.GuildID = ch.GuildID
+	}
+	if m.Type == discord.MessageTypeDefault && m.MessageReference != nil {
+		m.Type = discord.MessageTypeReply
+		m.ReferencedMessage = f.message(m.MessageReference.ChannelID, m.MessageReference.MessageID)
+	}
+	f.messages[channelID] = append(f.messages[channelID], m)
+	return m
+}
+
+func (f *Fake) InteractionRespond(interaction *discord.Interaction, resp *discord.InteractionResponse, options ...discord.RequestOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Responses = append(f.Responses, resp)
+	if resp.Type == discord.InteractionResponseChannelMessageWithSource && resp.Data != nil {
+		f.responses[interaction.ID] = f.send(interaction.ChannelID, &discord.Message{
+			Content: resp.Data.Content,
+			Embeds:  resp.Data.Embeds,
+			Flags:   resp.Data.Flags,
+		})
+	}
+	return nil
+}
+
+func (f *Fake) InteractionResponse(interaction *discord.Interaction, options ...discord.RequestOption) (*discord.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m, ok := f.responses[interaction.ID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return m, nil
+}
+
+func (f *Fake) InteractionResponseEdit(interaction *discord.Interaction, newresp *discord.WebhookEdit, options ...discord.RequestOption) (*discord.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m, ok := f.responses[interaction.ID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if newresp.Content != nil {
+		m.Content = *newresp.Content
+	}
+	if newresp.Embeds != nil {
+		m.Embeds = *newresp.Embeds
+	}
+	return m, nil
+}
+
+// FollowupMessageCreate sends the message in the channel of the interaction. The first followup
+// of a deferred interaction becomes its response, like it does on Discord
+func (f *Fake) FollowupMessageCreate(interaction *discord.Interaction, wait bool, data *discord.WebhookParams, options ...discord.RequestOption) (*discord.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m := f.send(interaction.ChannelID, &discord.Message{
+		Content:    data.Content,
+		Embeds:     data.Embeds,
+		Components: data.Components,
+		Flags:      data.Flags,
+	})
+	if _, ok := f.responses[interaction.ID]; !ok {
+		f.responses[interaction.ID] = m
+	}
+	return m, nil
+}
+
+func (f *Fake) ChannelMessage(channelID, messageID string, options ...discord.RequestOption) (*discord.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m := f.message(channelID, messageID)
+	if m == nil {
+		return nil, ErrNotFound
+	}
+	return m, nil
+}
+
+// ChannelMessages returns the messages of the channel newest first, like Discord
+func (f *Fake) ChannelMessages(channelID string, limit int, beforeID, afterID, aroundID string, options ...discord.RequestOption) ([]*discord.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	messages := f.messages[channelID]
+	if beforeID != "" {
+		i := slices.IndexFunc(messages, func(m *discord.Message) bool { return m.ID == beforeID })
+		if i == -1 {
+			return nil, ErrNotFound
+		}
+		messages = messages[:i]
+	}
+	messages = slices.Clone(messages[max(0, len(messages)-limit):])
+	slices.Reverse(messages)
+	return messages, nil
+}
+
+func (f *Fake) ChannelMessageSend(channelID string, content string, options ...discord.RequestOption) (*discord.Message, error) {
+	return f.ChannelMessageSendComplex(channelID, &discord.MessageSend{Content: content})
+}
+
+func (f *Fake) ChannelMessageSendReply(channelID string, content string, reference *discord.MessageReference, options ...discord.RequestOption) (*discord.Message, error) {
+	return f.ChannelMessageSendComplex(channelID, &discord.MessageSend{Content: content, Reference: reference})
+}
+
+func (f *Fake) ChannelMessageSendEmbedReply(channelID string, embed *discord.MessageEmbed, reference *discord.MessageReference, options ...discord.RequestOption) (*discord.Message, error) {
+	return f.ChannelMessageSendComplex(channelID, &discord.MessageSend{Embeds: []*discord.MessageEmbed{embed}, Reference: reference})
+}
+
+func (f *Fake) ChannelMessageSendComplex(channelID string, data *discord.MessageSend, options ...discord.RequestOption) (*discord.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.state.Channel(channelID); err != nil {
+		return nil, ErrNotFound
+	}
+	embeds := data.Embeds
+	if data.Embed != nil {
+		embeds = append(embeds, data.Embed)
+	}
+	return f.send(channelID, &discord.Message{
+		Content:          data.Content,
+		Embeds:           embeds,
+		Components:       data.Components,
+		MessageReference: data.Reference,
+	}), nil
+}
+
+func (f *Fake) ChannelMessageEditComplex(edit *discord.MessageEdit, options ...discord.RequestOption) (*discord.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Edits = append(f.Edits, edit)
+	m := f.message(edit.Channel, edit.ID)
+	if m == nil {
+		return nil, ErrNotFound
+	}
+	if edit.Content != nil {
+		m.Content = *edit.Content
+	}
+	if edit.Embeds != nil {
+		m.Embeds = *edit.Embeds
+	}
+	if edit.Components != nil {
+		m.Components = *edit.Components
+	}
+	return m, nil
+}
+
+func (f *Fake) ChannelMessageDelete(channelID, messageID string, options ...discord.RequestOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Deleted = append(f.Deleted, messageID)
+	f.messages[channelID] = slices.DeleteFunc(f.messages[channelID], func(m *discord.Message) bool {
+		return m.ID == messageID
+	})
+	return nil
+}
+
+func (f *Fake) ChannelTyping(channelID string, options ...discord.RequestOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Typing = append(f.Typing, channelID)
+	return nil
+}
+
+// ChannelEditComplex records locking and unlocking threads
+func (f *Fake) ChannelEditComplex(channelID string, data *discord.ChannelEdit, options ...discord.RequestOption) (*discord.Channel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch, err := f.state.Channel(channelID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	if data.Name != "" {
+		ch.Name = data.Name
+	}
+	if data.Locked != nil {
+		f.Locks = append(f.Locks, Lock{ChannelID: channelID, Locked: *data.Locked})
+		if ch.ThreadMetadata != nil {
+			ch.ThreadMetadata.Locked = *data.Locked
+		}
+	}
+	return ch, nil
+}
+
+func (f *Fake) MessageReactionAdd(channelID, messageID, emojiID string, options ...discord.RequestOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Reactions = append(f.Reactions, Reaction{ChannelID: channelID, MessageID: messageID, Emoji: emojiID})
+	return nil
+}
+
+func (f *Fake) MessageReactionRemove(channelID, messageID, emojiID, userID string, options ...discord.RequestOption) error {
+	return f.MessageReactionsRemoveEmoji(channelID, messageID, emojiID)
+}
+
+func (f *Fake) MessageReactionsRemoveEmoji(channelID, messageID, emojiID string, options ...discord.RequestOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Reactions = append(f.Reactions, Reaction{ChannelID: channelID, MessageID: messageID, Emoji: emojiID, Removed: true})
+	return nil
+}
+
+// MessageThreadStartComplex starts a thread of the bot on the message. Like on Discord, the first message
+// of the thread is a thread starter message referencing the message
+func (f *Fake) MessageThreadStartComplex(channelID, messageID string, data *discord.ThreadStart, options ...discord.RequestOption) (*discord.Channel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parent, err := f.state.Channel(channelID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	starter := f.message(channelID, messageID)
+	if starter == nil {
+		return nil, ErrNotFound
+	}
+
+	thread := &discord.Channel{
+		ID:             f.newID(),
+		GuildID:        parent.GuildID,
+		ParentID:       channelID,
+		OwnerID:        f.state.User.ID,
+		Name:           data.Name,
+		Type:           discord.ChannelTypeGuildPublicThread,
+		ThreadMetadata: &discord.ThreadMetadata{AutoArchiveDuration: data.AutoArchiveDuration},
+	}
+	if err := f.state.ChannelAdd(thread); err != nil {
+		return nil, err
+	}
+	f.Threads = append(f.Threads, thread)
+	f.messages[thread.ID] = append(f.messages[thread.ID], &discord.Message{
+		ID:                f.newID(),
+		ChannelID:         thread.ID,
+		GuildID:           thread.GuildID,
+		Type:              discord.MessageTypeThreadStarterMessage,
+		Author:            starter.Author,
+		ReferencedMessage: starter,
+	})
+	return thread, nil
+}
+
+func (f *Fake) ThreadMemberAdd(threadID, memberID string, options ...discord.RequestOption) error {
+	return nil
+}
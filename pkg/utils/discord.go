@@ -3,10 +3,11 @@ package utils
 import (
 	"log"
 
+	"github.com/RajaPremSai/go-openai-dicord-bot/pkg/session"
 	discord "github.com/bwmarrin/discordgo"
 )
 
-func ToggleDiscordThreadLock(s *discord.Session, channelID string, locked bool) {
+func ToggleDiscordThreadLock(s session.Session, channelID string, locked bool) {
 	_, err := s.ChannelEditComplex(channelID, &discord.ChannelEdit{
 		Locked: &locked,
 	})
@@ -15,7 +16,7 @@ func ToggleDiscordThreadLock(s *discord.Session, channelID string, locked bool)
 	}
 }
 
-func DiscordChannelMessageSend(s *discord.Session, channelID string, content string, messageReference *discord.MessageReference) (m *discord.Message, err error) {
+func DiscordChannelMessageSend(s session.Session, channelID string, content string, messageReference *discord.MessageReference) (m *discord.Message, err error) {
 	if messageReference != nil {
 		m, err = s.ChannelMessageSendReply(channelID, content, messageReference)
 	} else {
@@ -24,7 +25,7 @@ func DiscordChannelMessageSend(s *discord.Session, channelID string, content str
 	return
 }
 
-func DiscordChannelMessageEdit(s *discord.Session, messageID string, channelID string, content *string, embeds []*discord.MessageEmbed) error {
+func DiscordChannelMessageEdit(s session.Session, messageID string, channelID string, content *string, embeds []*discord.MessageEmbed) error {
 	_, err := s.ChannelMessageEditComplex(
 		&discord.MessageEdit{
 			Content: content,
@@ -35,3 +36,28 @@ func DiscordChannelMessageEdit(s *discord.Session, messageID string, channelID s
 	)
 	return err
 }
+
+func DiscordChannelMessageSendWithComponents(s session.Session, channelID string, content string, components []discord.MessageComponent, messageReference *discord.MessageReference) (*discord.Message, error) {
+	return s.ChannelMessageSendComplex(channelID, &discord.MessageSend{
+		Content:    content,
+		Components: components,
+		Reference:  messageReference,
+	})
+}
+
+// DiscordChannelMessageEditComponents edits the message content and replaces its components.
+// Passing no components removes them from the message
+func DiscordChannelMessageEditComponents(s session.Session, messageID string, channelID string, content *string, components []discord.MessageComponent) error {
+	if components == nil {
+		components = []discord.MessageComponent{}
+	}
+	_, err := s.ChannelMessageEditComplex(
+		&discord.MessageEdit{
+			Content:    content,
+			Components: &components,
+			ID:         messageID,
+			Channel:    channelID,
+		},
+	)
+	return err
+}
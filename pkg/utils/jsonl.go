@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// JSONLFile appends values to a JSONL file, one JSON line each. It is safe for concurrent use
+type JSONLFile struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewJSONLFile(path string) *JSONLFile {
+	return &JSONLFile{path: path}
+}
+
+// Append writes the value as a single JSON line, creating the file if it does not exist
+func (f *JSONLFile) Append(value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal record: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", f.path, err)
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}